@@ -180,6 +180,11 @@ var (
 	SearchRateLimitEnable         = true
 	SearchRateLimitNum            = 10
 	SearchRateLimitDuration int64 = 60
+
+	// Per-user redeem rate limit, guards redemption codes against brute-force guessing
+	RedeemRateLimitEnable         = true
+	RedeemRateLimitNum            = 5
+	RedeemRateLimitDuration int64 = 60
 )
 
 var RateLimitKeyExpirationDuration = 20 * time.Minute
@@ -194,6 +199,7 @@ const (
 	TokenStatusDisabled  = 2 // also don't use 0
 	TokenStatusExpired   = 3
 	TokenStatusExhausted = 4
+	TokenStatusSuspended = 5 // 异常消费暂停，用户确认后恢复
 )
 
 const (
@@ -214,4 +220,8 @@ const (
 	TopUpStatusSuccess = "success"
 	TopUpStatusFailed  = "failed"
 	TopUpStatusExpired = "expired"
+	// 支付撤销后的状态
+	TopUpStatusRefunded          = "refunded"
+	TopUpStatusPartiallyRefunded = "partially_refunded"
+	TopUpStatusDisputed          = "disputed"
 )
@@ -61,6 +61,9 @@ func InitEnv() {
 	} else {
 		CryptoSecret = SessionSecret
 	}
+	if err := InitSecretEncryption(); err != nil {
+		log.Fatal(err)
+	}
 	if os.Getenv("SQLITE_PATH") != "" {
 		SQLitePath = os.Getenv("SQLITE_PATH")
 	}
@@ -124,6 +127,10 @@ func InitEnv() {
 	SearchRateLimitEnable = GetEnvOrDefaultBool("SEARCH_RATE_LIMIT_ENABLE", true)
 	SearchRateLimitNum = GetEnvOrDefault("SEARCH_RATE_LIMIT", 10)
 	SearchRateLimitDuration = int64(GetEnvOrDefault("SEARCH_RATE_LIMIT_DURATION", 60))
+
+	RedeemRateLimitEnable = GetEnvOrDefaultBool("REDEEM_RATE_LIMIT_ENABLE", true)
+	RedeemRateLimitNum = GetEnvOrDefault("REDEEM_RATE_LIMIT", 5)
+	RedeemRateLimitDuration = int64(GetEnvOrDefault("REDEEM_RATE_LIMIT_DURATION", 60))
 	initConstantEnv()
 }
 
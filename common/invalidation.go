@@ -0,0 +1,220 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 跨实例缓存失效广播：本实例修改配置后立即通过 Redis pub/sub 通知其他实例，
+// 未启用 Redis 时仍依赖 SyncOptions、SyncChannelCache 的定期轮询
+const (
+	invalidationChannel    = "new-api:invalidation"
+	invalidationVersionKey = "new-api:invalidation:version"
+	invalidationNodesKey   = "new-api:invalidation:nodes"
+
+	invalidationHeartbeatInterval = 10 * time.Second
+	// 超过该时长未上报的实例视为已下线并从列表中清除
+	invalidationNodeExpire = 24 * time.Hour
+)
+
+// 失效事件类型，Key 为空表示全量重新加载
+const (
+	InvalidationOption        = "option"
+	InvalidationChannel       = "channel"
+	InvalidationChannelStatus = "channel_status"
+	InvalidationPermission    = "permission"
+	InvalidationPricing       = "pricing"
+)
+
+// InvalidationEvent 失效事件，Version 为全局递增版本号
+type InvalidationEvent struct {
+	Kind    string `json:"kind"`
+	Key     string `json:"key,omitempty"`
+	Version int64  `json:"version"`
+	Node    string `json:"node"`
+}
+
+// InvalidationNodeStatus 实例最近一次应用的事件版本
+type InvalidationNodeStatus struct {
+	Node           string `json:"node"`
+	IsMaster       bool   `json:"is_master"`
+	AppliedVersion int64  `json:"applied_version"`
+	AppliedAt      int64  `json:"applied_at"`
+	UpdatedAt      int64  `json:"updated_at"`
+}
+
+var (
+	invalidationHandlers     = make(map[string]func(key string))
+	invalidationHandlersLock sync.RWMutex
+	invalidationApplied      atomic.Int64
+	invalidationAppliedAt    atomic.Int64
+	invalidationOnce         sync.Once
+)
+
+// NodeId 当前实例标识
+var NodeId = fmt.Sprintf("%s-%d", hostname(), os.Getpid())
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "unknown"
+	}
+	return name
+}
+
+// RegisterInvalidationHandler 注册失效事件的处理函数，处理函数只刷新本实例缓存，不能再次广播
+func RegisterInvalidationHandler(kind string, handler func(key string)) {
+	invalidationHandlersLock.Lock()
+	defer invalidationHandlersLock.Unlock()
+	invalidationHandlers[kind] = handler
+}
+
+// PublishInvalidation 通知其他实例刷新缓存，调用方需已完成本实例的刷新
+func PublishInvalidation(kind string, key string) {
+	if !RedisEnabled || RDB == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	version, err := RDB.Incr(ctx, invalidationVersionKey).Result()
+	if err != nil {
+		SysError("failed to publish invalidation: " + err.Error())
+		return
+	}
+	data, _ := json.Marshal(InvalidationEvent{Kind: kind, Key: key, Version: version, Node: NodeId})
+	if err := RDB.Publish(ctx, invalidationChannel, data).Err(); err != nil {
+		SysError("failed to publish invalidation: " + err.Error())
+		return
+	}
+	markInvalidationApplied(version)
+}
+
+func markInvalidationApplied(version int64) {
+	for {
+		current := invalidationApplied.Load()
+		if version <= current {
+			return
+		}
+		if invalidationApplied.CompareAndSwap(current, version) {
+			invalidationAppliedAt.Store(time.Now().Unix())
+			return
+		}
+	}
+}
+
+// applyInvalidation 应用其他实例的事件；版本号不连续说明有事件丢失（如断线重连），此时全量刷新
+func applyInvalidation(event InvalidationEvent) {
+	last := invalidationApplied.Load()
+	markInvalidationApplied(event.Version)
+	if event.Node == NodeId {
+		return
+	}
+	invalidationHandlersLock.RLock()
+	defer invalidationHandlersLock.RUnlock()
+	if last > 0 && event.Version > last+1 {
+		SysLog(fmt.Sprintf("invalidation version gap: %d -> %d, reloading all caches", last, event.Version))
+		for _, handler := range invalidationHandlers {
+			handler("")
+		}
+		return
+	}
+	if handler, ok := invalidationHandlers[event.Kind]; ok {
+		handler(event.Key)
+	}
+}
+
+// StartInvalidationBus 订阅失效事件并定期上报本实例状态，未启用 Redis 时不启动
+func StartInvalidationBus() {
+	invalidationOnce.Do(func() {
+		if !RedisEnabled || RDB == nil {
+			return
+		}
+		ctx := context.Background()
+		if version, err := RDB.Get(ctx, invalidationVersionKey).Int64(); err == nil {
+			markInvalidationApplied(version)
+		}
+		pubsub := RDB.Subscribe(ctx, invalidationChannel)
+		go func() {
+			for message := range pubsub.Channel() {
+				var event InvalidationEvent
+				if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+					SysError("failed to decode invalidation: " + err.Error())
+					continue
+				}
+				applyInvalidation(event)
+			}
+		}()
+		go func() {
+			reportInvalidationNode()
+			ticker := time.NewTicker(invalidationHeartbeatInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				reportInvalidationNode()
+			}
+		}()
+		SysLog("invalidation bus started, node: " + NodeId)
+	})
+}
+
+func localInvalidationStatus() InvalidationNodeStatus {
+	return InvalidationNodeStatus{
+		Node:           NodeId,
+		IsMaster:       IsMasterNode,
+		AppliedVersion: invalidationApplied.Load(),
+		AppliedAt:      invalidationAppliedAt.Load(),
+		UpdatedAt:      time.Now().Unix(),
+	}
+}
+
+func reportInvalidationNode() {
+	data, _ := json.Marshal(localInvalidationStatus())
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := RDB.HSet(ctx, invalidationNodesKey, NodeId, data).Err(); err != nil {
+		SysError("failed to report invalidation node: " + err.Error())
+	}
+}
+
+// GetInvalidationStatus 返回当前全局版本号与各实例最近应用的版本，未启用 Redis 时只有本实例
+func GetInvalidationStatus() (int64, []InvalidationNodeStatus, error) {
+	if !RedisEnabled || RDB == nil {
+		return 0, []InvalidationNodeStatus{localInvalidationStatus()}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	version, err := RDB.Get(ctx, invalidationVersionKey).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, nil, err
+	}
+	values, err := RDB.HGetAll(ctx, invalidationNodesKey).Result()
+	if err != nil {
+		return 0, nil, err
+	}
+	nodes := make([]InvalidationNodeStatus, 0, len(values))
+	expired := make([]string, 0)
+	now := time.Now().Unix()
+	for field, value := range values {
+		var node InvalidationNodeStatus
+		if json.Unmarshal([]byte(value), &node) != nil || now-node.UpdatedAt > int64(invalidationNodeExpire.Seconds()) {
+			expired = append(expired, field)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	if len(expired) > 0 {
+		RDB.HDel(ctx, invalidationNodesKey, expired...)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Node < nodes[j].Node
+	})
+	return version, nodes, nil
+}
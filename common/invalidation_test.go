@@ -0,0 +1,39 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyInvalidation(t *testing.T) {
+	originalHandlers := invalidationHandlers
+	t.Cleanup(func() {
+		invalidationHandlers = originalHandlers
+		invalidationApplied.Store(0)
+	})
+	invalidationHandlers = make(map[string]func(key string))
+	invalidationApplied.Store(0)
+
+	var options, channels []string
+	RegisterInvalidationHandler(InvalidationOption, func(key string) { options = append(options, key) })
+	RegisterInvalidationHandler(InvalidationChannel, func(key string) { channels = append(channels, key) })
+
+	applyInvalidation(InvalidationEvent{Kind: InvalidationOption, Key: "GroupRatio", Version: 1, Node: "other"})
+	require.Equal(t, []string{"GroupRatio"}, options)
+	require.EqualValues(t, 1, invalidationApplied.Load())
+
+	// 本实例发出的事件已在本地生效，只更新版本号
+	applyInvalidation(InvalidationEvent{Kind: InvalidationOption, Key: "ModelRatio", Version: 2, Node: NodeId})
+	require.Len(t, options, 1)
+	require.EqualValues(t, 2, invalidationApplied.Load())
+
+	applyInvalidation(InvalidationEvent{Kind: InvalidationChannel, Key: "7", Version: 3, Node: "other"})
+	require.Equal(t, []string{"7"}, channels)
+
+	// 版本号不连续时全量刷新所有缓存
+	applyInvalidation(InvalidationEvent{Kind: InvalidationOption, Key: "TopupRatio", Version: 6, Node: "other"})
+	require.Equal(t, []string{"GroupRatio", ""}, options)
+	require.Equal(t, []string{"7", ""}, channels)
+	require.EqualValues(t, 6, invalidationApplied.Load())
+}
@@ -0,0 +1,210 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 密钥落库加密：每个值使用随机数据密钥加密，数据密钥再由主密钥加密后与密文一同保存，
+// 格式为 enc:v1:<主密钥ID>:<加密的数据密钥>:<密文>。未配置主密钥时按明文保存
+const secretCipherPrefix = "enc:v1:"
+
+type secretMasterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+var (
+	secretKeysLock   sync.RWMutex
+	secretKeys       = make(map[string]*secretMasterKey)
+	secretCurrentKey *secretMasterKey
+)
+
+func newSecretMasterKey(material string) (*secretMasterKey, error) {
+	key := sha256.Sum256([]byte(material))
+	id := sha256.Sum256(key[:])
+	aead, err := newSecretAEAD(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return &secretMasterKey{id: hex.EncodeToString(id[:4]), aead: aead}, nil
+}
+
+func newSecretAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// InitSecretEncryption 读取主密钥：SECRET_ENCRYPTION_KEY 或 SECRET_ENCRYPTION_KEY_FILE 为当前主密钥，
+// SECRET_ENCRYPTION_PREVIOUS_KEYS 为轮换前的旧主密钥（逗号分隔），仅用于解密
+func InitSecretEncryption() error {
+	current := os.Getenv("SECRET_ENCRYPTION_KEY")
+	if path := os.Getenv("SECRET_ENCRYPTION_KEY_FILE"); current == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read SECRET_ENCRYPTION_KEY_FILE: %w", err)
+		}
+		current = strings.TrimSpace(string(data))
+	}
+	var previous []string
+	for _, key := range strings.Split(os.Getenv("SECRET_ENCRYPTION_PREVIOUS_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			previous = append(previous, key)
+		}
+	}
+	if current == "" && len(previous) > 0 {
+		return errors.New("SECRET_ENCRYPTION_PREVIOUS_KEYS requires SECRET_ENCRYPTION_KEY")
+	}
+	if err := SetSecretEncryptionKeys(current, previous...); err != nil {
+		return err
+	}
+	if current != "" {
+		SysLog("secret encryption enabled, master key id: " + SecretEncryptionKeyId())
+	}
+	return nil
+}
+
+// SetSecretEncryptionKeys 设置当前主密钥与旧主密钥，current 为空表示关闭加密
+func SetSecretEncryptionKeys(current string, previous ...string) error {
+	keys := make(map[string]*secretMasterKey)
+	var currentKey *secretMasterKey
+	for i, material := range append([]string{current}, previous...) {
+		if material == "" {
+			continue
+		}
+		key, err := newSecretMasterKey(material)
+		if err != nil {
+			return err
+		}
+		keys[key.id] = key
+		if i == 0 {
+			currentKey = key
+		}
+	}
+	secretKeysLock.Lock()
+	defer secretKeysLock.Unlock()
+	secretKeys = keys
+	secretCurrentKey = currentKey
+	return nil
+}
+
+// SecretEncryptionKeyId 当前主密钥 ID，未启用加密时为空
+func SecretEncryptionKeyId() string {
+	secretKeysLock.RLock()
+	defer secretKeysLock.RUnlock()
+	if secretCurrentKey == nil {
+		return ""
+	}
+	return secretCurrentKey.id
+}
+
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretCipherPrefix)
+}
+
+// NeedsSecretReencryption 值为明文或由旧主密钥加密时返回 true
+func NeedsSecretReencryption(value string) bool {
+	current := SecretEncryptionKeyId()
+	if value == "" || current == "" {
+		return false
+	}
+	return !strings.HasPrefix(value, secretCipherPrefix+current+":")
+}
+
+// EncryptSecret 使用当前主密钥加密，未启用加密或已是密文时原样返回
+func EncryptSecret(plain string) (string, error) {
+	secretKeysLock.RLock()
+	master := secretCurrentKey
+	secretKeysLock.RUnlock()
+	if plain == "" || master == nil || IsEncryptedSecret(plain) {
+		return plain, nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := sealSecret(master.aead, dataKey, []byte(master.id))
+	if err != nil {
+		return "", err
+	}
+	aead, err := newSecretAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	payload, err := sealSecret(aead, []byte(plain), nil)
+	if err != nil {
+		return "", err
+	}
+	return secretCipherPrefix + master.id + ":" +
+		base64.StdEncoding.EncodeToString(wrapped) + ":" +
+		base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// DecryptSecret 解密密文，明文原样返回以兼容加密前写入的数据
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, secretCipherPrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("invalid encrypted secret")
+	}
+	secretKeysLock.RLock()
+	master := secretKeys[parts[0]]
+	secretKeysLock.RUnlock()
+	if master == nil {
+		return "", fmt.Errorf("master key %s not configured", parts[0])
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("invalid encrypted secret")
+	}
+	dataKey, err := openSecret(master.aead, wrapped, []byte(master.id))
+	if err != nil {
+		return "", err
+	}
+	aead, err := newSecretAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	payload, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("invalid encrypted secret")
+	}
+	plain, err := openSecret(aead, payload, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func sealSecret(aead cipher.AEAD, plain []byte, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, additional), nil
+}
+
+func openSecret(aead cipher.AEAD, data []byte, additional []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("invalid encrypted secret")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additional)
+	if err != nil {
+		return nil, errors.New("failed to decrypt secret")
+	}
+	return plain, nil
+}
@@ -0,0 +1,47 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretEncryption(t *testing.T) {
+	t.Cleanup(func() { _ = SetSecretEncryptionKeys("") })
+
+	// 未配置主密钥时按明文保存
+	require.NoError(t, SetSecretEncryptionKeys(""))
+	value, err := EncryptSecret("sk-test")
+	require.NoError(t, err)
+	require.Equal(t, "sk-test", value)
+	require.False(t, NeedsSecretReencryption(value))
+
+	require.NoError(t, SetSecretEncryptionKeys("old-master"))
+	oldCipher, err := EncryptSecret("sk-test")
+	require.NoError(t, err)
+	require.True(t, IsEncryptedSecret(oldCipher))
+	another, _ := EncryptSecret("sk-test")
+	require.NotEqual(t, oldCipher, another, "每次加密使用不同的数据密钥")
+	plain, err := DecryptSecret(oldCipher)
+	require.NoError(t, err)
+	require.Equal(t, "sk-test", plain)
+
+	// 轮换后旧密文仍可解密，但需要重新加密
+	require.NoError(t, SetSecretEncryptionKeys("new-master", "old-master"))
+	plain, err = DecryptSecret(oldCipher)
+	require.NoError(t, err)
+	require.Equal(t, "sk-test", plain)
+	require.True(t, NeedsSecretReencryption(oldCipher))
+	require.True(t, NeedsSecretReencryption("sk-plain"))
+	newCipher, err := EncryptSecret(plain)
+	require.NoError(t, err)
+	require.False(t, NeedsSecretReencryption(newCipher))
+
+	// 明文原样返回，缺少旧主密钥时无法解密
+	plain, err = DecryptSecret("sk-plain")
+	require.NoError(t, err)
+	require.Equal(t, "sk-plain", plain)
+	require.NoError(t, SetSecretEncryptionKeys("new-master"))
+	_, err = DecryptSecret(oldCipher)
+	require.Error(t, err)
+}
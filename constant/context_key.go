@@ -19,6 +19,8 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenEndUserLimit      ContextKey = "token_end_user_limit"
+	ContextKeyTokenDataResidency     ContextKey = "token_data_residency"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -42,6 +44,13 @@ const (
 	ContextKeyAutoGroupIndex      ContextKey = "auto_group_index"
 	ContextKeyAutoGroupRetryIndex ContextKey = "auto_group_retry_index"
 
+	// ContextKeyModelFallbackChain stores the remaining fallback models for cross-model retry
+	ContextKeyModelFallbackChain ContextKey = "model_fallback_chain"
+	// ContextKeyRequestedModel stores the model requested by the client once a fallback model is served
+	ContextKeyRequestedModel ContextKey = "requested_model"
+	// ContextKeyVirtualModel marks a virtual model whose concrete model is resolved after token estimation
+	ContextKeyVirtualModel ContextKey = "virtual_model"
+
 	/* user related keys */
 	ContextKeyUserId      ContextKey = "id"
 	ContextKeyUserSetting ContextKey = "user_setting"
@@ -52,6 +61,8 @@ const (
 	ContextKeyUsingGroup  ContextKey = "group"
 	ContextKeyUserName    ContextKey = "username"
 
+	ContextKeyUserDataResidency ContextKey = "user_data_residency"
+
 	ContextKeyLocalCountTokens ContextKey = "local_count_tokens"
 
 	ContextKeySystemPromptOverride ContextKey = "system_prompt_override"
@@ -65,4 +76,15 @@ const (
 
 	// ContextKeyLanguage stores the user's language preference for i18n
 	ContextKeyLanguage ContextKey = "language"
+
+	// ContextKeyAdmissionWaitMs stores how long the request waited in the admission queue
+	ContextKeyAdmissionWaitMs ContextKey = "admission_wait_ms"
+	// ContextKeyAdmissionStreamStarted marks that queue keepalive pings already committed an event stream response
+	ContextKeyAdmissionStreamStarted ContextKey = "admission_stream_started"
+
+	// ContextKeyEndUser stores the (optionally hashed) end-user identifier of the request
+	ContextKeyEndUser ContextKey = "end_user"
+
+	// ContextKeyDataResidency stores the data residency decision used to filter channels
+	ContextKeyDataResidency ContextKey = "data_residency"
 )
@@ -0,0 +1,67 @@
+package constant
+
+// 管理后台与管理接口的细粒度权限
+const (
+	PermissionAll = "*" // 全部权限，仅内置超级管理员角色使用
+
+	PermissionChannelRead     = "channel:read"
+	PermissionChannelWrite    = "channel:write"
+	PermissionChannelKeyView  = "channel:key:view"
+	PermissionUserRead        = "user:read"
+	PermissionUserWrite       = "user:write"
+	PermissionUserQuotaAdjust = "user:quota:adjust"
+	PermissionLogReadAll      = "log:read:all"
+	PermissionLogDelete       = "log:delete"
+	PermissionOptionRead      = "option:read"
+	PermissionOptionWrite     = "option:write"
+	PermissionPaymentManage   = "payment:manage"
+	PermissionRedemption      = "redemption:manage"
+	PermissionModelManage     = "model:manage"
+	PermissionDeployment      = "deployment:manage"
+	PermissionStatsRead       = "stats:read"
+	PermissionSystemManage    = "system:manage"
+	PermissionRoleManage      = "role:manage"
+	PermissionAuditRead       = "audit:read"
+	PermissionConfigManage    = "config:manage"
+)
+
+// Permissions 全部可分配的权限
+var Permissions = []string{
+	PermissionChannelRead,
+	PermissionChannelWrite,
+	PermissionChannelKeyView,
+	PermissionUserRead,
+	PermissionUserWrite,
+	PermissionUserQuotaAdjust,
+	PermissionLogReadAll,
+	PermissionLogDelete,
+	PermissionOptionRead,
+	PermissionOptionWrite,
+	PermissionPaymentManage,
+	PermissionRedemption,
+	PermissionModelManage,
+	PermissionDeployment,
+	PermissionStatsRead,
+	PermissionSystemManage,
+	PermissionRoleManage,
+	PermissionAuditRead,
+	PermissionConfigManage,
+}
+
+// RootOnlyPermissions 仅内置超级管理员角色拥有的权限，内置管理员角色不包含
+var RootOnlyPermissions = []string{
+	PermissionChannelKeyView,
+	PermissionOptionRead,
+	PermissionOptionWrite,
+	PermissionSystemManage,
+	PermissionRoleManage,
+	PermissionAuditRead,
+	PermissionConfigManage,
+}
+
+// 内置角色，与原有三级角色一一对应
+const (
+	BuiltInRoleCommon = "common"
+	BuiltInRoleAdmin  = "admin"
+	BuiltInRoleRoot   = "root"
+)
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// admissionMaxWait 客户端可通过 X-Queue-Max-Wait（秒）缩短排队时间，0 表示不排队
+func admissionMaxWait(c *gin.Context, setting *operation_setting.AdmissionQueueSetting) time.Duration {
+	maxWait := time.Duration(setting.MaxWaitSeconds) * time.Second
+	if header := c.GetHeader("X-Queue-Max-Wait"); header != "" {
+		if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+			if clientWait := time.Duration(seconds) * time.Second; clientWait < maxWait {
+				maxWait = clientWait
+			}
+		}
+	}
+	return maxWait
+}
+
+// acquireRelayAdmission 在预扣费前申请准入，未启用排队时返回 nil
+func acquireRelayAdmission(c *gin.Context, info *relaycommon.RelayInfo, relayFormat types.RelayFormat) (*service.AdmissionTicket, *types.NewAPIError) {
+	setting := operation_setting.GetAdmissionQueueSetting()
+	if !setting.Enabled || relayFormat == types.RelayFormatOpenAIRealtime {
+		return nil, nil
+	}
+	req := service.AdmissionRequest{
+		Model:   info.OriginModelName,
+		Group:   info.UsingGroup,
+		FlowKey: "user:" + strconv.Itoa(info.UserId),
+		Weight:  setting.GetGroupWeight(info.UserGroup),
+		MaxWait: admissionMaxWait(c, setting),
+	}
+	if setting.FairShareBy == operation_setting.AdmissionFairShareByGroup {
+		req.FlowKey = "group:" + info.UserGroup
+	}
+	if info.IsStream && setting.KeepAliveStream {
+		interval := helper.DefaultPingInterval
+		if generalSetting := operation_setting.GetGeneralSetting(); generalSetting.PingIntervalEnabled && generalSetting.PingIntervalSeconds > 0 {
+			interval = time.Duration(generalSetting.PingIntervalSeconds) * time.Second
+		}
+		req.KeepAliveInterval = interval
+		// 仅在确实需要等待时才开始事件流，保活使用 SSE 注释，客户端不会解析为数据
+		req.KeepAlive = func() error {
+			helper.SetEventStreamHeaders(c)
+			common.SetContextKey(c, constant.ContextKeyAdmissionStreamStarted, true)
+			return helper.PingData(c)
+		}
+	}
+	ticket, err := service.AcquireAdmission(c.Request.Context(), req)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeAdmissionRejected, http.StatusTooManyRequests, types.ErrOptionWithSkipRetry())
+	}
+	recordAdmissionWait(c, ticket)
+	return ticket, nil
+}
+
+func recordAdmissionWait(c *gin.Context, ticket *service.AdmissionTicket) {
+	if ticket.Wait <= 0 {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyAdmissionWaitMs, int(ticket.Wait.Milliseconds()))
+	logger.LogInfo(c, fmt.Sprintf("准入排队等待 %d ms", ticket.Wait.Milliseconds()))
+}
+
+// requeueRelayAdmission 所有渠道均限流时退还预扣费并重新排队，成功后可再次预扣费并尝试渠道
+func requeueRelayAdmission(c *gin.Context, ticket *service.AdmissionTicket, info *relaycommon.RelayInfo, apiErr *types.NewAPIError) bool {
+	if ticket == nil || apiErr == nil || apiErr.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	remaining := ticket.RemainingWait()
+	if remaining <= 0 {
+		return false
+	}
+	// 排队期间不占用额度
+	if info.Billing != nil {
+		info.Billing.Refund(c)
+		info.Billing = nil
+	}
+	if err := ticket.Requeue(c.Request.Context(), remaining); err != nil {
+		logger.LogWarn(c, "admission requeue failed: "+err.Error())
+		return false
+	}
+	recordAdmissionWait(c, ticket)
+	return true
+}
+
+// GetAdmissionQueueStats 返回准入队列深度与等待时间
+func GetAdmissionQueueStats(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{
+		"queues":   service.GetAdmissionQueueStats(),
+		"channels": service.GetChannelInflight(),
+	})
+}
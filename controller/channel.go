@@ -380,6 +380,29 @@ func GetChannel(c *gin.Context) {
 	return
 }
 
+// GetChannelCapacity 返回渠道容量配置及渠道与各密钥的当前用量
+func GetChannelCapacity(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	usage, err := model.GetChannelCapacityUsage(channel)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"capacity": channel.GetSetting().Capacity,
+		"usage":    usage,
+	})
+}
+
 // GetChannelKey 获取渠道密钥（需要通过安全验证中间件）
 // 此函数依赖 SecureVerificationRequired 中间件，确保用户已通过安全验证
 func GetChannelKey(c *gin.Context) {
@@ -404,6 +427,7 @@ func GetChannelKey(c *gin.Context) {
 
 	// 记录操作日志
 	model.RecordLog(userId, model.LogTypeSystem, fmt.Sprintf("查看渠道密钥信息 (渠道ID: %d)", channelId))
+	service.RecordAudit(c, "channel.key.reveal", "channel", channelId, nil, nil)
 
 	// 返回渠道密钥
 	c.JSON(http.StatusOK, gin.H{
@@ -655,6 +679,7 @@ func AddChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, "channel.create", "channel", "", nil, addChannelRequest.Channel)
 	service.ResetProxyClientCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -665,12 +690,16 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	originChannel, _ := model.GetChannelById(id, true)
 	channel := model.Channel{Id: id}
 	err := channel.Delete()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	if originChannel != nil {
+		service.RecordAudit(c, "channel.delete", "channel", id, originChannel, nil)
+	}
 	model.InitChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -958,6 +987,9 @@ func UpdateChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if updatedChannel, err := model.GetChannelById(channel.Id, true); err == nil {
+		service.RecordAudit(c, "channel.update", "channel", channel.Id, originChannel, updatedChannel)
+	}
 	model.InitChannelCache()
 	service.ResetProxyClientCache()
 	channel.Key = ""
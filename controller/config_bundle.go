@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type configExportRequest struct {
+	Format     string   `json:"format"`
+	Sections   []string `json:"sections"`
+	SecretMode string   `json:"secret_mode"`
+	Passphrase string   `json:"passphrase"`
+}
+
+// ExportConfigBundle 导出声明式配置包，默认 yaml 格式且不包含密钥
+func ExportConfigBundle(c *gin.Context) {
+	var req configExportRequest
+	// 请求体包含口令或明文密钥，不走通用的请求审计，仅在成功时记录摘要
+	c.Set(service.AuditRecordedKey, true)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	bundle, err := service.ExportConfigBundle(service.ConfigExportOptions{
+		Sections:   req.Sections,
+		SecretMode: req.SecretMode,
+		Passphrase: req.Passphrase,
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	data, err := service.MarshalConfigBundle(bundle, req.Format)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, "config.export", "config", "", nil, gin.H{
+		"sections":    req.Sections,
+		"secret_mode": bundle.SecretMode,
+	})
+	contentType, ext := "application/yaml; charset=utf-8", "yaml"
+	if req.Format == "json" {
+		contentType, ext = "application/json; charset=utf-8", "json"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="config-bundle-%d.%s"`, bundle.ExportedAt, ext))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+type configImportRequest struct {
+	// Content json 或 yaml 格式的配置包内容
+	Content    string `json:"content"`
+	Mode       string `json:"mode"`
+	DryRun     bool   `json:"dry_run"`
+	Passphrase string `json:"passphrase"`
+}
+
+// ImportConfigBundle 导入配置包，dry_run 时只返回变更不写入
+func ImportConfigBundle(c *gin.Context) {
+	var req configImportRequest
+	// 请求体包含口令或明文密钥，不走通用的请求审计，仅在成功时记录摘要
+	c.Set(service.AuditRecordedKey, true)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	bundle, err := service.ParseConfigBundle([]byte(req.Content))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	result, err := service.ImportConfigBundle(bundle, service.ConfigImportOptions{
+		Mode:       req.Mode,
+		DryRun:     req.DryRun,
+		Passphrase: req.Passphrase,
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	changes := make([]string, 0, len(result.Changes))
+	for _, change := range result.Changes {
+		changes = append(changes, fmt.Sprintf("%s %s %s", change.Action, change.Section, change.Name))
+	}
+	service.RecordAudit(c, "config.import", "config", "", nil, gin.H{
+		"mode":    result.Mode,
+		"dry_run": result.DryRun,
+		"changes": changes,
+	})
+	common.ApiSuccess(c, result)
+}
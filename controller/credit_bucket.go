@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSelfCreditBreakdown 用户查看余额按来源与到期时间的拆分
+func GetSelfCreditBreakdown(c *gin.Context) {
+	breakdown, err := model.GetUserCreditBreakdown(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, breakdown)
+}
+
+// GetUserCreditBreakdown 管理员查看用户余额拆分
+func GetUserCreditBreakdown(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的用户 ID")
+		return
+	}
+	breakdown, err := model.GetUserCreditBreakdown(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, breakdown)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/gin-gonic/gin"
 )
 
@@ -36,6 +37,8 @@ type CustomOAuthProviderResponse struct {
 	AuthStyle             int    `json:"auth_style"`
 	AccessPolicy          string `json:"access_policy"`
 	AccessDeniedMessage   string `json:"access_denied_message"`
+	ClaimMappings         string `json:"claim_mappings"`
+	TrustedForScimLink    bool   `json:"trusted_for_scim_link"`
 }
 
 type UserOAuthBindingResponse struct {
@@ -66,6 +69,8 @@ func toCustomOAuthProviderResponse(p *model.CustomOAuthProvider) *CustomOAuthPro
 		AuthStyle:             p.AuthStyle,
 		AccessPolicy:          p.AccessPolicy,
 		AccessDeniedMessage:   p.AccessDeniedMessage,
+		ClaimMappings:         p.ClaimMappings,
+		TrustedForScimLink:    p.TrustedForScimLink,
 	}
 }
 
@@ -131,6 +136,8 @@ type CreateCustomOAuthProviderRequest struct {
 	AuthStyle             int    `json:"auth_style"`
 	AccessPolicy          string `json:"access_policy"`
 	AccessDeniedMessage   string `json:"access_denied_message"`
+	ClaimMappings         string `json:"claim_mappings"`
+	TrustedForScimLink    bool   `json:"trusted_for_scim_link"`
 }
 
 type FetchCustomOAuthDiscoveryRequest struct {
@@ -249,6 +256,8 @@ func CreateCustomOAuthProvider(c *gin.Context) {
 		AuthStyle:             req.AuthStyle,
 		AccessPolicy:          req.AccessPolicy,
 		AccessDeniedMessage:   req.AccessDeniedMessage,
+		ClaimMappings:         req.ClaimMappings,
+		TrustedForScimLink:    req.TrustedForScimLink,
 	}
 
 	if err := model.CreateCustomOAuthProvider(provider); err != nil {
@@ -258,6 +267,7 @@ func CreateCustomOAuthProvider(c *gin.Context) {
 
 	// Register the provider in the OAuth registry
 	oauth.RegisterOrUpdateCustomProvider(provider)
+	service.RecordAudit(c, "custom_oauth.create", "custom_oauth_provider", provider.Id, nil, provider)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -286,6 +296,8 @@ type UpdateCustomOAuthProviderRequest struct {
 	AuthStyle             *int    `json:"auth_style"`            // Optional: if nil, keep existing
 	AccessPolicy          *string `json:"access_policy"`         // Optional: if nil, keep existing
 	AccessDeniedMessage   *string `json:"access_denied_message"` // Optional: if nil, keep existing
+	ClaimMappings         *string `json:"claim_mappings"`        // Optional: if nil, keep existing
+	TrustedForScimLink    *bool   `json:"trusted_for_scim_link"` // Optional: if nil, keep existing
 }
 
 // UpdateCustomOAuthProvider updates an existing custom OAuth provider
@@ -311,6 +323,7 @@ func UpdateCustomOAuthProvider(c *gin.Context) {
 	}
 
 	oldSlug := provider.Slug
+	originProvider := *provider
 
 	// Check if new slug is taken by another provider
 	if req.Slug != "" && req.Slug != provider.Slug {
@@ -380,6 +393,12 @@ func UpdateCustomOAuthProvider(c *gin.Context) {
 	if req.AccessDeniedMessage != nil {
 		provider.AccessDeniedMessage = *req.AccessDeniedMessage
 	}
+	if req.ClaimMappings != nil {
+		provider.ClaimMappings = *req.ClaimMappings
+	}
+	if req.TrustedForScimLink != nil {
+		provider.TrustedForScimLink = *req.TrustedForScimLink
+	}
 
 	if err := model.UpdateCustomOAuthProvider(provider); err != nil {
 		common.ApiError(c, err)
@@ -391,6 +410,7 @@ func UpdateCustomOAuthProvider(c *gin.Context) {
 		oauth.UnregisterCustomProvider(oldSlug)
 	}
 	oauth.RegisterOrUpdateCustomProvider(provider)
+	service.RecordAudit(c, "custom_oauth.update", "custom_oauth_provider", provider.Id, &originProvider, provider)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -434,6 +454,7 @@ func DeleteCustomOAuthProvider(c *gin.Context) {
 
 	// Unregister the provider from the OAuth registry
 	oauth.UnregisterCustomProvider(provider.Slug)
+	service.RecordAudit(c, "custom_oauth.delete", "custom_oauth_provider", id, provider, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -500,8 +521,7 @@ func GetUserOAuthBindingsByAdmin(c *gin.Context) {
 		return
 	}
 
-	myRole := c.GetInt("role")
-	if myRole <= targetUser.Role && myRole != common.RoleRootUser {
+	if !canManageUser(c, targetUser) {
 		common.ApiErrorMsg(c, "no permission")
 		return
 	}
@@ -559,8 +579,7 @@ func UnbindCustomOAuthByAdmin(c *gin.Context) {
 		return
 	}
 
-	myRole := c.GetInt("role")
-	if myRole <= targetUser.Role && myRole != common.RoleRootUser {
+	if !canManageUser(c, targetUser) {
 		common.ApiErrorMsg(c, "no permission")
 		return
 	}
@@ -27,8 +27,14 @@ func GetUserGroups(c *gin.Context) {
 	usableGroups := make(map[string]map[string]interface{})
 	userGroup := ""
 	userId := c.GetInt("id")
-	userGroup, _ = model.GetUserGroup(userId, false)
-	userUsableGroups := service.GetUserUsableGroups(userGroup)
+	var userUsableGroups map[string]string
+	if userCache, err := model.GetUserCache(userId); err == nil {
+		userGroup = userCache.Group
+		userUsableGroups = service.GetUserUsableGroupsWithSetting(userGroup, userCache.GetSetting())
+	} else {
+		userGroup, _ = model.GetUserGroup(userId, false)
+		userUsableGroups = service.GetUserUsableGroups(userGroup)
+	}
 	for groupName, _ := range ratio_setting.GetGroupRatioCopy() {
 		// UserUsableGroups contains the groups that the user can use
 		if desc, ok := userUsableGroups[groupName]; ok {
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+type groupPricingSimulateRequest struct {
+	Model     string `json:"model"`
+	Group     string `json:"group"`
+	UserGroup string `json:"user_group,omitempty"`
+	// UserId 用于查询真实的当月消费额度，MonthlyQuota 不为空时优先使用
+	UserId       int  `json:"user_id,omitempty"`
+	MonthlyQuota *int `json:"monthly_quota,omitempty"`
+	// Time 请求时间（Unix 秒），为空时使用当前时间
+	Time             int64 `json:"time,omitempty"`
+	PromptTokens     int   `json:"prompt_tokens"`
+	CompletionTokens int   `json:"completion_tokens"`
+	CacheTokens      int   `json:"cache_tokens,omitempty"`
+	// Settings 可选，按草稿规则试算而不影响当前配置
+	Settings *ratio_setting.GroupPricingRuleSettings `json:"settings,omitempty"`
+}
+
+// SimulateGroupPricing 预览一次假设请求在分组倍率与分组定价规则下的计费结果
+func SimulateGroupPricing(c *gin.Context) {
+	var req groupPricingSimulateRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if req.Model == "" || req.Group == "" {
+		common.ApiErrorMsg(c, "模型和分组不能为空")
+		return
+	}
+	if req.PromptTokens < 0 || req.CompletionTokens < 0 || req.CacheTokens < 0 || req.CacheTokens > req.PromptTokens {
+		common.ApiErrorMsg(c, "无效的 token 数量")
+		return
+	}
+
+	settings := ratio_setting.GetGroupPricingRuleSettings()
+	if req.Settings != nil {
+		if err := req.Settings.Validate(); err != nil {
+			common.ApiErrorMsg(c, "分组定价规则无效: "+err.Error())
+			return
+		}
+		settings = req.Settings
+	}
+	now := time.Now()
+	if req.Time > 0 {
+		now = time.Unix(req.Time, 0)
+	}
+
+	groupRatio := ratio_setting.GetGroupRatio(req.Group)
+	if req.UserGroup != "" {
+		if userGroupRatio, ok := ratio_setting.GetGroupGroupRatio(req.UserGroup, req.Group); ok {
+			groupRatio = userGroupRatio
+		}
+	}
+
+	monthlyQuota := 0
+	ruleRatio, rules := settings.Evaluate(ratio_setting.GroupPricingInput{
+		Group: req.Group,
+		Model: req.Model,
+		Now:   now,
+		MonthlyQuota: func(monthStart time.Time) int {
+			if req.MonthlyQuota != nil {
+				monthlyQuota = *req.MonthlyQuota
+			} else if req.UserId > 0 {
+				monthlyQuota, _ = model.GetUserMonthlyConsumeQuota(req.UserId, monthStart.Unix())
+			}
+			return monthlyQuota
+		},
+	})
+
+	result := gin.H{
+		"model":         req.Model,
+		"group":         req.Group,
+		"group_ratio":   groupRatio,
+		"rule_ratio":    ruleRatio,
+		"rules":         rules,
+		"monthly_quota": monthlyQuota,
+	}
+
+	dGroupRatio := decimal.NewFromFloat(groupRatio).Mul(decimal.NewFromFloat(ruleRatio))
+	var quota decimal.Decimal
+	modelPrice, usePrice := ratio_setting.GetModelPrice(req.Model, false)
+	result["use_price"] = usePrice
+	if usePrice {
+		result["model_price"] = modelPrice
+		quota = decimal.NewFromFloat(modelPrice).Mul(decimal.NewFromFloat(common.QuotaPerUnit)).Mul(dGroupRatio)
+	} else {
+		priceData := types.PriceData{
+			CompletionRatio: ratio_setting.GetCompletionRatio(req.Model),
+		}
+		modelRatio, ratioConfigured, _ := ratio_setting.GetModelRatio(req.Model)
+		priceData.ModelRatio = modelRatio
+		priceData.CacheRatio, _ = ratio_setting.GetCacheRatio(req.Model)
+		if tiers, ok := ratio_setting.GetModelPricingTiers(req.Model); ok {
+			priceData.SetPricingTiers(tiers, req.PromptTokens)
+		}
+		result["price_configured"] = ratioConfigured
+		result["model_ratio"] = priceData.ModelRatio
+		result["completion_ratio"] = priceData.CompletionRatio
+		result["cache_ratio"] = priceData.CacheRatio
+		if priceData.PricingTier != nil {
+			result["pricing_tier"] = priceData.PricingTier.Threshold
+		}
+
+		promptTokens := decimal.NewFromInt(int64(req.PromptTokens - req.CacheTokens)).
+			Add(decimal.NewFromInt(int64(req.CacheTokens)).Mul(decimal.NewFromFloat(priceData.CacheRatio)))
+		completionTokens := decimal.NewFromInt(int64(req.CompletionTokens)).Mul(decimal.NewFromFloat(priceData.CompletionRatio))
+		quota = promptTokens.Add(completionTokens).Mul(decimal.NewFromFloat(priceData.ModelRatio)).Mul(dGroupRatio)
+	}
+	result["quota"] = quota.Round(0).IntPart()
+	result["price"] = quota.Div(decimal.NewFromFloat(common.QuotaPerUnit)).InexactFloat64()
+	common.ApiSuccess(c, result)
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type invoiceIssueRequest struct {
+	TradeNo string `json:"trade_no"`
+}
+
+type invoiceVoidRequest struct {
+	Reason string `json:"reason"`
+}
+
+type statementSendRequest struct {
+	UserId int    `json:"user_id"`
+	Month  string `json:"month"`
+}
+
+func writeInvoiceHTML(c *gin.Context, inv *model.Invoice) {
+	content, err := service.RenderInvoiceHTML(inv)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.html"`, inv.InvoiceNo))
+	c.Data(http.StatusOK, "text/html; charset=utf-8", content)
+}
+
+func writeStatement(c *gin.Context, userId int) {
+	statement, err := service.BuildMonthlyStatement(userId, c.Query("month"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if c.Query("format") != "html" {
+		common.ApiSuccess(c, statement)
+		return
+	}
+	content, err := service.RenderStatementHTML(statement)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%d-%s.html"`, userId, statement.Month))
+	c.Data(http.StatusOK, "text/html; charset=utf-8", content)
+}
+
+func listInvoices(c *gin.Context, userId int) {
+	pageInfo := common.GetPageQuery(c)
+	invoices, total, err := model.GetInvoices(userId, c.Query("keyword"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(invoices)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func getInvoiceParam(c *gin.Context) (*model.Invoice, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的发票 ID")
+		return nil, false
+	}
+	inv, err := model.GetInvoiceById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return inv, true
+}
+
+// GetSelfInvoices 用户查看自己的发票
+func GetSelfInvoices(c *gin.Context) {
+	listInvoices(c, c.GetInt("id"))
+}
+
+// DownloadSelfInvoice 用户下载自己的发票
+func DownloadSelfInvoice(c *gin.Context) {
+	inv, ok := getInvoiceParam(c)
+	if !ok {
+		return
+	}
+	if inv.UserId != c.GetInt("id") {
+		common.ApiError(c, model.ErrInvoiceNotFound)
+		return
+	}
+	writeInvoiceHTML(c, inv)
+}
+
+// IssueSelfInvoice 用户为自己已完成的支付申请开具发票
+func IssueSelfInvoice(c *gin.Context) {
+	var req invoiceIssueRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil || req.TradeNo == "" {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	topUp := model.GetTopUpByTradeNo(req.TradeNo)
+	if topUp == nil || topUp.UserId != c.GetInt("id") {
+		common.ApiErrorMsg(c, "充值订单不存在")
+		return
+	}
+	inv, err := model.IssueInvoiceByTradeNo(req.TradeNo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, inv)
+}
+
+// GetSelfStatement 用户查看月度账单，format=html 时下载 HTML
+func GetSelfStatement(c *gin.Context) {
+	writeStatement(c, c.GetInt("id"))
+}
+
+// AdminListInvoices 管理员查看发票，可按用户筛选
+func AdminListInvoices(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	listInvoices(c, userId)
+}
+
+// AdminDownloadInvoice 管理员下载发票
+func AdminDownloadInvoice(c *gin.Context) {
+	inv, ok := getInvoiceParam(c)
+	if !ok {
+		return
+	}
+	writeInvoiceHTML(c, inv)
+}
+
+// AdminIssueInvoice 管理员为已完成的支付补开发票
+func AdminIssueInvoice(c *gin.Context) {
+	var req invoiceIssueRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil || req.TradeNo == "" {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	inv, err := model.IssueInvoiceByTradeNo(req.TradeNo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, inv)
+}
+
+// AdminRegenerateInvoice 作废原发票并按当前公司与税务信息重新开具
+func AdminRegenerateInvoice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的发票 ID")
+		return
+	}
+	inv, err := model.RegenerateInvoice(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, inv)
+}
+
+// AdminVoidInvoice 作废发票
+func AdminVoidInvoice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的发票 ID")
+		return
+	}
+	var req invoiceVoidRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	inv, err := model.VoidInvoice(id, req.Reason)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, inv)
+}
+
+// AdminGetStatement 管理员查看用户月度账单
+func AdminGetStatement(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil || userId <= 0 {
+		common.ApiErrorMsg(c, "无效的用户 ID")
+		return
+	}
+	writeStatement(c, userId)
+}
+
+// AdminSendStatement 立即向用户发送月度账单邮件
+func AdminSendStatement(c *gin.Context) {
+	var req statementSendRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil || req.UserId <= 0 {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if err := service.SendMonthlyStatement(req.UserId, req.Month); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
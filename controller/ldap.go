@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/oauth"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// LDAPLogin 使用目录账号密码登录，首次登录时自动创建账号，每次登录按分组映射同步用户分组
+func LDAPLogin(c *gin.Context) {
+	provider := oauth.GetPasswordProvider("ldap")
+	if provider == nil || !provider.IsEnabled() {
+		common.ApiErrorI18n(c, i18n.MsgOAuthNotEnabled, providerParams("LDAP"))
+		return
+	}
+	var loginRequest LoginRequest
+	if err := common.DecodeJson(c.Request.Body, &loginRequest); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if loginRequest.Username == "" || loginRequest.Password == "" {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+
+	oauthUser, err := provider.Authenticate(c.Request.Context(), loginRequest.Username, loginRequest.Password)
+	if err != nil {
+		handleOAuthError(c, err)
+		return
+	}
+
+	user, err := findOrCreateOAuthUser(c, provider, oauthUser, sessions.Default(c))
+	if err != nil {
+		switch err.(type) {
+		case *OAuthUserDeletedError:
+			common.ApiErrorI18n(c, i18n.MsgOAuthUserDeleted)
+		case *OAuthRegistrationDisabledError:
+			common.ApiErrorI18n(c, i18n.MsgUserRegisterDisabled)
+		default:
+			common.ApiError(c, err)
+		}
+		return
+	}
+
+	if user.Status != common.UserStatusEnabled {
+		common.ApiErrorI18n(c, i18n.MsgOAuthUserBanned)
+		return
+	}
+
+	syncOAuthUserMapping(c, provider, user, oauthUser)
+
+	if requireTwoFALogin(user, c) {
+		return
+	}
+	setupLogin(user, c)
+}
@@ -148,6 +148,38 @@ func GetLogsSelfStat(c *gin.Context) {
 	return
 }
 
+// GetEndUserStats 按终端用户聚合消费统计
+func GetEndUserStats(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	stats, err := model.GetEndUserUsageStats(c.Query("username"), c.Query("token_name"), startTimestamp, endTimestamp, getEndUserStatsLimit(c))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, stats)
+}
+
+// GetSelfEndUserStats 按终端用户聚合当前用户的消费统计
+func GetSelfEndUserStats(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	stats, err := model.GetEndUserUsageStats(c.GetString("username"), c.Query("token_name"), startTimestamp, endTimestamp, getEndUserStatsLimit(c))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, stats)
+}
+
+func getEndUserStatsLimit(c *gin.Context) int {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	return limit
+}
+
 func DeleteHistoryLogs(c *gin.Context) {
 	targetTimestamp, _ := strconv.ParseInt(c.Query("target_timestamp"), 10, 64)
 	if targetTimestamp == 0 {
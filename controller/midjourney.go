@@ -177,7 +177,11 @@ func UpdateMidjourneyTaskBulk() {
 				if err != nil {
 					logger.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
 				} else if won && shouldReturnQuota {
-					err = model.IncreaseUserQuota(task.UserId, task.Quota, false)
+					err = model.IncreaseUserQuota(task.UserId, task.Quota, false, model.QuotaLedgerMeta{
+						Type:           model.QuotaLedgerTypeRefund,
+						IdempotencyKey: "refund:midjourney:" + task.MjId,
+						ReferenceId:    task.MjId,
+					})
 					if err != nil {
 						logger.LogError(ctx, "fail to increase user quota: "+err.Error())
 					}
@@ -16,6 +16,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/channel/moonshot"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
@@ -133,7 +134,8 @@ func ListModels(c *gin.Context, modelType int) {
 			tokenModelLimit = map[string]bool{}
 		}
 		for allowModel, _ := range tokenModelLimit {
-			if !acceptUnsetRatioModel {
+			// 虚拟模型按解析后的具体模型计费，无需配置倍率
+			if !acceptUnsetRatioModel && !model_setting.GetVirtualModelSettings().IsVirtualModel(allowModel) {
 				_, _, exist := ratio_setting.GetModelRatioOrPrice(allowModel)
 				if !exist {
 					continue
@@ -200,6 +202,17 @@ func ListModels(c *gin.Context, modelType int) {
 				})
 			}
 		}
+		for _, virtualModel := range model_setting.GetVirtualModelSettings().GetModelNames() {
+			if common.StringsContains(models, virtualModel) {
+				continue
+			}
+			userOpenAiModels = append(userOpenAiModels, dto.OpenAIModels{
+				Id:      virtualModel,
+				Object:  "model",
+				Created: 1626777600,
+				OwnedBy: "virtual",
+			})
+		}
 	}
 
 	switch modelType {
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -9,6 +10,8 @@ import (
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -111,6 +114,8 @@ func HandleOAuth(c *gin.Context) {
 			common.ApiErrorI18n(c, i18n.MsgOAuthUserDeleted)
 		case *OAuthRegistrationDisabledError:
 			common.ApiErrorI18n(c, i18n.MsgUserRegisterDisabled)
+		case *OAuthScimLinkRefusedError:
+			common.ApiErrorI18n(c, i18n.MsgOAuthScimLinkRefused, providerParams(provider.GetName()))
 		default:
 			common.ApiError(c, err)
 		}
@@ -123,7 +128,10 @@ func HandleOAuth(c *gin.Context) {
 		return
 	}
 
-	// 9. Setup login
+	// 9. Sync group and role mapping from provider claims
+	syncOAuthUserMapping(c, provider, user, oauthUser)
+
+	// 10. Setup login
 	setupLogin(user, c)
 }
 
@@ -196,7 +204,7 @@ func handleOAuthBind(c *gin.Context, provider oauth.Provider) {
 }
 
 // findOrCreateOAuthUser finds existing user or creates new user
-func findOrCreateOAuthUser(c *gin.Context, provider oauth.Provider, oauthUser *oauth.OAuthUser, session sessions.Session) (*model.User, error) {
+func findOrCreateOAuthUser(c *gin.Context, provider oauth.UserBinder, oauthUser *oauth.OAuthUser, session sessions.Session) (*model.User, error) {
 	user := &model.User{}
 
 	// Check if user already exists with new ID
@@ -232,8 +240,15 @@ func findOrCreateOAuthUser(c *gin.Context, provider oauth.Provider, oauthUser *o
 		}
 	}
 
+	// SCIM 预先开通的账号在首次 OIDC 登录时按邮箱关联，避免重复创建
+	if scimUser, err := linkSCIMProvisionedUser(provider, oauthUser); err != nil || scimUser != nil {
+		return scimUser, err
+	}
+
 	// User doesn't exist, create new user if registration is enabled
-	if !common.RegisterEnabled {
+	// or the provider auto-provisions accounts (e.g. LDAP directory users)
+	passwordProvider, isPasswordProvider := provider.(oauth.PasswordProvider)
+	if !common.RegisterEnabled && !(isPasswordProvider && passwordProvider.AutoProvision()) {
 		return nil, &OAuthRegistrationDisabledError{}
 	}
 
@@ -310,6 +325,7 @@ func findOrCreateOAuthUser(c *gin.Context, provider oauth.Provider, oauthUser *o
 				"github_id":   user.GitHubId,
 				"discord_id":  user.DiscordId,
 				"oidc_id":     user.OidcId,
+				"ldap_id":     user.LdapId,
 				"linux_do_id": user.LinuxDOId,
 				"wechat_id":   user.WeChatId,
 				"telegram_id": user.TelegramId,
@@ -330,6 +346,67 @@ func findOrCreateOAuthUser(c *gin.Context, provider oauth.Provider, oauthUser *o
 	return user, nil
 }
 
+// linkSCIMProvisionedUser 将 OIDC 身份绑定到邮箱相同的 SCIM 用户，未找到 SCIM 用户时返回 nil；
+// 仅对标记为可信的内置 OIDC 与自定义 OAuth 提供方且邮箱已验证时关联，否则拒绝登录，由用户登录后手动绑定，
+// 避免未验证邮箱接管预先开通的账号或重复创建账号
+func linkSCIMProvisionedUser(provider oauth.UserBinder, oauthUser *oauth.OAuthUser) (*model.User, error) {
+	user, err := model.GetScimUserByEmail(oauthUser.Email)
+	if errors.Is(err, model.ErrScimUserNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	refused := &OAuthScimLinkRefusedError{}
+	if !oauthUser.EmailVerified {
+		common.SysLog(fmt.Sprintf("[OAuth] refused to link %s account to scim user %d: email not verified", provider.GetName(), user.Id))
+		return nil, refused
+	}
+	switch p := provider.(type) {
+	case *oauth.GenericOAuthProvider:
+		if !p.GetConfig().TrustedForScimLink {
+			return nil, refused
+		}
+		if _, err := model.GetUserOAuthBinding(user.Id, p.GetProviderId()); err == nil {
+			return nil, refused
+		}
+		err = model.CreateUserOAuthBinding(&model.UserOAuthBinding{
+			UserId:         user.Id,
+			ProviderId:     p.GetProviderId(),
+			ProviderUserId: oauthUser.ProviderUserID,
+		})
+	case *oauth.OIDCProvider:
+		if !system_setting.GetOIDCSettings().TrustedForScimLink || user.OidcId != "" {
+			return nil, refused
+		}
+		user.OidcId = oauthUser.ProviderUserID
+		err = user.Update(false)
+	default:
+		return nil, refused
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("[OAuth] failed to link scim user %d: %s", user.Id, err.Error()))
+		return nil, err
+	}
+	common.SysLog(fmt.Sprintf("[OAuth] linked %s account to scim user %d", provider.GetName(), user.Id))
+	return user, nil
+}
+
+// syncOAuthUserMapping 每次登录时按提供方声明映射同步用户分组、角色与可用分组，并记录审计日志
+func syncOAuthUserMapping(c *gin.Context, provider oauth.UserBinder, user *model.User, oauthUser *oauth.OAuthUser) {
+	if oauthUser.Mapping == nil {
+		return
+	}
+	before, after, err := service.ApplyIdentityMapping(user, oauthUser.Mapping)
+	if err != nil {
+		common.SysError(fmt.Sprintf("[OAuth] failed to sync %s mapping for user %d: %s", provider.GetName(), user.Id, err.Error()))
+		return
+	}
+	// 审计日志中以提供方作为操作者
+	c.Set("username", provider.GetName())
+	service.RecordAudit(c, "oauth.mapping.sync", "user", user.Id, before, after)
+}
+
 // Error types for OAuth
 type OAuthUserDeletedError struct{}
 
@@ -343,6 +420,13 @@ func (e *OAuthRegistrationDisabledError) Error() string {
 	return "registration is disabled"
 }
 
+// OAuthScimLinkRefusedError 邮箱对应 SCIM 预先开通的账号但不满足自动关联条件
+type OAuthScimLinkRefusedError struct{}
+
+func (e *OAuthScimLinkRefusedError) Error() string {
+	return "account provisioned for this email must be bound manually"
+}
+
 // handleOAuthError handles OAuth errors and returns translated message
 func handleOAuthError(c *gin.Context, err error) {
 	switch e := err.(type) {
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type paymentReversalRequest struct {
+	TradeNo string  `json:"trade_no"`
+	Kind    string  `json:"kind"`
+	Amount  float64 `json:"amount"`
+	Reason  string  `json:"reason"`
+	// EventId 可选，用于避免重复提交
+	EventId string `json:"event_id"`
+}
+
+// GetPaymentEvents 查看已处理的退款、争议与取消事件
+func GetPaymentEvents(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	events, total, err := model.GetPaymentEvents(c.Query("trade_no"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(events)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminApplyPaymentReversal 手动登记退款或争议，用于不提供退款通知的渠道（如易支付）
+func AdminApplyPaymentReversal(c *gin.Context) {
+	var req paymentReversalRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil || req.TradeNo == "" || req.Amount < 0 {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	switch req.Kind {
+	case model.PaymentReversalRefund, model.PaymentReversalDispute, model.PaymentReversalDisputeWon, model.PaymentReversalSubscriptionCancel:
+	default:
+		common.ApiErrorMsg(c, "无效的撤销类型")
+		return
+	}
+	if req.EventId == "" {
+		req.EventId = common.GetUUID()
+	}
+	result, err := service.HandlePaymentReversal(model.PaymentReversal{
+		Provider: "manual",
+		EventId:  req.EventId,
+		Kind:     req.Kind,
+		TradeNo:  req.TradeNo,
+		Amount:   req.Amount,
+		Reason:   req.Reason,
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if result == nil {
+		common.ApiErrorMsg(c, "退款处理未启用")
+		return
+	}
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("手动登记支付%s，订单 %s", req.Kind, req.TradeNo))
+	common.ApiSuccess(c, result)
+}
@@ -175,6 +175,26 @@ func ForceGC(c *gin.Context) {
 	})
 }
 
+// GetInvalidationStatus 返回缓存失效广播的全局版本号与各实例已应用的版本
+func GetInvalidationStatus(c *gin.Context) {
+	version, nodes, err := common.GetInvalidationStatus()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	mode := "pubsub"
+	if !common.RedisEnabled {
+		mode = "polling"
+	}
+	common.ApiSuccess(c, gin.H{
+		"mode":           mode,
+		"version":        version,
+		"sync_frequency": common.SyncFrequency,
+		"current_node":   common.NodeId,
+		"nodes":          nodes,
+	})
+}
+
 // LogFileInfo 日志文件信息
 type LogFileInfo struct {
 	Name    string    `json:"name"`
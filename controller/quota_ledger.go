@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserQuotaLedger 管理员查看用户额度流水
+func GetUserQuotaLedger(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil || userId <= 0 {
+		common.ApiErrorMsg(c, "无效的用户 ID")
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	entries, total, err := model.GetUserQuotaLedger(userId, c.Query("account"), c.Query("type"),
+		startTimestamp, endTimestamp, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(entries)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetQuotaLedgerReconcileReport 返回最近一次对账结果
+func GetQuotaLedgerReconcileReport(c *gin.Context) {
+	common.ApiSuccess(c, service.GetQuotaLedgerReconcileReport())
+}
+
+// RunQuotaLedgerReconcile 立即执行一次对账
+func RunQuotaLedgerReconcile(c *gin.Context) {
+	report, err := service.RunQuotaLedgerReconcile()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, report)
+}
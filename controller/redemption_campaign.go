@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxCampaignCodesPerRequest = 10000
+
+type campaignCodesRequest struct {
+	Count       int    `json:"count"`
+	Prefix      string `json:"prefix"`
+	UsageLimit  int    `json:"usage_limit"`
+	ExpiredTime int64  `json:"expired_time"`
+}
+
+func getCampaignParam(c *gin.Context) (*model.RedemptionCampaign, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的活动 ID")
+		return nil, false
+	}
+	campaign, err := model.GetRedemptionCampaignById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return campaign, true
+}
+
+func validateCampaign(campaign *model.RedemptionCampaign) error {
+	if err := campaign.Validate(); err != nil {
+		return err
+	}
+	if campaign.RewardType == model.RedemptionRewardGroup {
+		if !ratio_setting.ContainsGroupRatio(campaign.Group) {
+			return fmt.Errorf("分组 %s 不存在", campaign.Group)
+		}
+	}
+	return nil
+}
+
+func GetRedemptionCampaigns(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	campaigns, total, err := model.GetRedemptionCampaigns(c.Query("keyword"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(campaigns)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetRedemptionCampaign(c *gin.Context) {
+	campaign, ok := getCampaignParam(c)
+	if !ok {
+		return
+	}
+	common.ApiSuccess(c, campaign)
+}
+
+func AddRedemptionCampaign(c *gin.Context) {
+	var campaign model.RedemptionCampaign
+	if err := c.ShouldBindJSON(&campaign); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateCampaign(&campaign); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	campaign.Id = 0
+	campaign.UsedCount = 0
+	campaign.CreatedBy = c.GetInt("id")
+	if err := campaign.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, campaign)
+}
+
+func UpdateRedemptionCampaign(c *gin.Context) {
+	var campaign model.RedemptionCampaign
+	if err := c.ShouldBindJSON(&campaign); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetRedemptionCampaignById(campaign.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateCampaign(&campaign); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := campaign.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, campaign)
+}
+
+// GenerateRedemptionCampaignCodes 批量生成活动兑换码
+func GenerateRedemptionCampaignCodes(c *gin.Context) {
+	campaign, ok := getCampaignParam(c)
+	if !ok {
+		return
+	}
+	var req campaignCodesRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if req.Count <= 0 || req.Count > maxCampaignCodesPerRequest {
+		common.ApiErrorMsg(c, fmt.Sprintf("生成数量必须在 1 到 %d 之间", maxCampaignCodesPerRequest))
+		return
+	}
+	if valid, msg := validateExpiredTime(c, req.ExpiredTime); !valid {
+		common.ApiErrorMsg(c, msg)
+		return
+	}
+	keys, err := model.GenerateCampaignCodes(campaign, req.Prefix, req.Count, req.UsageLimit, req.ExpiredTime, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, keys)
+}
+
+// ExportRedemptionCampaignCodes 导出活动兑换码为 CSV
+func ExportRedemptionCampaignCodes(c *gin.Context) {
+	campaign, ok := getCampaignParam(c)
+	if !ok {
+		return
+	}
+	codes, err := model.GetCampaignCodes(campaign.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"key", "status", "usage_limit", "used_count", "created_time", "expired_time"})
+	for _, code := range codes {
+		expired := ""
+		if code.ExpiredTime != 0 {
+			expired = time.Unix(code.ExpiredTime, 0).Format(time.RFC3339)
+		}
+		_ = w.Write([]string{
+			code.Key,
+			strconv.Itoa(code.Status),
+			strconv.Itoa(code.UsageLimit),
+			strconv.Itoa(code.UsedCount),
+			time.Unix(code.CreatedTime, 0).Format(time.RFC3339),
+			expired,
+		})
+	}
+	w.Flush()
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="campaign-%d-codes.csv"`, campaign.Id))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+func GetRedemptionCampaignStats(c *gin.Context) {
+	campaign, ok := getCampaignParam(c)
+	if !ok {
+		return
+	}
+	stats, err := model.GetRedemptionCampaignStats(campaign.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"campaign": campaign,
+		"stats":    stats,
+	})
+}
@@ -89,19 +89,20 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		if newAPIError != nil {
 			logger.LogError(c, fmt.Sprintf("relay error: %s", newAPIError.Error()))
 			newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
-			switch relayFormat {
-			case types.RelayFormatOpenAIRealtime:
+			if relayFormat == types.RelayFormatOpenAIRealtime {
 				helper.WssError(c, ws, newAPIError.ToOpenAIError())
-			case types.RelayFormatClaude:
-				c.JSON(newAPIError.StatusCode, gin.H{
-					"type":  "error",
-					"error": newAPIError.ToClaudeError(),
-				})
-			default:
-				c.JSON(newAPIError.StatusCode, gin.H{
-					"error": newAPIError.ToOpenAIError(),
-				})
+				return
+			}
+			body := gin.H{"error": newAPIError.ToOpenAIError()}
+			if relayFormat == types.RelayFormatClaude {
+				body = gin.H{"type": "error", "error": newAPIError.ToClaudeError()}
 			}
+			// 排队保活已开始事件流时无法再返回状态码，改为发送 SSE error 事件
+			if common.GetContextKeyBool(c, constant.ContextKeyAdmissionStreamStarted) {
+				_ = helper.ErrorEvent(c, body)
+				return
+			}
+			c.JSON(newAPIError.StatusCode, body)
 		}
 	}()
 
@@ -124,9 +125,11 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	needSensitiveCheck := setting.ShouldCheckPromptSensitive()
 	needCountToken := constant.CountToken
+	// 虚拟模型按图片/音频/工具等请求特征路由，需要完整的 TokenCountMeta
+	virtualModel := common.GetContextKeyString(c, constant.ContextKeyVirtualModel)
 	// Avoid building huge CombineText (strings.Join) when token counting and sensitive check are both disabled.
 	var meta *types.TokenCountMeta
-	if needSensitiveCheck || needCountToken {
+	if needSensitiveCheck || needCountToken || virtualModel != "" {
 		meta = request.GetTokenCountMeta()
 	} else {
 		meta = fastTokenCountMetaForPricing(request)
@@ -149,6 +152,15 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	relayInfo.SetEstimatePromptTokens(tokens)
 
+	if virtualModel != "" {
+		resolvedModel, ok := service.ResolveVirtualModel(c, relayInfo, request, meta, tokens)
+		if !ok {
+			newAPIError = types.NewErrorWithStatusCode(fmt.Errorf("虚拟模型 %s 没有匹配且令牌可用的路由规则", virtualModel), types.ErrorCodeModelNotFound, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+			return
+		}
+		logger.LogInfo(c, fmt.Sprintf("虚拟模型 %s 解析为 %s", virtualModel, resolvedModel))
+	}
+
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeModelPriceError)
@@ -157,13 +169,16 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	// common.SetContextKey(c, constant.ContextKeyTokenCountMeta, meta)
 
-	if priceData.FreeModel {
-		logger.LogInfo(c, fmt.Sprintf("模型 %s 免费，跳过预扣费", relayInfo.OriginModelName))
-	} else {
-		newAPIError = service.PreConsumeBilling(c, priceData.QuotaToPreConsume, relayInfo)
-		if newAPIError != nil {
-			return
-		}
+	// 排队准入后才预扣费，等待超时的请求不占用额度
+	admission, admissionErr := acquireRelayAdmission(c, relayInfo, relayFormat)
+	if admissionErr != nil {
+		newAPIError = admissionErr
+		return
+	}
+	defer admission.Release()
+
+	if newAPIError = preConsumeRelayBilling(c, priceData, relayInfo); newAPIError != nil {
+		return
 	}
 
 	defer func() {
@@ -186,52 +201,89 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	relayInfo.RetryIndex = 0
 	relayInfo.LastError = nil
 
-	for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
-		relayInfo.RetryIndex = retryParam.GetRetry()
-		channel, channelErr := getChannel(c, relayInfo, retryParam)
-		if channelErr != nil {
-			logger.LogError(c, channelErr.Error())
-			newAPIError = channelErr
-			break
-		}
+	for {
+		for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
+			relayInfo.RetryIndex = retryParam.GetRetry()
+			channel, channelErr := getChannel(c, relayInfo, retryParam)
+			if channelErr != nil {
+				logger.LogError(c, channelErr.Error())
+				// 剩余渠道均已满时保留限流错误，以便重新排队
+				if len(retryParam.ExcludedChannelIds) == 0 || newAPIError == nil || newAPIError.GetErrorCode() != types.ErrorCodeChannelConcurrencyLimited {
+					newAPIError = channelErr
+				}
+				if switchModelFallback(c, relayInfo, retryParam, tokens, meta) {
+					continue
+				}
+				break
+			}
 
-		addUsedChannel(c, channel.Id)
-		bodyStorage, bodyErr := common.GetBodyStorage(c)
-		if bodyErr != nil {
-			// Ensure consistent 413 for oversized bodies even when error occurs later (e.g., retry path)
-			if common.IsRequestBodyTooLargeError(bodyErr) || errors.Is(bodyErr, common.ErrRequestBodyTooLarge) {
-				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
-			} else {
-				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+			releaseChannel, ok := service.AcquireChannelSlot(channel.Id, common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex), relayInfo.GetEstimatePromptTokens())
+			if !ok {
+				newAPIError = types.NewErrorWithStatusCode(fmt.Errorf("渠道 #%d 并发已达上限", channel.Id), types.ErrorCodeChannelConcurrencyLimited, http.StatusTooManyRequests)
+				if _, specific := c.Get("specific_channel_id"); specific {
+					break
+				}
+				// 未实际请求上游，换一个渠道且不计入重试次数
+				retryParam.ExcludeChannel(channel.Id)
+				continue
 			}
-			break
-		}
-		c.Request.Body = io.NopCloser(bodyStorage)
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
-		}
+			addUsedChannel(c, channel.Id)
+			bodyStorage, bodyErr := common.GetBodyStorage(c)
+			if bodyErr != nil {
+				// Ensure consistent 413 for oversized bodies even when error occurs later (e.g., retry path)
+				if common.IsRequestBodyTooLargeError(bodyErr) || errors.Is(bodyErr, common.ErrRequestBodyTooLarge) {
+					newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
+				} else {
+					newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+				}
+				releaseChannel()
+				break
+			}
+			c.Request.Body = io.NopCloser(bodyStorage)
 
-		if newAPIError == nil {
-			relayInfo.LastError = nil
-			return
-		}
+			switch relayFormat {
+			case types.RelayFormatOpenAIRealtime:
+				newAPIError = relay.WssHelper(c, relayInfo)
+			case types.RelayFormatClaude:
+				newAPIError = relay.ClaudeHelper(c, relayInfo)
+			case types.RelayFormatGemini:
+				newAPIError = geminiRelayHandler(c, relayInfo)
+			default:
+				newAPIError = relayHandler(c, relayInfo)
+			}
+			releaseChannel()
 
-		newAPIError = service.NormalizeViolationFeeError(newAPIError)
-		relayInfo.LastError = newAPIError
+			if newAPIError == nil {
+				relayInfo.LastError = nil
+				return
+			}
 
-		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+			newAPIError = service.NormalizeViolationFeeError(newAPIError)
+			relayInfo.LastError = newAPIError
 
-		if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
+			processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+
+			if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) || retryParam.GetRetry() >= common.RetryTimes {
+				// 当前模型重试用尽，可重试的错误切换到回退链中的下一个模型
+				if shouldRetry(c, newAPIError, 1) && switchModelFallback(c, relayInfo, retryParam, tokens, meta) {
+					continue
+				}
+				break
+			}
+		}
+		// 所有渠道均限流时回到队列等待容量，而不是直接失败
+		if !requeueRelayAdmission(c, admission, relayInfo, newAPIError) {
+			break
+		}
+		logger.LogInfo(c, "所有渠道均限流，重新排队等待")
+		if newAPIError = preConsumeRelayBilling(c, priceData, relayInfo); newAPIError != nil {
 			break
 		}
+		retryParam.SetRetry(0)
+		retryParam.ExcludedChannelIds = nil
+		retryParam.ResetRetryNextTry()
+		common.SetContextKey(c, constant.ContextKeyAutoGroupIndex, 0)
 	}
 
 	useChannel := c.GetStringSlice("use_channel")
@@ -241,6 +293,51 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	}
 }
 
+// preConsumeRelayBilling 预扣费，免费模型跳过
+func preConsumeRelayBilling(c *gin.Context, priceData types.PriceData, relayInfo *relaycommon.RelayInfo) *types.NewAPIError {
+	if priceData.FreeModel {
+		logger.LogInfo(c, fmt.Sprintf("模型 %s 免费，跳过预扣费", relayInfo.OriginModelName))
+		return nil
+	}
+	return service.PreConsumeBilling(c, priceData.QuotaToPreConsume, relayInfo)
+}
+
+// switchModelFallback 切换到回退链中的下一个模型：重新计算价格并重置重试计数，
+// 后续渠道选择、模型映射与格式转换均按新模型进行。预扣费沿用首个模型，结算时按实际模型计费。
+func switchModelFallback(c *gin.Context, relayInfo *relaycommon.RelayInfo, retryParam *service.RetryParam, tokens int, meta *types.TokenCountMeta) bool {
+	if relayInfo.ChannelMeta == nil && relayInfo.VirtualModelName == "" {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	requestedModel := relayInfo.RequestedModelName
+	if requestedModel == "" {
+		requestedModel = relayInfo.OriginModelName
+	}
+	for {
+		fallbackModel, ok := service.NextModelFallback(c)
+		if !ok {
+			return false
+		}
+		previousModel := relayInfo.OriginModelName
+		relayInfo.OriginModelName = fallbackModel
+		if _, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta); err != nil {
+			logger.LogWarn(c, fmt.Sprintf("skip fallback model %s: %s", fallbackModel, err.Error()))
+			relayInfo.OriginModelName = previousModel
+			continue
+		}
+		logger.LogInfo(c, fmt.Sprintf("模型回退：%s -> %s", previousModel, fallbackModel))
+		service.MarkModelFallback(c, requestedModel, fallbackModel)
+		relayInfo.RequestedModelName = requestedModel
+		retryParam.ModelName = fallbackModel
+		retryParam.SetRetry(0)
+		retryParam.ResetRetryNextTry()
+		common.SetContextKey(c, constant.ContextKeyAutoGroupIndex, 0)
+		return true
+	}
+}
+
 var upgrader = websocket.Upgrader{
 	Subprotocols: []string{"realtime"}, // WS 握手支持的协议，如果有使用 Sec-WebSocket-Protocol，则必须在此声明对应的 Protocol TODO add other protocol
 	CheckOrigin: func(r *http.Request) bool {
@@ -284,7 +381,8 @@ func fastTokenCountMetaForPricing(request dto.Request) *types.TokenCountMeta {
 }
 
 func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service.RetryParam) (*model.Channel, *types.NewAPIError) {
-	if info.ChannelMeta == nil {
+	// 虚拟模型在分发阶段没有选择渠道，首次也需要按解析后的模型选择；分发阶段的渠道已满时重新选择
+	if info.ChannelMeta == nil && info.VirtualModelName == "" && !lo.Contains(retryParam.ExcludedChannelIds, c.GetInt("channel_id")) {
 		autoBan := c.GetBool("auto_ban")
 		autoBanInt := 1
 		if !autoBan {
@@ -305,6 +403,9 @@ func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service
 		return nil, types.NewError(fmt.Errorf("获取分组 %s 下模型 %s 的可用渠道失败（retry）: %s", selectGroup, info.OriginModelName, err.Error()), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
 	}
 	if channel == nil {
+		if regions := service.GetDataResidencyRegions(c); len(regions) > 0 {
+			return nil, types.NewError(fmt.Errorf("分组 %s 下模型 %s 没有满足数据驻留策略的渠道（允许区域：%s）", selectGroup, info.OriginModelName, strings.Join(regions, ",")), types.ErrorCodeDataResidencyUnsatisfied, types.ErrOptionWithSkipRetry())
+		}
 		return nil, types.NewError(fmt.Errorf("分组 %s 下模型 %s 的可用渠道不存在（retry）", selectGroup, info.OriginModelName), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
 	}
 
@@ -383,6 +484,7 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 			adminInfo["multi_key_index"] = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
 		}
 		service.AppendChannelAffinityAdminInfo(c, adminInfo)
+		service.AppendDataResidencyAdminInfo(c, adminInfo)
 		other["admin_info"] = adminInfo
 		startTime := common.GetContextKeyTime(c, constant.ContextKeyRequestStartTime)
 		if startTime.IsZero() {
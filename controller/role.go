@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type roleResponse struct {
+	*model.Role
+	UserCount int64 `json:"user_count"`
+}
+
+// GetPermissionCatalog 返回全部可分配的权限
+func GetPermissionCatalog(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{
+		"permissions":    constant.Permissions,
+		"root_only":      constant.RootOnlyPermissions,
+		"built_in_roles": model.GetBuiltInRoles(),
+	})
+}
+
+// GetRoles 返回内置角色与自定义角色
+func GetRoles(c *gin.Context) {
+	roles, err := model.GetAllRoles()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	counts, err := model.CountRoleUsers()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	items := make([]roleResponse, 0, len(roles)+3)
+	for _, role := range model.GetBuiltInRoles() {
+		items = append(items, roleResponse{Role: role})
+	}
+	for _, role := range roles {
+		items = append(items, roleResponse{Role: role, UserCount: counts[role.Id]})
+	}
+	common.ApiSuccess(c, items)
+}
+
+func GetRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role, err := model.GetRoleById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, role)
+}
+
+// checkRoleGrantable 非超级管理员只能授予自己拥有且非超级管理员专属的权限，防止委派的角色管理员提权
+func checkRoleGrantable(c *gin.Context, roles ...*model.Role) error {
+	if c.GetInt("role") >= common.RoleRootUser {
+		return nil
+	}
+	owned, err := model.GetUserPermissions(c.GetInt("id"), c.GetInt("role"))
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if permission := owned.UngrantablePermission(role.GetPermissions()); permission != "" {
+			if slices.Contains(constant.RootOnlyPermissions, permission) {
+				return fmt.Errorf("无权授予超级管理员专属权限：%s", permission)
+			}
+			return fmt.Errorf("无权授予自己未拥有的权限：%s", permission)
+		}
+	}
+	return nil
+}
+
+// checkRoleNotAssignedToSelf 非超级管理员不能修改或删除自己被分配的角色
+func checkRoleNotAssignedToSelf(c *gin.Context, roleId int) error {
+	if c.GetInt("role") >= common.RoleRootUser {
+		return nil
+	}
+	roles, err := model.GetUserRoles(c.GetInt("id"))
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if role.Id == roleId {
+			return errors.New("不能修改自己被分配的角色")
+		}
+	}
+	return nil
+}
+
+// validateRole 校验角色名称与权限，并整理权限列表
+func validateRole(role *model.Role) error {
+	role.Name = strings.TrimSpace(role.Name)
+	if role.Name == "" {
+		return errors.New("角色名称不能为空")
+	}
+	if model.IsBuiltInRoleName(role.Name) {
+		return errors.New("不能使用内置角色名称")
+	}
+	if dup, err := model.IsRoleNameDuplicated(role.Id, role.Name); err != nil {
+		return err
+	} else if dup {
+		return errors.New("角色名称已存在")
+	}
+	permissions, err := model.NormalizePermissions(role.Permissions)
+	if err != nil {
+		return err
+	}
+	role.Permissions = permissions
+	return nil
+}
+
+func CreateRole(c *gin.Context) {
+	var role model.Role
+	if err := c.ShouldBindJSON(&role); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role.Id = 0
+	if err := validateRole(&role); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := checkRoleGrantable(c, &role); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := role.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, "role.create", "role", role.Id, nil, &role)
+	common.ApiSuccess(c, &role)
+}
+
+func UpdateRole(c *gin.Context) {
+	var role model.Role
+	if err := c.ShouldBindJSON(&role); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if role.Id == 0 {
+		common.ApiErrorMsg(c, "缺少角色 ID")
+		return
+	}
+	originRole, err := model.GetRoleById(role.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateRole(&role); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := checkRoleNotAssignedToSelf(c, role.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// 原有权限与新权限都必须在操作者可授予的范围内
+	if err := checkRoleGrantable(c, originRole, &role); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role.CreatedTime = originRole.CreatedTime
+	if err := role.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, "role.update", "role", role.Id, originRole, &role)
+	common.ApiSuccess(c, &role)
+}
+
+func DeleteRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	originRole, err := model.GetRoleById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := checkRoleNotAssignedToSelf(c, id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := checkRoleGrantable(c, originRole); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteRoleById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, "role.delete", "role", id, originRole, nil)
+	common.ApiSuccess(c, nil)
+}
+
+// GetUserRoles 返回用户的内置角色、自定义角色与最终权限
+func GetUserRoles(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	roles, err := model.GetUserRoles(user.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	permissions, err := model.GetUserPermissions(user.Id, user.Role)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"role":        user.Role,
+		"roles":       roles,
+		"permissions": permissions.List(),
+	})
+}
+
+func roleNames(roles []*model.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
+
+// changedRoles 返回两组角色中仅出现在一组的角色
+func changedRoles(origin []*model.Role, updated []*model.Role) []*model.Role {
+	ids := func(roles []*model.Role) map[int]bool {
+		set := make(map[int]bool, len(roles))
+		for _, role := range roles {
+			set[role.Id] = true
+		}
+		return set
+	}
+	originIds, updatedIds := ids(origin), ids(updated)
+	changed := make([]*model.Role, 0)
+	for _, role := range updated {
+		if !originIds[role.Id] {
+			changed = append(changed, role)
+		}
+	}
+	for _, role := range origin {
+		if !updatedIds[role.Id] {
+			changed = append(changed, role)
+		}
+	}
+	return changed
+}
+
+type setUserRolesRequest struct {
+	RoleIds []int `json:"role_ids"`
+}
+
+// SetUserRoles 覆盖用户的自定义角色分配
+func SetUserRoles(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req setUserRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if user.Id == c.GetInt("id") && c.GetInt("role") != common.RoleRootUser {
+		common.ApiErrorMsg(c, "不能修改自己的角色")
+		return
+	}
+	if user.Role == common.RoleRootUser && c.GetInt("role") != common.RoleRootUser {
+		common.ApiErrorMsg(c, "无权修改超级管理员的角色")
+		return
+	}
+	originRoles, err := model.GetUserRoles(user.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	newRoles, err := model.GetRolesByIds(req.RoleIds)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// 新分配与被移除的角色都必须在操作者可授予的范围内，保持不变的角色不检查
+	if err := checkRoleGrantable(c, changedRoles(originRoles, newRoles)...); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.SetUserRoles(user.Id, req.RoleIds); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	roles, _ := model.GetUserRoles(user.Id)
+	service.RecordAudit(c, "user.roles", "user", user.Id, gin.H{"roles": roleNames(originRoles)}, gin.H{"roles": roleNames(roles)})
+	model.RecordLog(user.Id, model.LogTypeManage, "管理员修改了用户的角色分配")
+	common.ApiSuccess(c, nil)
+}
@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func scimJSON(c *gin.Context, status int, data any) {
+	c.Header("Content-Type", dto.SCIMContentType)
+	c.JSON(status, data)
+}
+
+func scimError(c *gin.Context, err error) {
+	scimErr := service.SCIMErrorFrom(err)
+	if scimErr.Status >= http.StatusInternalServerError {
+		common.SysError("scim error: " + err.Error())
+	}
+	scimJSON(c, scimErr.Status, scimErr.Response())
+}
+
+func bindSCIMBody(c *gin.Context, v any) bool {
+	if err := common.DecodeJson(c.Request.Body, v); err != nil {
+		scimError(c, service.NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidSyntax, "invalid request body"))
+		return false
+	}
+	return true
+}
+
+func scimPage(c *gin.Context) (int, int) {
+	startIndex, _ := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	count, _ := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(dto.SCIMDefaultPageSize)))
+	return startIndex, count
+}
+
+func scimUserAudit(user *dto.SCIMUser) gin.H {
+	return gin.H{"user_name": user.UserName, "external_id": user.ExternalId, "active": user.Active != nil && *user.Active}
+}
+
+func scimGroupAudit(group *dto.SCIMGroup) gin.H {
+	return gin.H{"display_name": group.DisplayName, "external_id": group.ExternalId, "members": len(group.Members)}
+}
+
+// GetSCIMServiceProviderConfig 声明支持的 SCIM 能力
+func GetSCIMServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{dto.SCIMSchemaProviderConf},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": dto.SCIMMaxPageSize},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication scheme using the SCIM bearer secret",
+		}},
+	})
+}
+
+func GetSCIMUsers(c *gin.Context) {
+	startIndex, count := scimPage(c)
+	result, err := service.ListSCIMUsers(c.Query("filter"), startIndex, count)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, result)
+}
+
+func GetSCIMUser(c *gin.Context) {
+	user, err := service.GetSCIMUser(c.Param("id"))
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, user)
+}
+
+func CreateSCIMUser(c *gin.Context) {
+	var req dto.SCIMUser
+	if !bindSCIMBody(c, &req) {
+		return
+	}
+	user, err := service.CreateSCIMUser(&req)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	service.RecordAudit(c, "scim.user.create", "user", user.Id, nil, scimUserAudit(user))
+	scimJSON(c, http.StatusCreated, user)
+}
+
+func UpdateSCIMUser(c *gin.Context) {
+	before, err := service.GetSCIMUser(c.Param("id"))
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	var user *dto.SCIMUser
+	if c.Request.Method == http.MethodPatch {
+		var req dto.SCIMPatchRequest
+		if !bindSCIMBody(c, &req) {
+			return
+		}
+		user, err = service.PatchSCIMUser(c.Param("id"), &req)
+	} else {
+		var req dto.SCIMUser
+		if !bindSCIMBody(c, &req) {
+			return
+		}
+		user, err = service.ReplaceSCIMUser(c.Param("id"), &req)
+	}
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	service.RecordAudit(c, "scim.user.update", "user", user.Id, scimUserAudit(before), scimUserAudit(user))
+	scimJSON(c, http.StatusOK, user)
+}
+
+func DeleteSCIMUser(c *gin.Context) {
+	before, err := service.GetSCIMUser(c.Param("id"))
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	if err := service.DeleteSCIMUser(c.Param("id")); err != nil {
+		scimError(c, err)
+		return
+	}
+	service.RecordAudit(c, "scim.user.delete", "user", before.Id, scimUserAudit(before), nil)
+	c.Status(http.StatusNoContent)
+}
+
+func GetSCIMGroups(c *gin.Context) {
+	startIndex, count := scimPage(c)
+	result, err := service.ListSCIMGroups(c.Query("filter"), startIndex, count)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, result)
+}
+
+func GetSCIMGroup(c *gin.Context) {
+	group, err := service.GetSCIMGroup(c.Param("id"))
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, group)
+}
+
+func CreateSCIMGroup(c *gin.Context) {
+	var req dto.SCIMGroup
+	if !bindSCIMBody(c, &req) {
+		return
+	}
+	group, err := service.CreateSCIMGroup(&req)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	service.RecordAudit(c, "scim.group.create", "scim_group", group.Id, nil, scimGroupAudit(group))
+	scimJSON(c, http.StatusCreated, group)
+}
+
+func UpdateSCIMGroup(c *gin.Context) {
+	before, err := service.GetSCIMGroup(c.Param("id"))
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	var group *dto.SCIMGroup
+	if c.Request.Method == http.MethodPatch {
+		var req dto.SCIMPatchRequest
+		if !bindSCIMBody(c, &req) {
+			return
+		}
+		group, err = service.PatchSCIMGroup(c.Param("id"), &req)
+	} else {
+		var req dto.SCIMGroup
+		if !bindSCIMBody(c, &req) {
+			return
+		}
+		group, err = service.ReplaceSCIMGroup(c.Param("id"), &req)
+	}
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	service.RecordAudit(c, "scim.group.update", "scim_group", group.Id, scimGroupAudit(before), scimGroupAudit(group))
+	scimJSON(c, http.StatusOK, group)
+}
+
+func DeleteSCIMGroup(c *gin.Context) {
+	before, err := service.GetSCIMGroup(c.Param("id"))
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	if err := service.DeleteSCIMGroup(c.Param("id")); err != nil {
+		scimError(c, err)
+		return
+	}
+	service.RecordAudit(c, "scim.group.delete", "scim_group", before.Id, scimGroupAudit(before), nil)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSecretEncryptionStatus 返回密钥加密状态与重新加密任务进度
+func GetSecretEncryptionStatus(c *gin.Context) {
+	keyId := common.SecretEncryptionKeyId()
+	common.ApiSuccess(c, gin.H{
+		"enabled":  keyId != "",
+		"key_id":   keyId,
+		"rotation": model.GetSecretRotationStatus(),
+	})
+}
+
+// StartSecretRotation 使用当前主密钥重新加密全部密钥，用于启用加密或轮换主密钥后
+func StartSecretRotation(c *gin.Context) {
+	if err := model.StartSecretRotation(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, model.GetSecretRotationStatus())
+}
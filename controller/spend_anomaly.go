@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type spendAnomalyReviewRequest struct {
+	// Action dismiss 忽略，restore 恢复令牌，disable 禁用令牌
+	Action string `json:"action"`
+	Note   string `json:"note"`
+}
+
+func getSpendAnomalyParam(c *gin.Context) (*model.SpendAnomaly, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的记录 ID")
+		return nil, false
+	}
+	anomaly, err := model.GetSpendAnomalyById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return anomaly, true
+}
+
+// restoreSuspendedToken 恢复因异常消费暂停的令牌，其他状态不变
+func restoreSuspendedToken(tokenId int) error {
+	if tokenId == 0 {
+		return nil
+	}
+	token, err := model.GetTokenById(tokenId)
+	if err != nil {
+		return err
+	}
+	if token.Status != common.TokenStatusSuspended {
+		return nil
+	}
+	_, err = model.SetTokenStatus(tokenId, common.TokenStatusEnabled)
+	return err
+}
+
+func GetSpendAnomalies(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	anomalies, total, err := model.GetSpendAnomalies(userId, c.Query("status"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(anomalies)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetSelfSpendAnomalies(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	anomalies, total, err := model.GetSpendAnomalies(c.GetInt("id"), c.Query("status"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(anomalies)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// ConfirmSpendAnomaly 用户确认异常消费为本人操作并恢复令牌
+func ConfirmSpendAnomaly(c *gin.Context) {
+	anomaly, ok := getSpendAnomalyParam(c)
+	if !ok {
+		return
+	}
+	userId := c.GetInt("id")
+	if anomaly.UserId != userId {
+		common.ApiError(c, model.ErrSpendAnomalyNotFound)
+		return
+	}
+	if anomaly.Status != model.SpendAnomalyStatusPending {
+		common.ApiErrorMsg(c, "该记录已处理")
+		return
+	}
+	if err := restoreSuspendedToken(anomaly.TokenId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.ReviewSpendAnomaly(anomaly.Id, model.SpendAnomalyStatusConfirmed, userId, ""); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// ReviewSpendAnomaly 管理员处理异常消费记录
+func ReviewSpendAnomaly(c *gin.Context) {
+	anomaly, ok := getSpendAnomalyParam(c)
+	if !ok {
+		return
+	}
+	var req spendAnomalyReviewRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	status := model.SpendAnomalyStatusResolved
+	var err error
+	switch req.Action {
+	case "dismiss":
+		status = model.SpendAnomalyStatusDismissed
+		err = restoreSuspendedToken(anomaly.TokenId)
+	case "restore":
+		if anomaly.TokenId != 0 {
+			_, err = model.SetTokenStatus(anomaly.TokenId, common.TokenStatusEnabled)
+		}
+	case "disable":
+		if anomaly.TokenId != 0 {
+			_, err = model.SetTokenStatus(anomaly.TokenId, common.TokenStatusDisabled)
+		}
+	default:
+		common.ApiErrorMsg(c, "无效的处理方式")
+		return
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.ReviewSpendAnomaly(anomaly.Id, status, c.GetInt("id"), req.Note); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
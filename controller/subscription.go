@@ -6,6 +6,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -162,6 +163,7 @@ func AdminCreateSubscriptionPlan(c *gin.Context) {
 		return
 	}
 	model.InvalidateSubscriptionPlanCache(req.Plan.Id)
+	service.RecordAudit(c, "subscription_plan.create", "subscription_plan", req.Plan.Id, nil, req.Plan)
 	common.ApiSuccess(c, req.Plan)
 }
 
@@ -219,6 +221,7 @@ func AdminUpdateSubscriptionPlan(c *gin.Context) {
 		common.ApiErrorMsg(c, "自定义重置周期需大于0秒")
 		return
 	}
+	originPlan, _ := model.GetSubscriptionPlanById(id)
 
 	err := model.DB.Transaction(func(tx *gorm.DB) error {
 		// update plan (allow zero values updates with map)
@@ -251,6 +254,9 @@ func AdminUpdateSubscriptionPlan(c *gin.Context) {
 		return
 	}
 	model.InvalidateSubscriptionPlanCache(id)
+	if updatedPlan, err := model.GetSubscriptionPlanById(id); err == nil && originPlan != nil {
+		service.RecordAudit(c, "subscription_plan.update", "subscription_plan", id, originPlan, updatedPlan)
+	}
 	common.ApiSuccess(c, nil)
 }
 
@@ -274,6 +280,7 @@ func AdminUpdateSubscriptionPlanStatus(c *gin.Context) {
 		return
 	}
 	model.InvalidateSubscriptionPlanCache(id)
+	service.RecordAudit(c, "subscription_plan.status", "subscription_plan", id, nil, gin.H{"enabled": *req.Enabled})
 	common.ApiSuccess(c, nil)
 }
 
@@ -187,6 +187,10 @@ func AddToken(c *gin.Context) {
 			return
 		}
 	}
+	if token.EndUserRPM < 0 || token.EndUserTPM < 0 || token.EndUserDailyQuota < 0 {
+		common.ApiErrorI18n(c, i18n.MsgTokenEndUserLimitNegative)
+		return
+	}
 	// 检查用户令牌数量是否已达上限
 	maxTokens := operation_setting.GetMaxUserTokens()
 	count, err := model.CountUserTokens(c.GetInt("id"))
@@ -221,6 +225,10 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		EndUserRPM:         token.EndUserRPM,
+		EndUserTPM:         token.EndUserTPM,
+		EndUserDailyQuota:  token.EndUserDailyQuota,
+		DataResidency:      strings.Join(model.ParseRegions(token.DataResidency), ","),
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -247,15 +255,25 @@ func DeleteToken(c *gin.Context) {
 	})
 }
 
+// UpdateTokenRequest 更新令牌的请求，终端用户限制与驻留区域未传入时保留原值，避免旧客户端或部分更新清空限制
+type UpdateTokenRequest struct {
+	model.Token
+	EndUserRPM        *int    `json:"end_user_rpm"`         // Optional: if nil, keep existing
+	EndUserTPM        *int    `json:"end_user_tpm"`         // Optional: if nil, keep existing
+	EndUserDailyQuota *int    `json:"end_user_daily_quota"` // Optional: if nil, keep existing
+	DataResidency     *string `json:"data_residency"`       // Optional: if nil, keep existing
+}
+
 func UpdateToken(c *gin.Context) {
 	userId := c.GetInt("id")
 	statusOnly := c.Query("status_only")
-	token := model.Token{}
-	err := c.ShouldBindJSON(&token)
+	req := UpdateTokenRequest{}
+	err := c.ShouldBindJSON(&req)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	token := req.Token
 	if len(token.Name) > 50 {
 		common.ApiErrorI18n(c, i18n.MsgTokenNameTooLong)
 		return
@@ -271,6 +289,11 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	if (req.EndUserRPM != nil && *req.EndUserRPM < 0) || (req.EndUserTPM != nil && *req.EndUserTPM < 0) ||
+		(req.EndUserDailyQuota != nil && *req.EndUserDailyQuota < 0) {
+		common.ApiErrorI18n(c, i18n.MsgTokenEndUserLimitNegative)
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		common.ApiError(c, err)
@@ -286,6 +309,11 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	// 异常暂停的令牌需通过确认异常消费恢复
+	if cleanToken.Status == common.TokenStatusSuspended && token.Status != common.TokenStatusSuspended {
+		common.ApiErrorMsg(c, "该令牌因异常消费已暂停，请先确认异常消费记录")
+		return
+	}
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
 	} else {
@@ -299,6 +327,18 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		if req.EndUserRPM != nil {
+			cleanToken.EndUserRPM = *req.EndUserRPM
+		}
+		if req.EndUserTPM != nil {
+			cleanToken.EndUserTPM = *req.EndUserTPM
+		}
+		if req.EndUserDailyQuota != nil {
+			cleanToken.EndUserDailyQuota = *req.EndUserDailyQuota
+		}
+		if req.DataResidency != nil {
+			cleanToken.DataResidency = strings.Join(model.ParseRegions(*req.DataResidency), ",")
+		}
 	}
 	err = cleanToken.Update()
 	if err != nil {
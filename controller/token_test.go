@@ -240,6 +240,75 @@ func TestUpdateTokenMasksKeyInResponse(t *testing.T) {
 	}
 }
 
+func TestUpdateTokenKeepsOmittedEndUserLimits(t *testing.T) {
+	db := setupTokenControllerTestDB(t)
+	token := seedToken(t, db, 1, "limited-token", "ghij1234klmn5678")
+	if err := db.Model(token).Updates(map[string]any{"end_user_rpm": 10, "end_user_daily_quota": 500}).Error; err != nil {
+		t.Fatalf("failed to seed end user limits: %v", err)
+	}
+
+	body := map[string]any{
+		"id":              token.Id,
+		"name":            "renamed-token",
+		"expired_time":    -1,
+		"unlimited_quota": true,
+		"group":           "default",
+		"end_user_rpm":    0,
+	}
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPut, "/api/token/", body, 1)
+	UpdateToken(ctx)
+	if response := decodeAPIResponse(t, recorder); !response.Success {
+		t.Fatalf("expected success response, got message: %s", response.Message)
+	}
+
+	var stored model.Token
+	if err := db.First(&stored, token.Id).Error; err != nil {
+		t.Fatalf("failed to load token: %v", err)
+	}
+	if stored.EndUserRPM != 0 {
+		t.Fatalf("expected explicit end_user_rpm to be applied, got %d", stored.EndUserRPM)
+	}
+	if stored.EndUserDailyQuota != 500 {
+		t.Fatalf("expected omitted end_user_daily_quota to be kept, got %d", stored.EndUserDailyQuota)
+	}
+}
+
+func TestUpdateTokenKeepsOmittedDataResidency(t *testing.T) {
+	db := setupTokenControllerTestDB(t)
+	token := seedToken(t, db, 1, "resident-token", "opqr1234stuv5678")
+	if err := db.Model(token).Update("data_residency", "eu").Error; err != nil {
+		t.Fatalf("failed to seed data residency: %v", err)
+	}
+
+	update := func(body map[string]any) model.Token {
+		t.Helper()
+		body["id"] = token.Id
+		body["name"] = "resident-token"
+		body["expired_time"] = -1
+		body["unlimited_quota"] = true
+		ctx, recorder := newAuthenticatedContext(t, http.MethodPut, "/api/token/", body, 1)
+		UpdateToken(ctx)
+		if response := decodeAPIResponse(t, recorder); !response.Success {
+			t.Fatalf("expected success response, got message: %s", response.Message)
+		}
+		var stored model.Token
+		if err := db.First(&stored, token.Id).Error; err != nil {
+			t.Fatalf("failed to load token: %v", err)
+		}
+		return stored
+	}
+
+	if stored := update(map[string]any{}); stored.DataResidency != "eu" {
+		t.Fatalf("expected omitted data_residency to be kept, got %q", stored.DataResidency)
+	}
+	if stored := update(map[string]any{"data_residency": " US , eu "}); stored.DataResidency != "us,eu" {
+		t.Fatalf("expected data_residency to be normalized, got %q", stored.DataResidency)
+	}
+	if stored := update(map[string]any{"data_residency": ""}); stored.DataResidency != "" {
+		t.Fatalf("expected explicit empty data_residency to clear the policy, got %q", stored.DataResidency)
+	}
+}
+
 func TestGetTokenKeyRequiresOwnershipAndReturnsFullKey(t *testing.T) {
 	db := setupTokenControllerTestDB(t)
 	token := seedToken(t, db, 1, "owned-token", "owner1234token5678")
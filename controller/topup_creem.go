@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"io"
 	"log"
@@ -222,12 +223,35 @@ type CreemWebhookEvent struct {
 			UpdatedAt string `json:"updated_at"`
 			Mode      string `json:"mode"`
 		} `json:"customer"`
+		Subscription struct {
+			Id string `json:"id"`
+		} `json:"subscription"`
 		Status   string            `json:"status"`
 		Metadata map[string]string `json:"metadata"`
 		Mode     string            `json:"mode"`
 	} `json:"object"`
 }
 
+// CreemReversalEvent 退款、争议与订阅取消事件中用到的字段
+type CreemReversalEvent struct {
+	Id        string `json:"id"`
+	EventType string `json:"eventType"`
+	Object    struct {
+		Id           string `json:"id"`
+		RefundAmount int    `json:"refund_amount"`
+		Amount       int    `json:"amount"`
+		Reason       string `json:"reason"`
+		Checkout     struct {
+			RequestId string `json:"request_id"`
+		} `json:"checkout"`
+		Order struct {
+			Id         string `json:"id"`
+			AmountPaid int    `json:"amount_paid"`
+		} `json:"order"`
+		Metadata map[string]string `json:"metadata"`
+	} `json:"object"`
+}
+
 func CreemWebhook(c *gin.Context) {
 	// 读取body内容用于打印，同时保留原始数据供后续使用
 	bodyBytes, err := io.ReadAll(c.Request.Body)
@@ -276,6 +300,8 @@ func CreemWebhook(c *gin.Context) {
 	switch webhookEvent.EventType {
 	case "checkout.completed":
 		handleCheckoutCompleted(c, &webhookEvent)
+	case "refund.created", "dispute.created", "subscription.canceled":
+		handleCreemReversal(c, bodyBytes)
 	default:
 		log.Printf("忽略Creem Webhook事件类型: %s", webhookEvent.EventType)
 		c.Status(http.StatusOK)
@@ -303,6 +329,7 @@ func handleCheckoutCompleted(c *gin.Context, event *CreemWebhookEvent) {
 	LockOrder(referenceId)
 	defer UnlockOrder(referenceId)
 	if err := model.CompleteSubscriptionOrder(referenceId, common.GetJsonString(event)); err == nil {
+		_ = model.SetTopUpProviderReference(referenceId, event.Object.Subscription.Id)
 		c.Status(http.StatusOK)
 		return
 	} else if err != nil && !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
@@ -359,11 +386,62 @@ func handleCheckoutCompleted(c *gin.Context, event *CreemWebhookEvent) {
 		return
 	}
 
+	_ = model.SetTopUpProviderReference(referenceId, event.Object.Order.Id)
+
 	log.Printf("Creem充值成功 - 订单号: %s, 充值额度: %d, 支付金额: %.2f",
 		referenceId, topUp.Amount, topUp.Money)
 	c.Status(http.StatusOK)
 }
 
+// 处理退款、争议与订阅取消事件
+func handleCreemReversal(c *gin.Context, bodyBytes []byte) {
+	var event CreemReversalEvent
+	if err := common.Unmarshal(bodyBytes, &event); err != nil {
+		log.Printf("解析Creem撤销事件失败: %v", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	reversal := model.PaymentReversal{
+		Provider:          PaymentMethodCreem,
+		EventId:           event.Id,
+		TradeNo:           event.Object.Checkout.RequestId,
+		ProviderReference: event.Object.Order.Id,
+		Reason:            event.Object.Reason,
+	}
+	if reversal.TradeNo == "" && event.Object.Metadata != nil {
+		reversal.TradeNo = event.Object.Metadata["reference_id"]
+	}
+	switch event.EventType {
+	case "refund.created":
+		reversal.Kind = model.PaymentReversalRefund
+		// 退款金额按订单实付比例折算为本地订单金额
+		if topUp := model.GetTopUpByTradeNo(reversal.TradeNo); topUp != nil &&
+			event.Object.Order.AmountPaid > 0 && event.Object.RefundAmount > 0 {
+			reversal.Amount = topUp.Money * float64(event.Object.RefundAmount) / float64(event.Object.Order.AmountPaid)
+		}
+		// 无法折算时不按全额扣回，交由管理员核实后手动登记
+		if reversal.Amount <= 0 {
+			service.FlagPaymentReversalForReview(reversal, fmt.Sprintf("无法确定退款金额（refund_amount=%d, amount_paid=%d）",
+				event.Object.RefundAmount, event.Object.Order.AmountPaid))
+			c.Status(http.StatusOK)
+			return
+		}
+	case "dispute.created":
+		reversal.Kind = model.PaymentReversalDispute
+	case "subscription.canceled":
+		reversal.Kind = model.PaymentReversalSubscriptionCancel
+		reversal.ProviderReference = event.Object.Id
+	}
+	if _, err := service.HandlePaymentReversal(reversal); err != nil {
+		log.Printf("处理Creem撤销事件失败: %s %s %v", event.EventType, event.Id, err)
+		if !errors.Is(err, model.ErrPaymentReversalTargetNotFound) {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+	c.Status(http.StatusOK)
+}
+
 type CreemCheckoutRequest struct {
 	ProductId string `json:"product_id"`
 	RequestId string `json:"request_id"`
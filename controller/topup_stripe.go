@@ -12,6 +12,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
@@ -170,6 +171,15 @@ func StripeWebhook(c *gin.Context) {
 		sessionCompleted(event)
 	case stripe.EventTypeCheckoutSessionExpired:
 		sessionExpired(event)
+	case stripe.EventTypeChargeRefunded, stripe.EventTypeChargeDisputeCreated,
+		stripe.EventTypeChargeDisputeClosed, stripe.EventTypeCustomerSubscriptionDeleted:
+		if err := stripeReversal(event); err != nil {
+			log.Printf("处理Stripe撤销事件失败: %s %s %v\n", event.Type, event.ID, err)
+			if !errors.Is(err, model.ErrPaymentReversalTargetNotFound) {
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+		}
 	default:
 		log.Printf("不支持的Stripe Webhook事件类型: %s\n", event.Type)
 	}
@@ -195,7 +205,13 @@ func sessionCompleted(event stripe.Event) {
 		"currency":     strings.ToUpper(event.GetObjectValue("currency")),
 		"event_type":   string(event.Type),
 	}
+	// 退款与争议事件通过 payment_intent 或 subscription 关联订单
+	providerReference := event.GetObjectValue("payment_intent")
+	if providerReference == "" {
+		providerReference = event.GetObjectValue("subscription")
+	}
 	if err := model.CompleteSubscriptionOrder(referenceId, common.GetJsonString(payload)); err == nil {
+		_ = model.SetTopUpProviderReference(referenceId, providerReference)
 		return
 	} else if err != nil && !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
 		log.Println("complete subscription order failed:", err.Error(), referenceId)
@@ -208,11 +224,49 @@ func sessionCompleted(event stripe.Event) {
 		return
 	}
 
+	_ = model.SetTopUpProviderReference(referenceId, providerReference)
+
 	total, _ := strconv.ParseFloat(event.GetObjectValue("amount_total"), 64)
 	currency := strings.ToUpper(event.GetObjectValue("currency"))
 	log.Printf("收到款项：%s, %.2f(%s)", referenceId, total/100, currency)
 }
 
+// stripeReversal 将退款、争议与订阅删除事件转换为支付撤销
+func stripeReversal(event stripe.Event) error {
+	reversal := model.PaymentReversal{
+		Provider:          PaymentMethodStripe,
+		EventId:           event.ID,
+		ProviderReference: event.GetObjectValue("payment_intent"),
+		Reason:            event.GetObjectValue("reason"),
+	}
+	switch event.Type {
+	case stripe.EventTypeChargeRefunded:
+		// amount_refunded 为累计退款金额
+		amount, _ := strconv.ParseFloat(event.GetObjectValue("amount"), 64)
+		refunded, _ := strconv.ParseFloat(event.GetObjectValue("amount_refunded"), 64)
+		if amount <= 0 || refunded <= 0 {
+			return nil
+		}
+		reversal.Kind = model.PaymentReversalRefund
+		reversal.CumulativeRatio = refunded / amount
+	case stripe.EventTypeChargeDisputeCreated:
+		reversal.Kind = model.PaymentReversalDispute
+	case stripe.EventTypeChargeDisputeClosed:
+		if event.GetObjectValue("status") != "won" {
+			return nil
+		}
+		reversal.Kind = model.PaymentReversalDisputeWon
+	case stripe.EventTypeCustomerSubscriptionDeleted:
+		reversal.Kind = model.PaymentReversalSubscriptionCancel
+		reversal.ProviderReference = event.GetObjectValue("id")
+		reversal.Reason = event.GetObjectValue("cancellation_details", "reason")
+	default:
+		return nil
+	}
+	_, err := service.HandlePaymentReversal(reversal)
+	return err
+}
+
 func sessionExpired(event stripe.Event) {
 	referenceId := event.GetObjectValue("client_reference_id")
 	status := event.GetObjectValue("status")
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -330,12 +331,55 @@ func WaffoWebhook(c *gin.Context) {
 		log.Printf("Waffo Webhook - EventType: %s, MerchantOrderId: %s, OrderStatus: %s",
 			event.EventType, payload.Result.MerchantOrderID, payload.Result.OrderStatus)
 		handleWaffoPayment(c, wh, &payload.Result.PaymentNotificationResult)
+	case core.EventRefund:
+		var payload core.RefundNotification
+		if err := common.Unmarshal(bodyBytes, &payload); err != nil || payload.Result == nil {
+			sendWaffoWebhookResponse(c, wh, false, "invalid refund payload")
+			return
+		}
+		handleWaffoRefund(c, wh, payload.Result)
 	default:
 		log.Printf("Waffo Webhook 未知事件: %s", event.EventType)
 		sendWaffoWebhookResponse(c, wh, true, "")
 	}
 }
 
+// handleWaffoRefund 处理退款通知，仅处理已完成的退款
+func handleWaffoRefund(c *gin.Context, wh *core.WebhookHandler, result *core.RefundNotificationResult) {
+	log.Printf("Waffo Webhook - Refund: %s, OrigPaymentRequestId: %s, RefundStatus: %s",
+		result.RefundRequestID, result.OrigPaymentRequestID, result.RefundStatus)
+	reversal := model.PaymentReversal{
+		Provider: "waffo",
+		EventId:  result.AcquiringRefundOrderID,
+		Kind:     model.PaymentReversalRefund,
+		TradeNo:  result.OrigPaymentRequestID,
+		Reason:   result.RefundReason,
+	}
+	if reversal.EventId == "" {
+		reversal.EventId = result.RefundRequestID
+	}
+	switch result.RefundStatus {
+	case core.RefundStatusFullyRefunded:
+		reversal.CumulativeRatio = 1
+	case core.RefundStatusPartiallyRefunded:
+		reversal.Amount, _ = strconv.ParseFloat(result.RefundAmount, 64)
+		if reversal.Amount <= 0 {
+			sendWaffoWebhookResponse(c, wh, true, "")
+			return
+		}
+	default:
+		sendWaffoWebhookResponse(c, wh, true, "")
+		return
+	}
+	if _, err := service.HandlePaymentReversal(reversal); err != nil &&
+		!errors.Is(err, model.ErrPaymentReversalTargetNotFound) {
+		log.Printf("Waffo 退款处理失败: %v, 订单: %s", err, result.OrigPaymentRequestID)
+		sendWaffoWebhookResponse(c, wh, false, "refund processing failed")
+		return
+	}
+	sendWaffoWebhookResponse(c, wh, true, "")
+}
+
 // handleWaffoPayment 处理支付完成通知
 func handleWaffoPayment(c *gin.Context, wh *core.WebhookHandler, result *core.PaymentNotificationResult) {
 	if result.OrderStatus != "PAY_SUCCESS" {
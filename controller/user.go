@@ -60,30 +60,38 @@ func Login(c *gin.Context) {
 	}
 
 	// 检查是否启用2FA
-	if model.IsTwoFAEnabled(user.Id) {
-		// 设置pending session，等待2FA验证
-		session := sessions.Default(c)
-		session.Set("pending_username", user.Username)
-		session.Set("pending_user_id", user.Id)
-		err := session.Save()
-		if err != nil {
-			common.ApiErrorI18n(c, i18n.MsgUserSessionSaveFailed)
-			return
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"message": i18n.T(c, i18n.MsgUserRequire2FA),
-			"success": true,
-			"data": map[string]interface{}{
-				"require_2fa": true,
-			},
-		})
+	if requireTwoFALogin(&user, c) {
 		return
 	}
 
 	setupLogin(&user, c)
 }
 
+// requireTwoFALogin 用户启用 2FA 时设置待验证会话并返回 true，由调用方结束登录流程
+func requireTwoFALogin(user *model.User, c *gin.Context) bool {
+	if !model.IsTwoFAEnabled(user.Id) {
+		return false
+	}
+	// 设置pending session，等待2FA验证
+	session := sessions.Default(c)
+	session.Set("pending_username", user.Username)
+	session.Set("pending_user_id", user.Id)
+	err := session.Save()
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgUserSessionSaveFailed)
+		return true
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": i18n.T(c, i18n.MsgUserRequire2FA),
+		"success": true,
+		"data": map[string]interface{}{
+			"require_2fa": true,
+		},
+	})
+	return true
+}
+
 // setup session & cookies and then return user info
 func setupLogin(user *model.User, c *gin.Context) {
 	session := sessions.Default(c)
@@ -257,6 +265,17 @@ func SearchUsers(c *gin.Context) {
 	return
 }
 
+// canManageUser 超级管理员不受限，其余只能管理级别更低的用户；
+// 通过自定义角色获得管理权限的普通用户只能管理其他未分配自定义角色的普通用户
+func canManageUser(c *gin.Context, target *model.User) bool {
+	myRole := c.GetInt("role")
+	if myRole == common.RoleRootUser || myRole > target.Role {
+		return true
+	}
+	return myRole == common.RoleCommonUser && target.Role == common.RoleCommonUser &&
+		target.Id != c.GetInt("id") && !model.UserHasCustomRoles(target.Id)
+}
+
 func GetUser(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -268,8 +287,7 @@ func GetUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= user.Role && myRole != common.RoleRootUser {
+	if !canManageUser(c, user) {
 		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionSameLevel)
 		return
 	}
@@ -378,9 +396,20 @@ func GetSelf(c *gin.Context) {
 
 	// 计算用户权限信息
 	permissions := calculateUserPermissions(userRole)
+	adminPermissions := make([]string, 0)
+	if set, err := model.GetUserPermissions(id, userRole); err == nil {
+		adminPermissions = set.List()
+	}
 
 	// 获取用户设置并提取sidebar_modules
 	userSetting := user.GetSetting()
+	// 返回解密后的设置，Webhook 密钥仅对用户本人可见
+	settingJSON := user.Setting
+	if settingJSON != "" {
+		if data, err := common.Marshal(userSetting); err == nil {
+			settingJSON = string(data)
+		}
+	}
 
 	// 构建响应数据，包含用户信息和权限
 	responseData := map[string]interface{}{
@@ -393,6 +422,7 @@ func GetSelf(c *gin.Context) {
 		"github_id":         user.GitHubId,
 		"discord_id":        user.DiscordId,
 		"oidc_id":           user.OidcId,
+		"ldap_id":           user.LdapId,
 		"wechat_id":         user.WeChatId,
 		"telegram_id":       user.TelegramId,
 		"group":             user.Group,
@@ -405,10 +435,11 @@ func GetSelf(c *gin.Context) {
 		"aff_history_quota": user.AffHistoryQuota,
 		"inviter_id":        user.InviterId,
 		"linux_do_id":       user.LinuxDOId,
-		"setting":           user.Setting,
+		"setting":           settingJSON,
 		"stripe_customer":   user.StripeCustomer,
 		"sidebar_modules":   userSetting.SidebarModules, // 正确提取sidebar_modules字段
 		"permissions":       permissions,                // 新增权限字段
+		"admin_permissions": adminPermissions,           // 管理后台细粒度权限
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -519,7 +550,7 @@ func GetUserModels(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	groups := service.GetUserUsableGroups(user.Group)
+	groups := service.GetUserUsableGroupsWithSetting(user.Group, user.GetSetting())
 	var models []string
 	for group := range groups {
 		for _, g := range model.GetGroupEnabledModels(group) {
@@ -536,13 +567,20 @@ func GetUserModels(c *gin.Context) {
 	return
 }
 
+// UpdateUserRequest 管理员更新用户的请求，驻留区域未传入时保留原值，避免部分更新放开驻留限制
+type UpdateUserRequest struct {
+	model.User
+	DataResidency *string `json:"data_residency"` // Optional: if nil, keep existing
+}
+
 func UpdateUser(c *gin.Context) {
-	var updatedUser model.User
-	err := json.NewDecoder(c.Request.Body).Decode(&updatedUser)
-	if err != nil || updatedUser.Id == 0 {
+	var req UpdateUserRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Id == 0 {
 		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
 		return
 	}
+	updatedUser := req.User
 	if updatedUser.Password == "" {
 		updatedUser.Password = "$I_LOVE_U" // make Validator happy :)
 	}
@@ -555,15 +593,26 @@ func UpdateUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= originUser.Role && myRole != common.RoleRootUser {
+	if !canManageUser(c, originUser) {
 		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionHigherLevel)
 		return
 	}
-	if myRole <= updatedUser.Role && myRole != common.RoleRootUser {
+	updatedUser.DataResidency = originUser.DataResidency
+	if req.DataResidency != nil {
+		updatedUser.DataResidency = *req.DataResidency
+	}
+	myRole := c.GetInt("role")
+	if updatedUser.Role != originUser.Role && myRole <= updatedUser.Role && myRole != common.RoleRootUser {
 		common.ApiErrorI18n(c, i18n.MsgUserCannotCreateHigherLevel)
 		return
 	}
+	if !model.UserHasPermission(c.GetInt("id"), myRole, constant.PermissionUserWrite) {
+		// 仅有额度调整权限时，除额度外的字段保持不变
+		quota := updatedUser.Quota
+		updatedUser = *originUser
+		updatedUser.Quota = quota
+		updatedUser.Password = ""
+	}
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
@@ -575,6 +624,9 @@ func UpdateUser(c *gin.Context) {
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(originUser.Quota), logger.LogQuota(updatedUser.Quota)))
 	}
+	if user, err := model.GetUserById(originUser.Id, false); err == nil {
+		service.RecordAudit(c, "user.update", "user", originUser.Id, originUser, user)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -601,8 +653,7 @@ func AdminClearUserBinding(c *gin.Context) {
 		return
 	}
 
-	myRole := c.GetInt("role")
-	if myRole <= user.Role && myRole != common.RoleRootUser {
+	if !canManageUser(c, user) {
 		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionSameLevel)
 		return
 	}
@@ -763,8 +814,7 @@ func DeleteUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= originUser.Role {
+	if !canManageUser(c, originUser) || originUser.Role == common.RoleRootUser {
 		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionHigherLevel)
 		return
 	}
@@ -776,6 +826,7 @@ func DeleteUser(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, "user.delete", "user", id, originUser, nil)
 }
 
 func DeleteSelf(c *gin.Context) {
@@ -815,7 +866,8 @@ func CreateUser(c *gin.Context) {
 		user.DisplayName = user.Username
 	}
 	myRole := c.GetInt("role")
-	if user.Role >= myRole {
+	// 通过自定义角色管理用户的普通用户只能创建普通用户
+	if user.Role >= myRole && (myRole >= common.RoleAdminUser || user.Role > common.RoleCommonUser) {
 		common.ApiErrorI18n(c, i18n.MsgUserCannotCreateHigherLevel)
 		return
 	}
@@ -830,6 +882,11 @@ func CreateUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, "user.create", "user", cleanUser.Id, nil, gin.H{
+		"username":     cleanUser.Username,
+		"display_name": cleanUser.DisplayName,
+		"role":         cleanUser.Role,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -861,11 +918,12 @@ func ManageUser(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgUserNotExists)
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= user.Role && myRole != common.RoleRootUser {
+	if !canManageUser(c, &user) {
 		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionHigherLevel)
 		return
 	}
+	myRole := c.GetInt("role")
+	before := gin.H{"role": user.Role, "status": user.Status}
 	switch req.Action {
 	case "disable":
 		user.Status = common.UserStatusDisabled
@@ -913,6 +971,11 @@ func ManageUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if req.Action == "delete" {
+		service.RecordAudit(c, "user.delete", "user", user.Id, before, nil)
+	} else {
+		service.RecordAudit(c, "user."+req.Action, "user", user.Id, before, gin.H{"role": user.Role, "status": user.Status})
+	}
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -1015,7 +1078,7 @@ func TopUp(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	quota, err := model.Redeem(req.Key, id)
+	result, err := model.RedeemWithResult(req.Key, id)
 	if err != nil {
 		if errors.Is(err, model.ErrRedeemFailed) {
 			common.ApiErrorI18n(c, i18n.MsgRedeemFailed)
@@ -1027,7 +1090,8 @@ func TopUp(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    quota,
+		"data":    result.Quota,
+		"reward":  result,
 	})
 }
 
@@ -1139,13 +1203,14 @@ func UpdateUserSetting(c *gin.Context) {
 		upstreamModelUpdateNotifyEnabled = *req.UpstreamModelUpdateNotifyEnabled
 	}
 
-	// 构建设置
+	// 构建设置，身份映射授予的可用分组不允许用户修改
 	settings := dto.UserSetting{
 		NotifyType:                       req.QuotaWarningType,
 		QuotaWarningThreshold:            req.QuotaWarningThreshold,
 		UpstreamModelUpdateNotifyEnabled: upstreamModelUpdateNotifyEnabled,
 		AcceptUnsetRatioModel:            req.AcceptUnsetModelRatioModel,
 		RecordIpLog:                      req.RecordIpLog,
+		ExtraUsableGroups:                existingSettings.ExtraUsableGroups,
 	}
 
 	// 如果是webhook类型,添加webhook相关设置
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type virtualModelEvaluateRequest struct {
+	Model string `json:"model"`
+	model_setting.VirtualModelFeatures
+	// Rules 可选，按草稿规则试算而不影响当前配置
+	Rules *model_setting.VirtualModel `json:"rules,omitempty"`
+}
+
+// EvaluateVirtualModel 按给定的请求特征试算虚拟模型的路由结果（dry-run），不发起任何上游请求
+func EvaluateVirtualModel(c *gin.Context) {
+	var req virtualModelEvaluateRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if req.Model == "" {
+		common.ApiErrorMsg(c, "模型名称不能为空")
+		return
+	}
+
+	// 请求头名称按 HTTP 规范化，与实际请求的匹配方式一致
+	if len(req.Headers) > 0 {
+		headers := make(http.Header, len(req.Headers))
+		for key, values := range req.Headers {
+			for _, value := range values {
+				headers.Add(key, value)
+			}
+		}
+		req.Headers = headers
+	}
+
+	settings := model_setting.GetVirtualModelSettings()
+	if req.Rules != nil {
+		settings = &model_setting.VirtualModelSettings{
+			Enabled: true,
+			Models:  map[string]model_setting.VirtualModel{req.Model: *req.Rules},
+		}
+	} else if !settings.IsVirtualModel(req.Model) {
+		common.ApiErrorMsg(c, "虚拟模型不存在或未启用")
+		return
+	}
+
+	target, rule, ok := settings.Resolve(req.Model, req.VirtualModelFeatures, nil)
+	if !ok {
+		common.ApiSuccess(c, gin.H{
+			"model":   req.Model,
+			"matched": false,
+		})
+		return
+	}
+	modelPrice, usePrice := ratio_setting.GetModelPrice(target, false)
+	modelRatio, ratioConfigured, _ := ratio_setting.GetModelRatio(target)
+	common.ApiSuccess(c, gin.H{
+		"model":            req.Model,
+		"matched":          true,
+		"resolved_model":   target,
+		"rule":             rule,
+		"use_price":        usePrice,
+		"model_price":      modelPrice,
+		"model_ratio":      modelRatio,
+		"completion_ratio": ratio_setting.GetCompletionRatio(target),
+		"price_configured": usePrice || ratioConfigured,
+	})
+}
@@ -7,6 +7,22 @@ type ChannelSettings struct {
 	PassThroughBodyEnabled bool   `json:"pass_through_body_enabled,omitempty"`
 	SystemPrompt           string `json:"system_prompt,omitempty"`
 	SystemPromptOverride   bool   `json:"system_prompt_override,omitempty"`
+	EmulateTools           bool   `json:"emulate_tools,omitempty"` // 上游不支持原生 function calling 时，由网关通过提示词模拟工具调用
+	// Capacity 渠道容量限制，选择渠道时跳过已满的渠道
+	Capacity *ChannelCapacity `json:"capacity,omitempty"`
+}
+
+// ChannelCapacity 渠道与单个密钥的并发、RPM、TPM 上限，0 表示不限制
+type ChannelCapacity struct {
+	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	RPM            int `json:"rpm,omitempty"`
+	TPM            int `json:"tpm,omitempty"`
+	// 多密钥渠道中每个密钥的上限
+	KeyMaxConcurrency int `json:"key_max_concurrency,omitempty"`
+	KeyRPM            int `json:"key_rpm,omitempty"`
+	KeyTPM            int `json:"key_tpm,omitempty"`
+	// LearnFromHeaders 未配置 RPM/TPM 时从上游 x-ratelimit-* 响应头学习
+	LearnFromHeaders bool `json:"learn_from_headers,omitempty"`
 }
 
 type VertexKeyType string
@@ -40,6 +56,31 @@ type ChannelOtherSettings struct {
 	UpstreamModelUpdateLastDetectedModels []string      `json:"upstream_model_update_last_detected_models,omitempty"` // 上次检测到的可加入模型
 	UpstreamModelUpdateLastRemovedModels  []string      `json:"upstream_model_update_last_removed_models,omitempty"`  // 上次检测到的可删除模型
 	UpstreamModelUpdateIgnoredModels      []string      `json:"upstream_model_update_ignored_models,omitempty"`       // 手动忽略的模型
+	// ClaudePromptCache 渠道级自动 prompt caching 策略，优先级高于分组策略
+	ClaudePromptCache *ClaudePromptCacheSettings `json:"claude_prompt_cache,omitempty"`
+	// Regions 渠道上游所在区域标签（如 eu、eu-west-1、us），用于数据驻留策略筛选渠道
+	Regions []string `json:"regions,omitempty"`
+}
+
+const (
+	ClaudePromptCacheTTL5m = "5m"
+	ClaudePromptCacheTTL1h = "1h"
+)
+
+// ClaudePromptCacheSettings 自动为 Claude 请求注入 cache_control 断点
+type ClaudePromptCacheSettings struct {
+	Enabled        bool   `json:"enabled"`
+	TTL            string `json:"ttl,omitempty"`              // "5m" (默认) 或 "1h"
+	CacheSystem    bool   `json:"cache_system,omitempty"`     // 在 system 提示词末尾放置断点
+	CacheTools     bool   `json:"cache_tools,omitempty"`      // 在工具定义末尾放置断点
+	CacheLastTurns int    `json:"cache_last_turns,omitempty"` // 在最后 N 条消息上放置断点
+}
+
+func (s *ClaudePromptCacheSettings) GetTTL() string {
+	if s == nil || s.TTL != ClaudePromptCacheTTL1h {
+		return ClaudePromptCacheTTL5m
+	}
+	return ClaudePromptCacheTTL1h
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
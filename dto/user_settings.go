@@ -1,21 +1,36 @@
 package dto
 
 type UserSetting struct {
-	NotifyType                       string  `json:"notify_type,omitempty"`                          // QuotaWarningType 额度预警类型
-	QuotaWarningThreshold            float64 `json:"quota_warning_threshold,omitempty"`              // QuotaWarningThreshold 额度预警阈值
-	WebhookUrl                       string  `json:"webhook_url,omitempty"`                          // WebhookUrl webhook地址
-	WebhookSecret                    string  `json:"webhook_secret,omitempty"`                       // WebhookSecret webhook密钥
-	NotificationEmail                string  `json:"notification_email,omitempty"`                   // NotificationEmail 通知邮箱地址
-	BarkUrl                          string  `json:"bark_url,omitempty"`                             // BarkUrl Bark推送URL
-	GotifyUrl                        string  `json:"gotify_url,omitempty"`                           // GotifyUrl Gotify服务器地址
-	GotifyToken                      string  `json:"gotify_token,omitempty"`                         // GotifyToken Gotify应用令牌
-	GotifyPriority                   int     `json:"gotify_priority"`                                // GotifyPriority Gotify消息优先级
-	UpstreamModelUpdateNotifyEnabled bool    `json:"upstream_model_update_notify_enabled,omitempty"` // 是否接收上游模型更新定时检测通知（仅管理员）
-	AcceptUnsetRatioModel            bool    `json:"accept_unset_model_ratio_model,omitempty"`       // AcceptUnsetRatioModel 是否接受未设置价格的模型
-	RecordIpLog                      bool    `json:"record_ip_log,omitempty"`                        // 是否记录请求和错误日志IP
-	SidebarModules                   string  `json:"sidebar_modules,omitempty"`                      // SidebarModules 左侧边栏模块配置
-	BillingPreference                string  `json:"billing_preference,omitempty"`                   // BillingPreference 扣费策略（订阅/钱包）
-	Language                         string  `json:"language,omitempty"`                             // Language 用户语言偏好 (zh, en)
+	NotifyType                       string   `json:"notify_type,omitempty"`                          // QuotaWarningType 额度预警类型
+	QuotaWarningThreshold            float64  `json:"quota_warning_threshold,omitempty"`              // QuotaWarningThreshold 额度预警阈值
+	WebhookUrl                       string   `json:"webhook_url,omitempty"`                          // WebhookUrl webhook地址
+	WebhookSecret                    string   `json:"webhook_secret,omitempty"`                       // WebhookSecret webhook密钥
+	NotificationEmail                string   `json:"notification_email,omitempty"`                   // NotificationEmail 通知邮箱地址
+	BarkUrl                          string   `json:"bark_url,omitempty"`                             // BarkUrl Bark推送URL
+	GotifyUrl                        string   `json:"gotify_url,omitempty"`                           // GotifyUrl Gotify服务器地址
+	GotifyToken                      string   `json:"gotify_token,omitempty"`                         // GotifyToken Gotify应用令牌
+	GotifyPriority                   int      `json:"gotify_priority"`                                // GotifyPriority Gotify消息优先级
+	UpstreamModelUpdateNotifyEnabled bool     `json:"upstream_model_update_notify_enabled,omitempty"` // 是否接收上游模型更新定时检测通知（仅管理员）
+	AcceptUnsetRatioModel            bool     `json:"accept_unset_model_ratio_model,omitempty"`       // AcceptUnsetRatioModel 是否接受未设置价格的模型
+	RecordIpLog                      bool     `json:"record_ip_log,omitempty"`                        // 是否记录请求和错误日志IP
+	SidebarModules                   string   `json:"sidebar_modules,omitempty"`                      // SidebarModules 左侧边栏模块配置
+	BillingPreference                string   `json:"billing_preference,omitempty"`                   // BillingPreference 扣费策略（订阅/钱包）
+	Language                         string   `json:"language,omitempty"`                             // Language 用户语言偏好 (zh, en)
+	ExtraUsableGroups                []string `json:"extra_usable_groups,omitempty"`                  // ExtraUsableGroups 身份提供方声明映射授予的额外可用分组，登录时同步
+}
+
+// IdentityMapping 身份提供方（OIDC、LDAP 等）按声明映射得到的用户属性，每次登录时同步到用户
+type IdentityMapping struct {
+	// Group 网关分组，为空表示不修改
+	Group string
+	// Roles 角色名称，内置的 admin 角色会将用户设为管理员，其余为自定义角色
+	Roles []string
+	// UsableGroups 额外可用分组
+	UsableGroups []string
+	// SyncRoles 为 true 时按 Roles 覆盖用户角色，未配置角色映射的提供方不修改角色
+	SyncRoles bool
+	// SyncUsableGroups 为 true 时按 UsableGroups 覆盖额外可用分组
+	SyncUsableGroups bool
 }
 
 var (
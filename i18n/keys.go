@@ -42,6 +42,7 @@ const (
 	MsgTokenExhausted            = "token.exhausted"
 	MsgTokenStatusUnavailable    = "token.status_unavailable"
 	MsgTokenDbError              = "token.db_error"
+	MsgTokenEndUserLimitNegative = "token.end_user_limit_negative"
 )
 
 // Redemption related messages
@@ -278,6 +279,8 @@ const (
 	MsgOAuthTokenFailed     = "oauth.token_failed"
 	MsgOAuthUserInfoEmpty   = "oauth.user_info_empty"
 	MsgOAuthTrustLevelLow   = "oauth.trust_level_low"
+	MsgOAuthInvalidLogin    = "oauth.invalid_login"
+	MsgOAuthScimLinkRefused = "oauth.scim_link_refused"
 )
 
 // Model layer error messages (for translation in controller)
@@ -302,6 +305,10 @@ const (
 	MsgDistributorNoAvailableChannel  = "distributor.no_available_channel"
 	MsgDistributorInvalidMidjourney   = "distributor.invalid_midjourney_request"
 	MsgDistributorInvalidParseModel   = "distributor.invalid_request_parse_model"
+	MsgDistributorEndUserLimited      = "distributor.end_user_limited"
+	MsgDistributorResidencyConflict   = "distributor.data_residency_conflict"
+	MsgDistributorNoResidentChannel   = "distributor.no_resident_channel"
+	MsgDistributorChannelNotResident  = "distributor.channel_not_resident"
 )
 
 // Custom OAuth provider related messages
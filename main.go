@@ -93,6 +93,9 @@ func main() {
 	// 热更新配置
 	go model.SyncOptions(common.SyncFrequency)
 
+	// 跨实例缓存失效广播，未启用 Redis 时依赖上面的定期同步
+	common.StartInvalidationBus()
+
 	// 数据看板
 	go model.UpdateQuotaData()
 
@@ -112,6 +115,24 @@ func main() {
 	// Subscription quota reset task (daily/weekly/monthly/custom)
 	service.StartSubscriptionQuotaResetTask()
 
+	// Quota ledger reconciliation against user balances
+	service.StartQuotaLedgerReconcileTask()
+
+	// Expire prepaid credit buckets
+	service.StartCreditBucketExpireTask()
+
+	// Restore temporary groups granted by redemption campaigns
+	service.StartRedemptionGroupGrantTask()
+
+	// Month-end statement emails
+	service.StartMonthlyStatementTask()
+
+	// Spend anomaly detection and token suspension
+	service.StartSpendAnomalyTask()
+
+	// Audit log retention cleanup
+	service.StartAuditLogCleanupTask()
+
 	// Wire task polling adaptor factory (breaks service -> relay import cycle)
 	service.GetTaskAdaptorFunc = func(platform constant.TaskPlatform) service.TaskPollingAdaptor {
 		a := relay.GetTaskAdaptor(platform)
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const auditBodyLimit = 64 << 10
+
+// AuditManagement 为经过管理权限校验的写操作补充审计记录，接口已显式记录变更时不重复记录
+func AuditManagement() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		var body []byte
+		if c.Request.Body != nil && c.Request.ContentLength > 0 && c.Request.ContentLength <= auditBodyLimit {
+			body, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		c.Next()
+		if c.GetBool(service.AuditRequiredKey) && !c.GetBool(service.AuditRecordedKey) {
+			service.RecordAuditRequest(c, body)
+		}
+	}
+}
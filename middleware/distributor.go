@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -16,6 +17,8 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
@@ -25,6 +28,12 @@ import (
 type ModelRequest struct {
 	Model string `json:"model"`
 	Group string `json:"group,omitempty"`
+	// Models 客户端指定的备选模型列表（OpenRouter 风格），在启用模型回退时生效
+	Models []string `json:"models,omitempty"`
+	// 终端用户标识：OpenAI user / safety_identifier，Claude metadata.user_id
+	User             json.RawMessage `json:"user,omitempty"`
+	SafetyIdentifier json.RawMessage `json:"safety_identifier,omitempty"`
+	Metadata         json.RawMessage `json:"metadata,omitempty"`
 }
 
 func Distribute() func(c *gin.Context) {
@@ -36,6 +45,9 @@ func Distribute() func(c *gin.Context) {
 			abortWithOpenAiMessage(c, http.StatusBadRequest, i18n.T(c, i18n.MsgDistributorInvalidRequest, map[string]any{"Error": err.Error()}))
 			return
 		}
+		if !setupEndUser(c, modelRequest) {
+			return
+		}
 		if ok {
 			id, err := strconv.Atoi(channelId.(string))
 			if err != nil {
@@ -51,6 +63,13 @@ func Distribute() func(c *gin.Context) {
 				abortWithOpenAiMessage(c, http.StatusForbidden, i18n.T(c, i18n.MsgDistributorChannelDisabled))
 				return
 			}
+			if !setupDataResidency(c, common.GetContextKeyString(c, constant.ContextKeyUsingGroup)) {
+				return
+			}
+			if !model.ChannelSatisfiesResidency(channel, service.GetDataResidencyRegions(c)) {
+				abortWithOpenAiMessage(c, http.StatusForbidden, i18n.T(c, i18n.MsgDistributorChannelNotResident, map[string]any{"ChannelId": channel.Id}), types.ErrorCodeDataResidencyUnsatisfied)
+				return
+			}
 		} else {
 			// Select a channel for the user
 			// check token model mapping
@@ -99,9 +118,19 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
-				if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
+				if !setupDataResidency(c, usingGroup) {
+					return
+				}
+				service.InitModelFallbackChain(c, usingGroup, modelRequest.Model, modelRequest.Models)
+
+				// 虚拟模型需要在预估 token 后才能解析为具体模型，渠道在 relay 中选择
+				virtualModel := model_setting.GetVirtualModelSettings().IsVirtualModel(modelRequest.Model)
+				if virtualModel {
+					common.SetContextKey(c, constant.ContextKeyVirtualModel, modelRequest.Model)
+				} else if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
 					preferred, err := model.CacheGetChannel(preferredChannelID)
-					if err == nil && preferred != nil {
+					// 亲和渠道不满足数据驻留策略时按常规流程重新选择
+					if err == nil && preferred != nil && model.ChannelSatisfiesResidency(preferred, service.GetDataResidencyRegions(c)) {
 						if preferred.Status != common.ChannelStatusEnabled {
 							if service.ShouldSkipRetryAfterChannelAffinityFailure(c) {
 								abortWithOpenAiMessage(c, http.StatusForbidden, i18n.T(c, i18n.MsgDistributorChannelDisabled))
@@ -127,13 +156,20 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
-				if channel == nil {
+				if channel == nil && !virtualModel {
 					channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
 						Ctx:        c,
 						ModelName:  modelRequest.Model,
 						TokenGroup: usingGroup,
 						Retry:      common.GetPointer(0),
 					})
+					if channel == nil {
+						// 当前模型没有可用渠道时，按回退链尝试备选模型
+						if fallbackChannel, fallbackGroup, fallbackModel := selectFallbackChannel(c, modelRequest.Model, usingGroup); fallbackChannel != nil {
+							channel, selectGroup, err = fallbackChannel, fallbackGroup, nil
+							modelRequest.Model = fallbackModel
+						}
+					}
 					if err != nil {
 						showGroup := usingGroup
 						if usingGroup == "auto" {
@@ -149,6 +185,11 @@ func Distribute() func(c *gin.Context) {
 						return
 					}
 					if channel == nil {
+						// 存在驻留策略时不放宽到其他区域，直接拒绝
+						if regions := service.GetDataResidencyRegions(c); len(regions) > 0 {
+							abortWithOpenAiMessage(c, http.StatusServiceUnavailable, i18n.T(c, i18n.MsgDistributorNoResidentChannel, map[string]any{"Group": usingGroup, "Model": modelRequest.Model, "Regions": strings.Join(regions, ",")}), types.ErrorCodeDataResidencyUnsatisfied)
+							return
+						}
 						abortWithOpenAiMessage(c, http.StatusServiceUnavailable, i18n.T(c, i18n.MsgDistributorNoAvailableChannel, map[string]any{"Group": usingGroup, "Model": modelRequest.Model}), types.ErrorCodeModelNotFound)
 						return
 					}
@@ -164,6 +205,94 @@ func Distribute() func(c *gin.Context) {
 	}
 }
 
+// selectFallbackChannel 依次为回退链中的备选模型选择渠道，返回第一个可用的渠道
+func selectFallbackChannel(c *gin.Context, requestedModel string, usingGroup string) (*model.Channel, string, string) {
+	for {
+		fallbackModel, ok := service.NextModelFallback(c)
+		if !ok {
+			return nil, "", ""
+		}
+		// 切换模型后自动分组需要从第一个分组重新选择
+		common.SetContextKey(c, constant.ContextKeyAutoGroupIndex, 0)
+		channel, selectGroup, err := service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
+			Ctx:        c,
+			ModelName:  fallbackModel,
+			TokenGroup: usingGroup,
+			Retry:      common.GetPointer(0),
+		})
+		if err != nil || channel == nil {
+			continue
+		}
+		service.MarkModelFallback(c, requestedModel, fallbackModel)
+		return channel, selectGroup, fallbackModel
+	}
+}
+
+// rawJSONString 读取字符串类型的 JSON 字段，其他类型返回空
+func rawJSONString(raw json.RawMessage) string {
+	var value string
+	if len(raw) == 0 || common.Unmarshal(raw, &value) != nil {
+		return ""
+	}
+	return value
+}
+
+// getEndUserId 依次从配置的请求头、safety_identifier、user 与 metadata.user_id 读取终端用户标识
+func getEndUserId(c *gin.Context, modelRequest *ModelRequest) string {
+	if header := operation_setting.GetEndUserSetting().HeaderName; header != "" {
+		if id := c.GetHeader(header); id != "" {
+			return id
+		}
+	}
+	if id := rawJSONString(modelRequest.SafetyIdentifier); id != "" {
+		return id
+	}
+	if id := rawJSONString(modelRequest.User); id != "" {
+		return id
+	}
+	var metadata struct {
+		UserId json.RawMessage `json:"user_id"`
+	}
+	if len(modelRequest.Metadata) > 0 && common.Unmarshal(modelRequest.Metadata, &metadata) == nil {
+		return rawJSONString(metadata.UserId)
+	}
+	return ""
+}
+
+// setupDataResidency 判定请求的数据驻留策略，各来源策略冲突时拒绝请求
+func setupDataResidency(c *gin.Context, usingGroup string) bool {
+	decision, err := service.ResolveDataResidency(c, usingGroup)
+	if err != nil {
+		abortWithOpenAiMessage(c, http.StatusForbidden, i18n.T(c, i18n.MsgDistributorResidencyConflict), types.ErrorCodeDataResidencyUnsatisfied)
+		return false
+	}
+	if decision != nil {
+		common.SetContextKey(c, constant.ContextKeyDataResidency, decision)
+	}
+	return true
+}
+
+// setupEndUser 记录终端用户标识并检查令牌的终端用户限制，未通过时中止请求；未开启终端用户识别时跳过
+func setupEndUser(c *gin.Context, modelRequest *ModelRequest) bool {
+	if !operation_setting.GetEndUserSetting().Enabled {
+		return true
+	}
+	endUser := service.NormalizeEndUserId(getEndUserId(c, modelRequest))
+	if endUser == "" {
+		return true
+	}
+	common.SetContextKey(c, constant.ContextKeyEndUser, endUser)
+	limit, ok := common.GetContextKeyType[model.EndUserLimit](c, constant.ContextKeyTokenEndUserLimit)
+	if !ok {
+		return true
+	}
+	if exceeded := model.AcquireEndUserLimit(common.GetContextKeyInt(c, constant.ContextKeyTokenId), endUser, limit); exceeded != "" {
+		abortWithOpenAiMessage(c, http.StatusTooManyRequests, i18n.T(c, i18n.MsgDistributorEndUserLimited, map[string]any{"Limit": exceeded}), types.ErrorCodeEndUserLimitExceeded)
+		return false
+	}
+	return true
+}
+
 // getModelFromRequest 从请求中读取模型信息
 // 根据 Content-Type 自动处理：
 // - application/json
@@ -276,6 +405,10 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 			return nil, false, err
 		}
 		modelRequest.Model = req.Model
+		modelRequest.Models = req.Models
+		modelRequest.User = req.User
+		modelRequest.SafetyIdentifier = req.SafetyIdentifier
+		modelRequest.Metadata = req.Metadata
 	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
 		//wss://api.openai.com/v1/realtime?model=gpt-4o-realtime-preview-2024-10-01
@@ -332,6 +465,7 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 			return nil, false, err
 		}
 		modelRequest.Model = req.Model
+		modelRequest.Models = req.Models
 		modelRequest.Group = req.Group
 		common.SetContextKey(c, constant.ContextKeyTokenGroup, modelRequest.Group)
 	}
@@ -347,6 +481,10 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	if channel == nil {
 		return types.NewError(errors.New("channel is nil"), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
 	}
+	if !model.ChannelSatisfiesResidency(channel, service.GetDataResidencyRegions(c)) {
+		return types.NewErrorWithStatusCode(fmt.Errorf("channel #%d does not satisfy the data residency policy", channel.Id), types.ErrorCodeDataResidencyUnsatisfied, http.StatusForbidden, types.ErrOptionWithSkipRetry())
+	}
+	service.MarkDataResidencyChannel(c, channel)
 	common.SetContextKey(c, constant.ContextKeyChannelId, channel.Id)
 	common.SetContextKey(c, constant.ContextKeyChannelName, channel.Name)
 	common.SetContextKey(c, constant.ContextKeyChannelType, channel.Type)
@@ -203,3 +203,12 @@ func SearchRateLimit() func(c *gin.Context) {
 	}
 	return userRateLimitFactory(common.SearchRateLimitNum, common.SearchRateLimitDuration, "SR")
 }
+
+// RedeemRateLimit returns a per-user rate limiter for the redemption code endpoint.
+// Configurable via REDEEM_RATE_LIMIT_ENABLE / REDEEM_RATE_LIMIT / REDEEM_RATE_LIMIT_DURATION.
+func RedeemRateLimit() func(c *gin.Context) {
+	if !common.RedeemRateLimitEnable {
+		return defNext
+	}
+	return userRateLimitFactory(common.RedeemRateLimitNum, common.RedeemRateLimitDuration, "RD")
+}
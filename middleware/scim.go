@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIMAuth 校验身份提供方的 Bearer 密钥，未启用 SCIM 时接口不可用
+func SCIMAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := system_setting.GetSCIMSettings()
+		if !settings.Enabled || settings.BearerSecret == "" {
+			abortWithSCIMError(c, service.NewSCIMError(http.StatusNotFound, "", "SCIM provisioning is not enabled"))
+			return
+		}
+		token := strings.TrimSpace(c.Request.Header.Get("Authorization"))
+		if len(token) < 7 || !strings.EqualFold(token[:7], "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token[7:])), []byte(settings.BearerSecret)) != 1 {
+			abortWithSCIMError(c, service.NewSCIMError(http.StatusUnauthorized, "", "invalid bearer token"))
+			return
+		}
+		// 审计日志中以 scim 作为操作者
+		c.Set("username", "scim")
+		c.Next()
+	}
+}
+
+func abortWithSCIMError(c *gin.Context, err *service.SCIMError) {
+	c.Header("Content-Type", dto.SCIMContentType)
+	c.AbortWithStatusJSON(err.Status, err.Response())
+}
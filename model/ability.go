@@ -3,6 +3,7 @@ package model
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -58,91 +59,104 @@ func GetAllEnableAbilities() []Ability {
 	return abilities
 }
 
-func getPriority(group string, model string, retry int) (int, error) {
-
-	var priorities []int
-	err := DB.Model(&Ability{}).
-		Select("DISTINCT(priority)").
-		Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true).
-		Order("priority DESC").              // 按优先级降序排序
-		Pluck("priority", &priorities).Error // Pluck用于将查询的结果直接扫描到一个切片中
-
-	if err != nil {
-		// 处理错误
-		return 0, err
-	}
-
-	if len(priorities) == 0 {
-		// 如果没有查询到优先级，则返回错误
-		return 0, errors.New("数据库一致性被破坏")
+// withChannelIds 限定候选渠道，channelIds 为 nil 时不限制
+func withChannelIds(tx *gorm.DB, channelIds []int) *gorm.DB {
+	if channelIds == nil {
+		return tx
 	}
-
-	// 确定要使用的优先级
-	var priorityToUse int
-	if retry >= len(priorities) {
-		// 如果重试次数大于优先级数，则使用最小的优先级
-		priorityToUse = priorities[len(priorities)-1]
-	} else {
-		priorityToUse = priorities[retry]
-	}
-	return priorityToUse, nil
+	return tx.Where("channel_id IN ?", channelIds)
 }
 
-func getChannelQuery(group string, model string, retry int) (*gorm.DB, error) {
-	maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true)
-	channelQuery := DB.Where(commonGroupCol+" = ? and model = ? and enabled = ? and priority = (?)", group, model, true, maxPrioritySubQuery)
-	if retry != 0 {
-		priority, err := getPriority(group, model, retry)
+// GetChannel 从数据库选择渠道，按 abilities 中的优先级与权重选择并跳过已达容量上限的渠道，选中后只加载该渠道；
+// regions 不为空时只在满足数据驻留策略的渠道中选择，excludedChannelIds 中的渠道不参与选择
+func GetChannel(group string, model string, retry int, regions []string, excludedChannelIds []int) (*Channel, error) {
+	var err error
+	var channelIds []int
+	if len(regions) > 0 {
+		channelIds, err = getResidentChannelIdsDB(group, model, regions)
 		if err != nil {
 			return nil, err
-		} else {
-			channelQuery = DB.Where(commonGroupCol+" = ? and model = ? and enabled = ? and priority = ?", group, model, true, priority)
+		}
+		if len(channelIds) == 0 {
+			return nil, nil
 		}
 	}
-
-	return channelQuery, nil
-}
-
-func GetChannel(group string, model string, retry int) (*Channel, error) {
+	query := withChannelIds(DB.Select("channel_id", "priority", "weight").
+		Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true), channelIds)
+	if len(excludedChannelIds) > 0 {
+		query = query.Where("channel_id NOT IN ?", excludedChannelIds)
+	}
 	var abilities []Ability
-
-	var err error = nil
-	channelQuery, err := getChannelQuery(group, model, retry)
-	if err != nil {
+	if err = query.Find(&abilities).Error; err != nil || len(abilities) == 0 {
 		return nil, err
 	}
-	if common.UsingSQLite || common.UsingPostgreSQL {
-		err = channelQuery.Order("weight DESC").Find(&abilities).Error
-	} else {
-		err = channelQuery.Order("weight DESC").Find(&abilities).Error
+	tiers := groupAbilitiesByPriority(abilities)
+	if retry >= len(tiers) {
+		retry = len(tiers) - 1
 	}
+	available, err := abilityChannelsWithCapacity(lo.Flatten(tiers[retry:]))
 	if err != nil {
 		return nil, err
 	}
-	channel := Channel{}
-	if len(abilities) > 0 {
-		// Randomly choose one
-		weightSum := uint(0)
-		for _, ability_ := range abilities {
-			weightSum += ability_.Weight + 10
+	// 当前优先级全部已满时依次尝试更低优先级，均已满时仍按原优先级选择，由调用方在占用名额时拒绝
+	selected := tiers[retry]
+	for _, tier := range tiers[retry:] {
+		if availableAbilities := lo.Filter(tier, func(ability Ability, _ int) bool {
+			return available[ability.ChannelId]
+		}); len(availableAbilities) > 0 {
+			selected = availableAbilities
+			break
 		}
-		// Randomly choose one
-		weight := common.GetRandomInt(int(weightSum))
-		for _, ability_ := range abilities {
-			weight -= int(ability_.Weight) + 10
-			//log.Printf("weight: %d, ability weight: %d", weight, *ability_.Weight)
-			if weight <= 0 {
-				channel.Id = ability_.ChannelId
-				break
-			}
-		}
-	} else {
-		return nil, nil
 	}
-	err = DB.First(&channel, "id = ?", channel.Id).Error
+	channel := Channel{}
+	err = DB.First(&channel, "id = ?", pickAbilityByWeight(selected).ChannelId).Error
 	return &channel, err
 }
 
+// groupAbilitiesByPriority 按优先级从高到低分组
+func groupAbilitiesByPriority(abilities []Ability) [][]Ability {
+	byPriority := make(map[int64][]Ability)
+	for _, ability := range abilities {
+		priority := lo.FromPtr(ability.Priority)
+		byPriority[priority] = append(byPriority[priority], ability)
+	}
+	priorities := lo.Keys(byPriority)
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] > priorities[j] })
+	tiers := make([][]Ability, 0, len(priorities))
+	for _, priority := range priorities {
+		tiers = append(tiers, byPriority[priority])
+	}
+	return tiers
+}
+
+// abilityChannelsWithCapacity 只加载容量检查需要的列，返回仍有余量的渠道
+func abilityChannelsWithCapacity(abilities []Ability) (map[int]bool, error) {
+	var channels []*Channel
+	err := DB.Select("id", "setting", "channel_info").
+		Where("id IN ?", lo.Map(abilities, func(ability Ability, _ int) int { return ability.ChannelId })).
+		Find(&channels).Error
+	if err != nil {
+		return nil, err
+	}
+	return channelsWithCapacity(channels, channelDefaultConcurrency()), nil
+}
+
+// pickAbilityByWeight 按权重随机选择，每个渠道额外加 10 的平滑权重
+func pickAbilityByWeight(abilities []Ability) Ability {
+	weightSum := 0
+	for _, ability := range abilities {
+		weightSum += int(ability.Weight) + 10
+	}
+	weight := common.GetRandomInt(weightSum)
+	for _, ability := range abilities {
+		weight -= int(ability.Weight) + 10
+		if weight < 0 {
+			return ability
+		}
+	}
+	return abilities[len(abilities)-1]
+}
+
 func (channel *Channel) AddAbilities(tx *gorm.DB) error {
 	models_ := strings.Split(channel.Models, ",")
 	groups_ := strings.Split(channel.Group, ",")
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+// AuditLog 管理操作审计记录，与使用日志分表存储、分开清理
+type AuditLog struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	ActorId    int    `json:"actor_id" gorm:"index"`
+	ActorName  string `json:"actor_name" gorm:"type:varchar(64)"`
+	ActorRole  int    `json:"actor_role"`
+	Ip         string `json:"ip" gorm:"type:varchar(64)"`
+	Method     string `json:"method" gorm:"type:varchar(16)"`
+	Route      string `json:"route" gorm:"type:varchar(255)"`
+	Action     string `json:"action" gorm:"type:varchar(64);index"`
+	TargetType string `json:"target_type" gorm:"type:varchar(32);index"`
+	TargetId   string `json:"target_id" gorm:"type:varchar(64);index"`
+	// Diff 变更字段的前后值，JSON 格式，敏感字段已脱敏
+	Diff       string `json:"diff" gorm:"type:text"`
+	StatusCode int    `json:"status_code"`
+}
+
+// AuditLogQuery 审计日志查询条件
+type AuditLogQuery struct {
+	ActorId        int
+	Action         string
+	TargetType     string
+	TargetId       string
+	Keyword        string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func (l *AuditLog) Insert() error {
+	if l.CreatedAt == 0 {
+		l.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(l).Error
+}
+
+func GetAuditLogs(query AuditLogQuery, startIdx int, num int) (logs []*AuditLog, total int64, err error) {
+	tx := DB.Model(&AuditLog{})
+	if query.ActorId != 0 {
+		tx = tx.Where("actor_id = ?", query.ActorId)
+	}
+	if query.Action != "" {
+		tx = tx.Where("action = ?", query.Action)
+	}
+	if query.TargetType != "" {
+		tx = tx.Where("target_type = ?", query.TargetType)
+	}
+	if query.TargetId != "" {
+		tx = tx.Where("target_id = ?", query.TargetId)
+	}
+	if query.Keyword != "" {
+		keyword := "%" + query.Keyword + "%"
+		tx = tx.Where("(route LIKE ? OR diff LIKE ? OR actor_name LIKE ?)", keyword, keyword, keyword)
+	}
+	if query.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTimestamp)
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTimestamp)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
+
+// DeleteAuditLogsBefore 删除指定时间之前的审计日志
+func DeleteAuditLogsBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", timestamp).Delete(&AuditLog{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLogQueryAndRetention(t *testing.T) {
+	truncateTables(t)
+
+	require.NoError(t, (&AuditLog{CreatedAt: 100, ActorId: 1, Action: "channel.update", TargetType: "channel", TargetId: "7", Route: "/api/channel/", Diff: `{"name":{}}`}).Insert())
+	require.NoError(t, (&AuditLog{CreatedAt: 200, ActorId: 2, Action: "option.update", TargetType: "option", TargetId: "ModelRatio", Route: "/api/option/"}).Insert())
+	require.NoError(t, (&AuditLog{CreatedAt: 300, ActorId: 1, Action: "request", TargetType: "redemption", Route: "/api/redemption/"}).Insert())
+
+	logs, total, err := GetAuditLogs(AuditLogQuery{ActorId: 1}, 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Equal(t, "request", logs[0].Action)
+
+	_, total, err = GetAuditLogs(AuditLogQuery{TargetType: "channel", TargetId: "7", Keyword: "name"}, 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+
+	_, total, err = GetAuditLogs(AuditLogQuery{ActorId: 1, Keyword: "redemption", StartTimestamp: 150}, 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+
+	n, err := DeleteAuditLogsBefore(250)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -21,7 +22,7 @@ import (
 type Channel struct {
 	Id                 int     `json:"id"`
 	Type               int     `json:"type" gorm:"default:0"`
-	Key                string  `json:"key" gorm:"not null"`
+	Key                string  `json:"key" gorm:"not null;serializer:secret"`
 	OpenAIOrganization *string `json:"openai_organization"`
 	TestModel          *string `json:"test_model"`
 	Status             int     `json:"status" gorm:"default:1"`
@@ -144,6 +145,20 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	if len(enabledIdx) == 0 {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
+	// 跳过已达容量上限的密钥，全部已满时仍从启用的密钥中选择
+	if getChannelCapacity(channel) != nil {
+		availableIdx := channelKeysWithCapacity(channel, enabledIdx)
+		if len(availableIdx) > 0 && len(availableIdx) < len(enabledIdx) {
+			enabledIdx = availableIdx
+			// 轮询模式下已满的密钥视为暂不可用
+			getStatus = func(idx int) int {
+				if lo.Contains(availableIdx, idx) {
+					return common.ChannelStatusEnabled
+				}
+				return common.ChannelStatusAutoDisabled
+			}
+		}
+	}
 
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
@@ -289,6 +304,17 @@ func GetChannelsByTag(tag string, idSort bool, selectAll bool) ([]*Channel, erro
 	return channels, err
 }
 
+// channelKeywordCondition 按 ID、名称、密钥与 Base URL 匹配关键字；启用密钥加密后库中为密文，
+// 无法按明文比对，此时不再按密钥搜索
+func channelKeywordCondition(keyword string, baseURLCol string) (string, []interface{}) {
+	if common.SecretEncryptionKeyId() != "" {
+		return "(id = ? OR name LIKE ? OR " + baseURLCol + " LIKE ?)",
+			[]interface{}{common.String2Int(keyword), "%" + keyword + "%", "%" + keyword + "%"}
+	}
+	return "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?)",
+		[]interface{}{common.String2Int(keyword), "%" + keyword + "%", keyword, "%" + keyword + "%"}
+}
+
 func SearchChannels(keyword string, group string, model string, idSort bool) ([]*Channel, error) {
 	var channels []*Channel
 	modelsCol := "`models`"
@@ -323,11 +349,13 @@ func SearchChannels(keyword string, group string, model string, idSort bool) ([]
 			// sqlite, PostgreSQL
 			groupCondition = `(',' || ` + commonGroupCol + ` || ',') LIKE ?`
 		}
-		whereClause = "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%", "%,"+group+",%")
+		whereClause, args = channelKeywordCondition(keyword, baseURLCol)
+		whereClause += " AND " + modelsCol + ` LIKE ? AND ` + groupCondition
+		args = append(args, "%"+model+"%", "%,"+group+",%")
 	} else {
-		whereClause = "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%")
+		whereClause, args = channelKeywordCondition(keyword, baseURLCol)
+		whereClause += " AND " + modelsCol + " LIKE ?"
+		args = append(args, "%"+model+"%")
 	}
 
 	// 执行查询
@@ -675,6 +703,10 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 			common.SysLog(fmt.Sprintf("failed to update channel status: channel_id=%d, status=%d, error=%v", channel.Id, status, err))
 			return false
 		}
+		if channel.ChannelInfo.IsMultiKey {
+			// 多 Key 的状态列表保存在渠道信息中，其他实例需重新加载该渠道
+			common.PublishInvalidation(common.InvalidationChannel, strconv.Itoa(channel.Id))
+		}
 	}
 	return true
 }
@@ -818,11 +850,13 @@ func SearchTags(keyword string, group string, model string, idSort bool) ([]*str
 			// sqlite, PostgreSQL
 			groupCondition = `(',' || ` + commonGroupCol + ` || ',') LIKE ?`
 		}
-		whereClause = "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%", "%,"+group+",%")
+		whereClause, args = channelKeywordCondition(keyword, baseURLCol)
+		whereClause += " AND " + modelsCol + ` LIKE ? AND ` + groupCondition
+		args = append(args, "%"+model+"%", "%,"+group+",%")
 	} else {
-		whereClause = "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%")
+		whereClause, args = channelKeywordCondition(keyword, baseURLCol)
+		whereClause += " AND " + modelsCol + " LIKE ?"
+		args = append(args, "%"+model+"%")
 	}
 
 	subQuery := baseQuery.Where(whereClause, args...).
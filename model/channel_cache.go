@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 )
 
@@ -18,10 +20,16 @@ var group2model2channels map[string]map[string][]int // enabled channel
 var channelsIDM map[int]*Channel                     // all channels include disabled
 var channelSyncLock sync.RWMutex
 
+// InitChannelCache 从数据库重新加载渠道缓存，并通知其他实例
 func InitChannelCache() {
 	if !common.MemoryCacheEnabled {
 		return
 	}
+	loadChannelCache()
+	common.PublishInvalidation(common.InvalidationChannel, "")
+}
+
+func loadChannelCache() {
 	newChannelId2channel := make(map[int]*Channel)
 	var channels []*Channel
 	DB.Find(&channels)
@@ -89,74 +97,112 @@ func SyncChannelCache(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Second)
 		common.SysLog("syncing channels from database")
-		InitChannelCache()
+		loadChannelCache()
 	}
 }
 
-func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+// GetRandomSatisfiedChannel 按优先级与权重选择渠道，regions 不为空时先过滤出满足数据驻留策略的渠道，
+// excludedChannelIds 为本次请求已确认无余量的渠道
+func GetRandomSatisfiedChannel(group string, model string, retry int, regions []string, excludedChannelIds []int) (*Channel, error) {
 	// if memory cache is disabled, get channel directly from database
 	if !common.MemoryCacheEnabled {
-		return GetChannel(group, model, retry)
+		return GetChannel(group, model, retry, regions, excludedChannelIds)
 	}
 
+	channels, err := getCachedChannels(group, model, regions, excludedChannelIds)
+	if err != nil || len(channels) == 0 {
+		return nil, err
+	}
+	// 容量在渠道缓存锁外批量读取，只有一个渠道时同样检查
+	return selectChannelByPriority(groupChannelsByPriority(channels), retry)
+}
+
+// getCachedChannels 在渠道缓存锁内取出分组模型下满足驻留策略且未被排除的候选渠道
+func getCachedChannels(group string, model string, regions []string, excludedChannelIds []int) ([]*Channel, error) {
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
 
 	// First, try to find channels with the exact model name.
-	channels := group2model2channels[group][model]
+	channelIds := group2model2channels[group][model]
 
 	// If no channels found, try to find channels with the normalized model name.
-	if len(channels) == 0 {
+	if len(channelIds) == 0 {
 		normalizedModel := ratio_setting.FormatMatchingModelName(model)
-		channels = group2model2channels[group][normalizedModel]
-	}
-
-	if len(channels) == 0 {
-		return nil, nil
+		channelIds = group2model2channels[group][normalizedModel]
 	}
 
-	if len(channels) == 1 {
-		if channel, ok := channelsIDM[channels[0]]; ok {
-			return channel, nil
+	channelIds = filterResidentChannelIds(channelIds, regions)
+	channels := make([]*Channel, 0, len(channelIds))
+	for _, channelId := range channelIds {
+		if slices.Contains(excludedChannelIds, channelId) {
+			continue
 		}
-		return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channels[0])
-	}
-
-	uniquePriorities := make(map[int]bool)
-	for _, channelId := range channels {
-		if channel, ok := channelsIDM[channelId]; ok {
-			uniquePriorities[int(channel.GetPriority())] = true
-		} else {
+		channel, ok := channelsIDM[channelId]
+		if !ok {
 			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
 		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+// groupChannelsByPriority 按优先级从高到低分组
+func groupChannelsByPriority(channels []*Channel) [][]*Channel {
+	byPriority := make(map[int64][]*Channel)
+	for _, channel := range channels {
+		priority := channel.GetPriority()
+		byPriority[priority] = append(byPriority[priority], channel)
+	}
+	priorities := make([]int64, 0, len(byPriority))
+	for priority := range byPriority {
+		priorities = append(priorities, priority)
 	}
-	var sortedUniquePriorities []int
-	for priority := range uniquePriorities {
-		sortedUniquePriorities = append(sortedUniquePriorities, priority)
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] > priorities[j] })
+	tiers := make([][]*Channel, 0, len(priorities))
+	for _, priority := range priorities {
+		tiers = append(tiers, byPriority[priority])
 	}
-	sort.Sort(sort.Reverse(sort.IntSlice(sortedUniquePriorities)))
+	return tiers
+}
 
-	if retry >= len(uniquePriorities) {
-		retry = len(uniquePriorities) - 1
+// selectChannelByPriority 从 retry 对应的优先级开始按权重选择，跳过已达容量上限的渠道，当前优先级全部已满时依次尝试更低优先级；
+// 所有渠道均已满时仍按原优先级选择，由调用方在占用名额时拒绝。tiers 不能为空，调用方不应持有 channelSyncLock
+func selectChannelByPriority(tiers [][]*Channel, retry int) (*Channel, error) {
+	if retry >= len(tiers) {
+		retry = len(tiers) - 1
+	}
+	candidates := make([]*Channel, 0)
+	for _, tier := range tiers[retry:] {
+		candidates = append(candidates, tier...)
 	}
-	targetPriority := int64(sortedUniquePriorities[retry])
-
-	// get the priority for the given retry number
-	var sumWeight = 0
-	var targetChannels []*Channel
-	for _, channelId := range channels {
-		if channel, ok := channelsIDM[channelId]; ok {
-			if channel.GetPriority() == targetPriority {
-				sumWeight += channel.GetWeight()
-				targetChannels = append(targetChannels, channel)
+	available := channelsWithCapacity(candidates, channelDefaultConcurrency())
+	for _, tier := range tiers[retry:] {
+		availableChannels := make([]*Channel, 0, len(tier))
+		for _, channel := range tier {
+			if available[channel.Id] {
+				availableChannels = append(availableChannels, channel)
 			}
-		} else {
-			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
+		}
+		if len(availableChannels) > 0 {
+			return pickChannelByWeight(availableChannels)
 		}
 	}
+	return pickChannelByWeight(tiers[retry])
+}
 
-	if len(targetChannels) == 0 {
-		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
+// channelDefaultConcurrency 启用准入排队时的渠道默认并发上限
+func channelDefaultConcurrency() int {
+	if setting := operation_setting.GetAdmissionQueueSetting(); setting.Enabled {
+		return setting.ChannelConcurrency
+	}
+	return 0
+}
+
+// pickChannelByWeight 按权重随机选择渠道
+func pickChannelByWeight(targetChannels []*Channel) (*Channel, error) {
+	sumWeight := 0
+	for _, channel := range targetChannels {
+		sumWeight += channel.GetWeight()
 	}
 
 	// smoothing factor and adjustment
@@ -222,10 +268,16 @@ func CacheGetChannelInfo(id int) (*ChannelInfo, error) {
 	return &c.ChannelInfo, nil
 }
 
+// CacheUpdateChannelStatus 更新缓存中的渠道状态，并通知其他实例
 func CacheUpdateChannelStatus(id int, status int) {
 	if !common.MemoryCacheEnabled {
 		return
 	}
+	cacheUpdateChannelStatus(id, status)
+	common.PublishInvalidation(common.InvalidationChannelStatus, fmt.Sprintf("%d:%d", id, status))
+}
+
+func cacheUpdateChannelStatus(id int, status int) {
 	channelSyncLock.Lock()
 	defer channelSyncLock.Unlock()
 	if channel, ok := channelsIDM[id]; ok {
@@ -0,0 +1,552 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// 并发租约的过期时间，实例异常退出或漏释放的名额到期后自动回收
+	channelCapacityLeaseTTL   = 10 * time.Minute
+	channelCapacityWindowTTL  = 2 * time.Minute
+	channelCapacityLearnedTTL = time.Hour
+)
+
+// channelCapacityScope 一个计数单位：整个渠道或多密钥渠道中的单个密钥
+type channelCapacityScope struct {
+	name        string
+	concurrency int
+	rpm         int
+	tpm         int
+	learn       bool
+}
+
+// ChannelCapacityUsage 渠道或密钥的当前用量
+type ChannelCapacityUsage struct {
+	Scope       string `json:"scope"`
+	Concurrency int64  `json:"concurrency"`
+	RPM         int64  `json:"rpm"`
+	TPM         int64  `json:"tpm"`
+	Blocked     bool   `json:"blocked"`
+	LearnedRPM  int64  `json:"learned_rpm"`
+	LearnedTPM  int64  `json:"learned_tpm"`
+}
+
+func (s channelCapacityScope) keys(now time.Time) []string {
+	minute := now.Unix() / 60
+	prefix := "channel_cap:" + s.name
+	return []string{
+		prefix + ":leases",
+		fmt.Sprintf("%s:rpm:%d", prefix, minute),
+		fmt.Sprintf("%s:tpm:%d", prefix, minute),
+		prefix + ":block",
+		prefix + ":learned_rpm",
+		prefix + ":learned_tpm",
+	}
+}
+
+func (s channelCapacityScope) limited() bool {
+	return s.concurrency > 0 || s.rpm > 0 || s.tpm > 0 || s.learn
+}
+
+// hasCapacity 根据用量判断是否还能接收请求
+func (s channelCapacityScope) hasCapacity(usage ChannelCapacityUsage) bool {
+	if usage.Blocked {
+		return false
+	}
+	rpm, tpm := int64(s.rpm), int64(s.tpm)
+	if s.learn {
+		if rpm == 0 {
+			rpm = usage.LearnedRPM
+		}
+		if tpm == 0 {
+			tpm = usage.LearnedTPM
+		}
+	}
+	if s.concurrency > 0 && usage.Concurrency >= int64(s.concurrency) {
+		return false
+	}
+	if rpm > 0 && usage.RPM >= rpm {
+		return false
+	}
+	if tpm > 0 && usage.TPM >= tpm {
+		return false
+	}
+	return true
+}
+
+func channelScopeName(channelId int) string {
+	return strconv.Itoa(channelId)
+}
+
+func channelKeyScopeName(channelId int, keyIndex int) string {
+	return fmt.Sprintf("%d:%d", channelId, keyIndex)
+}
+
+// getChannelCapacity 读取渠道容量配置，未配置时返回 nil
+func getChannelCapacity(channel *Channel) *dto.ChannelCapacity {
+	if channel.Setting == nil || !strings.Contains(*channel.Setting, "capacity") {
+		return nil
+	}
+	return channel.GetSetting().Capacity
+}
+
+// channelScopes 返回渠道级与密钥级的计数单位，defaultConcurrency 用于未配置并发上限的渠道
+func channelScopes(channel *Channel, keyIndex int, defaultConcurrency int) []channelCapacityScope {
+	capacity := getChannelCapacity(channel)
+	if capacity == nil {
+		capacity = &dto.ChannelCapacity{}
+	}
+	channelScope := channelCapacityScope{
+		name:        channelScopeName(channel.Id),
+		concurrency: capacity.MaxConcurrency,
+		rpm:         capacity.RPM,
+		tpm:         capacity.TPM,
+	}
+	if channelScope.concurrency == 0 {
+		channelScope.concurrency = defaultConcurrency
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		// 单密钥渠道的上游限制即渠道限制
+		channelScope.learn = capacity.LearnFromHeaders
+		return []channelCapacityScope{channelScope}
+	}
+	keyScope := channelCapacityScope{
+		name:        channelKeyScopeName(channel.Id, keyIndex),
+		concurrency: capacity.KeyMaxConcurrency,
+		rpm:         capacity.KeyRPM,
+		tpm:         capacity.KeyTPM,
+		learn:       capacity.LearnFromHeaders,
+	}
+	return []channelCapacityScope{channelScope, keyScope}
+}
+
+// channelCapacityStore 计数存储，启用 Redis 时多实例共享
+type channelCapacityStore interface {
+	usage(scopes []channelCapacityScope) ([]ChannelCapacityUsage, error)
+	acquire(scopes []channelCapacityScope, tokens int, lease string) (bool, error)
+	release(scopes []channelCapacityScope, lease string)
+	set(key string, value int64, ttl time.Duration)
+}
+
+func getChannelCapacityStore() channelCapacityStore {
+	if common.RedisEnabled && common.RDB != nil {
+		return redisChannelCapacityStore{}
+	}
+	return memoryCapacityStore
+}
+
+func usageFromValues(scope string, values []int64, blocked bool) ChannelCapacityUsage {
+	return ChannelCapacityUsage{
+		Scope:       scope,
+		Concurrency: max(values[0], 0),
+		RPM:         values[1],
+		TPM:         values[2],
+		Blocked:     blocked,
+		LearnedRPM:  values[4],
+		LearnedTPM:  values[5],
+	}
+}
+
+type redisChannelCapacityStore struct{}
+
+// 并发名额为有序集合中的租约，分值为过期时间（毫秒），检查前先清理过期租约；
+// 检查所有计数单位均有余量后再统一计数，保证多实例下不超限
+var channelCapacityAcquireScript = redis.NewScript(`
+local now = tonumber(ARGV[2])
+local n = #KEYS / 6
+for i = 0, n - 1 do
+	local k = i * 6
+	local a = 5 + i * 4
+	if redis.call('EXISTS', KEYS[k + 4]) == 1 then return 0 end
+	redis.call('ZREMRANGEBYSCORE', KEYS[k + 1], '-inf', now)
+	local conc = tonumber(ARGV[a + 1])
+	local rpm = tonumber(ARGV[a + 2])
+	local tpm = tonumber(ARGV[a + 3])
+	if ARGV[a + 4] == '1' then
+		if rpm == 0 then rpm = tonumber(redis.call('GET', KEYS[k + 5]) or '0') end
+		if tpm == 0 then tpm = tonumber(redis.call('GET', KEYS[k + 6]) or '0') end
+	end
+	if conc > 0 and redis.call('ZCARD', KEYS[k + 1]) >= conc then return 0 end
+	if rpm > 0 and tonumber(redis.call('GET', KEYS[k + 2]) or '0') >= rpm then return 0 end
+	if tpm > 0 and tonumber(redis.call('GET', KEYS[k + 3]) or '0') >= tpm then return 0 end
+end
+for i = 0, n - 1 do
+	local k = i * 6
+	redis.call('ZADD', KEYS[k + 1], now + tonumber(ARGV[3]), ARGV[5])
+	redis.call('PEXPIRE', KEYS[k + 1], ARGV[3])
+	redis.call('INCR', KEYS[k + 2])
+	redis.call('EXPIRE', KEYS[k + 2], ARGV[4])
+	redis.call('INCRBY', KEYS[k + 3], ARGV[1])
+	redis.call('EXPIRE', KEYS[k + 3], ARGV[4])
+end
+return 1
+`)
+
+// usage 通过一次管道读取全部计数单位，并发数只统计未过期的租约
+func (redisChannelCapacityStore) usage(scopes []channelCapacityScope) ([]ChannelCapacityUsage, error) {
+	ctx := context.Background()
+	now := time.Now()
+	minLease := "(" + strconv.FormatInt(now.UnixMilli(), 10)
+	pipe := common.RDB.Pipeline()
+	leaseCmds := make([]*redis.IntCmd, len(scopes))
+	valueCmds := make([]*redis.SliceCmd, len(scopes))
+	for i, scope := range scopes {
+		keys := scope.keys(now)
+		leaseCmds[i] = pipe.ZCount(ctx, keys[0], minLease, "+inf")
+		valueCmds[i] = pipe.MGet(ctx, keys[1:]...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	usages := make([]ChannelCapacityUsage, len(scopes))
+	for i, scope := range scopes {
+		values := make([]int64, 6)
+		values[0] = leaseCmds[i].Val()
+		blocked := false
+		for j, result := range valueCmds[i].Val() {
+			if result == nil {
+				continue
+			}
+			if j+1 == 3 {
+				blocked = true
+				continue
+			}
+			if str, ok := result.(string); ok {
+				values[j+1], _ = strconv.ParseInt(str, 10, 64)
+			}
+		}
+		usages[i] = usageFromValues(scope.name, values, blocked)
+	}
+	return usages, nil
+}
+
+func (redisChannelCapacityStore) acquire(scopes []channelCapacityScope, tokens int, lease string) (bool, error) {
+	now := time.Now()
+	keys := make([]string, 0, len(scopes)*6)
+	args := []interface{}{tokens, now.UnixMilli(), channelCapacityLeaseTTL.Milliseconds(), int(channelCapacityWindowTTL.Seconds()), lease}
+	for _, scope := range scopes {
+		keys = append(keys, scope.keys(now)...)
+		learn := "0"
+		if scope.learn {
+			learn = "1"
+		}
+		args = append(args, scope.concurrency, scope.rpm, scope.tpm, learn)
+	}
+	result, err := channelCapacityAcquireScript.Run(context.Background(), common.RDB, keys, args...).Int()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+func (redisChannelCapacityStore) release(scopes []channelCapacityScope, lease string) {
+	now := time.Now()
+	pipe := common.RDB.Pipeline()
+	for _, scope := range scopes {
+		pipe.ZRem(context.Background(), scope.keys(now)[0], lease)
+	}
+	if _, err := pipe.Exec(context.Background()); err != nil {
+		common.SysError("failed to release channel capacity: " + err.Error())
+	}
+}
+
+func (redisChannelCapacityStore) set(key string, value int64, ttl time.Duration) {
+	if err := common.RDB.Set(context.Background(), key, value, ttl).Err(); err != nil {
+		common.SysError("failed to update channel capacity: " + err.Error())
+	}
+}
+
+// localChannelCapacityStore 未启用 Redis 时的单实例计数，过期数据在读取时淘汰，并定期清理不再访问的键
+type localChannelCapacityStore struct {
+	mu        sync.Mutex
+	values    map[string]int64
+	expires   map[string]time.Time
+	leases    map[string]map[string]time.Time // 并发键 -> 租约 -> 过期时间
+	nextSweep time.Time
+}
+
+var memoryCapacityStore = &localChannelCapacityStore{
+	values:  make(map[string]int64),
+	expires: make(map[string]time.Time),
+	leases:  make(map[string]map[string]time.Time),
+}
+
+func (s *localChannelCapacityStore) getLocked(key string, now time.Time) (int64, bool) {
+	if expire, ok := s.expires[key]; ok && !now.Before(expire) {
+		delete(s.values, key)
+		delete(s.expires, key)
+	}
+	value, ok := s.values[key]
+	return value, ok
+}
+
+func (s *localChannelCapacityStore) incrLocked(key string, delta int64, ttl time.Duration, now time.Time) {
+	value, _ := s.getLocked(key, now)
+	s.values[key] = value + delta
+	s.expires[key] = now.Add(ttl)
+}
+
+// leaseCountLocked 清理过期租约并返回未过期的租约数
+func (s *localChannelCapacityStore) leaseCountLocked(key string, now time.Time) int64 {
+	leases := s.leases[key]
+	for lease, expire := range leases {
+		if !now.Before(expire) {
+			delete(leases, lease)
+		}
+	}
+	if len(leases) == 0 {
+		delete(s.leases, key)
+	}
+	return int64(len(leases))
+}
+
+// sweepLocked 每个计数窗口最多全量清理一次
+func (s *localChannelCapacityStore) sweepLocked(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(channelCapacityWindowTTL)
+	for key, expire := range s.expires {
+		if !now.Before(expire) {
+			delete(s.values, key)
+			delete(s.expires, key)
+		}
+	}
+	for key := range s.leases {
+		s.leaseCountLocked(key, now)
+	}
+}
+
+func (s *localChannelCapacityStore) usageLocked(scopes []channelCapacityScope, now time.Time) []ChannelCapacityUsage {
+	usages := make([]ChannelCapacityUsage, len(scopes))
+	for i, scope := range scopes {
+		keys := scope.keys(now)
+		values := make([]int64, 6)
+		values[0] = s.leaseCountLocked(keys[0], now)
+		for j := 1; j < len(keys); j++ {
+			values[j], _ = s.getLocked(keys[j], now)
+		}
+		_, blocked := s.getLocked(keys[3], now)
+		usages[i] = usageFromValues(scope.name, values, blocked)
+	}
+	return usages
+}
+
+func (s *localChannelCapacityStore) usage(scopes []channelCapacityScope) ([]ChannelCapacityUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usageLocked(scopes, time.Now()), nil
+}
+
+func (s *localChannelCapacityStore) acquire(scopes []channelCapacityScope, tokens int, lease string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweepLocked(now)
+	for i, usage := range s.usageLocked(scopes, now) {
+		if !scopes[i].hasCapacity(usage) {
+			return false, nil
+		}
+	}
+	for _, scope := range scopes {
+		keys := scope.keys(now)
+		if s.leases[keys[0]] == nil {
+			s.leases[keys[0]] = make(map[string]time.Time)
+		}
+		s.leases[keys[0]][lease] = now.Add(channelCapacityLeaseTTL)
+		s.incrLocked(keys[1], 1, channelCapacityWindowTTL, now)
+		s.incrLocked(keys[2], int64(tokens), channelCapacityWindowTTL, now)
+	}
+	return true, nil
+}
+
+func (s *localChannelCapacityStore) release(scopes []channelCapacityScope, lease string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, scope := range scopes {
+		key := scope.keys(now)[0]
+		delete(s.leases[key], lease)
+		s.leaseCountLocked(key, now)
+	}
+}
+
+func (s *localChannelCapacityStore) set(key string, value int64, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.expires[key] = time.Now().Add(ttl)
+}
+
+// channelsWithCapacity 一次读取全部候选渠道及其启用密钥的用量，返回各渠道是否还有余量；
+// 多密钥渠道需至少一个启用的密钥有余量，读取失败时视为有余量，避免 Redis 故障导致无渠道可用
+func channelsWithCapacity(channels []*Channel, defaultConcurrency int) map[int]bool {
+	type scopeRange struct{ start, keyStart, end int }
+	scopes := make([]channelCapacityScope, 0, len(channels))
+	ranges := make([]scopeRange, len(channels))
+	for i, channel := range channels {
+		channelScopes := channelScopes(channel, 0, defaultConcurrency)
+		ranges[i].start = len(scopes)
+		if channelScopes[0].limited() {
+			scopes = append(scopes, channelScopes[0])
+		}
+		ranges[i].keyStart = len(scopes)
+		if len(channelScopes) > 1 && channelScopes[1].limited() {
+			keyScope := channelScopes[1]
+			for idx := range capacityKeyCount(channel) {
+				if status, ok := channel.ChannelInfo.MultiKeyStatusList[idx]; ok && status != common.ChannelStatusEnabled {
+					continue
+				}
+				keyScope.name = channelKeyScopeName(channel.Id, idx)
+				scopes = append(scopes, keyScope)
+			}
+		}
+		ranges[i].end = len(scopes)
+	}
+
+	var usages []ChannelCapacityUsage
+	if len(scopes) > 0 {
+		var err error
+		if usages, err = getChannelCapacityStore().usage(scopes); err != nil {
+			common.SysError("failed to read channel capacity: " + err.Error())
+			usages = nil
+		}
+	}
+	available := make(map[int]bool, len(channels))
+	for i, channel := range channels {
+		if usages == nil {
+			available[channel.Id] = true
+			continue
+		}
+		r := ranges[i]
+		ok := true
+		for j := r.start; j < r.keyStart; j++ {
+			if !scopes[j].hasCapacity(usages[j]) {
+				ok = false
+			}
+		}
+		if ok && r.keyStart < r.end {
+			ok = false
+			for j := r.keyStart; j < r.end; j++ {
+				if scopes[j].hasCapacity(usages[j]) {
+					ok = true
+					break
+				}
+			}
+		}
+		available[channel.Id] = ok
+	}
+	return available
+}
+
+// capacityKeyCount 多密钥渠道的密钥数量，只加载了 channel_info 时取 MultiKeySize
+func capacityKeyCount(channel *Channel) int {
+	if channel.Key == "" {
+		return channel.ChannelInfo.MultiKeySize
+	}
+	return len(channel.GetKeys())
+}
+
+// ChannelHasCapacity 判断渠道是否还有余量，多密钥渠道需至少一个启用的密钥有余量
+func ChannelHasCapacity(channel *Channel, defaultConcurrency int) bool {
+	return channelsWithCapacity([]*Channel{channel}, defaultConcurrency)[channel.Id]
+}
+
+// channelKeysWithCapacity 返回多密钥渠道中仍有余量的密钥
+func channelKeysWithCapacity(channel *Channel, indexes []int) []int {
+	scopes := channelScopes(channel, 0, 0)
+	if len(scopes) < 2 || !scopes[1].limited() {
+		return indexes
+	}
+	keyScopes := make([]channelCapacityScope, len(indexes))
+	for i, idx := range indexes {
+		keyScopes[i] = scopes[1]
+		keyScopes[i].name = channelKeyScopeName(channel.Id, idx)
+	}
+	usages, err := getChannelCapacityStore().usage(keyScopes)
+	if err != nil {
+		common.SysError("failed to read channel capacity: " + err.Error())
+		return indexes
+	}
+	available := make([]int, 0, len(indexes))
+	for i, usage := range usages {
+		if keyScopes[i].hasCapacity(usage) {
+			available = append(available, indexes[i])
+		}
+	}
+	return available
+}
+
+// AcquireChannelCapacity 以一个新租约占用渠道与密钥的并发、RPM、TPM 名额，返回释放函数
+func AcquireChannelCapacity(channel *Channel, keyIndex int, tokens int, defaultConcurrency int) (func(), bool) {
+	scopes := channelScopes(channel, keyIndex, defaultConcurrency)
+	limited := make([]channelCapacityScope, 0, len(scopes))
+	for _, scope := range scopes {
+		if scope.limited() {
+			limited = append(limited, scope)
+		}
+	}
+	if len(limited) == 0 {
+		return func() {}, true
+	}
+	store := getChannelCapacityStore()
+	lease := common.GetUUID()
+	ok, err := store.acquire(limited, tokens, lease)
+	if err != nil {
+		common.SysError("failed to acquire channel capacity: " + err.Error())
+		return func() {}, true
+	}
+	if !ok {
+		return nil, false
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { store.release(limited, lease) })
+	}, true
+}
+
+// SetChannelLearnedLimits 记录从上游响应头学习到的 RPM/TPM，0 表示未知
+func SetChannelLearnedLimits(channelId int, keyIndex int, isMultiKey bool, rpm int64, tpm int64) {
+	scope := channelCapacityScope{name: channelScopeName(channelId)}
+	if isMultiKey {
+		scope.name = channelKeyScopeName(channelId, keyIndex)
+	}
+	keys := scope.keys(time.Now())
+	store := getChannelCapacityStore()
+	if rpm > 0 {
+		store.set(keys[4], rpm, channelCapacityLearnedTTL)
+	}
+	if tpm > 0 {
+		store.set(keys[5], tpm, channelCapacityLearnedTTL)
+	}
+}
+
+// BlockChannelCapacity 上游额度耗尽时在重置前暂停使用该渠道或密钥
+func BlockChannelCapacity(channelId int, keyIndex int, isMultiKey bool, d time.Duration) {
+	scope := channelCapacityScope{name: channelScopeName(channelId)}
+	if isMultiKey {
+		scope.name = channelKeyScopeName(channelId, keyIndex)
+	}
+	getChannelCapacityStore().set(scope.keys(time.Now())[3], 1, d)
+}
+
+// GetChannelCapacityUsage 返回渠道及其各密钥的当前用量
+func GetChannelCapacityUsage(channel *Channel) ([]ChannelCapacityUsage, error) {
+	scopes := []channelCapacityScope{{name: channelScopeName(channel.Id)}}
+	if channel.ChannelInfo.IsMultiKey {
+		for i := range channel.GetKeys() {
+			scopes = append(scopes, channelCapacityScope{name: channelKeyScopeName(channel.Id, i)})
+		}
+	}
+	return getChannelCapacityStore().usage(scopes)
+}
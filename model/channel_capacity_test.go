@@ -0,0 +1,165 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/stretchr/testify/require"
+)
+
+func newCapacityChannel(id int, priority int64, capacity *dto.ChannelCapacity) *Channel {
+	channel := &Channel{Id: id, Status: common.ChannelStatusEnabled, Priority: &priority}
+	channel.SetSetting(dto.ChannelSettings{Capacity: capacity})
+	return channel
+}
+
+func TestChannelCapacityAcquireRelease(t *testing.T) {
+	channel := newCapacityChannel(9101, 0, &dto.ChannelCapacity{MaxConcurrency: 1, RPM: 2})
+
+	release, ok := AcquireChannelCapacity(channel, 0, 10, 0)
+	require.True(t, ok)
+	_, ok = AcquireChannelCapacity(channel, 0, 10, 0)
+	require.False(t, ok, "concurrency cap reached")
+	require.False(t, ChannelHasCapacity(channel, 0))
+
+	release()
+	release()
+	release, ok = AcquireChannelCapacity(channel, 0, 10, 0)
+	require.True(t, ok)
+	release()
+	_, ok = AcquireChannelCapacity(channel, 0, 10, 0)
+	require.False(t, ok, "rpm cap reached")
+}
+
+func TestChannelCapacityLearnedAndBlocked(t *testing.T) {
+	channel := newCapacityChannel(9102, 0, &dto.ChannelCapacity{LearnFromHeaders: true})
+	require.True(t, ChannelHasCapacity(channel, 0))
+
+	SetChannelLearnedLimits(channel.Id, 0, false, 0, 100)
+	release, ok := AcquireChannelCapacity(channel, 0, 150, 0)
+	require.True(t, ok)
+	release()
+	require.False(t, ChannelHasCapacity(channel, 0), "learned tpm reached")
+
+	other := newCapacityChannel(9103, 0, &dto.ChannelCapacity{LearnFromHeaders: true})
+	BlockChannelCapacity(other.Id, 0, false, time.Minute)
+	_, ok = AcquireChannelCapacity(other, 0, 1, 0)
+	require.False(t, ok)
+}
+
+func TestGetRandomSatisfiedChannelSkipsFullChannels(t *testing.T) {
+	high := newCapacityChannel(9201, 10, &dto.ChannelCapacity{MaxConcurrency: 1})
+	low := newCapacityChannel(9202, 0, nil)
+
+	channelSyncLock.Lock()
+	oldGroups, oldChannels := group2model2channels, channelsIDM
+	group2model2channels = map[string]map[string][]int{"default": {"cap-model": {high.Id, low.Id}}}
+	channelsIDM = map[int]*Channel{high.Id: high, low.Id: low}
+	channelSyncLock.Unlock()
+	oldMemoryCache := common.MemoryCacheEnabled
+	common.MemoryCacheEnabled = true
+	t.Cleanup(func() {
+		channelSyncLock.Lock()
+		group2model2channels, channelsIDM = oldGroups, oldChannels
+		channelSyncLock.Unlock()
+		common.MemoryCacheEnabled = oldMemoryCache
+	})
+
+	channel, err := GetRandomSatisfiedChannel("default", "cap-model", 0, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, high.Id, channel.Id)
+
+	release, ok := AcquireChannelCapacity(high, 0, 0, 0)
+	require.True(t, ok)
+	defer release()
+	channel, err = GetRandomSatisfiedChannel("default", "cap-model", 0, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, low.Id, channel.Id)
+
+	// 占用名额失败的渠道被排除后不再参与选择
+	channel, err = GetRandomSatisfiedChannel("default", "cap-model", 0, nil, []int{low.Id})
+	require.NoError(t, err)
+	require.Equal(t, high.Id, channel.Id)
+	channel, err = GetRandomSatisfiedChannel("default", "cap-model", 0, nil, []int{high.Id, low.Id})
+	require.NoError(t, err)
+	require.Nil(t, channel)
+}
+
+func TestChannelCapacityLeaseExpiry(t *testing.T) {
+	channel := newCapacityChannel(9104, 0, &dto.ChannelCapacity{MaxConcurrency: 1})
+	leaked, ok := AcquireChannelCapacity(channel, 0, 0, 0)
+	require.True(t, ok)
+
+	// 模拟漏释放的名额到期
+	key := channelCapacityScope{name: channelScopeName(channel.Id)}.keys(time.Now())[0]
+	memoryCapacityStore.mu.Lock()
+	for lease := range memoryCapacityStore.leases[key] {
+		memoryCapacityStore.leases[key][lease] = time.Now().Add(-time.Second)
+	}
+	memoryCapacityStore.mu.Unlock()
+	require.True(t, ChannelHasCapacity(channel, 0))
+
+	release, ok := AcquireChannelCapacity(channel, 0, 0, 0)
+	require.True(t, ok)
+	// 过期租约的释放不影响新的租约
+	leaked()
+	require.False(t, ChannelHasCapacity(channel, 0))
+	release()
+	require.True(t, ChannelHasCapacity(channel, 0))
+}
+
+func TestGetChannelSkipsFullChannelsDB(t *testing.T) {
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM channels")
+		DB.Exec("DELETE FROM abilities")
+	})
+	high := newCapacityChannel(9211, 10, &dto.ChannelCapacity{MaxConcurrency: 1})
+	low := newCapacityChannel(9212, 0, nil)
+	for _, channel := range []*Channel{high, low} {
+		require.NoError(t, DB.Create(channel).Error)
+		require.NoError(t, DB.Create(&Ability{Group: "default", Model: "cap-model", ChannelId: channel.Id, Enabled: true, Priority: channel.Priority}).Error)
+	}
+
+	channel, err := GetChannel("default", "cap-model", 0, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, high.Id, channel.Id)
+
+	release, ok := AcquireChannelCapacity(high, 0, 0, 0)
+	require.True(t, ok)
+	defer release()
+	channel, err = GetChannel("default", "cap-model", 0, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, low.Id, channel.Id)
+}
+
+func TestGetChannelUsesAbilityPriorityDB(t *testing.T) {
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM channels")
+		DB.Exec("DELETE FROM abilities")
+	})
+	// 数据库路径按 abilities 行的优先级选择，不依赖渠道行
+	preferred := newCapacityChannel(9221, 0, nil)
+	other := newCapacityChannel(9222, 10, nil)
+	preferred.Key = "sk-preferred"
+	abilityPriority := int64(20)
+	for _, channel := range []*Channel{preferred, other} {
+		require.NoError(t, DB.Create(channel).Error)
+	}
+	require.NoError(t, DB.Create(&Ability{Group: "default", Model: "ability-model", ChannelId: preferred.Id, Enabled: true, Priority: &abilityPriority}).Error)
+	require.NoError(t, DB.Create(&Ability{Group: "default", Model: "ability-model", ChannelId: other.Id, Enabled: true, Priority: other.Priority}).Error)
+
+	channel, err := GetChannel("default", "ability-model", 0, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, preferred.Id, channel.Id)
+	require.Equal(t, "sk-preferred", channel.Key)
+
+	channel, err = GetChannel("default", "ability-model", 1, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, other.Id, channel.Id)
+
+	channel, err = GetChannel("default", "ability-model", 0, nil, []int{preferred.Id})
+	require.NoError(t, err)
+	require.Equal(t, other.Id, channel.Id)
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"errors"
+	"fmt"
 	"math/rand"
 	"time"
 
@@ -105,6 +106,9 @@ func userCheckinWithTransaction(checkin *Checkin, userId int, quotaAwarded int)
 			Update("quota", gorm.Expr("quota + ?", quotaAwarded)).Error; err != nil {
 			return errors.New("签到失败：更新额度出错")
 		}
+		if err := RecordQuotaLedger(tx, userId, quotaAwarded, checkinLedgerMeta(checkin)); err != nil {
+			return errors.New("签到失败：更新额度出错")
+		}
 
 		return nil
 	})
@@ -131,7 +135,7 @@ func userCheckinWithoutTransaction(checkin *Checkin, userId int, quotaAwarded in
 
 	// 步骤2: 增加用户额度
 	// 使用 db=true 强制直接写入数据库，不使用批量更新
-	if err := IncreaseUserQuota(userId, quotaAwarded, true); err != nil {
+	if err := IncreaseUserQuota(userId, quotaAwarded, true, checkinLedgerMeta(checkin)); err != nil {
 		// 如果增加额度失败，需要回滚签到记录
 		DB.Delete(checkin)
 		return nil, errors.New("签到失败：更新额度出错")
@@ -177,3 +181,12 @@ func GetUserCheckinStats(userId int, month string) (map[string]interface{}, erro
 		"records":          checkinRecords,  // 本月签到记录详情（不含id和user_id）
 	}, nil
 }
+
+// checkinLedgerMeta 每个用户每天只会有一条签到入账
+func checkinLedgerMeta(checkin *Checkin) QuotaLedgerMeta {
+	return QuotaLedgerMeta{
+		Type:           QuotaLedgerTypeCheckin,
+		IdempotencyKey: fmt.Sprintf("checkin:%d:%s", checkin.UserId, checkin.CheckinDate),
+		ReferenceId:    checkin.CheckinDate,
+	}
+}
@@ -0,0 +1,302 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CreditBucketStatusActive  = "active"
+	CreditBucketStatusExpired = "expired"
+)
+
+// CreditBucket 一笔入账额度，按来源记录剩余额度与过期时间。
+// 用户余额中没有对应额度桶的部分视为永不过期的付费额度
+type CreditBucket struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"index:idx_credit_bucket_user_status,priority:1"`
+	Source      string `json:"source" gorm:"type:varchar(32)"`
+	Promo       bool   `json:"promo"`
+	Amount      int    `json:"amount"`
+	Remaining   int    `json:"remaining"`
+	ExpiresAt   int64  `json:"expires_at" gorm:"bigint;index;default:0"` // 0 表示永不过期
+	Status      string `json:"status" gorm:"type:varchar(16);index:idx_credit_bucket_user_status,priority:2"`
+	ReferenceId string `json:"reference_id,omitempty" gorm:"type:varchar(128);default:''"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+}
+
+// CreditBucketUsage 请求从额度桶扣除的明细，退款与结算返还时退回原额度桶
+type CreditBucketUsage struct {
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id"`
+	RequestId string `json:"request_id" gorm:"type:varchar(64);index"`
+	BucketId  int    `json:"bucket_id"`
+	Amount    int    `json:"amount"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// creditBucketSource 返回入账类型对应的额度桶来源配置，不产生额度桶的类型返回 false
+func creditBucketSource(ledgerType string) (expireDays int, promo bool, ok bool) {
+	setting := operation_setting.GetCreditBucketSetting()
+	switch ledgerType {
+	case QuotaLedgerTypeTopUp:
+		return setting.TopUpExpireDays, false, true
+	case QuotaLedgerTypeRedemption:
+		return setting.RedemptionExpireDays, true, true
+	case QuotaLedgerTypeCheckin:
+		return setting.CheckinExpireDays, true, true
+	case QuotaLedgerTypeAffiliate, QuotaLedgerTypeInvite:
+		return setting.AffiliateExpireDays, true, true
+	case QuotaLedgerTypeAdmin:
+		return setting.AdminExpireDays, false, true
+	}
+	return 0, false, false
+}
+
+func creditBucketOrder(tx *gorm.DB, meta QuotaLedgerMeta) *gorm.DB {
+	// 拒付扣回优先扣除该订单入账的额度桶
+	if meta.Type == QuotaLedgerTypeChargeback && meta.ReferenceId != "" {
+		tx = tx.Order(gorm.Expr("CASE WHEN reference_id = ? THEN 0 ELSE 1 END", meta.ReferenceId))
+	}
+	switch operation_setting.GetCreditBucketSetting().ConsumeOrder {
+	case operation_setting.CreditBucketOrderFIFO:
+		return tx.Order("id asc")
+	case operation_setting.CreditBucketOrderPromoFirst:
+		tx = tx.Order("promo desc")
+	}
+	return tx.Order("CASE WHEN expires_at = 0 THEN 1 ELSE 0 END").Order("expires_at asc").Order("id asc")
+}
+
+// applyCreditBucketsTx 按余额变动同步额度桶，调用方需持有该用户的记账锁
+func applyCreditBucketsTx(tx *gorm.DB, userId int, amount int, meta QuotaLedgerMeta) error {
+	if amount < 0 {
+		if meta.Type == QuotaLedgerTypeExpire {
+			return nil
+		}
+		return consumeCreditBucketsTx(tx, userId, -amount, meta)
+	}
+	if meta.RequestId != "" {
+		restored, err := restoreCreditBucketsTx(tx, userId, amount, meta.RequestId)
+		if err != nil || restored > 0 {
+			return err
+		}
+	}
+	expireDays, promo, ok := creditBucketSource(meta.Type)
+	if !ok {
+		return nil
+	}
+	now := common.GetTimestamp()
+	bucket := CreditBucket{
+		UserId:      userId,
+		Source:      meta.Type,
+		Promo:       promo,
+		Amount:      amount,
+		Remaining:   amount,
+		Status:      CreditBucketStatusActive,
+		ReferenceId: meta.ReferenceId,
+		CreatedAt:   now,
+	}
+	if expireDays > 0 {
+		bucket.ExpiresAt = now + int64(expireDays)*86400
+	}
+	return tx.Create(&bucket).Error
+}
+
+// consumeCreditBucketsTx 按配置顺序从额度桶扣除，不足部分由无额度桶的余额承担
+func consumeCreditBucketsTx(tx *gorm.DB, userId int, amount int, meta QuotaLedgerMeta) error {
+	var buckets []CreditBucket
+	err := creditBucketOrder(tx.Where("user_id = ? AND status = ? AND remaining > 0", userId, CreditBucketStatusActive), meta).
+		Find(&buckets).Error
+	if err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	for _, bucket := range buckets {
+		if amount <= 0 {
+			break
+		}
+		take := bucket.Remaining
+		if take > amount {
+			take = amount
+		}
+		if err := tx.Model(&CreditBucket{}).Where("id = ?", bucket.Id).
+			Update("remaining", gorm.Expr("remaining - ?", take)).Error; err != nil {
+			return err
+		}
+		if meta.RequestId != "" {
+			usage := CreditBucketUsage{UserId: userId, RequestId: meta.RequestId, BucketId: bucket.Id, Amount: take, CreatedAt: now}
+			if err := tx.Create(&usage).Error; err != nil {
+				return err
+			}
+		}
+		amount -= take
+	}
+	return nil
+}
+
+// restoreCreditBucketsTx 将请求返还的额度退回原额度桶，返回实际退回的额度。
+// 已过期的额度桶会重新激活，由下次过期扫描再次扣除
+func restoreCreditBucketsTx(tx *gorm.DB, userId int, amount int, requestId string) (int, error) {
+	var usages []CreditBucketUsage
+	if err := tx.Where("request_id = ? AND user_id = ? AND amount > 0", requestId, userId).
+		Order("id desc").Find(&usages).Error; err != nil {
+		return 0, err
+	}
+	restored := 0
+	for _, usage := range usages {
+		if amount <= 0 {
+			break
+		}
+		back := usage.Amount
+		if back > amount {
+			back = amount
+		}
+		if err := tx.Model(&CreditBucket{}).Where("id = ?", usage.BucketId).Updates(map[string]interface{}{
+			"remaining": gorm.Expr("remaining + ?", back),
+			"status":    CreditBucketStatusActive,
+		}).Error; err != nil {
+			return restored, err
+		}
+		if err := tx.Model(&CreditBucketUsage{}).Where("id = ?", usage.Id).
+			Update("amount", gorm.Expr("amount - ?", back)).Error; err != nil {
+			return restored, err
+		}
+		amount -= back
+		restored += back
+	}
+	return restored, nil
+}
+
+// ExpireCreditBuckets 扣除已过期额度桶的剩余额度，返回处理的额度桶数量
+func ExpireCreditBuckets(now int64, limit int) (int, error) {
+	var buckets []CreditBucket
+	if err := DB.Where("status = ? AND expires_at > 0 AND expires_at <= ?", CreditBucketStatusActive, now).
+		Order("expires_at asc").Limit(limit).Find(&buckets).Error; err != nil {
+		return 0, err
+	}
+	for _, bucket := range buckets {
+		if err := expireCreditBucket(bucket.Id, bucket.UserId); err != nil {
+			return 0, err
+		}
+	}
+	return len(buckets), nil
+}
+
+func expireCreditBucket(bucketId int, userId int) error {
+	expired := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var bucket CreditBucket
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", bucketId).First(&bucket).Error; err != nil {
+			return err
+		}
+		if bucket.Status != CreditBucketStatusActive {
+			return nil
+		}
+		if err := tx.Model(&CreditBucket{}).Where("id = ?", bucket.Id).Updates(map[string]interface{}{
+			"remaining": 0,
+			"status":    CreditBucketStatusExpired,
+		}).Error; err != nil {
+			return err
+		}
+		if bucket.Remaining <= 0 {
+			return nil
+		}
+		// 余额已不足时只扣到 0，避免过期导致欠费
+		var quota int
+		if err := tx.Model(&User{}).Where("id = ?", bucket.UserId).Select("quota").Find(&quota).Error; err != nil {
+			return err
+		}
+		quota += pendingBatchUserQuota(bucket.UserId)
+		expired = bucket.Remaining
+		if expired > quota {
+			expired = quota
+		}
+		if expired <= 0 {
+			expired = 0
+			return nil
+		}
+		// 退款返还后额度桶可能再次过期，幂等键中带上时间
+		if err := tx.Model(&User{}).Where("id = ?", bucket.UserId).
+			Update("quota", gorm.Expr("quota - ?", expired)).Error; err != nil {
+			return err
+		}
+		return RecordQuotaLedger(tx, bucket.UserId, -expired, QuotaLedgerMeta{
+			Type:           QuotaLedgerTypeExpire,
+			IdempotencyKey: fmt.Sprintf("expire:%d:%d", bucket.Id, common.GetTimestamp()),
+			ReferenceId:    bucket.ReferenceId,
+			Remark:         bucket.Source,
+		})
+	})
+	if err == nil && expired > 0 {
+		_ = invalidateUserCache(userId)
+	}
+	return err
+}
+
+// CleanupCreditBucketUsages 删除早于指定时间的扣除明细
+func CleanupCreditBucketUsages(before int64) error {
+	return DB.Where("created_at < ?", before).Delete(&CreditBucketUsage{}).Error
+}
+
+// CreditExpiryGroup 同一到期时间的剩余额度
+type CreditExpiryGroup struct {
+	ExpiresAt int64 `json:"expires_at"`
+	Amount    int   `json:"amount"`
+}
+
+// CreditBreakdown 用户余额按额度桶与到期时间的拆分
+type CreditBreakdown struct {
+	Quota int `json:"quota"`
+	// Unbucketed 没有对应额度桶的余额，永不过期
+	Unbucketed int                 `json:"unbucketed"`
+	Promo      int                 `json:"promo"`
+	Paid       int                 `json:"paid"`
+	ByExpiry   []CreditExpiryGroup `json:"by_expiry"`
+	Buckets    []CreditBucket      `json:"buckets"`
+}
+
+// GetUserCreditBreakdown 返回用户的有效额度桶及按到期时间汇总的余额
+func GetUserCreditBreakdown(userId int) (*CreditBreakdown, error) {
+	quota, err := GetUserQuota(userId, true)
+	if err != nil {
+		return nil, err
+	}
+	breakdown := &CreditBreakdown{Quota: quota, ByExpiry: make([]CreditExpiryGroup, 0), Buckets: make([]CreditBucket, 0)}
+	if err := DB.Where("user_id = ? AND status = ? AND remaining > 0", userId, CreditBucketStatusActive).
+		Order("id asc").Find(&breakdown.Buckets).Error; err != nil {
+		return nil, err
+	}
+	byExpiry := make(map[int64]int)
+	bucketed := 0
+	for _, bucket := range breakdown.Buckets {
+		bucketed += bucket.Remaining
+		byExpiry[bucket.ExpiresAt] += bucket.Remaining
+		if bucket.Promo {
+			breakdown.Promo += bucket.Remaining
+		} else {
+			breakdown.Paid += bucket.Remaining
+		}
+	}
+	if quota > bucketed {
+		breakdown.Unbucketed = quota - bucketed
+		breakdown.Paid += breakdown.Unbucketed
+		byExpiry[0] += breakdown.Unbucketed
+	}
+	for expiresAt, amount := range byExpiry {
+		breakdown.ByExpiry = append(breakdown.ByExpiry, CreditExpiryGroup{ExpiresAt: expiresAt, Amount: amount})
+	}
+	// 永不过期的排在最后
+	sort.Slice(breakdown.ByExpiry, func(i, j int) bool {
+		a, b := breakdown.ByExpiry[i].ExpiresAt, breakdown.ByExpiry[j].ExpiresAt
+		if a == 0 || b == 0 {
+			return b == 0 && a != 0
+		}
+		return a < b
+	})
+	return breakdown, nil
+}
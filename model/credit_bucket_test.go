@@ -0,0 +1,90 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func useCreditBucketSetting(t *testing.T, order string) *operation_setting.CreditBucketSetting {
+	t.Helper()
+	setting := operation_setting.GetCreditBucketSetting()
+	original := *setting
+	setting.Enabled = true
+	setting.ConsumeOrder = order
+	t.Cleanup(func() { *setting = original })
+	return setting
+}
+
+func getCreditBucketBySource(t *testing.T, userId int, source string) CreditBucket {
+	t.Helper()
+	var bucket CreditBucket
+	require.NoError(t, DB.Where("user_id = ? AND source = ?", userId, source).First(&bucket).Error)
+	return bucket
+}
+
+func TestCreditBucketExpiringFirstAndRefund(t *testing.T) {
+	truncateTables(t)
+	setting := useCreditBucketSetting(t, operation_setting.CreditBucketOrderExpiringFirst)
+	setting.CheckinExpireDays = 7
+	insertLedgerUser(t, 1, 0)
+
+	require.NoError(t, IncreaseUserQuota(1, 1000, true, QuotaLedgerMeta{Type: QuotaLedgerTypeTopUp, IdempotencyKey: "topup:t1"}))
+	require.NoError(t, IncreaseUserQuota(1, 300, true, QuotaLedgerMeta{Type: QuotaLedgerTypeCheckin, IdempotencyKey: "checkin:1"}))
+
+	require.NoError(t, DecreaseUserQuota(1, 400, QuotaLedgerMeta{Type: QuotaLedgerTypePreConsume, RequestId: "req-1", IdempotencyKey: "pre_consume:req-1"}))
+	require.Equal(t, 0, getCreditBucketBySource(t, 1, QuotaLedgerTypeCheckin).Remaining)
+	require.Equal(t, 900, getCreditBucketBySource(t, 1, QuotaLedgerTypeTopUp).Remaining)
+
+	// 退款退回原额度桶
+	require.NoError(t, IncreaseUserQuota(1, 400, true, QuotaLedgerMeta{Type: QuotaLedgerTypeRefund, RequestId: "req-1", IdempotencyKey: "refund:req-1"}))
+	require.Equal(t, 300, getCreditBucketBySource(t, 1, QuotaLedgerTypeCheckin).Remaining)
+	require.Equal(t, 1000, getCreditBucketBySource(t, 1, QuotaLedgerTypeTopUp).Remaining)
+}
+
+func TestCreditBucketPromoFirst(t *testing.T) {
+	truncateTables(t)
+	setting := useCreditBucketSetting(t, operation_setting.CreditBucketOrderPromoFirst)
+	setting.TopUpExpireDays = 30
+	insertLedgerUser(t, 2, 0)
+
+	require.NoError(t, IncreaseUserQuota(2, 500, true, QuotaLedgerMeta{Type: QuotaLedgerTypeTopUp}))
+	require.NoError(t, IncreaseUserQuota(2, 200, true, QuotaLedgerMeta{Type: QuotaLedgerTypeRedemption}))
+
+	require.NoError(t, DecreaseUserQuota(2, 250))
+	require.Equal(t, 0, getCreditBucketBySource(t, 2, QuotaLedgerTypeRedemption).Remaining)
+	require.Equal(t, 450, getCreditBucketBySource(t, 2, QuotaLedgerTypeTopUp).Remaining)
+}
+
+func TestCreditBucketExpireAndBreakdown(t *testing.T) {
+	truncateTables(t)
+	setting := useCreditBucketSetting(t, operation_setting.CreditBucketOrderExpiringFirst)
+	setting.RedemptionExpireDays = 1
+	useQuotaLedgerSetting(t)
+	// 存量余额没有额度桶
+	insertLedgerUser(t, 3, 100)
+
+	require.NoError(t, IncreaseUserQuota(3, 300, true, QuotaLedgerMeta{Type: QuotaLedgerTypeRedemption}))
+	breakdown, err := GetUserCreditBreakdown(3)
+	require.NoError(t, err)
+	require.Equal(t, 400, breakdown.Quota)
+	require.Equal(t, 100, breakdown.Unbucketed)
+	require.Equal(t, 300, breakdown.Promo)
+	require.Len(t, breakdown.ByExpiry, 2)
+	require.Zero(t, breakdown.ByExpiry[1].ExpiresAt)
+
+	require.NoError(t, DB.Model(&CreditBucket{}).Where("user_id = ?", 3).Update("expires_at", common.GetTimestamp()-1).Error)
+	n, err := ExpireCreditBuckets(common.GetTimestamp(), 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	bucket := getCreditBucketBySource(t, 3, QuotaLedgerTypeRedemption)
+	require.Equal(t, CreditBucketStatusExpired, bucket.Status)
+	require.Equal(t, 100, getUserQuotaForTest(t, 3))
+
+	drifts, err := ReconcileQuotaLedger(0)
+	require.NoError(t, err)
+	require.Empty(t, drifts)
+}
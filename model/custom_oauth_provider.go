@@ -15,6 +15,18 @@ type accessPolicyPayload struct {
 	Groups     []accessPolicyPayload `json:"groups"`
 }
 
+type claimMappingPayload struct {
+	DefaultGroup string                    `json:"default_group"`
+	Rules        []claimMappingRulePayload `json:"rules"`
+}
+
+type claimMappingRulePayload struct {
+	Policy       accessPolicyPayload `json:"policy"`
+	Group        string              `json:"group"`
+	Roles        []string            `json:"roles"`
+	UsableGroups []string            `json:"usable_groups"`
+}
+
 type accessConditionItem struct {
 	Field string `json:"field"`
 	Op    string `json:"op"`
@@ -44,7 +56,7 @@ type CustomOAuthProvider struct {
 	Icon                  string `json:"icon" gorm:"type:varchar(128);default:''"`                       // Icon name from @lobehub/icons
 	Enabled               bool   `json:"enabled" gorm:"default:false"`                                   // Whether this provider is enabled
 	ClientId              string `json:"client_id" gorm:"type:varchar(256)"`                             // OAuth client ID
-	ClientSecret          string `json:"-" gorm:"type:varchar(512)"`                                     // OAuth client secret (not returned to frontend)
+	ClientSecret          string `json:"-" gorm:"type:varchar(1024);serializer:secret"`                  // OAuth client secret (not returned to frontend, encrypted at rest)
 	AuthorizationEndpoint string `json:"authorization_endpoint" gorm:"type:varchar(512)"`                // Authorization URL
 	TokenEndpoint         string `json:"token_endpoint" gorm:"type:varchar(512)"`                        // Token exchange URL
 	UserInfoEndpoint      string `json:"user_info_endpoint" gorm:"type:varchar(512)"`                    // User info URL
@@ -61,6 +73,8 @@ type CustomOAuthProvider struct {
 	AuthStyle           int    `json:"auth_style" gorm:"default:0"`                    // 0=auto, 1=params, 2=header (Basic Auth)
 	AccessPolicy        string `json:"access_policy" gorm:"type:text"`                 // JSON policy for access control based on user info
 	AccessDeniedMessage string `json:"access_denied_message" gorm:"type:varchar(512)"` // Custom error message template when access is denied
+	ClaimMappings       string `json:"claim_mappings" gorm:"type:text"`                // JSON rules mapping user info claims to group, roles and usable groups, synced on every login
+	TrustedForScimLink  bool   `json:"trusted_for_scim_link" gorm:"default:false"`     // Trust verified emails from this provider to link SCIM-provisioned accounts
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -200,7 +214,33 @@ func validateCustomOAuthProvider(provider *CustomOAuthProvider) error {
 			return fmt.Errorf("access_policy is invalid: %w", err)
 		}
 	}
+	if err := ValidateClaimMappings(provider.ClaimMappings); err != nil {
+		return fmt.Errorf("claim_mappings is invalid: %w", err)
+	}
+
+	return nil
+}
 
+// ValidateClaimMappings validates claim mapping rules; an empty value disables mapping
+func ValidateClaimMappings(raw string) error {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	var mapping claimMappingPayload
+	if err := common.UnmarshalJsonStr(raw, &mapping); err != nil {
+		return errors.New("must be valid JSON")
+	}
+	if len(mapping.Rules) == 0 {
+		return errors.New("at least one rule is required")
+	}
+	for index, rule := range mapping.Rules {
+		if rule.Group == "" && len(rule.Roles) == 0 && len(rule.UsableGroups) == 0 {
+			return fmt.Errorf("rule[%d] must set group, roles or usable_groups", index)
+		}
+		if err := validateAccessPolicyPayload(&rule.Policy); err != nil {
+			return fmt.Errorf("rule[%d].policy: %w", index, err)
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// NormalizeRegions 统一区域标签格式：去除空白、转小写并去重
+func NormalizeRegions(regions []string) []string {
+	normalized := make([]string, 0, len(regions))
+	for _, region := range regions {
+		region = strings.ToLower(strings.TrimSpace(region))
+		if region != "" {
+			normalized = append(normalized, region)
+		}
+	}
+	return lo.Uniq(normalized)
+}
+
+// ParseRegions 解析逗号分隔的区域列表
+func ParseRegions(raw string) []string {
+	return NormalizeRegions(strings.Split(raw, ","))
+}
+
+// RegionWithin 判断区域是否位于允许的区域内，如 eu-west-1 位于 eu 内
+func RegionWithin(region string, allowed string) bool {
+	return region == allowed || strings.HasPrefix(region, allowed+"-")
+}
+
+// GetRegions 返回渠道的区域标签
+func (channel *Channel) GetRegions() []string {
+	if !strings.Contains(channel.OtherSettings, "regions") {
+		return nil
+	}
+	return NormalizeRegions(channel.GetOtherSettings().Regions)
+}
+
+// ChannelSatisfiesResidency 渠道任一区域标签位于允许的区域内即视为合规，未打标签的渠道在有驻留策略时不合规；
+// 允许列表为空表示不限制
+func ChannelSatisfiesResidency(channel *Channel, regions []string) bool {
+	if len(regions) == 0 {
+		return true
+	}
+	for _, tag := range channel.GetRegions() {
+		for _, allowed := range regions {
+			if RegionWithin(tag, allowed) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterResidentChannelIds 在优先级与权重之前过滤出满足驻留策略的渠道，调用方需持有 channelSyncLock
+func filterResidentChannelIds(channelIds []int, regions []string) []int {
+	if len(regions) == 0 {
+		return channelIds
+	}
+	filtered := make([]int, 0, len(channelIds))
+	for _, channelId := range channelIds {
+		// 不存在的渠道保留给后续的一致性检查报错
+		if channel, ok := channelsIDM[channelId]; !ok || ChannelSatisfiesResidency(channel, regions) {
+			filtered = append(filtered, channelId)
+		}
+	}
+	return filtered
+}
+
+// getResidentChannelIdsDB 未启用内存缓存时查询分组模型下满足驻留策略的渠道
+func getResidentChannelIdsDB(group string, model string, regions []string) ([]int, error) {
+	var channelIds []int
+	err := DB.Model(&Ability{}).
+		Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true).
+		Distinct().Pluck("channel_id", &channelIds).Error
+	if err != nil || len(channelIds) == 0 {
+		return nil, err
+	}
+	var channels []*Channel
+	if err := DB.Select("id", "settings").Where("id IN ?", channelIds).Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	resident := make([]int, 0, len(channels))
+	for _, channel := range channels {
+		if ChannelSatisfiesResidency(channel, regions) {
+			resident = append(resident, channel.Id)
+		}
+	}
+	return resident, nil
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/stretchr/testify/require"
+)
+
+func newRegionChannel(id int, priority int64, regions ...string) *Channel {
+	channel := &Channel{Id: id, Name: "region", Status: common.ChannelStatusEnabled, Priority: &priority, Group: "default", Models: "geo-model"}
+	if len(regions) > 0 {
+		channel.SetOtherSettings(dto.ChannelOtherSettings{Regions: regions})
+	}
+	return channel
+}
+
+func TestChannelSatisfiesResidency(t *testing.T) {
+	channel := newRegionChannel(9301, 0, "EU-West-1", "eu-central-1")
+	require.True(t, ChannelSatisfiesResidency(channel, nil))
+	require.True(t, ChannelSatisfiesResidency(channel, []string{"eu"}))
+	require.True(t, ChannelSatisfiesResidency(channel, []string{"us", "eu-west-1"}))
+	require.False(t, ChannelSatisfiesResidency(channel, []string{"us"}))
+	require.False(t, ChannelSatisfiesResidency(channel, []string{"eu-west-2"}))
+	require.False(t, ChannelSatisfiesResidency(newRegionChannel(9302, 0), []string{"eu"}), "untagged channels fail closed")
+	require.Equal(t, []string{"eu", "us"}, ParseRegions(" EU, us,,eu "))
+}
+
+func TestGetRandomSatisfiedChannelResidency(t *testing.T) {
+	us := newRegionChannel(9311, 10, "us-east-1")
+	untagged := newRegionChannel(9312, 10)
+	eu := newRegionChannel(9313, 0, "eu-west-1")
+
+	channelSyncLock.Lock()
+	oldGroups, oldChannels := group2model2channels, channelsIDM
+	group2model2channels = map[string]map[string][]int{"default": {"geo-model": {us.Id, untagged.Id, eu.Id}}}
+	channelsIDM = map[int]*Channel{us.Id: us, untagged.Id: untagged, eu.Id: eu}
+	channelSyncLock.Unlock()
+	oldMemoryCache := common.MemoryCacheEnabled
+	common.MemoryCacheEnabled = true
+	t.Cleanup(func() {
+		channelSyncLock.Lock()
+		group2model2channels, channelsIDM = oldGroups, oldChannels
+		channelSyncLock.Unlock()
+		common.MemoryCacheEnabled = oldMemoryCache
+	})
+
+	// 驻留策略在优先级之前过滤，高优先级的非合规渠道不会被选中
+	for retry := 0; retry < 3; retry++ {
+		channel, err := GetRandomSatisfiedChannel("default", "geo-model", retry, []string{"eu"}, nil)
+		require.NoError(t, err)
+		require.Equal(t, eu.Id, channel.Id)
+	}
+	channel, err := GetRandomSatisfiedChannel("default", "geo-model", 0, []string{"ap"}, nil)
+	require.NoError(t, err)
+	require.Nil(t, channel)
+
+	channel, err = GetRandomSatisfiedChannel("default", "geo-model", 0, nil, nil)
+	require.NoError(t, err)
+	require.NotEqual(t, eu.Id, channel.Id)
+}
+
+func TestGetChannelResidencyDB(t *testing.T) {
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM channels")
+		DB.Exec("DELETE FROM abilities")
+	})
+	us := newRegionChannel(9321, 10, "us")
+	eu := newRegionChannel(9322, 0, "eu")
+	for _, channel := range []*Channel{us, eu} {
+		require.NoError(t, DB.Create(channel).Error)
+		require.NoError(t, DB.Create(&Ability{Group: "default", Model: "geo-model", ChannelId: channel.Id, Enabled: true, Priority: channel.Priority}).Error)
+	}
+
+	channel, err := GetChannel("default", "geo-model", 0, []string{"eu"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, eu.Id, channel.Id)
+	channel, err = GetChannel("default", "geo-model", 1, []string{"eu"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, eu.Id, channel.Id)
+	channel, err = GetChannel("default", "geo-model", 0, []string{"ap"}, nil)
+	require.NoError(t, err)
+	require.Nil(t, channel)
+	channel, err = GetChannel("default", "geo-model", 0, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, us.Id, channel.Id)
+}
@@ -0,0 +1,256 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	endUserWindowTTL = 2 * time.Minute
+	// 日额度按 UTC 自然日计数，多保留一天避免跨日边界提前过期
+	endUserDailyTTL = 48 * time.Hour
+)
+
+// 超出的终端用户限制类型
+const (
+	EndUserLimitRPM   = "rpm"
+	EndUserLimitTPM   = "tpm"
+	EndUserLimitQuota = "daily_quota"
+)
+
+// EndUserLimit 令牌下单个终端用户的限制，0 表示不限制
+type EndUserLimit struct {
+	RPM        int `json:"rpm"`
+	TPM        int `json:"tpm"`
+	DailyQuota int `json:"daily_quota"`
+}
+
+func (l EndUserLimit) Enabled() bool {
+	return l.RPM > 0 || l.TPM > 0 || l.DailyQuota > 0
+}
+
+// GetEndUserLimit 返回令牌配置的终端用户限制
+func (token *Token) GetEndUserLimit() EndUserLimit {
+	return EndUserLimit{
+		RPM:        token.EndUserRPM,
+		TPM:        token.EndUserTPM,
+		DailyQuota: token.EndUserDailyQuota,
+	}
+}
+
+// endUserKeys 返回当前分钟请求数、当前分钟 token 数与当日消费额度的计数键
+func endUserKeys(tokenId int, endUser string, now time.Time) []string {
+	prefix := fmt.Sprintf("end_user:%d:%s", tokenId, endUser)
+	minute := now.Unix() / 60
+	day := now.Unix() / 86400
+	return []string{
+		fmt.Sprintf("%s:rpm:%d", prefix, minute),
+		fmt.Sprintf("%s:tpm:%d", prefix, minute),
+		fmt.Sprintf("%s:quota:%d", prefix, day),
+	}
+}
+
+// exceededEndUserLimit 根据当前计数返回超出的限制类型，未超出时返回空
+func exceededEndUserLimit(limit EndUserLimit, values []int64) string {
+	if limit.RPM > 0 && values[0] >= int64(limit.RPM) {
+		return EndUserLimitRPM
+	}
+	if limit.TPM > 0 && values[1] >= int64(limit.TPM) {
+		return EndUserLimitTPM
+	}
+	if limit.DailyQuota > 0 && values[2] >= int64(limit.DailyQuota) {
+		return EndUserLimitQuota
+	}
+	return ""
+}
+
+// endUserLimitStore 终端用户计数存储，启用 Redis 时多实例共享
+type endUserLimitStore interface {
+	acquire(keys []string, limit EndUserLimit) (string, error)
+	record(keys []string, tokens int, quota int) error
+}
+
+func getEndUserLimitStore() endUserLimitStore {
+	if common.RedisEnabled && common.RDB != nil {
+		return redisEndUserLimitStore{}
+	}
+	return memoryEndUserLimitStore
+}
+
+type redisEndUserLimitStore struct{}
+
+// 检查三项限制均未超出后计入本次请求，返回超出的限制序号
+var endUserLimitAcquireScript = redis.NewScript(`
+for i = 1, 3 do
+	local limit = tonumber(ARGV[i])
+	if limit > 0 and tonumber(redis.call('GET', KEYS[i]) or '0') >= limit then return i end
+end
+redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+return 0
+`)
+
+var endUserLimitNames = []string{"", EndUserLimitRPM, EndUserLimitTPM, EndUserLimitQuota}
+
+func (redisEndUserLimitStore) acquire(keys []string, limit EndUserLimit) (string, error) {
+	result, err := endUserLimitAcquireScript.Run(context.Background(), common.RDB, keys,
+		limit.RPM, limit.TPM, limit.DailyQuota, int(endUserWindowTTL.Seconds())).Int()
+	if err != nil {
+		return "", err
+	}
+	if result < 0 || result >= len(endUserLimitNames) {
+		return "", fmt.Errorf("unexpected end user limit result: %d", result)
+	}
+	return endUserLimitNames[result], nil
+}
+
+func (redisEndUserLimitStore) record(keys []string, tokens int, quota int) error {
+	ctx := context.Background()
+	pipe := common.RDB.Pipeline()
+	if tokens > 0 {
+		pipe.IncrBy(ctx, keys[1], int64(tokens))
+		pipe.Expire(ctx, keys[1], endUserWindowTTL)
+	}
+	if quota > 0 {
+		pipe.IncrBy(ctx, keys[2], int64(quota))
+		pipe.Expire(ctx, keys[2], endUserDailyTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// endUserCounter 单个计数及其过期时间
+type endUserCounter struct {
+	value  int64
+	expire time.Time
+}
+
+// localEndUserLimitStore 未启用 Redis 时的单实例计数，计数读取时惰性过期，
+// 其余过期计数每个窗口周期最多清理一次，避免每次请求遍历全部计数
+type localEndUserLimitStore struct {
+	mu        sync.Mutex
+	counters  map[string]*endUserCounter
+	nextSweep time.Time
+}
+
+var memoryEndUserLimitStore = &localEndUserLimitStore{
+	counters: make(map[string]*endUserCounter),
+}
+
+func (s *localEndUserLimitStore) getLocked(key string, now time.Time) int64 {
+	counter, ok := s.counters[key]
+	if !ok {
+		return 0
+	}
+	if !now.Before(counter.expire) {
+		delete(s.counters, key)
+		return 0
+	}
+	return counter.value
+}
+
+func (s *localEndUserLimitStore) incrLocked(key string, delta int64, ttl time.Duration, now time.Time) {
+	s.counters[key] = &endUserCounter{value: s.getLocked(key, now) + delta, expire: now.Add(ttl)}
+}
+
+func (s *localEndUserLimitStore) sweepLocked(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(endUserWindowTTL)
+	for key, counter := range s.counters {
+		if !now.Before(counter.expire) {
+			delete(s.counters, key)
+		}
+	}
+}
+
+func (s *localEndUserLimitStore) acquire(keys []string, limit EndUserLimit) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweepLocked(now)
+	values := make([]int64, len(keys))
+	for i, key := range keys {
+		values[i] = s.getLocked(key, now)
+	}
+	if exceeded := exceededEndUserLimit(limit, values); exceeded != "" {
+		return exceeded, nil
+	}
+	s.incrLocked(keys[0], 1, endUserWindowTTL, now)
+	return "", nil
+}
+
+func (s *localEndUserLimitStore) record(keys []string, tokens int, quota int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if tokens > 0 {
+		s.incrLocked(keys[1], int64(tokens), endUserWindowTTL, now)
+	}
+	if quota > 0 {
+		s.incrLocked(keys[2], int64(quota), endUserDailyTTL, now)
+	}
+	return nil
+}
+
+// AcquireEndUserLimit 检查终端用户是否超出令牌的限制并计入本次请求，返回超出的限制类型；
+// 计数读取失败时放行，避免 Redis 故障导致请求全部失败
+func AcquireEndUserLimit(tokenId int, endUser string, limit EndUserLimit) string {
+	if endUser == "" || !limit.Enabled() {
+		return ""
+	}
+	exceeded, err := getEndUserLimitStore().acquire(endUserKeys(tokenId, endUser, time.Now()), limit)
+	if err != nil {
+		common.SysError("failed to check end user limit: " + err.Error())
+		return ""
+	}
+	return exceeded
+}
+
+// RecordEndUserUsage 计入终端用户实际消耗的 token 数与额度
+func RecordEndUserUsage(tokenId int, endUser string, tokens int, quota int) {
+	if endUser == "" || (tokens <= 0 && quota <= 0) {
+		return
+	}
+	if err := getEndUserLimitStore().record(endUserKeys(tokenId, endUser, time.Now()), tokens, quota); err != nil {
+		common.SysError("failed to record end user usage: " + err.Error())
+	}
+}
+
+// EndUserUsageStat 按终端用户聚合的消费统计
+type EndUserUsageStat struct {
+	EndUser          string `json:"end_user"`
+	Requests         int64  `json:"requests"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+// GetEndUserUsageStats 按终端用户聚合消费日志，按消费额度降序返回前 limit 个
+func GetEndUserUsageStats(username string, tokenName string, startTimestamp int64, endTimestamp int64, limit int) ([]EndUserUsageStat, error) {
+	tx := LOG_DB.Table("logs").
+		Select("end_user, count(*) requests, coalesce(sum(quota),0) quota, coalesce(sum(prompt_tokens),0) prompt_tokens, coalesce(sum(completion_tokens),0) completion_tokens").
+		Where("type = ? and end_user <> ''", LogTypeConsume)
+	if username != "" {
+		tx = tx.Where("username = ?", username)
+	}
+	if tokenName != "" {
+		tx = tx.Where("token_name = ?", tokenName)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	stats := make([]EndUserUsageStat, 0)
+	err := tx.Group("end_user").Order("quota desc").Limit(limit).Scan(&stats).Error
+	return stats, err
+}
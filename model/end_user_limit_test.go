@@ -0,0 +1,76 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndUserLimit(t *testing.T) {
+	limit := EndUserLimit{RPM: 2, TPM: 100, DailyQuota: 500}
+
+	require.Empty(t, AcquireEndUserLimit(9201, "alice", limit))
+	require.Empty(t, AcquireEndUserLimit(9201, "alice", limit))
+	require.Equal(t, EndUserLimitRPM, AcquireEndUserLimit(9201, "alice", limit))
+	// 同一令牌下的其他终端用户与其他令牌下的同名终端用户互不影响
+	require.Empty(t, AcquireEndUserLimit(9201, "bob", limit))
+	require.Empty(t, AcquireEndUserLimit(9202, "alice", limit))
+
+	RecordEndUserUsage(9201, "bob", 100, 0)
+	require.Equal(t, EndUserLimitTPM, AcquireEndUserLimit(9201, "bob", limit))
+
+	RecordEndUserUsage(9202, "alice", 0, 500)
+	require.Equal(t, EndUserLimitQuota, AcquireEndUserLimit(9202, "alice", EndUserLimit{DailyQuota: 500}))
+
+	require.Empty(t, AcquireEndUserLimit(9201, "alice", EndUserLimit{}), "limits disabled")
+	require.Empty(t, AcquireEndUserLimit(9201, "", limit), "no end user")
+}
+
+func TestGetEndUserUsageStats(t *testing.T) {
+	t.Cleanup(func() {
+		LOG_DB.Exec("DELETE FROM logs")
+	})
+	logs := []*Log{
+		{UserId: 1, Username: "saas", TokenName: "prod", Type: LogTypeConsume, EndUser: "alice", Quota: 100, PromptTokens: 10, CompletionTokens: 5, CreatedAt: 1000},
+		{UserId: 1, Username: "saas", TokenName: "prod", Type: LogTypeConsume, EndUser: "alice", Quota: 50, PromptTokens: 4, CompletionTokens: 1, CreatedAt: 1001},
+		{UserId: 1, Username: "saas", TokenName: "prod", Type: LogTypeConsume, EndUser: "bob", Quota: 300, PromptTokens: 20, CompletionTokens: 10, CreatedAt: 1002},
+		{UserId: 1, Username: "saas", TokenName: "prod", Type: LogTypeConsume, Quota: 999, CreatedAt: 1003},
+		{UserId: 1, Username: "saas", TokenName: "prod", Type: LogTypeError, EndUser: "alice", CreatedAt: 1004},
+		{UserId: 2, Username: "other", TokenName: "prod", Type: LogTypeConsume, EndUser: "alice", Quota: 700, CreatedAt: 1005},
+	}
+	require.NoError(t, LOG_DB.Create(&logs).Error)
+
+	stats, err := GetEndUserUsageStats("saas", "", 0, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []EndUserUsageStat{
+		{EndUser: "bob", Requests: 1, Quota: 300, PromptTokens: 20, CompletionTokens: 10},
+		{EndUser: "alice", Requests: 2, Quota: 150, PromptTokens: 14, CompletionTokens: 6},
+	}, stats)
+
+	stats, err = GetEndUserUsageStats("", "prod", 1001, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, []EndUserUsageStat{{EndUser: "alice", Requests: 2, Quota: 750, PromptTokens: 4, CompletionTokens: 1}}, stats)
+}
+
+func TestLocalEndUserLimitStoreExpiry(t *testing.T) {
+	store := &localEndUserLimitStore{counters: make(map[string]*endUserCounter)}
+	now := time.Now()
+	store.incrLocked("a", 1, time.Minute, now)
+	store.incrLocked("b", 1, time.Hour, now)
+	require.EqualValues(t, 1, store.getLocked("a", now))
+
+	// 过期计数读取时惰性删除
+	later := now.Add(2 * time.Minute)
+	require.Zero(t, store.getLocked("a", later))
+	require.NotContains(t, store.counters, "a")
+
+	// 未被读取的过期计数在下次清理时删除，清理间隔内不重复遍历
+	store.incrLocked("c", 1, time.Minute, now)
+	store.sweepLocked(later)
+	require.NotContains(t, store.counters, "c")
+	require.Contains(t, store.counters, "b")
+	store.incrLocked("d", 1, time.Minute, now)
+	store.sweepLocked(later)
+	require.Contains(t, store.counters, "d")
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 注册其他实例广播的缓存失效事件，处理函数只刷新本实例
+func init() {
+	common.RegisterInvalidationHandler(common.InvalidationOption, reloadOptionFromDatabase)
+	common.RegisterInvalidationHandler(common.InvalidationChannel, func(string) {
+		scheduleChannelCacheReload()
+	})
+	common.RegisterInvalidationHandler(common.InvalidationChannelStatus, applyChannelStatusInvalidation)
+	common.RegisterInvalidationHandler(common.InvalidationPermission, func(key string) {
+		userId, _ := strconv.Atoi(key)
+		clearUserPermissionCache(userId)
+	})
+	common.RegisterInvalidationHandler(common.InvalidationPricing, func(string) {
+		refreshPricing()
+	})
+}
+
+// reloadOptionFromDatabase 重新读取单个配置项，key 为空时重新加载全部
+func reloadOptionFromDatabase(key string) {
+	if key == "" {
+		loadOptionsFromDatabase()
+		return
+	}
+	var option Option
+	if err := DB.Where(&Option{Key: key}).First(&option).Error; err != nil {
+		common.SysError("failed to reload option " + key + ": " + err.Error())
+		return
+	}
+	if err := updateOptionMap(option.Key, option.Value); err != nil {
+		common.SysError("failed to update option map: " + err.Error())
+	}
+}
+
+var channelCacheReloadPending atomic.Bool
+
+// scheduleChannelCacheReload 合并短时间内的多次渠道变更，只在后台重新加载一次
+func scheduleChannelCacheReload() {
+	if !common.MemoryCacheEnabled || !channelCacheReloadPending.CompareAndSwap(false, true) {
+		return
+	}
+	gopool.Go(func() {
+		channelCacheReloadPending.Store(false)
+		loadChannelCache()
+	})
+}
+
+// applyChannelStatusInvalidation 直接更新缓存中的渠道状态，key 格式为 渠道ID:状态
+func applyChannelStatusInvalidation(key string) {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	idStr, statusStr, ok := strings.Cut(key, ":")
+	id, idErr := strconv.Atoi(idStr)
+	status, statusErr := strconv.Atoi(statusStr)
+	if !ok || idErr != nil || statusErr != nil {
+		scheduleChannelCacheReload()
+		return
+	}
+	cacheUpdateChannelStatus(id, status)
+}
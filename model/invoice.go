@@ -0,0 +1,296 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	InvoiceStatusIssued = "issued"
+	InvoiceStatusVoid   = "void"
+)
+
+const (
+	InvoiceKindTopUp        = "topup"
+	InvoiceKindSubscription = "subscription"
+)
+
+const invoiceSequenceName = "invoice"
+
+var (
+	ErrInvoiceNotFound       = errors.New("invoice not found")
+	ErrInvoiceAlreadyVoided  = errors.New("invoice already voided")
+	ErrInvoicePaymentNotPaid = errors.New("payment is not completed")
+)
+
+// Invoice 支付成功后开具的发票。已开具的发票不再修改，重新开具时作废原发票并生成新号码
+type Invoice struct {
+	Id            int     `json:"id"`
+	InvoiceNo     string  `json:"invoice_no" gorm:"type:varchar(64);uniqueIndex"`
+	UserId        int     `json:"user_id" gorm:"index"`
+	TradeNo       string  `json:"trade_no" gorm:"type:varchar(255);index"`
+	Kind          string  `json:"kind" gorm:"type:varchar(16)"`
+	Description   string  `json:"description" gorm:"type:varchar(255)"`
+	PaymentMethod string  `json:"payment_method" gorm:"type:varchar(50)"`
+	Currency      string  `json:"currency" gorm:"type:varchar(16)"`
+	Subtotal      float64 `json:"subtotal"`
+	TaxName       string  `json:"tax_name" gorm:"type:varchar(32)"`
+	TaxRate       float64 `json:"tax_rate"`
+	TaxAmount     float64 `json:"tax_amount"`
+	Total         float64 `json:"total"`
+	// Seller 开具时的公司信息快照，避免修改设置后影响历史发票
+	Seller     string `json:"seller" gorm:"type:text"`
+	Status     string `json:"status" gorm:"type:varchar(16);index"`
+	VoidReason string `json:"void_reason,omitempty" gorm:"type:varchar(255)"`
+	// ReplacesId 重新开具时指向被作废的原发票
+	ReplacesId int   `json:"replaces_id,omitempty" gorm:"default:0"`
+	PaidAt     int64 `json:"paid_at"`
+	IssuedAt   int64 `json:"issued_at" gorm:"bigint;index"`
+	VoidedAt   int64 `json:"voided_at,omitempty"`
+}
+
+// InvoiceSeller 发票上的开票方信息
+type InvoiceSeller struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	TaxId   string `json:"tax_id"`
+	Email   string `json:"email"`
+	Footer  string `json:"footer"`
+}
+
+// InvoiceSequence 发票号计数器，保证号码全局递增且不复用
+type InvoiceSequence struct {
+	Name  string `json:"name" gorm:"primaryKey;type:varchar(32)"`
+	Value int64  `json:"value"`
+}
+
+func (inv *Invoice) GetSeller() InvoiceSeller {
+	var seller InvoiceSeller
+	if inv.Seller != "" {
+		_ = common.UnmarshalJsonStr(inv.Seller, &seller)
+	}
+	return seller
+}
+
+func nextInvoiceSequenceTx(tx *gorm.DB) (int64, error) {
+	seq := InvoiceSequence{Name: invoiceSequenceName}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&seq).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Model(&InvoiceSequence{}).Where("name = ?", invoiceSequenceName).
+		Update("value", gorm.Expr("value + 1")).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Where("name = ?", invoiceSequenceName).First(&seq).Error; err != nil {
+		return 0, err
+	}
+	return seq.Value, nil
+}
+
+// buildInvoiceTx 按当前发票设置生成发票，支付金额视为含税价
+func buildInvoiceTx(tx *gorm.DB, topUp *TopUp) (*Invoice, error) {
+	setting := operation_setting.GetInvoiceSetting()
+	seller, err := common.Marshal(InvoiceSeller{
+		Name:    setting.CompanyName,
+		Address: setting.CompanyAddress,
+		TaxId:   setting.CompanyTaxId,
+		Email:   setting.CompanyEmail,
+		Footer:  setting.Footer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	seq, err := nextInvoiceSequenceTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Invoice{
+		InvoiceNo:     fmt.Sprintf("%s%08d", setting.NumberPrefix, seq),
+		UserId:        topUp.UserId,
+		TradeNo:       topUp.TradeNo,
+		Kind:          InvoiceKindTopUp,
+		Description:   "额度充值",
+		PaymentMethod: topUp.PaymentMethod,
+		Currency:      setting.Currency,
+		TaxName:       setting.TaxName,
+		TaxRate:       setting.TaxRate,
+		Seller:        string(seller),
+		Status:        InvoiceStatusIssued,
+		PaidAt:        topUp.CompleteTime,
+		IssuedAt:      common.GetTimestamp(),
+	}
+	var order SubscriptionOrder
+	if err := tx.Where("trade_no = ?", topUp.TradeNo).Limit(1).Find(&order).Error; err != nil {
+		return nil, err
+	}
+	if order.Id != 0 {
+		inv.Kind = InvoiceKindSubscription
+		inv.Description = "订阅套餐"
+		if plan, err := getSubscriptionPlanByIdTx(tx, order.PlanId); err == nil && plan.Title != "" {
+			inv.Description = "订阅套餐: " + plan.Title
+		}
+	}
+
+	total := decimal.NewFromFloat(topUp.Money).Round(2)
+	subtotal := total
+	if setting.TaxRate > 0 {
+		subtotal = total.Div(decimal.NewFromFloat(1 + setting.TaxRate)).Round(2)
+	}
+	inv.Total = total.InexactFloat64()
+	inv.Subtotal = subtotal.InexactFloat64()
+	inv.TaxAmount = total.Sub(subtotal).InexactFloat64()
+
+	if err := tx.Create(inv).Error; err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func getActiveInvoiceByTradeNoTx(tx *gorm.DB, tradeNo string) (*Invoice, error) {
+	var inv Invoice
+	err := tx.Where("trade_no = ? AND status = ?", tradeNo, InvoiceStatusIssued).
+		Order("id desc").Limit(1).Find(&inv).Error
+	if err != nil || inv.Id == 0 {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// IssueInvoiceByTradeNo 为已完成的支付开具发票，已存在有效发票时直接返回
+func IssueInvoiceByTradeNo(tradeNo string) (*Invoice, error) {
+	tradeNo = strings.TrimSpace(tradeNo)
+	if tradeNo == "" {
+		return nil, errors.New("trade_no is empty")
+	}
+	var inv *Invoice
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var topUp TopUp
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("trade_no = ?", tradeNo).First(&topUp).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("充值订单不存在")
+			}
+			return err
+		}
+		if topUp.Status != common.TopUpStatusSuccess {
+			return ErrInvoicePaymentNotPaid
+		}
+		existing, err := getActiveInvoiceByTradeNoTx(tx, tradeNo)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			inv = existing
+			return nil
+		}
+		inv, err = buildInvoiceTx(tx, &topUp)
+		return err
+	})
+	return inv, err
+}
+
+// IssueInvoiceAfterPayment 支付成功后自动开具发票，失败只记录日志，管理员可稍后补开
+func IssueInvoiceAfterPayment(tradeNo string) {
+	if !operation_setting.GetInvoiceSetting().Enabled || tradeNo == "" {
+		return
+	}
+	if _, err := IssueInvoiceByTradeNo(tradeNo); err != nil {
+		common.SysError(fmt.Sprintf("failed to issue invoice for %s: %s", tradeNo, err.Error()))
+	}
+}
+
+func voidInvoiceTx(tx *gorm.DB, id int, reason string) (*Invoice, error) {
+	var inv Invoice
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&inv, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, err
+	}
+	if inv.Status == InvoiceStatusVoid {
+		return nil, ErrInvoiceAlreadyVoided
+	}
+	inv.Status = InvoiceStatusVoid
+	inv.VoidReason = reason
+	inv.VoidedAt = common.GetTimestamp()
+	if err := tx.Model(&Invoice{}).Where("id = ?", inv.Id).Updates(map[string]interface{}{
+		"status":      inv.Status,
+		"void_reason": inv.VoidReason,
+		"voided_at":   inv.VoidedAt,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// VoidInvoice 作废发票，号码不会被复用
+func VoidInvoice(id int, reason string) (*Invoice, error) {
+	var inv *Invoice
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		inv, err = voidInvoiceTx(tx, id, reason)
+		return err
+	})
+	return inv, err
+}
+
+// RegenerateInvoice 作废原发票并按当前设置重新开具
+func RegenerateInvoice(id int) (*Invoice, error) {
+	var inv *Invoice
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		old, err := voidInvoiceTx(tx, id, "regenerated")
+		if err != nil {
+			return err
+		}
+		var topUp TopUp
+		if err := tx.Where("trade_no = ?", old.TradeNo).First(&topUp).Error; err != nil {
+			return err
+		}
+		if topUp.Status != common.TopUpStatusSuccess {
+			return ErrInvoicePaymentNotPaid
+		}
+		inv, err = buildInvoiceTx(tx, &topUp)
+		if err != nil {
+			return err
+		}
+		inv.ReplacesId = old.Id
+		return tx.Model(&Invoice{}).Where("id = ?", inv.Id).Update("replaces_id", old.Id).Error
+	})
+	return inv, err
+}
+
+func GetInvoiceById(id int) (*Invoice, error) {
+	var inv Invoice
+	if err := DB.First(&inv, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// GetInvoices 分页查询发票，userId 为 0 时查询全部用户
+func GetInvoices(userId int, keyword string, startIdx int, num int) (invoices []*Invoice, total int64, err error) {
+	tx := DB.Model(&Invoice{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if keyword != "" {
+		like := "%" + keyword + "%"
+		tx = tx.Where("invoice_no LIKE ? OR trade_no LIKE ?", like, like)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&invoices).Error
+	return invoices, total, err
+}
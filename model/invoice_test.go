@@ -0,0 +1,90 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func insertPaidTopUp(t *testing.T, userId int, tradeNo string, money float64) {
+	t.Helper()
+	require.NoError(t, DB.Create(&TopUp{
+		UserId:        userId,
+		Money:         money,
+		TradeNo:       tradeNo,
+		PaymentMethod: "stripe",
+		Status:        common.TopUpStatusSuccess,
+		CompleteTime:  common.GetTimestamp(),
+	}).Error)
+}
+
+func useInvoiceSetting(t *testing.T, prefix string, taxRate float64) {
+	t.Helper()
+	setting := operation_setting.GetInvoiceSetting()
+	original := *setting
+	setting.NumberPrefix = prefix
+	setting.TaxRate = taxRate
+	t.Cleanup(func() { *setting = original })
+}
+
+func TestIssueInvoiceSequentialAndIdempotent(t *testing.T) {
+	truncateTables(t)
+	useInvoiceSetting(t, "INV-", 0)
+	insertPaidTopUp(t, 1, "trade-1", 10)
+	insertPaidTopUp(t, 1, "trade-2", 20)
+
+	first, err := IssueInvoiceByTradeNo("trade-1")
+	require.NoError(t, err)
+	require.Equal(t, "INV-00000001", first.InvoiceNo)
+	require.Equal(t, InvoiceKindTopUp, first.Kind)
+
+	again, err := IssueInvoiceByTradeNo("trade-1")
+	require.NoError(t, err)
+	require.Equal(t, first.Id, again.Id)
+
+	second, err := IssueInvoiceByTradeNo("trade-2")
+	require.NoError(t, err)
+	require.Equal(t, "INV-00000002", second.InvoiceNo)
+}
+
+func TestIssueInvoiceSplitsTaxFromTotal(t *testing.T) {
+	truncateTables(t)
+	useInvoiceSetting(t, "INV-", 0.06)
+	insertPaidTopUp(t, 1, "trade-tax", 106)
+
+	inv, err := IssueInvoiceByTradeNo("trade-tax")
+	require.NoError(t, err)
+	require.Equal(t, 106.0, inv.Total)
+	require.Equal(t, 100.0, inv.Subtotal)
+	require.Equal(t, 6.0, inv.TaxAmount)
+}
+
+func TestIssueInvoiceRejectsPendingPayment(t *testing.T) {
+	truncateTables(t)
+	require.NoError(t, DB.Create(&TopUp{UserId: 1, Money: 5, TradeNo: "trade-pending", Status: common.TopUpStatusPending}).Error)
+
+	_, err := IssueInvoiceByTradeNo("trade-pending")
+	require.ErrorIs(t, err, ErrInvoicePaymentNotPaid)
+}
+
+func TestRegenerateInvoiceVoidsOriginal(t *testing.T) {
+	truncateTables(t)
+	useInvoiceSetting(t, "INV-", 0)
+	insertPaidTopUp(t, 1, "trade-regen", 10)
+
+	original, err := IssueInvoiceByTradeNo("trade-regen")
+	require.NoError(t, err)
+	regenerated, err := RegenerateInvoice(original.Id)
+	require.NoError(t, err)
+	require.Equal(t, original.Id, regenerated.ReplacesId)
+	require.NotEqual(t, original.InvoiceNo, regenerated.InvoiceNo)
+
+	voided, err := GetInvoiceById(original.Id)
+	require.NoError(t, err)
+	require.Equal(t, InvoiceStatusVoid, voided.Status)
+
+	_, err = VoidInvoice(original.Id, "again")
+	require.ErrorIs(t, err, ErrInvoiceAlreadyVoided)
+}
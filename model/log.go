@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/types"
 
@@ -36,6 +37,7 @@ type Log struct {
 	Group            string `json:"group" gorm:"index"`
 	Ip               string `json:"ip" gorm:"index;default:''"`
 	RequestId        string `json:"request_id,omitempty" gorm:"type:varchar(64);index:idx_logs_request_id;default:''"`
+	EndUser          string `json:"end_user,omitempty" gorm:"type:varchar(128);index;default:''"`
 	Other            string `json:"other"`
 }
 
@@ -125,6 +127,7 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 			return ""
 		}(),
 		RequestId: requestId,
+		EndUser:   common.GetContextKeyString(c, constant.ContextKeyEndUser),
 		Other:     otherStr,
 	}
 	err := LOG_DB.Create(log).Error
@@ -186,6 +189,7 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 			return ""
 		}(),
 		RequestId: requestId,
+		EndUser:   common.GetContextKeyString(c, constant.ContextKeyEndUser),
 		Other:     otherStr,
 	}
 	err := LOG_DB.Create(log).Error
@@ -278,8 +278,25 @@ func migrateDB() error {
 		&SubscriptionOrder{},
 		&UserSubscription{},
 		&SubscriptionPreConsumeRecord{},
+		&QuotaLedger{},
+		&Invoice{},
+		&InvoiceSequence{},
+		&PaymentEvent{},
+		&CreditBucket{},
+		&CreditBucketUsage{},
+		&RedemptionCampaign{},
+		&RedemptionUse{},
+		&RedemptionGroupGrant{},
+		&SpendAnomaly{},
+		&UserMonthlyQuota{},
+		&Role{},
+		&UserRole{},
+		&AuditLog{},
 		&CustomOAuthProvider{},
 		&UserOAuthBinding{},
+		&ScimUser{},
+		&ScimGroup{},
+		&ScimGroupMember{},
 	)
 	if err != nil {
 		return err
@@ -326,8 +343,25 @@ func migrateDBFast() error {
 		{&SubscriptionOrder{}, "SubscriptionOrder"},
 		{&UserSubscription{}, "UserSubscription"},
 		{&SubscriptionPreConsumeRecord{}, "SubscriptionPreConsumeRecord"},
+		{&QuotaLedger{}, "QuotaLedger"},
+		{&Invoice{}, "Invoice"},
+		{&InvoiceSequence{}, "InvoiceSequence"},
+		{&PaymentEvent{}, "PaymentEvent"},
+		{&CreditBucket{}, "CreditBucket"},
+		{&CreditBucketUsage{}, "CreditBucketUsage"},
+		{&RedemptionCampaign{}, "RedemptionCampaign"},
+		{&RedemptionUse{}, "RedemptionUse"},
+		{&RedemptionGroupGrant{}, "RedemptionGroupGrant"},
+		{&SpendAnomaly{}, "SpendAnomaly"},
+		{&UserMonthlyQuota{}, "UserMonthlyQuota"},
+		{&Role{}, "Role"},
+		{&UserRole{}, "UserRole"},
+		{&AuditLog{}, "AuditLog"},
 		{&CustomOAuthProvider{}, "CustomOAuthProvider"},
 		{&UserOAuthBinding{}, "UserOAuthBinding"},
+		{&ScimUser{}, "ScimUser"},
+		{&ScimGroup{}, "ScimGroup"},
+		{&ScimGroupMember{}, "ScimGroupMember"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -16,7 +16,17 @@ import (
 
 type Option struct {
 	Key   string `json:"key" gorm:"primaryKey"`
-	Value string `json:"value"`
+	Value string `json:"value" gorm:"serializer:option_secret"`
+}
+
+// IsSecretOption 判断配置项是否为密钥类配置，此类配置不对外返回且加密保存
+func IsSecretOption(key string) bool {
+	return strings.HasSuffix(key, "Token") ||
+		strings.HasSuffix(key, "Secret") ||
+		strings.HasSuffix(key, "Key") ||
+		strings.HasSuffix(key, "secret") ||
+		strings.HasSuffix(key, "api_key") ||
+		strings.HasSuffix(key, "password")
 }
 
 func AllOption() ([]*Option, error) {
@@ -132,6 +142,7 @@ func InitOptionMap() {
 	common.OptionMap["ModelPrice"] = ratio_setting.ModelPrice2JSONString()
 	common.OptionMap["CacheRatio"] = ratio_setting.CacheRatio2JSONString()
 	common.OptionMap["CreateCacheRatio"] = ratio_setting.CreateCacheRatio2JSONString()
+	common.OptionMap["ModelPricingTiers"] = ratio_setting.ModelPricingTiers2JSONString()
 	common.OptionMap["GroupRatio"] = ratio_setting.GroupRatio2JSONString()
 	common.OptionMap["GroupGroupRatio"] = ratio_setting.GroupGroupRatio2JSONString()
 	common.OptionMap["UserUsableGroups"] = setting.UserUsableGroups2JSONString()
@@ -185,6 +196,12 @@ func loadOptionsFromDatabase() {
 	}
 }
 
+// ReloadOptions 从数据库重新加载全部配置项，用于批量导入配置后立即生效
+func ReloadOptions() {
+	loadOptionsFromDatabase()
+	common.PublishInvalidation(common.InvalidationOption, "")
+}
+
 func SyncOptions(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Second)
@@ -206,7 +223,11 @@ func UpdateOption(key string, value string) error {
 	// otherwise it will execute Update (with all fields).
 	DB.Save(&option)
 	// Update OptionMap
-	return updateOptionMap(key, value)
+	if err := updateOptionMap(key, value); err != nil {
+		return err
+	}
+	common.PublishInvalidation(common.InvalidationOption, key)
+	return nil
 }
 
 func updateOptionMap(key string, value string) (err error) {
@@ -476,6 +497,8 @@ func updateOptionMap(key string, value string) (err error) {
 		err = ratio_setting.UpdateCacheRatioByJSONString(value)
 	case "CreateCacheRatio":
 		err = ratio_setting.UpdateCreateCacheRatioByJSONString(value)
+	case "ModelPricingTiers":
+		err = ratio_setting.UpdateModelPricingTiersByJSONString(value)
 	case "ImageRatio":
 		err = ratio_setting.UpdateImageRatioByJSONString(value)
 	case "AudioRatio":
@@ -539,6 +562,9 @@ func handleConfigUpdate(key, value string) bool {
 		// 同步磁盘缓存配置到 common 包
 		performance_setting.UpdateAndSync()
 	}
+	if configName == "group_pricing_rule" && (configKey == "timezone" || configKey == "rules") {
+		ratio_setting.RefreshGroupPricingRuleLocations()
+	}
 
 	return true // 已处理
 }
@@ -0,0 +1,290 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PaymentReversalRefund             = "refund"              // 全额或部分退款
+	PaymentReversalDispute            = "dispute"             // 发起争议或拒付
+	PaymentReversalDisputeWon         = "dispute_won"         // 争议胜诉，恢复被扣回的额度
+	PaymentReversalSubscriptionCancel = "subscription_cancel" // 渠道侧取消订阅
+)
+
+var ErrPaymentReversalTargetNotFound = errors.New("payment for reversal not found")
+
+// PaymentEvent 已处理的支付渠道事件，(provider, event_id) 唯一，保证重复通知只处理一次
+type PaymentEvent struct {
+	Id         int     `json:"id"`
+	Provider   string  `json:"provider" gorm:"type:varchar(32);uniqueIndex:idx_payment_event,priority:1"`
+	EventId    string  `json:"event_id" gorm:"type:varchar(191);uniqueIndex:idx_payment_event,priority:2"`
+	Kind       string  `json:"kind" gorm:"type:varchar(32)"`
+	TradeNo    string  `json:"trade_no" gorm:"type:varchar(255);index"`
+	UserId     int     `json:"user_id" gorm:"index"`
+	Amount     float64 `json:"amount"`
+	QuotaDelta int     `json:"quota_delta"`
+	Reason     string  `json:"reason" gorm:"type:varchar(255)"`
+	CreatedAt  int64   `json:"created_at" gorm:"bigint"`
+}
+
+// PaymentReversal 一次退款、争议或取消通知。TradeNo 与 ProviderReference 至少提供一个
+type PaymentReversal struct {
+	Provider          string
+	EventId           string
+	Kind              string
+	TradeNo           string
+	ProviderReference string
+	// Amount 本次退款或争议的支付金额，0 表示剩余全部金额
+	Amount float64
+	// CumulativeRatio 渠道给出的累计退款比例 (0,1]，大于 0 时优先于 Amount
+	CumulativeRatio float64
+	Reason          string
+}
+
+// PaymentReversalResult 处理结果，供调用方通知管理员
+type PaymentReversalResult struct {
+	Duplicate bool   `json:"duplicate"`
+	TradeNo   string `json:"trade_no"`
+	UserId    int    `json:"user_id"`
+	Status    string `json:"status"`
+	// QuotaDelta 对用户余额的调整，扣回为负数
+	QuotaDelta int `json:"quota_delta"`
+	// SubscriptionId 需要失效的用户订阅
+	SubscriptionId int  `json:"subscription_id,omitempty"`
+	UserSuspended  bool `json:"user_suspended"`
+}
+
+// creditedTopUpQuota 返回订单实际入账的额度，优先取流水记录
+func creditedTopUpQuota(tx *gorm.DB, topUp *TopUp) int {
+	var entry QuotaLedger
+	if err := tx.Where("idempotency_key = ?", "topup:"+topUp.TradeNo).Limit(1).Find(&entry).Error; err == nil && entry.Id != 0 {
+		return entry.Amount
+	}
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	switch topUp.PaymentMethod {
+	case "stripe":
+		return int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
+	case "creem":
+		return int(topUp.Amount)
+	default:
+		return int(decimal.NewFromInt(topUp.Amount).Mul(dQuotaPerUnit).IntPart())
+	}
+}
+
+// proportionalQuota 按支付金额比例换算应扣回的额度
+func proportionalQuota(credited int, money float64, total float64) int {
+	if total <= 0 || money >= total {
+		return credited
+	}
+	return int(decimal.NewFromInt(int64(credited)).Mul(decimal.NewFromFloat(money)).Div(decimal.NewFromFloat(total)).IntPart())
+}
+
+func findReversalTopUpTx(tx *gorm.DB, r PaymentReversal) (*TopUp, error) {
+	var topUp TopUp
+	query := tx.Set("gorm:query_option", "FOR UPDATE")
+	var err error
+	if r.TradeNo != "" {
+		err = query.Where("trade_no = ?", r.TradeNo).Limit(1).Find(&topUp).Error
+	}
+	if err == nil && topUp.Id == 0 && r.ProviderReference != "" {
+		err = query.Where("provider_reference = ?", r.ProviderReference).Limit(1).Find(&topUp).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	if topUp.Id == 0 {
+		return nil, ErrPaymentReversalTargetNotFound
+	}
+	return &topUp, nil
+}
+
+// findOrderSubscriptionTx 找到订阅订单开通的用户订阅
+func findOrderSubscriptionTx(tx *gorm.DB, order *SubscriptionOrder) (int, error) {
+	var sub UserSubscription
+	err := tx.Where("user_id = ? AND plan_id = ? AND source = ? AND status = ? AND start_time >= ?",
+		order.UserId, order.PlanId, "order", "active", order.CreateTime).
+		Order("id asc").Limit(1).Find(&sub).Error
+	return sub.Id, err
+}
+
+// ApplyPaymentReversal 处理退款、争议与订阅取消：扣回或恢复额度、更新订单状态、必要时作废发票。
+// 订阅的失效需要调用方在事务外执行 AdminInvalidateUserSubscription。
+func ApplyPaymentReversal(r PaymentReversal) (*PaymentReversalResult, error) {
+	if r.Provider == "" || r.EventId == "" {
+		return nil, errors.New("provider and event id are required")
+	}
+	result := &PaymentReversalResult{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		event := PaymentEvent{
+			Provider:  r.Provider,
+			EventId:   r.EventId,
+			Kind:      r.Kind,
+			Reason:    r.Reason,
+			CreatedAt: common.GetTimestamp(),
+		}
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&event)
+		if created.Error != nil {
+			return created.Error
+		}
+		if created.RowsAffected == 0 {
+			result.Duplicate = true
+			return nil
+		}
+
+		topUp, err := findReversalTopUpTx(tx, r)
+		if err != nil {
+			return err
+		}
+		result.TradeNo = topUp.TradeNo
+		result.UserId = topUp.UserId
+
+		var order SubscriptionOrder
+		if err := tx.Where("trade_no = ?", topUp.TradeNo).Limit(1).Find(&order).Error; err != nil {
+			return err
+		}
+		isSubscription := order.Id != 0
+
+		remaining := topUp.Money - topUp.RefundedMoney
+		amount := remaining
+		if r.CumulativeRatio > 0 {
+			amount = topUp.Money*math.Min(r.CumulativeRatio, 1) - topUp.RefundedMoney
+		} else if r.Amount > 0 {
+			amount = r.Amount
+		}
+		if amount > remaining {
+			amount = remaining
+		}
+		quotaDelta := 0
+		switch r.Kind {
+		case PaymentReversalRefund, PaymentReversalDispute:
+			// 争议中的订单已全额扣回，不再重复处理
+			if topUp.Status != common.TopUpStatusSuccess && topUp.Status != common.TopUpStatusPartiallyRefunded {
+				break
+			}
+			if r.Kind == PaymentReversalRefund && amount <= 0.005 {
+				break
+			}
+			if !isSubscription {
+				quotaDelta = -proportionalQuota(creditedTopUpQuota(tx, topUp), amount, topUp.Money)
+			}
+			if r.Kind == PaymentReversalDispute {
+				topUp.Status = common.TopUpStatusDisputed
+			} else {
+				topUp.RefundedMoney += amount
+				topUp.Status = common.TopUpStatusPartiallyRefunded
+			}
+			fullyReversed := r.Kind == PaymentReversalDispute || topUp.RefundedMoney >= topUp.Money-0.005
+			if fullyReversed {
+				if r.Kind == PaymentReversalRefund {
+					topUp.Status = common.TopUpStatusRefunded
+				}
+				if isSubscription {
+					if result.SubscriptionId, err = findOrderSubscriptionTx(tx, &order); err != nil {
+						return err
+					}
+				}
+				if inv, err := getActiveInvoiceByTradeNoTx(tx, topUp.TradeNo); err != nil {
+					return err
+				} else if inv != nil {
+					if _, err := voidInvoiceTx(tx, inv.Id, r.Kind); err != nil {
+						return err
+					}
+				}
+			}
+		case PaymentReversalDisputeWon:
+			if topUp.Status != common.TopUpStatusDisputed {
+				break
+			}
+			// 恢复此前争议扣回的额度
+			var clawed int64
+			if err := tx.Model(&PaymentEvent{}).Where("trade_no = ? AND kind = ?", topUp.TradeNo, PaymentReversalDispute).
+				Select("COALESCE(sum(quota_delta), 0)").Scan(&clawed).Error; err != nil {
+				return err
+			}
+			quotaDelta = int(-clawed)
+			topUp.Status = common.TopUpStatusSuccess
+			if topUp.RefundedMoney > 0 {
+				topUp.Status = common.TopUpStatusPartiallyRefunded
+			}
+		case PaymentReversalSubscriptionCancel:
+			if isSubscription {
+				if result.SubscriptionId, err = findOrderSubscriptionTx(tx, &order); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unknown payment reversal kind %q", r.Kind)
+		}
+
+		if quotaDelta != 0 {
+			if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).
+				Update("quota", gorm.Expr("quota + ?", quotaDelta)).Error; err != nil {
+				return err
+			}
+			if err := RecordQuotaLedger(tx, topUp.UserId, quotaDelta, QuotaLedgerMeta{
+				Type:           QuotaLedgerTypeChargeback,
+				IdempotencyKey: fmt.Sprintf("chargeback:%s:%s", r.Provider, r.EventId),
+				ReferenceId:    topUp.TradeNo,
+				Remark:         r.Kind,
+			}); err != nil {
+				return err
+			}
+			if quotaDelta < 0 && operation_setting.GetPaymentReversalSetting().Policy == operation_setting.PaymentReversalPolicySuspend {
+				var quota int
+				if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Select("quota").Find(&quota).Error; err != nil {
+					return err
+				}
+				if quota+pendingBatchUserQuota(topUp.UserId) < 0 {
+					if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).
+						Update("status", common.UserStatusDisabled).Error; err != nil {
+						return err
+					}
+					result.UserSuspended = true
+				}
+			}
+		}
+		if err := tx.Model(&TopUp{}).Where("id = ?", topUp.Id).Updates(map[string]interface{}{
+			"status":         topUp.Status,
+			"refunded_money": math.Round(topUp.RefundedMoney*100) / 100,
+		}).Error; err != nil {
+			return err
+		}
+		result.Status = topUp.Status
+		result.QuotaDelta = quotaDelta
+		return tx.Model(&PaymentEvent{}).Where("id = ?", event.Id).Updates(map[string]interface{}{
+			"trade_no":    topUp.TradeNo,
+			"user_id":     topUp.UserId,
+			"amount":      amount,
+			"quota_delta": quotaDelta,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !result.Duplicate && result.UserId > 0 && (result.QuotaDelta != 0 || result.UserSuspended) {
+		_ = invalidateUserCache(result.UserId)
+	}
+	return result, nil
+}
+
+// GetPaymentEvents 分页查询已处理的支付渠道事件
+func GetPaymentEvents(tradeNo string, startIdx int, num int) (events []*PaymentEvent, total int64, err error) {
+	tx := DB.Model(&PaymentEvent{})
+	if tradeNo != "" {
+		tx = tx.Where("trade_no = ?", tradeNo)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&events).Error
+	return events, total, err
+}
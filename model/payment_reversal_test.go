@@ -0,0 +1,109 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+// 10 美元的 Stripe 订单入账 10 * QuotaPerUnit
+func setupReversalTopUp(t *testing.T, userId int, tradeNo string) int {
+	t.Helper()
+	credited := int(10 * common.QuotaPerUnit)
+	insertLedgerUser(t, userId, credited)
+	insertPaidTopUp(t, userId, tradeNo, 10)
+	return credited
+}
+
+func getUserQuotaForTest(t *testing.T, userId int) int {
+	t.Helper()
+	var user User
+	require.NoError(t, DB.First(&user, userId).Error)
+	return user.Quota
+}
+
+func TestPaymentReversalPartialThenFullRefund(t *testing.T) {
+	truncateTables(t)
+	useQuotaLedgerSetting(t)
+	credited := setupReversalTopUp(t, 1, "trade-refund")
+
+	result, err := ApplyPaymentReversal(PaymentReversal{Provider: "stripe", EventId: "evt-1", Kind: PaymentReversalRefund, TradeNo: "trade-refund", Amount: 4})
+	require.NoError(t, err)
+	require.Equal(t, -credited*4/10, result.QuotaDelta)
+	require.Equal(t, common.TopUpStatusPartiallyRefunded, result.Status)
+
+	// 累计比例 100%，只扣回剩余部分
+	result, err = ApplyPaymentReversal(PaymentReversal{Provider: "stripe", EventId: "evt-2", Kind: PaymentReversalRefund, TradeNo: "trade-refund", CumulativeRatio: 1})
+	require.NoError(t, err)
+	require.Equal(t, -credited*6/10, result.QuotaDelta)
+	require.Equal(t, common.TopUpStatusRefunded, result.Status)
+	require.Equal(t, 0, getUserQuotaForTest(t, 1))
+
+	drifts, err := ReconcileQuotaLedger(0)
+	require.NoError(t, err)
+	require.Empty(t, drifts)
+}
+
+func TestPaymentReversalDuplicateEvent(t *testing.T) {
+	truncateTables(t)
+	credited := setupReversalTopUp(t, 2, "trade-dup")
+
+	reversal := PaymentReversal{Provider: "creem", EventId: "evt-dup", Kind: PaymentReversalRefund, TradeNo: "trade-dup", Amount: 5}
+	_, err := ApplyPaymentReversal(reversal)
+	require.NoError(t, err)
+	result, err := ApplyPaymentReversal(reversal)
+	require.NoError(t, err)
+	require.True(t, result.Duplicate)
+	require.Equal(t, credited/2, getUserQuotaForTest(t, 2))
+}
+
+func TestPaymentReversalDisputeWonRestoresQuota(t *testing.T) {
+	truncateTables(t)
+	credited := setupReversalTopUp(t, 3, "trade-dispute")
+	require.NoError(t, DB.Model(&TopUp{}).Where("trade_no = ?", "trade-dispute").Update("provider_reference", "pi_123").Error)
+
+	result, err := ApplyPaymentReversal(PaymentReversal{Provider: "stripe", EventId: "evt-d1", Kind: PaymentReversalDispute, ProviderReference: "pi_123"})
+	require.NoError(t, err)
+	require.Equal(t, -credited, result.QuotaDelta)
+	require.Equal(t, common.TopUpStatusDisputed, result.Status)
+
+	// 争议期间的退款通知不会重复扣回
+	result, err = ApplyPaymentReversal(PaymentReversal{Provider: "stripe", EventId: "evt-d2", Kind: PaymentReversalRefund, ProviderReference: "pi_123"})
+	require.NoError(t, err)
+	require.Zero(t, result.QuotaDelta)
+
+	result, err = ApplyPaymentReversal(PaymentReversal{Provider: "stripe", EventId: "evt-d3", Kind: PaymentReversalDisputeWon, ProviderReference: "pi_123"})
+	require.NoError(t, err)
+	require.Equal(t, credited, result.QuotaDelta)
+	require.Equal(t, common.TopUpStatusSuccess, result.Status)
+	require.Equal(t, credited, getUserQuotaForTest(t, 3))
+}
+
+func TestPaymentReversalSuspendPolicy(t *testing.T) {
+	truncateTables(t)
+	setting := operation_setting.GetPaymentReversalSetting()
+	original := *setting
+	setting.Policy = operation_setting.PaymentReversalPolicySuspend
+	t.Cleanup(func() { *setting = original })
+
+	credited := setupReversalTopUp(t, 4, "trade-suspend")
+	// 用户已消耗部分额度，扣回后余额为负
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", 4).Update("quota", credited/2).Error)
+
+	result, err := ApplyPaymentReversal(PaymentReversal{Provider: "stripe", EventId: "evt-s1", Kind: PaymentReversalRefund, TradeNo: "trade-suspend"})
+	require.NoError(t, err)
+	require.True(t, result.UserSuspended)
+
+	var user User
+	require.NoError(t, DB.First(&user, 4).Error)
+	require.Equal(t, common.UserStatusDisabled, user.Status)
+	require.Equal(t, -credited/2, user.Quota)
+}
+
+func TestPaymentReversalUnknownOrder(t *testing.T) {
+	truncateTables(t)
+	_, err := ApplyPaymentReversal(PaymentReversal{Provider: "stripe", EventId: "evt-x", Kind: PaymentReversalRefund, TradeNo: "missing"})
+	require.ErrorIs(t, err, ErrPaymentReversalTargetNotFound)
+}
@@ -1,9 +1,16 @@
 package model
 
+import "github.com/QuantumNous/new-api/common"
+
 // RefreshPricing 强制立即重新计算与定价相关的缓存。
 // 该方法用于需要最新数据的内部管理 API，
-// 因此会绕过默认的 1 分钟延迟刷新。
+// 因此会绕过默认的 1 分钟延迟刷新，并通知其他实例同步刷新。
 func RefreshPricing() {
+	refreshPricing()
+	common.PublishInvalidation(common.InvalidationPricing, "")
+}
+
+func refreshPricing() {
 	updatePricingLock.Lock()
 	defer updatePricingLock.Unlock()
 
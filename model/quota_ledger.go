@@ -0,0 +1,296 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	QuotaLedgerAccountWallet       = "wallet"       // 用户余额 users.quota
+	QuotaLedgerAccountSubscription = "subscription" // 订阅额度，余额为订阅剩余额度
+)
+
+const (
+	QuotaLedgerTypeOpening           = "opening" // 首次记账时的期初余额
+	QuotaLedgerTypeTopUp             = "topup"
+	QuotaLedgerTypeRedemption        = "redemption"
+	QuotaLedgerTypeCheckin           = "checkin"
+	QuotaLedgerTypeAffiliate         = "affiliate"
+	QuotaLedgerTypeInvite            = "invite"
+	QuotaLedgerTypePreConsume        = "pre_consume"
+	QuotaLedgerTypeSettle            = "settle"
+	QuotaLedgerTypeRefund            = "refund"
+	QuotaLedgerTypeSubscriptionReset = "subscription_reset"
+	QuotaLedgerTypeAdmin             = "admin"
+	QuotaLedgerTypeChargeback        = "chargeback" // 退款或拒付扣回
+	QuotaLedgerTypeExpire            = "expire"     // 额度桶过期
+	QuotaLedgerTypeAdjust            = "adjust"     // 未标注来源的额度变动
+)
+
+var errQuotaLedgerImmutable = errors.New("quota ledger entries are immutable")
+
+// QuotaLedger 只追加的额度流水，每条记录变动金额与变动后的账本余额
+type QuotaLedger struct {
+	Id             int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserId         int    `json:"user_id" gorm:"index:idx_quota_ledger_user_account,priority:1"`
+	Account        string `json:"account" gorm:"type:varchar(16);index:idx_quota_ledger_user_account,priority:2;default:'wallet'"`
+	Type           string `json:"type" gorm:"type:varchar(32);index"`
+	Amount         int    `json:"amount"`
+	BalanceAfter   int    `json:"balance_after"`
+	IdempotencyKey string `json:"idempotency_key" gorm:"type:varchar(191);uniqueIndex"`
+	RequestId      string `json:"request_id,omitempty" gorm:"type:varchar(64);default:''"`
+	TokenId        int    `json:"token_id,omitempty" gorm:"default:0"`
+	// ReferenceId 关联的业务单据，例如充值订单号、兑换码 id、任务 id
+	ReferenceId string `json:"reference_id,omitempty" gorm:"type:varchar(128);default:''"`
+	Remark      string `json:"remark,omitempty" gorm:"type:varchar(255);default:''"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// QuotaLedgerMeta 额度变动的来源信息，IdempotencyKey 为空时自动生成
+type QuotaLedgerMeta struct {
+	Type           string
+	IdempotencyKey string
+	RequestId      string
+	TokenId        int
+	ReferenceId    string
+	Remark         string
+}
+
+func (l *QuotaLedger) BeforeUpdate(tx *gorm.DB) error {
+	return errQuotaLedgerImmutable
+}
+
+func (l *QuotaLedger) BeforeDelete(tx *gorm.DB) error {
+	return errQuotaLedgerImmutable
+}
+
+func pickQuotaLedgerMeta(metas []QuotaLedgerMeta, defaultType string) QuotaLedgerMeta {
+	meta := QuotaLedgerMeta{}
+	if len(metas) > 0 {
+		meta = metas[0]
+	}
+	if meta.Type == "" {
+		meta.Type = defaultType
+	}
+	return meta
+}
+
+// pendingBatchUserQuota 返回批量更新中尚未写入数据库的用户额度变动
+func pendingBatchUserQuota(userId int) int {
+	batchUpdateLocks[BatchUpdateTypeUserQuota].Lock()
+	defer batchUpdateLocks[BatchUpdateTypeUserQuota].Unlock()
+	return batchUpdateStores[BatchUpdateTypeUserQuota][userId]
+}
+
+// quotaLedgerActive 开启额度流水或额度桶时，用户余额变动需要与记账在同一事务内完成
+func quotaLedgerActive() bool {
+	return operation_setting.GetQuotaLedgerSetting().Enabled || operation_setting.GetCreditBucketSetting().Enabled
+}
+
+// updateUserQuotaWithLedger 在同一事务内修改用户余额并记账，记账失败时余额变动一并回滚；
+// 此时不再合并批量更新
+func updateUserQuotaWithLedger(userId int, delta int, meta QuotaLedgerMeta) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", delta)).Error; err != nil {
+			return err
+		}
+		return RecordQuotaLedger(tx, userId, delta, meta)
+	})
+}
+
+// RecordQuotaLedger 记录一次用户余额变动并同步额度桶，必须在同一事务内实际修改 users.quota 之后调用：
+// 加锁读取变动后的余额作为 balance_after，流水与余额一同提交或回滚，多实例并发时也不会分叉。
+// tx 为空时单独开启事务；相同 IdempotencyKey 的记录只会写入一次。
+func RecordQuotaLedger(tx *gorm.DB, userId int, amount int, meta QuotaLedgerMeta) error {
+	ledgerEnabled := operation_setting.GetQuotaLedgerSetting().Enabled
+	bucketEnabled := operation_setting.GetCreditBucketSetting().Enabled
+	if (!ledgerEnabled && !bucketEnabled) || amount == 0 || userId <= 0 {
+		return nil
+	}
+	if tx == nil {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			return RecordQuotaLedger(tx, userId, amount, meta)
+		})
+	}
+	if meta.Type == "" {
+		meta.Type = QuotaLedgerTypeAdjust
+	}
+	if meta.IdempotencyKey == "" {
+		meta.IdempotencyKey = fmt.Sprintf("%s:%s", meta.Type, common.GetUUID())
+	}
+
+	if ledgerEnabled {
+		balance, err := lockUserQuotaBalance(tx, userId)
+		if err != nil {
+			return err
+		}
+		if err := ensureQuotaLedgerOpening(tx, userId, balance-amount); err != nil {
+			return err
+		}
+		entry := QuotaLedger{
+			UserId:         userId,
+			Account:        QuotaLedgerAccountWallet,
+			Type:           meta.Type,
+			Amount:         amount,
+			BalanceAfter:   balance,
+			IdempotencyKey: meta.IdempotencyKey,
+			RequestId:      meta.RequestId,
+			TokenId:        meta.TokenId,
+			ReferenceId:    meta.ReferenceId,
+			Remark:         meta.Remark,
+			CreatedAt:      common.GetTimestamp(),
+		}
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+		if created.Error != nil {
+			return created.Error
+		}
+		// 重复入账不再变动额度桶
+		if created.RowsAffected == 0 {
+			return nil
+		}
+	}
+	if bucketEnabled {
+		return applyCreditBucketsTx(tx, userId, amount, meta)
+	}
+	return nil
+}
+
+// lockUserQuotaBalance 锁定用户行并返回当前余额（含未落库的批量更新），同一用户的记账在事务提交前串行；
+// SQLite 的写事务本身串行，不支持 FOR UPDATE
+func lockUserQuotaBalance(tx *gorm.DB, userId int) (int, error) {
+	query := tx.Model(&User{}).Where("id = ?", userId).Select("quota")
+	if !common.UsingSQLite {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	var quota int
+	if err := query.Find(&quota).Error; err != nil {
+		return 0, err
+	}
+	return quota + pendingBatchUserQuota(userId), nil
+}
+
+// ensureQuotaLedgerOpening 用户首次记账时以变动前的余额写入期初记录
+func ensureQuotaLedgerOpening(tx *gorm.DB, userId int, balance int) error {
+	var count int64
+	err := tx.Model(&QuotaLedger{}).Where("user_id = ? AND account = ?", userId, QuotaLedgerAccountWallet).
+		Limit(1).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	opening := QuotaLedger{
+		UserId:         userId,
+		Account:        QuotaLedgerAccountWallet,
+		Type:           QuotaLedgerTypeOpening,
+		Amount:         balance,
+		BalanceAfter:   balance,
+		IdempotencyKey: fmt.Sprintf("opening:%d", userId),
+		CreatedAt:      common.GetTimestamp(),
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&opening).Error
+}
+
+// recordSubscriptionLedgerTx 记录订阅额度变动，余额为订阅剩余额度
+func recordSubscriptionLedgerTx(tx *gorm.DB, sub *UserSubscription, amount int64, meta QuotaLedgerMeta) error {
+	if !operation_setting.GetQuotaLedgerSetting().Enabled || amount == 0 || sub == nil {
+		return nil
+	}
+	if meta.IdempotencyKey == "" {
+		meta.IdempotencyKey = fmt.Sprintf("%s:%s", meta.Type, common.GetUUID())
+	}
+	entry := QuotaLedger{
+		UserId:         sub.UserId,
+		Account:        QuotaLedgerAccountSubscription,
+		Type:           meta.Type,
+		Amount:         int(amount),
+		BalanceAfter:   int(sub.AmountTotal - sub.AmountUsed),
+		IdempotencyKey: meta.IdempotencyKey,
+		ReferenceId:    meta.ReferenceId,
+		Remark:         meta.Remark,
+		CreatedAt:      common.GetTimestamp(),
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error
+}
+
+// GetUserQuotaLedger 分页查询用户流水，按时间倒序
+func GetUserQuotaLedger(userId int, account string, ledgerType string, startTimestamp int64, endTimestamp int64, startIdx int, num int) (entries []*QuotaLedger, total int64, err error) {
+	tx := DB.Model(&QuotaLedger{}).Where("user_id = ?", userId)
+	if account != "" {
+		tx = tx.Where("account = ?", account)
+	}
+	if ledgerType != "" {
+		tx = tx.Where("type = ?", ledgerType)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&entries).Error
+	return entries, total, err
+}
+
+// QuotaLedgerDrift 用户余额与账本余额的差异
+type QuotaLedgerDrift struct {
+	UserId        int `json:"user_id"`
+	Quota         int `json:"quota"`
+	LedgerBalance int `json:"ledger_balance"`
+	LedgerSum     int `json:"ledger_sum"`
+	Drift         int `json:"drift"`
+}
+
+// ReconcileQuotaLedger 比对用户余额（含未落库的批量更新）与账本最新余额及流水合计，返回超过阈值的差异
+func ReconcileQuotaLedger(threshold int) ([]QuotaLedgerDrift, error) {
+	type ledgerRow struct {
+		UserId       int
+		BalanceAfter int
+		LedgerSum    int
+		Quota        int
+	}
+	var rows []ledgerRow
+	latest := DB.Model(&QuotaLedger{}).Select("max(id)").
+		Where("account = ?", QuotaLedgerAccountWallet).Group("user_id")
+	sums := DB.Model(&QuotaLedger{}).Select("user_id, sum(amount) as ledger_sum").
+		Where("account = ?", QuotaLedgerAccountWallet).Group("user_id")
+	err := DB.Table("quota_ledgers AS l").
+		Select("l.user_id, l.balance_after, s.ledger_sum, u.quota").
+		Joins("JOIN (?) AS s ON s.user_id = l.user_id", sums).
+		Joins("JOIN users AS u ON u.id = l.user_id").
+		Where("l.id IN (?)", latest).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	if threshold < 0 {
+		threshold = 0
+	}
+	drifts := make([]QuotaLedgerDrift, 0)
+	for _, row := range rows {
+		quota := row.Quota + pendingBatchUserQuota(row.UserId)
+		drift := quota - row.BalanceAfter
+		absDrift := drift
+		if absDrift < 0 {
+			absDrift = -absDrift
+		}
+		if absDrift <= threshold && row.LedgerSum == row.BalanceAfter {
+			continue
+		}
+		drifts = append(drifts, QuotaLedgerDrift{
+			UserId:        row.UserId,
+			Quota:         quota,
+			LedgerBalance: row.BalanceAfter,
+			LedgerSum:     row.LedgerSum,
+			Drift:         drift,
+		})
+	}
+	return drifts, nil
+}
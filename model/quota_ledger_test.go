@@ -0,0 +1,118 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// useQuotaLedgerSetting 测试期间开启额度流水，结束后恢复
+func useQuotaLedgerSetting(t *testing.T) {
+	t.Helper()
+	setting := operation_setting.GetQuotaLedgerSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.Enabled = true
+}
+
+func insertLedgerUser(t *testing.T, id int, quota int) {
+	t.Helper()
+	require.NoError(t, DB.Create(&User{Id: id, Username: "ledger_user", Quota: quota, AffCode: "ledger"}).Error)
+}
+
+func TestQuotaLedgerOpeningAndBalanceChain(t *testing.T) {
+	truncateTables(t)
+	useQuotaLedgerSetting(t)
+	insertLedgerUser(t, 1, 1000)
+
+	require.NoError(t, DecreaseUserQuota(1, 300, QuotaLedgerMeta{Type: QuotaLedgerTypePreConsume, IdempotencyKey: "pre_consume:req-1"}))
+	require.NoError(t, IncreaseUserQuota(1, 100, true, QuotaLedgerMeta{Type: QuotaLedgerTypeRefund, IdempotencyKey: "refund:req-1"}))
+
+	entries, total, err := GetUserQuotaLedger(1, QuotaLedgerAccountWallet, "", 0, 0, 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, total)
+	// 倒序：refund、pre_consume、opening
+	require.Equal(t, QuotaLedgerTypeOpening, entries[2].Type)
+	require.Equal(t, 1000, entries[2].BalanceAfter)
+	require.Equal(t, -300, entries[1].Amount)
+	require.Equal(t, 700, entries[1].BalanceAfter)
+	require.Equal(t, 800, entries[0].BalanceAfter)
+
+	drifts, err := ReconcileQuotaLedger(0)
+	require.NoError(t, err)
+	require.Empty(t, drifts)
+}
+
+func TestQuotaLedgerIdempotencyKey(t *testing.T) {
+	truncateTables(t)
+	useQuotaLedgerSetting(t)
+	insertLedgerUser(t, 2, 500)
+
+	meta := QuotaLedgerMeta{Type: QuotaLedgerTypeTopUp, IdempotencyKey: "topup:order-1"}
+	require.NoError(t, RecordQuotaLedger(nil, 2, 200, meta))
+	require.NoError(t, RecordQuotaLedger(nil, 2, 200, meta))
+
+	_, total, err := GetUserQuotaLedger(2, "", QuotaLedgerTypeTopUp, 0, 0, 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+}
+
+func TestQuotaLedgerReconcileDetectsDrift(t *testing.T) {
+	truncateTables(t)
+	useQuotaLedgerSetting(t)
+	insertLedgerUser(t, 3, 1000)
+
+	require.NoError(t, DecreaseUserQuota(3, 100))
+	// 绕过账本直接修改余额
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", 3).Update("quota", 2000).Error)
+
+	drifts, err := ReconcileQuotaLedger(0)
+	require.NoError(t, err)
+	require.Len(t, drifts, 1)
+	require.Equal(t, 3, drifts[0].UserId)
+	require.Equal(t, 900, drifts[0].LedgerBalance)
+	require.Equal(t, 1100, drifts[0].Drift)
+
+	drifts, err = ReconcileQuotaLedger(2000)
+	require.NoError(t, err)
+	require.Empty(t, drifts)
+}
+
+func TestQuotaLedgerEntriesAreImmutable(t *testing.T) {
+	truncateTables(t)
+	useQuotaLedgerSetting(t)
+	insertLedgerUser(t, 4, 100)
+	require.NoError(t, RecordQuotaLedger(nil, 4, 50, QuotaLedgerMeta{}))
+
+	var entry QuotaLedger
+	require.NoError(t, DB.Where("user_id = ? AND type = ?", 4, QuotaLedgerTypeAdjust).First(&entry).Error)
+	require.Error(t, DB.Model(&entry).Update("amount", 1).Error)
+	require.Error(t, DB.Delete(&entry).Error)
+}
+
+func TestQuotaLedgerRolledBackWithQuotaUpdate(t *testing.T) {
+	truncateTables(t)
+	useQuotaLedgerSetting(t)
+	insertLedgerUser(t, 5, 1000)
+
+	// 记账与余额变动在同一事务内，事务回滚时两者都不生效
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		require.NoError(t, tx.Model(&User{}).Where("id = ?", 5).Update("quota", gorm.Expr("quota + ?", 200)).Error)
+		require.NoError(t, RecordQuotaLedger(tx, 5, 200, QuotaLedgerMeta{Type: QuotaLedgerTypeTopUp}))
+		return errors.New("payment failed")
+	})
+	require.Error(t, err)
+	_, total, err := GetUserQuotaLedger(5, "", "", 0, 0, 0, 10)
+	require.NoError(t, err)
+	require.Zero(t, total)
+
+	// 默认关闭时不记账
+	operation_setting.GetQuotaLedgerSetting().Enabled = false
+	require.NoError(t, DecreaseUserQuota(5, 100))
+	_, total, err = GetUserQuotaLedger(5, "", "", 0, 0, 0, 10)
+	require.NoError(t, err)
+	require.Zero(t, total)
+}
@@ -27,6 +27,10 @@ type Redemption struct {
 	UsedUserId   int            `json:"used_user_id"`
 	DeletedAt    gorm.DeletedAt `gorm:"index"`
 	ExpiredTime  int64          `json:"expired_time" gorm:"bigint"` // 过期时间，0 表示不过期
+	// 活动兑换码字段，CampaignId 为 0 时为普通一次性兑换码
+	CampaignId int `json:"campaign_id" gorm:"index;default:0"`
+	UsageLimit int `json:"usage_limit" gorm:"default:0"` // 单个兑换码可兑换次数，0 表示只受活动总量限制
+	UsedCount  int `json:"used_count" gorm:"default:0"`
 }
 
 func GetAllRedemptions(startIdx int, num int) (redemptions []*Redemption, total int64, err error) {
@@ -116,20 +120,30 @@ func GetRedemptionById(id int) (*Redemption, error) {
 }
 
 func Redeem(key string, userId int) (quota int, err error) {
+	result, err := RedeemWithResult(key, userId)
+	if err != nil {
+		return 0, err
+	}
+	return result.Quota, nil
+}
+
+// RedeemWithResult 兑换普通兑换码或活动兑换码，返回获得的奖励
+func RedeemWithResult(key string, userId int) (*RedeemResult, error) {
 	if key == "" {
-		return 0, errors.New("未提供兑换码")
+		return nil, errors.New("未提供兑换码")
 	}
 	if userId == 0 {
-		return 0, errors.New("无效的 user id")
+		return nil, errors.New("无效的 user id")
 	}
 	redemption := &Redemption{}
+	result := &RedeemResult{RewardType: RedemptionRewardQuota}
 
 	keyCol := "`key`"
 	if common.UsingPostgreSQL {
 		keyCol = `"key"`
 	}
 	common.RandomSleep()
-	err = DB.Transaction(func(tx *gorm.DB) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
 		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
 		if err != nil {
 			return errors.New("无效的兑换码")
@@ -140,10 +154,23 @@ func Redeem(key string, userId int) (quota int, err error) {
 		if redemption.ExpiredTime != 0 && redemption.ExpiredTime < common.GetTimestamp() {
 			return errors.New("该兑换码已过期")
 		}
+		if redemption.CampaignId != 0 {
+			result, err = redeemCampaignCodeTx(tx, redemption, userId)
+			return err
+		}
+		result.Quota = redemption.Quota
 		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
 		if err != nil {
 			return err
 		}
+		err = RecordQuotaLedger(tx, userId, redemption.Quota, QuotaLedgerMeta{
+			Type:           QuotaLedgerTypeRedemption,
+			IdempotencyKey: fmt.Sprintf("redemption:%d", redemption.Id),
+			ReferenceId:    strconv.Itoa(redemption.Id),
+		})
+		if err != nil {
+			return err
+		}
 		redemption.RedeemedTime = common.GetTimestamp()
 		redemption.Status = common.RedemptionCodeStatusUsed
 		redemption.UsedUserId = userId
@@ -151,11 +178,25 @@ func Redeem(key string, userId int) (quota int, err error) {
 		return err
 	})
 	if err != nil {
+		var restricted *RedeemRestrictionError
+		if errors.As(err, &restricted) {
+			return nil, err
+		}
 		common.SysError("redemption failed: " + err.Error())
-		return 0, ErrRedeemFailed
+		return nil, ErrRedeemFailed
+	}
+	if result.Group != "" {
+		_ = UpdateUserGroupCache(userId, result.Group)
+	}
+	switch result.RewardType {
+	case RedemptionRewardQuota:
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", logger.LogQuota(result.Quota), redemption.Id))
+	case RedemptionRewardSubscription:
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码开通订阅，兑换码ID %d", redemption.Id))
+	case RedemptionRewardGroup:
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码临时升级到分组 %s，兑换码ID %d", result.Group, redemption.Id))
 	}
-	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", logger.LogQuota(redemption.Quota), redemption.Id))
-	return redemption.Quota, nil
+	return result, nil
 }
 
 func (redemption *Redemption) Insert() error {
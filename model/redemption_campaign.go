@@ -0,0 +1,458 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RedemptionRewardQuota        = "quota"
+	RedemptionRewardSubscription = "subscription"
+	RedemptionRewardGroup        = "group" // 临时升级用户分组
+)
+
+const (
+	RedemptionGroupGrantActive  = "active"
+	RedemptionGroupGrantExpired = "expired"
+)
+
+// 活动兑换码随机部分长度，加前缀后不超过 Redemption.Key 的 32 位
+const redemptionCampaignKeyRandomLength = 16
+
+var redemptionKeyPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{0,16}$`)
+
+// RedeemRestrictionError 兑换码有效但用户不满足活动条件，消息可直接返回给用户
+type RedeemRestrictionError struct {
+	Message string
+}
+
+func (e *RedeemRestrictionError) Error() string {
+	return e.Message
+}
+
+func redeemRestricted(msg string) error {
+	return &RedeemRestrictionError{Message: msg}
+}
+
+// RedemptionCampaign 兑换活动，活动下的兑换码可多次使用，奖励与限制由活动统一配置
+type RedemptionCampaign struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);index"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+	RewardType  string `json:"reward_type" gorm:"type:varchar(16)"`
+	Quota       int    `json:"quota"`
+	PlanId      int    `json:"plan_id"`
+	Group       string `json:"group" gorm:"type:varchar(64)"`
+	GroupDays   int    `json:"group_days"`
+	// MaxUses 活动总兑换次数，0 表示不限
+	MaxUses int `json:"max_uses"`
+	// PerUserLimit 每个用户可兑换次数，0 表示不限
+	PerUserLimit int `json:"per_user_limit"`
+	// NewUserDays 仅限注册 N 天内的用户，0 表示不限
+	NewUserDays int `json:"new_user_days"`
+	// AllowedGroups 允许兑换的用户分组，逗号分隔，为空表示不限
+	AllowedGroups string `json:"allowed_groups" gorm:"type:varchar(255)"`
+	StartTime     int64  `json:"start_time" gorm:"bigint"`
+	EndTime       int64  `json:"end_time" gorm:"bigint"`
+	Status        int    `json:"status" gorm:"default:1"`
+	UsedCount     int    `json:"used_count" gorm:"default:0"`
+	CreatedBy     int    `json:"created_by"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+}
+
+// RedemptionUse 活动兑换记录
+type RedemptionUse struct {
+	Id           int    `json:"id"`
+	CampaignId   int    `json:"campaign_id" gorm:"index:idx_redemption_use_campaign_user,priority:1"`
+	UserId       int    `json:"user_id" gorm:"index:idx_redemption_use_campaign_user,priority:2"`
+	RedemptionId int    `json:"redemption_id" gorm:"index"`
+	RewardType   string `json:"reward_type" gorm:"type:varchar(16)"`
+	Quota        int    `json:"quota"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint;index"`
+}
+
+// RedemptionGroupGrant 兑换获得的临时分组，到期后恢复原分组
+type RedemptionGroupGrant struct {
+	Id         int    `json:"id"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	CampaignId int    `json:"campaign_id"`
+	Group      string `json:"group" gorm:"type:varchar(64)"`
+	PrevGroup  string `json:"prev_group" gorm:"type:varchar(64)"`
+	ExpiresAt  int64  `json:"expires_at" gorm:"bigint;index"`
+	Status     string `json:"status" gorm:"type:varchar(16);index"`
+}
+
+// RedeemResult 兑换结果
+type RedeemResult struct {
+	RewardType     string `json:"reward_type"`
+	Quota          int    `json:"quota"`
+	SubscriptionId int    `json:"subscription_id,omitempty"`
+	Group          string `json:"group,omitempty"`
+	GroupExpiresAt int64  `json:"group_expires_at,omitempty"`
+}
+
+func (campaign *RedemptionCampaign) allowedGroups() []string {
+	groups := make([]string, 0)
+	for _, g := range strings.Split(campaign.AllowedGroups, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// Validate 校验活动配置
+func (campaign *RedemptionCampaign) Validate() error {
+	campaign.Name = strings.TrimSpace(campaign.Name)
+	if campaign.Name == "" || len([]rune(campaign.Name)) > 64 {
+		return errors.New("活动名称长度必须在 1 到 64 之间")
+	}
+	if campaign.MaxUses < 0 || campaign.PerUserLimit < 0 || campaign.NewUserDays < 0 {
+		return errors.New("次数与天数不能为负数")
+	}
+	if campaign.EndTime != 0 && campaign.EndTime <= campaign.StartTime {
+		return errors.New("结束时间必须晚于开始时间")
+	}
+	switch campaign.RewardType {
+	case RedemptionRewardQuota:
+		if campaign.Quota <= 0 {
+			return errors.New("奖励额度必须大于 0")
+		}
+	case RedemptionRewardSubscription:
+		if campaign.PlanId <= 0 {
+			return errors.New("请选择订阅套餐")
+		}
+		if _, err := GetSubscriptionPlanById(campaign.PlanId); err != nil {
+			return errors.New("订阅套餐不存在")
+		}
+	case RedemptionRewardGroup:
+		campaign.Group = strings.TrimSpace(campaign.Group)
+		if campaign.Group == "" || campaign.GroupDays <= 0 {
+			return errors.New("请设置升级分组与有效天数")
+		}
+	default:
+		return errors.New("无效的奖励类型")
+	}
+	return nil
+}
+
+func (campaign *RedemptionCampaign) Insert() error {
+	campaign.CreatedTime = common.GetTimestamp()
+	if campaign.Status == 0 {
+		campaign.Status = common.RedemptionCodeStatusEnabled
+	}
+	return DB.Create(campaign).Error
+}
+
+// Update 更新活动配置，已兑换次数不受影响
+func (campaign *RedemptionCampaign) Update() error {
+	return DB.Model(campaign).Select("name", "description", "reward_type", "quota", "plan_id", "group", "group_days",
+		"max_uses", "per_user_limit", "new_user_days", "allowed_groups", "start_time", "end_time", "status").
+		Updates(campaign).Error
+}
+
+func GetRedemptionCampaignById(id int) (*RedemptionCampaign, error) {
+	var campaign RedemptionCampaign
+	if err := DB.First(&campaign, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+func GetRedemptionCampaigns(keyword string, startIdx int, num int) (campaigns []*RedemptionCampaign, total int64, err error) {
+	tx := DB.Model(&RedemptionCampaign{})
+	if keyword != "" {
+		tx = tx.Where("name LIKE ?", keyword+"%")
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&campaigns).Error
+	return campaigns, total, err
+}
+
+// GenerateCampaignCodes 批量生成活动兑换码，返回生成的兑换码
+func GenerateCampaignCodes(campaign *RedemptionCampaign, prefix string, count int, usageLimit int, expiredTime int64, creatorId int) ([]string, error) {
+	if !redemptionKeyPrefixPattern.MatchString(prefix) {
+		return nil, errors.New("前缀只能包含字母、数字、- 和 _，且不超过 16 位")
+	}
+	if usageLimit < 0 {
+		return nil, errors.New("单码可兑换次数不能为负数")
+	}
+	now := common.GetTimestamp()
+	codes := make([]Redemption, 0, count)
+	keys := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		key := prefix + strings.ToUpper(common.GetRandomString(redemptionCampaignKeyRandomLength))
+		codes = append(codes, Redemption{
+			UserId:      creatorId,
+			Key:         key,
+			Status:      common.RedemptionCodeStatusEnabled,
+			Name:        campaign.Name,
+			Quota:       campaign.Quota,
+			CreatedTime: now,
+			ExpiredTime: expiredTime,
+			CampaignId:  campaign.Id,
+			UsageLimit:  usageLimit,
+		})
+		keys = append(keys, key)
+	}
+	if err := DB.CreateInBatches(codes, 100).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetCampaignCodes 返回活动下的全部兑换码，用于导出
+func GetCampaignCodes(campaignId int) (codes []*Redemption, err error) {
+	err = DB.Where("campaign_id = ?", campaignId).Order("id asc").Find(&codes).Error
+	return codes, err
+}
+
+// checkCampaignEligibilityTx 校验活动状态、总量与用户限制
+func checkCampaignEligibilityTx(tx *gorm.DB, campaign *RedemptionCampaign, userId int) error {
+	now := common.GetTimestamp()
+	if campaign.Status != common.RedemptionCodeStatusEnabled {
+		return redeemRestricted("该兑换活动已停止")
+	}
+	if campaign.StartTime != 0 && now < campaign.StartTime {
+		return redeemRestricted("该兑换活动尚未开始")
+	}
+	if campaign.EndTime != 0 && now > campaign.EndTime {
+		return redeemRestricted("该兑换活动已结束")
+	}
+	if campaign.MaxUses > 0 && campaign.UsedCount >= campaign.MaxUses {
+		return redeemRestricted("该兑换活动已被领完")
+	}
+	var user User
+	if err := tx.Select("id", "created_time", commonGroupCol).Where("id = ?", userId).First(&user).Error; err != nil {
+		return err
+	}
+	if campaign.NewUserDays > 0 &&
+		(user.CreatedTime == 0 || now-user.CreatedTime > int64(campaign.NewUserDays)*86400) {
+		return redeemRestricted("该兑换码仅限新用户使用")
+	}
+	if groups := campaign.allowedGroups(); len(groups) > 0 && !common.StringsContains(groups, user.Group) {
+		return redeemRestricted("您所在的分组不能使用该兑换码")
+	}
+	if campaign.PerUserLimit > 0 {
+		var used int64
+		if err := tx.Model(&RedemptionUse{}).Where("campaign_id = ? AND user_id = ?", campaign.Id, userId).
+			Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= int64(campaign.PerUserLimit) {
+			return redeemRestricted("您已兑换过该活动")
+		}
+	}
+	return nil
+}
+
+// grantRedemptionGroupTx 临时升级用户分组，同一分组重复兑换时顺延到期时间
+func grantRedemptionGroupTx(tx *gorm.DB, campaign *RedemptionCampaign, userId int) (*RedemptionGroupGrant, error) {
+	duration := int64(campaign.GroupDays) * 86400
+	var grant RedemptionGroupGrant
+	if err := tx.Where("user_id = ? AND status = ? AND "+commonGroupCol+" = ?", userId, RedemptionGroupGrantActive, campaign.Group).
+		Order("id desc").Limit(1).Find(&grant).Error; err != nil {
+		return nil, err
+	}
+	if grant.Id != 0 {
+		grant.ExpiresAt += duration
+		return &grant, tx.Model(&RedemptionGroupGrant{}).Where("id = ?", grant.Id).Update("expires_at", grant.ExpiresAt).Error
+	}
+	current, err := getUserGroupByIdTx(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if current == campaign.Group {
+		return nil, redeemRestricted("您已在该分组中")
+	}
+	grant = RedemptionGroupGrant{
+		UserId:     userId,
+		CampaignId: campaign.Id,
+		Group:      campaign.Group,
+		PrevGroup:  current,
+		ExpiresAt:  common.GetTimestamp() + duration,
+		Status:     RedemptionGroupGrantActive,
+	}
+	if err := tx.Create(&grant).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&User{}).Where("id = ?", userId).Update("group", campaign.Group).Error; err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// redeemCampaignCodeTx 兑换活动码，调用方已锁定兑换码记录
+func redeemCampaignCodeTx(tx *gorm.DB, redemption *Redemption, userId int) (*RedeemResult, error) {
+	var campaign RedemptionCampaign
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&campaign, "id = ?", redemption.CampaignId).Error; err != nil {
+		return nil, errors.New("无效的兑换码")
+	}
+	if redemption.UsageLimit > 0 && redemption.UsedCount >= redemption.UsageLimit {
+		return nil, errors.New("该兑换码已被使用")
+	}
+	if err := checkCampaignEligibilityTx(tx, &campaign, userId); err != nil {
+		return nil, err
+	}
+
+	now := common.GetTimestamp()
+	result := &RedeemResult{RewardType: campaign.RewardType}
+	switch campaign.RewardType {
+	case RedemptionRewardQuota:
+		result.Quota = campaign.Quota
+		if err := tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", campaign.Quota)).Error; err != nil {
+			return nil, err
+		}
+		if err := RecordQuotaLedger(tx, userId, campaign.Quota, QuotaLedgerMeta{
+			Type:           QuotaLedgerTypeRedemption,
+			IdempotencyKey: fmt.Sprintf("redemption:%d:%d:%d", redemption.Id, userId, redemption.UsedCount),
+			ReferenceId:    strconv.Itoa(redemption.Id),
+		}); err != nil {
+			return nil, err
+		}
+	case RedemptionRewardSubscription:
+		plan, err := getSubscriptionPlanByIdTx(tx, campaign.PlanId)
+		if err != nil {
+			return nil, err
+		}
+		sub, err := CreateUserSubscriptionFromPlanTx(tx, userId, plan, "redemption")
+		if err != nil {
+			return nil, redeemRestricted(err.Error())
+		}
+		result.SubscriptionId = sub.Id
+		result.Group = strings.TrimSpace(plan.UpgradeGroup)
+	case RedemptionRewardGroup:
+		grant, err := grantRedemptionGroupTx(tx, &campaign, userId)
+		if err != nil {
+			return nil, err
+		}
+		result.Group = grant.Group
+		result.GroupExpiresAt = grant.ExpiresAt
+	default:
+		return nil, fmt.Errorf("unknown reward type %q", campaign.RewardType)
+	}
+
+	use := RedemptionUse{
+		CampaignId:   campaign.Id,
+		UserId:       userId,
+		RedemptionId: redemption.Id,
+		RewardType:   campaign.RewardType,
+		Quota:        result.Quota,
+		CreatedTime:  now,
+	}
+	if err := tx.Create(&use).Error; err != nil {
+		return nil, err
+	}
+	redemption.UsedCount++
+	redemption.RedeemedTime = now
+	redemption.UsedUserId = userId
+	if redemption.UsageLimit > 0 && redemption.UsedCount >= redemption.UsageLimit {
+		redemption.Status = common.RedemptionCodeStatusUsed
+	}
+	if err := tx.Model(&Redemption{}).Where("id = ?", redemption.Id).Updates(map[string]interface{}{
+		"used_count":    redemption.UsedCount,
+		"redeemed_time": redemption.RedeemedTime,
+		"used_user_id":  userId,
+		"status":        redemption.Status,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return result, tx.Model(&RedemptionCampaign{}).Where("id = ?", campaign.Id).
+		Update("used_count", gorm.Expr("used_count + ?", 1)).Error
+}
+
+// ExpireRedemptionGroupGrants 恢复已到期的临时分组，用户分组已被修改时不再回退
+func ExpireRedemptionGroupGrants(now int64) (int, error) {
+	var grants []RedemptionGroupGrant
+	if err := DB.Where("status = ? AND expires_at <= ?", RedemptionGroupGrantActive, now).
+		Limit(200).Find(&grants).Error; err != nil {
+		return 0, err
+	}
+	for _, grant := range grants {
+		restored := false
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&RedemptionGroupGrant{}).Where("id = ? AND status = ?", grant.Id, RedemptionGroupGrantActive).
+				Update("status", RedemptionGroupGrantExpired)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			current, err := getUserGroupByIdTx(tx, grant.UserId)
+			if err != nil {
+				return err
+			}
+			if current != grant.Group {
+				return nil
+			}
+			restored = true
+			return tx.Model(&User{}).Where("id = ?", grant.UserId).Update("group", grant.PrevGroup).Error
+		})
+		if err != nil {
+			return 0, err
+		}
+		if restored {
+			_ = UpdateUserGroupCache(grant.UserId, grant.PrevGroup)
+		}
+	}
+	return len(grants), nil
+}
+
+// RedemptionCampaignDailyUses 活动每日兑换次数
+type RedemptionCampaignDailyUses struct {
+	Date string `json:"date"`
+	Uses int    `json:"uses"`
+}
+
+// RedemptionCampaignStats 活动兑换统计
+type RedemptionCampaignStats struct {
+	CampaignId     int                           `json:"campaign_id"`
+	Codes          int64                         `json:"codes"`
+	CodesExhausted int64                         `json:"codes_exhausted"`
+	Uses           int64                         `json:"uses"`
+	Users          int64                         `json:"users"`
+	QuotaGranted   int64                         `json:"quota_granted"`
+	Daily          []RedemptionCampaignDailyUses `json:"daily"`
+}
+
+func GetRedemptionCampaignStats(campaignId int) (*RedemptionCampaignStats, error) {
+	stats := &RedemptionCampaignStats{CampaignId: campaignId, Daily: make([]RedemptionCampaignDailyUses, 0)}
+	if err := DB.Model(&Redemption{}).Where("campaign_id = ?", campaignId).Count(&stats.Codes).Error; err != nil {
+		return nil, err
+	}
+	if err := DB.Model(&Redemption{}).Where("campaign_id = ? AND status = ?", campaignId, common.RedemptionCodeStatusUsed).
+		Count(&stats.CodesExhausted).Error; err != nil {
+		return nil, err
+	}
+	uses := DB.Model(&RedemptionUse{}).Where("campaign_id = ?", campaignId)
+	if err := uses.Session(&gorm.Session{}).Count(&stats.Uses).Error; err != nil {
+		return nil, err
+	}
+	if err := uses.Session(&gorm.Session{}).Distinct("user_id").Count(&stats.Users).Error; err != nil {
+		return nil, err
+	}
+	if err := uses.Session(&gorm.Session{}).Select("COALESCE(sum(quota), 0)").Scan(&stats.QuotaGranted).Error; err != nil {
+		return nil, err
+	}
+	var times []int64
+	if err := uses.Session(&gorm.Session{}).Order("created_time asc").Pluck("created_time", &times).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range times {
+		date := time.Unix(t, 0).Format("2006-01-02")
+		if n := len(stats.Daily); n > 0 && stats.Daily[n-1].Date == date {
+			stats.Daily[n-1].Uses++
+			continue
+		}
+		stats.Daily = append(stats.Daily, RedemptionCampaignDailyUses{Date: date, Uses: 1})
+	}
+	return stats, nil
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func insertCampaignUser(t *testing.T, id int, createdTime int64) {
+	t.Helper()
+	require.NoError(t, DB.Create(&User{
+		Id:          id,
+		Username:    "campaign_user_" + common.GetRandomString(6),
+		AffCode:     common.GetRandomString(8),
+		Group:       "default",
+		CreatedTime: createdTime,
+	}).Error)
+}
+
+func createCampaignWithCode(t *testing.T, campaign *RedemptionCampaign, usageLimit int) string {
+	t.Helper()
+	require.NoError(t, campaign.Validate())
+	require.NoError(t, campaign.Insert())
+	keys, err := GenerateCampaignCodes(campaign, "PROMO-", 1, usageLimit, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Len(t, keys[0], 22)
+	return keys[0]
+}
+
+// redeemCampaignForTest 跳过 Redeem 中的随机延迟，直接执行活动兑换事务
+func redeemCampaignForTest(key string, userId int) (*RedeemResult, error) {
+	var result *RedeemResult
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var redemption Redemption
+		if err := tx.Where(commonKeyCol+" = ?", key).First(&redemption).Error; err != nil {
+			return err
+		}
+		var err error
+		result, err = redeemCampaignCodeTx(tx, &redemption, userId)
+		return err
+	})
+	return result, err
+}
+
+func TestCampaignCodePerUserAndTotalLimit(t *testing.T) {
+	truncateTables(t)
+	now := common.GetTimestamp()
+	for id := 1; id <= 3; id++ {
+		insertCampaignUser(t, id, now)
+	}
+	key := createCampaignWithCode(t, &RedemptionCampaign{
+		Name: "launch", RewardType: RedemptionRewardQuota, Quota: 500, MaxUses: 2, PerUserLimit: 1,
+	}, 0)
+
+	result, err := redeemCampaignForTest(key, 1)
+	require.NoError(t, err)
+	require.Equal(t, 500, result.Quota)
+	require.Equal(t, 500, getUserQuotaForTest(t, 1))
+
+	_, err = redeemCampaignForTest(key, 1)
+	var restricted *RedeemRestrictionError
+	require.ErrorAs(t, err, &restricted)
+
+	_, err = redeemCampaignForTest(key, 2)
+	require.NoError(t, err)
+	_, err = redeemCampaignForTest(key, 3)
+	require.ErrorAs(t, err, &restricted)
+
+	var campaign RedemptionCampaign
+	require.NoError(t, DB.First(&campaign).Error)
+	stats, err := GetRedemptionCampaignStats(campaign.Id)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, stats.Uses)
+	require.EqualValues(t, 2, stats.Users)
+	require.EqualValues(t, 1000, stats.QuotaGranted)
+	require.Len(t, stats.Daily, 1)
+}
+
+func TestCampaignCodeNewUserAndGroupRestriction(t *testing.T) {
+	truncateTables(t)
+	insertCampaignUser(t, 1, 0)
+	insertCampaignUser(t, 2, common.GetTimestamp())
+	key := createCampaignWithCode(t, &RedemptionCampaign{
+		Name: "newbie", RewardType: RedemptionRewardQuota, Quota: 100, NewUserDays: 7, AllowedGroups: "default, vip",
+	}, 1)
+
+	var restricted *RedeemRestrictionError
+	_, err := redeemCampaignForTest(key, 1)
+	require.ErrorAs(t, err, &restricted)
+
+	_, err = redeemCampaignForTest(key, 2)
+	require.NoError(t, err)
+
+	// 单码只能使用一次
+	var code Redemption
+	require.NoError(t, DB.Where(commonKeyCol+" = ?", key).First(&code).Error)
+	require.Equal(t, common.RedemptionCodeStatusUsed, code.Status)
+}
+
+func TestCampaignCodeTemporaryGroup(t *testing.T) {
+	truncateTables(t)
+	insertCampaignUser(t, 1, common.GetTimestamp())
+	key := createCampaignWithCode(t, &RedemptionCampaign{
+		Name: "vip trial", RewardType: RedemptionRewardGroup, Group: "vip", GroupDays: 3,
+	}, 0)
+
+	result, err := redeemCampaignForTest(key, 1)
+	require.NoError(t, err)
+	require.Equal(t, "vip", result.Group)
+	group, err := getUserGroupByIdTx(DB, 1)
+	require.NoError(t, err)
+	require.Equal(t, "vip", group)
+
+	require.NoError(t, DB.Model(&RedemptionGroupGrant{}).Where("user_id = ?", 1).
+		Update("expires_at", common.GetTimestamp()-1).Error)
+	n, err := ExpireRedemptionGroupGrants(common.GetTimestamp())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	group, err = getUserGroupByIdTx(DB, 1)
+	require.NoError(t, err)
+	require.Equal(t, "default", group)
+}
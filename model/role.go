@@ -0,0 +1,335 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"gorm.io/gorm"
+)
+
+var ErrRoleNotFound = errors.New("角色不存在")
+
+// Role 自定义角色，由一组权限组成，可分配给用户。
+// 原有的普通用户、管理员、超级管理员作为内置角色保留，不落库。
+type Role struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+	// Permissions 权限列表，逗号分隔
+	Permissions string `json:"permissions" gorm:"type:text"`
+	BuiltIn     bool   `json:"built_in" gorm:"-"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// UserRole 用户与自定义角色的关联
+type UserRole struct {
+	Id          int   `json:"id"`
+	UserId      int   `json:"user_id" gorm:"uniqueIndex:idx_user_role"`
+	RoleId      int   `json:"role_id" gorm:"uniqueIndex:idx_user_role;index"`
+	CreatedTime int64 `json:"created_time" gorm:"bigint"`
+}
+
+// PermissionSet 用户最终拥有的权限集合
+type PermissionSet map[string]struct{}
+
+func (s PermissionSet) Has(permission string) bool {
+	if _, ok := s[constant.PermissionAll]; ok {
+		return true
+	}
+	_, ok := s[permission]
+	return ok
+}
+
+// HasAny 具备任一权限即返回 true
+func (s PermissionSet) HasAny(permissions ...string) bool {
+	for _, permission := range permissions {
+		if s.Has(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// UngrantablePermission 返回非超级管理员无权授予的第一个权限：超级管理员专属权限或自身未拥有的权限，
+// 全部可授予时返回空
+func (s PermissionSet) UngrantablePermission(permissions []string) string {
+	for _, permission := range permissions {
+		if slices.Contains(constant.RootOnlyPermissions, permission) || !s.Has(permission) {
+			return permission
+		}
+	}
+	return ""
+}
+
+func (s PermissionSet) List() []string {
+	list := make([]string, 0, len(s))
+	for permission := range s {
+		list = append(list, permission)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (r *Role) GetPermissions() []string {
+	return splitPermissions(r.Permissions)
+}
+
+func splitPermissions(value string) []string {
+	permissions := make([]string, 0)
+	for _, permission := range strings.Split(value, ",") {
+		permission = strings.TrimSpace(permission)
+		if permission != "" && !slices.Contains(permissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// NormalizePermissions 校验并整理权限列表，未知权限返回错误
+func NormalizePermissions(value string) (string, error) {
+	permissions := splitPermissions(value)
+	for _, permission := range permissions {
+		if !slices.Contains(constant.Permissions, permission) {
+			return "", fmt.Errorf("未知权限：%s", permission)
+		}
+	}
+	sort.Strings(permissions)
+	return strings.Join(permissions, ","), nil
+}
+
+// builtInRolePermissions 返回原有三级角色对应的权限
+func builtInRolePermissions(role int) []string {
+	switch {
+	case role >= common.RoleRootUser:
+		return []string{constant.PermissionAll}
+	case role >= common.RoleAdminUser:
+		permissions := make([]string, 0, len(constant.Permissions))
+		for _, permission := range constant.Permissions {
+			if !slices.Contains(constant.RootOnlyPermissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+		return permissions
+	default:
+		return nil
+	}
+}
+
+// GetBuiltInRoles 返回内置角色，供角色列表展示
+func GetBuiltInRoles() []*Role {
+	roles := []*Role{
+		{Name: constant.BuiltInRoleCommon, Description: "普通用户"},
+		{Name: constant.BuiltInRoleAdmin, Description: "管理员"},
+		{Name: constant.BuiltInRoleRoot, Description: "超级管理员"},
+	}
+	for i, level := range []int{common.RoleCommonUser, common.RoleAdminUser, common.RoleRootUser} {
+		roles[i].Permissions = strings.Join(builtInRolePermissions(level), ",")
+		roles[i].BuiltIn = true
+	}
+	return roles
+}
+
+func IsBuiltInRoleName(name string) bool {
+	return name == constant.BuiltInRoleCommon || name == constant.BuiltInRoleAdmin || name == constant.BuiltInRoleRoot
+}
+
+func (r *Role) Insert() error {
+	now := common.GetTimestamp()
+	r.CreatedTime = now
+	r.UpdatedTime = now
+	return DB.Create(r).Error
+}
+
+func (r *Role) Update() error {
+	r.UpdatedTime = common.GetTimestamp()
+	err := DB.Model(r).Select("name", "description", "permissions", "updated_time").Updates(r).Error
+	if err == nil {
+		InvalidateUserPermissions(0)
+	}
+	return err
+}
+
+// IsRoleNameDuplicated 检查角色名称是否重复（排除自身 ID）
+func IsRoleNameDuplicated(id int, name string) (bool, error) {
+	var cnt int64
+	err := DB.Model(&Role{}).Where("name = ? AND id <> ?", name, id).Count(&cnt).Error
+	return cnt > 0, err
+}
+
+func GetRoleById(id int) (*Role, error) {
+	var role Role
+	err := DB.First(&role, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoleNotFound
+	}
+	return &role, err
+}
+
+func GetAllRoles() ([]*Role, error) {
+	var roles []*Role
+	err := DB.Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+// DeleteRoleById 删除角色并解除所有用户的分配
+func DeleteRoleById(id int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", id).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&Role{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRoleNotFound
+		}
+		return nil
+	})
+	if err == nil {
+		InvalidateUserPermissions(0)
+	}
+	return err
+}
+
+// CountRoleUsers 返回各角色已分配的用户数
+func CountRoleUsers() (map[int]int64, error) {
+	var rows []struct {
+		RoleId int
+		Count  int64
+	}
+	err := DB.Model(&UserRole{}).Select("role_id, count(*) as count").Group("role_id").Scan(&rows).Error
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.RoleId] = row.Count
+	}
+	return counts, err
+}
+
+// GetUserRoles 返回用户被分配的自定义角色
+func GetUserRoles(userId int) ([]*Role, error) {
+	var roles []*Role
+	err := DB.Where("id IN (?)", DB.Model(&UserRole{}).Select("role_id").Where("user_id = ?", userId)).
+		Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+// GetRolesByIds 按 ID 返回自定义角色
+func GetRolesByIds(ids []int) ([]*Role, error) {
+	roles := make([]*Role, 0)
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	err := DB.Where("id IN ?", ids).Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+// SetUserRoles 覆盖用户的自定义角色分配
+func SetUserRoles(userId int, roleIds []int) error {
+	roleIds = slices.Compact(slices.Sorted(slices.Values(roleIds)))
+	if len(roleIds) > 0 {
+		var cnt int64
+		if err := DB.Model(&Role{}).Where("id IN ?", roleIds).Count(&cnt).Error; err != nil {
+			return err
+		}
+		if int(cnt) != len(roleIds) {
+			return ErrRoleNotFound
+		}
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+		now := common.GetTimestamp()
+		for _, roleId := range roleIds {
+			if err := tx.Create(&UserRole{UserId: userId, RoleId: roleId, CreatedTime: now}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		InvalidateUserPermissions(userId)
+	}
+	return err
+}
+
+const userPermissionCacheTTL = time.Minute
+
+type userPermissionEntry struct {
+	role        int
+	permissions PermissionSet
+	expireAt    time.Time
+}
+
+var userPermissionCache sync.Map // user id -> *userPermissionEntry
+
+// InvalidateUserPermissions 清除用户权限缓存，userId 为 0 时清除全部，并通知其他实例
+func InvalidateUserPermissions(userId int) {
+	clearUserPermissionCache(userId)
+	common.PublishInvalidation(common.InvalidationPermission, strconv.Itoa(userId))
+}
+
+func clearUserPermissionCache(userId int) {
+	if userId != 0 {
+		userPermissionCache.Delete(userId)
+		return
+	}
+	userPermissionCache.Clear()
+}
+
+// GetUserPermissions 返回用户的最终权限：内置角色权限与所有自定义角色权限的并集
+func GetUserPermissions(userId int, role int) (PermissionSet, error) {
+	if value, ok := userPermissionCache.Load(userId); ok {
+		entry := value.(*userPermissionEntry)
+		if entry.role == role && time.Now().Before(entry.expireAt) {
+			return entry.permissions, nil
+		}
+	}
+	permissions := make(PermissionSet)
+	for _, permission := range builtInRolePermissions(role) {
+		permissions[permission] = struct{}{}
+	}
+	roles, err := GetUserRoles(userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roles {
+		for _, permission := range r.GetPermissions() {
+			permissions[permission] = struct{}{}
+		}
+	}
+	userPermissionCache.Store(userId, &userPermissionEntry{
+		role:        role,
+		permissions: permissions,
+		expireAt:    time.Now().Add(userPermissionCacheTTL),
+	})
+	return permissions, nil
+}
+
+// UserHasPermission 用户具备任一指定权限时返回 true
+func UserHasPermission(userId int, role int, permissions ...string) bool {
+	set, err := GetUserPermissions(userId, role)
+	if err != nil {
+		common.SysError("failed to get user permissions: " + err.Error())
+		return false
+	}
+	return set.HasAny(permissions...)
+}
+
+// UserHasCustomRoles 判断用户是否被分配了自定义角色
+func UserHasCustomRoles(userId int) bool {
+	var cnt int64
+	DB.Model(&UserRole{}).Where("user_id = ?", userId).Count(&cnt)
+	return cnt > 0
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltInRolePermissions(t *testing.T) {
+	truncateTables(t)
+	InvalidateUserPermissions(0)
+
+	perms, err := GetUserPermissions(1, common.RoleCommonUser)
+	require.NoError(t, err)
+	require.False(t, perms.Has(constant.PermissionLogReadAll))
+
+	perms, err = GetUserPermissions(2, common.RoleAdminUser)
+	require.NoError(t, err)
+	require.True(t, perms.Has(constant.PermissionChannelWrite))
+	require.False(t, perms.Has(constant.PermissionChannelKeyView), "admin 不包含原超级管理员专属权限")
+	require.False(t, perms.Has(constant.PermissionOptionWrite))
+
+	perms, err = GetUserPermissions(3, common.RoleRootUser)
+	require.NoError(t, err)
+	require.True(t, perms.Has(constant.PermissionRoleManage))
+}
+
+func TestCustomRolePermissions(t *testing.T) {
+	truncateTables(t)
+	InvalidateUserPermissions(0)
+
+	_, err := NormalizePermissions("log:read:all,unknown")
+	require.Error(t, err)
+	value, err := NormalizePermissions(" user:quota:adjust , log:read:all,log:read:all")
+	require.NoError(t, err)
+	require.Equal(t, "log:read:all,user:quota:adjust", value)
+
+	support := &Role{Name: "support", Permissions: value}
+	require.NoError(t, support.Insert())
+	require.ErrorIs(t, SetUserRoles(11, []int{support.Id, support.Id + 100}), ErrRoleNotFound)
+	require.NoError(t, SetUserRoles(11, []int{support.Id, support.Id}))
+	require.True(t, UserHasCustomRoles(11))
+
+	require.True(t, UserHasPermission(11, common.RoleCommonUser, constant.PermissionLogReadAll))
+	require.True(t, UserHasPermission(11, common.RoleCommonUser, constant.PermissionChannelWrite, constant.PermissionUserQuotaAdjust))
+	require.False(t, UserHasPermission(11, common.RoleCommonUser, constant.PermissionChannelWrite))
+
+	// 修改角色后缓存立即失效
+	support.Permissions = constant.PermissionChannelRead
+	require.NoError(t, support.Update())
+	require.False(t, UserHasPermission(11, common.RoleCommonUser, constant.PermissionLogReadAll))
+	require.True(t, UserHasPermission(11, common.RoleCommonUser, constant.PermissionChannelRead))
+
+	require.NoError(t, DeleteRoleById(support.Id))
+	require.False(t, UserHasCustomRoles(11))
+	require.False(t, UserHasPermission(11, common.RoleCommonUser, constant.PermissionChannelRead))
+	require.ErrorIs(t, DeleteRoleById(support.Id), ErrRoleNotFound)
+}
+
+func TestUngrantablePermission(t *testing.T) {
+	delegated := PermissionSet{constant.PermissionRoleManage: {}, constant.PermissionLogReadAll: {}}
+	require.Empty(t, delegated.UngrantablePermission([]string{constant.PermissionLogReadAll}))
+	require.Equal(t, constant.PermissionChannelWrite, delegated.UngrantablePermission([]string{constant.PermissionLogReadAll, constant.PermissionChannelWrite}), "未拥有的权限")
+	require.Equal(t, constant.PermissionRoleManage, delegated.UngrantablePermission([]string{constant.PermissionRoleManage}), "超级管理员专属权限即使拥有也不能授予")
+
+	root := PermissionSet{constant.PermissionAll: {}}
+	require.Equal(t, constant.PermissionOptionWrite, root.UngrantablePermission([]string{constant.PermissionOptionWrite}), "超级管理员由调用方放行")
+}
@@ -0,0 +1,296 @@
+package model
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrScimUserNotFound  = errors.New("SCIM 用户不存在")
+	ErrScimGroupNotFound = errors.New("SCIM 组不存在")
+)
+
+// ScimUser 记录由 SCIM 开通的用户，保存身份提供方的 userName 与 externalId
+type ScimUser struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex"`
+	UserName    string `json:"user_name" gorm:"type:varchar(255);uniqueIndex"`
+	ExternalId  string `json:"external_id" gorm:"type:varchar(255);index"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// ScimGroup 身份提供方推送的组，通过 SCIM 设置中的映射对应网关分组与角色
+type ScimGroup struct {
+	Id          int    `json:"id"`
+	DisplayName string `json:"display_name" gorm:"type:varchar(255);uniqueIndex"`
+	ExternalId  string `json:"external_id" gorm:"type:varchar(255);index"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// ScimGroupMember SCIM 组成员
+type ScimGroupMember struct {
+	Id      int `json:"id"`
+	GroupId int `json:"group_id" gorm:"uniqueIndex:idx_scim_group_member"`
+	UserId  int `json:"user_id" gorm:"uniqueIndex:idx_scim_group_member;index"`
+}
+
+func GetScimUserByUserId(userId int) (*ScimUser, error) {
+	var scimUser ScimUser
+	err := DB.Where("user_id = ?", userId).First(&scimUser).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrScimUserNotFound
+	}
+	return &scimUser, err
+}
+
+// GetScimUserByEmail 按邮箱查找由 SCIM 开通的用户，供 OIDC 首次登录时关联账号
+func GetScimUserByEmail(email string) (*User, error) {
+	if email == "" {
+		return nil, ErrScimUserNotFound
+	}
+	var user User
+	err := DB.Where("email = ? AND id IN (?)", email, DB.Model(&ScimUser{}).Select("user_id")).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrScimUserNotFound
+	}
+	return &user, err
+}
+
+// IsScimUserNameTaken 检查 userName 是否已被其他 SCIM 用户使用（排除自身用户 ID）
+func IsScimUserNameTaken(userName string, userId int) (bool, error) {
+	var cnt int64
+	err := DB.Model(&ScimUser{}).Where("user_name = ? AND user_id <> ?", userName, userId).Count(&cnt).Error
+	return cnt > 0, err
+}
+
+// SearchScimUsers 按属性精确过滤 SCIM 用户，column 为空时返回全部
+func SearchScimUsers(column string, value string, startIdx int, num int) ([]*ScimUser, int64, error) {
+	query := DB.Model(&ScimUser{})
+	switch column {
+	case "":
+	case "email":
+		query = query.Where("user_id IN (?)", DB.Model(&User{}).Select("id").Where("email = ?", value))
+	default:
+		query = query.Where(column+" = ?", value)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var scimUsers []*ScimUser
+	err := query.Order("id asc").Limit(num).Offset(startIdx).Find(&scimUsers).Error
+	return scimUsers, total, err
+}
+
+// CreateScimUser 在事务中创建用户及其 SCIM 关联
+func CreateScimUser(user *User, scimUser *ScimUser) error {
+	var err error
+	user.Password, err = common.Password2Hash(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Quota = common.QuotaForNewUser
+	user.AffCode = common.GetRandomString(4)
+	user.CreatedTime = common.GetTimestamp()
+	if user.Setting == "" {
+		user.SetSetting(dto.UserSetting{SidebarModules: generateDefaultSidebarConfigForRole(user.Role)})
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		now := common.GetTimestamp()
+		scimUser.UserId = user.Id
+		scimUser.CreatedTime = now
+		scimUser.UpdatedTime = now
+		return tx.Create(scimUser).Error
+	})
+}
+
+// UpdateScimUser 保存身份提供方推送的用户属性
+func UpdateScimUser(user *User, scimUser *ScimUser) error {
+	scimUser.UpdatedTime = common.GetTimestamp()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", user.Id).Updates(map[string]interface{}{
+			"username":     user.Username,
+			"display_name": user.DisplayName,
+			"email":        user.Email,
+			"status":       user.Status,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(scimUser).Select("user_name", "external_id", "updated_time").Updates(scimUser).Error
+	})
+	if err != nil {
+		return err
+	}
+	return updateUserCache(*user)
+}
+
+// DeleteScimUser 删除 SCIM 关联与组成员关系，并软删除用户
+func DeleteScimUser(user *User) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.Id).Delete(&ScimGroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.Id).Delete(&ScimUser{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(user).Error
+	})
+	if err != nil {
+		return err
+	}
+	return invalidateUserCache(user.Id)
+}
+
+func GetScimGroupById(id int) (*ScimGroup, error) {
+	var group ScimGroup
+	err := DB.First(&group, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrScimGroupNotFound
+	}
+	return &group, err
+}
+
+// IsScimGroupNameTaken 检查组名是否重复（排除自身 ID）
+func IsScimGroupNameTaken(displayName string, id int) (bool, error) {
+	var cnt int64
+	err := DB.Model(&ScimGroup{}).Where("display_name = ? AND id <> ?", displayName, id).Count(&cnt).Error
+	return cnt > 0, err
+}
+
+// SearchScimGroups 按属性精确过滤 SCIM 组，column 为空时返回全部
+func SearchScimGroups(column string, value string, startIdx int, num int) ([]*ScimGroup, int64, error) {
+	query := DB.Model(&ScimGroup{})
+	if column != "" {
+		query = query.Where(column+" = ?", value)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var groups []*ScimGroup
+	err := query.Order("id asc").Limit(num).Offset(startIdx).Find(&groups).Error
+	return groups, total, err
+}
+
+// SaveScimGroup 创建或更新组，memberIds 不为 nil 时覆盖成员列表
+func SaveScimGroup(group *ScimGroup, memberIds []int) error {
+	now := common.GetTimestamp()
+	group.UpdatedTime = now
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if group.Id == 0 {
+			group.CreatedTime = now
+			if err := tx.Create(group).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(group).Select("display_name", "external_id", "updated_time").Updates(group).Error; err != nil {
+			return err
+		}
+		if memberIds == nil {
+			return nil
+		}
+		if err := tx.Where("group_id = ?", group.Id).Delete(&ScimGroupMember{}).Error; err != nil {
+			return err
+		}
+		return addScimGroupMembers(tx, group.Id, slices.Compact(slices.Sorted(slices.Values(memberIds))))
+	})
+}
+
+// AddScimGroupMembers 添加组成员，已存在的成员忽略
+func AddScimGroupMembers(groupId int, userIds []int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var existing []int
+		if err := tx.Model(&ScimGroupMember{}).Where("group_id = ? AND user_id IN ?", groupId, userIds).
+			Pluck("user_id", &existing).Error; err != nil {
+			return err
+		}
+		added := make([]int, 0, len(userIds))
+		for _, userId := range userIds {
+			if !slices.Contains(existing, userId) && !slices.Contains(added, userId) {
+				added = append(added, userId)
+			}
+		}
+		return addScimGroupMembers(tx, groupId, added)
+	})
+}
+
+func addScimGroupMembers(tx *gorm.DB, groupId int, userIds []int) error {
+	for _, userId := range userIds {
+		if err := tx.Create(&ScimGroupMember{GroupId: groupId, UserId: userId}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RemoveScimGroupMembers(groupId int, userIds []int) error {
+	return DB.Where("group_id = ? AND user_id IN ?", groupId, userIds).Delete(&ScimGroupMember{}).Error
+}
+
+// DeleteScimGroup 删除组及其成员关系
+func DeleteScimGroup(id int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", id).Delete(&ScimGroupMember{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&ScimGroup{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrScimGroupNotFound
+		}
+		return nil
+	})
+}
+
+// GetScimGroupMemberIds 返回组内用户 ID
+func GetScimGroupMemberIds(groupId int) ([]int, error) {
+	var userIds []int
+	err := DB.Model(&ScimGroupMember{}).Where("group_id = ?", groupId).Order("user_id asc").Pluck("user_id", &userIds).Error
+	return userIds, err
+}
+
+// GetUserScimGroups 返回用户所属的 SCIM 组，按组名排序
+func GetUserScimGroups(userId int) ([]*ScimGroup, error) {
+	var groups []*ScimGroup
+	err := DB.Where("id IN (?)", DB.Model(&ScimGroupMember{}).Select("group_id").Where("user_id = ?", userId)).
+		Order("display_name asc").Find(&groups).Error
+	return groups, err
+}
+
+// GetExistingScimUserIds 过滤出确实由 SCIM 管理的用户 ID
+func GetExistingScimUserIds(userIds []int) ([]int, error) {
+	var existing []int
+	if len(userIds) == 0 {
+		return existing, nil
+	}
+	err := DB.Model(&ScimUser{}).Where("user_id IN ?", userIds).Pluck("user_id", &existing).Error
+	return existing, err
+}
+
+// GetRoleIdsByNames 按名称查找自定义角色，不存在的名称忽略
+func GetRoleIdsByNames(names []string) ([]int, error) {
+	var roleIds []int
+	if len(names) == 0 {
+		return roleIds, nil
+	}
+	trimmed := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			trimmed = append(trimmed, name)
+		}
+	}
+	err := DB.Model(&Role{}).Where("name IN ?", trimmed).Order("id asc").Pluck("id", &roleIds).Error
+	return roleIds, err
+}
@@ -0,0 +1,257 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// secretSerializer 在 GORM 层透明加解密密钥字段，字段标签为 serializer:secret。
+// 注意按列名更新（Update("key", ...)）不会经过序列化器，需改用结构体更新
+type secretSerializer struct{}
+
+func init() {
+	schema.RegisterSerializer("secret", secretSerializer{})
+	schema.RegisterSerializer("option_secret", optionSecretSerializer{})
+}
+
+func (secretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	case nil:
+	default:
+		return fmt.Errorf("unsupported secret value type %T", dbValue)
+	}
+	plain, err := common.DecryptSecret(value)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: %w", field.DBName, err)
+	}
+	return field.Set(ctx, dst, plain)
+}
+
+func (secretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, _ := fieldValue.(string)
+	return common.EncryptSecret(value)
+}
+
+// optionSecretSerializer 仅加密密钥类配置项，其余配置按明文保存
+type optionSecretSerializer struct {
+	secretSerializer
+}
+
+func (optionSecretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, _ := fieldValue.(string)
+	if option, ok := dst.Interface().(Option); ok && IsSecretOption(option.Key) {
+		return common.EncryptSecret(value)
+	}
+	return value, nil
+}
+
+// UpdateChannelKey 只更新渠道密钥
+func UpdateChannelKey(tx *gorm.DB, channelId int, key string) error {
+	if tx == nil {
+		tx = DB
+	}
+	return tx.Model(&Channel{}).Where("id = ?", channelId).Select("key").Updates(&Channel{Key: key}).Error
+}
+
+// SecretRotationStatus 密钥重新加密任务的进度
+type SecretRotationStatus struct {
+	Running    bool           `json:"running"`
+	KeyId      string         `json:"key_id"`
+	StartedAt  int64          `json:"started_at"`
+	FinishedAt int64          `json:"finished_at"`
+	Updated    map[string]int `json:"updated"`
+	Error      string         `json:"error,omitempty"`
+}
+
+var (
+	secretRotationLock   sync.Mutex
+	secretRotationStatus SecretRotationStatus
+)
+
+func GetSecretRotationStatus() SecretRotationStatus {
+	secretRotationLock.Lock()
+	defer secretRotationLock.Unlock()
+	status := secretRotationStatus
+	status.Updated = make(map[string]int, len(secretRotationStatus.Updated))
+	for key, value := range secretRotationStatus.Updated {
+		status.Updated[key] = value
+	}
+	return status
+}
+
+func addSecretRotationCount(name string, count int) {
+	secretRotationLock.Lock()
+	defer secretRotationLock.Unlock()
+	secretRotationStatus.Updated[name] += count
+}
+
+// StartSecretRotation 在后台将明文及旧主密钥加密的数据使用当前主密钥重新加密
+func StartSecretRotation() error {
+	keyId := common.SecretEncryptionKeyId()
+	if keyId == "" {
+		return fmt.Errorf("未配置主密钥 SECRET_ENCRYPTION_KEY")
+	}
+	secretRotationLock.Lock()
+	defer secretRotationLock.Unlock()
+	if secretRotationStatus.Running {
+		return fmt.Errorf("重新加密任务正在运行")
+	}
+	secretRotationStatus = SecretRotationStatus{
+		Running:   true,
+		KeyId:     keyId,
+		StartedAt: common.GetTimestamp(),
+		Updated:   make(map[string]int),
+	}
+	go func() {
+		err := rotateSecrets()
+		secretRotationLock.Lock()
+		defer secretRotationLock.Unlock()
+		secretRotationStatus.Running = false
+		secretRotationStatus.FinishedAt = common.GetTimestamp()
+		if err != nil {
+			secretRotationStatus.Error = err.Error()
+			common.SysError("secret rotation failed: " + err.Error())
+			return
+		}
+		common.SysLog(fmt.Sprintf("secret rotation finished: %v", secretRotationStatus.Updated))
+	}()
+	return nil
+}
+
+const secretRotationBatchSize = 100
+
+// secretRow 按原始列值读取，绕过序列化器与钩子
+type secretRow struct {
+	Id           int
+	Key          string
+	Value        string
+	ClientSecret string
+}
+
+func rotateSecrets() error {
+	err := rotateSecretColumn("channels", &Channel{}, "key",
+		func(row secretRow) string { return row.Key },
+		func(id int, plain string) error { return UpdateChannelKey(nil, id, plain) })
+	if err != nil {
+		return err
+	}
+	err = rotateSecretColumn("custom_oauth_providers", &CustomOAuthProvider{}, "client_secret",
+		func(row secretRow) string { return row.ClientSecret },
+		func(id int, plain string) error {
+			return DB.Model(&CustomOAuthProvider{}).Where("id = ?", id).Select("client_secret").
+				Updates(&CustomOAuthProvider{ClientSecret: plain}).Error
+		})
+	if err != nil {
+		return err
+	}
+	if err := rotateSecretOptions(); err != nil {
+		return err
+	}
+	return rotateUserWebhookSecrets()
+}
+
+func rotateSecretColumn(name string, table interface{}, column string, get func(row secretRow) string, save func(id int, plain string) error) error {
+	lastId := 0
+	for {
+		var rows []secretRow
+		err := DB.Model(table).Select("id", column).Where("id > ?", lastId).
+			Order("id").Limit(secretRotationBatchSize).Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		count := 0
+		for _, row := range rows {
+			lastId = row.Id
+			value := get(row)
+			if !common.NeedsSecretReencryption(value) {
+				continue
+			}
+			plain, err := common.DecryptSecret(value)
+			if err != nil {
+				return fmt.Errorf("%s #%d: %w", name, row.Id, err)
+			}
+			if err := save(row.Id, plain); err != nil {
+				return err
+			}
+			count++
+		}
+		addSecretRotationCount(name, count)
+	}
+}
+
+func rotateSecretOptions() error {
+	var rows []secretRow
+	if err := DB.Model(&Option{}).Select(commonKeyCol, "value").Find(&rows).Error; err != nil {
+		return err
+	}
+	count := 0
+	for _, row := range rows {
+		if !IsSecretOption(row.Key) || !common.NeedsSecretReencryption(row.Value) {
+			continue
+		}
+		plain, err := common.DecryptSecret(row.Value)
+		if err != nil {
+			return fmt.Errorf("option %s: %w", row.Key, err)
+		}
+		if err := DB.Save(&Option{Key: row.Key, Value: plain}).Error; err != nil {
+			return err
+		}
+		count++
+	}
+	addSecretRotationCount("options", count)
+	return nil
+}
+
+func rotateUserWebhookSecrets() error {
+	lastId := 0
+	for {
+		var users []*User
+		err := DB.Select("id", "setting").Where("id > ? AND setting LIKE ?", lastId, "%webhook_secret%").
+			Order("id").Limit(secretRotationBatchSize).Find(&users).Error
+		if err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			return nil
+		}
+		count := 0
+		for _, user := range users {
+			lastId = user.Id
+			setting := user.GetSetting()
+			if setting.WebhookSecret == "" {
+				continue
+			}
+			var raw struct {
+				WebhookSecret string `json:"webhook_secret"`
+			}
+			_ = common.Unmarshal([]byte(user.Setting), &raw)
+			if !common.NeedsSecretReencryption(raw.WebhookSecret) {
+				continue
+			}
+			user.SetSetting(setting)
+			if err := DB.Model(&User{}).Where("id = ?", user.Id).Update("setting", user.Setting).Error; err != nil {
+				return err
+			}
+			if err := updateUserSettingCache(user.Id, user.Setting); err != nil {
+				common.SysError("failed to update user setting cache: " + err.Error())
+			}
+			count++
+		}
+		addSecretRotationCount("users", count)
+	}
+}
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/stretchr/testify/require"
+)
+
+func rawColumn(t *testing.T, query string, args ...interface{}) string {
+	t.Helper()
+	var value string
+	require.NoError(t, DB.Raw(query, args...).Scan(&value).Error)
+	return value
+}
+
+func TestSecretEncryptionAtRest(t *testing.T) {
+	truncateTables(t)
+	t.Cleanup(func() { _ = common.SetSecretEncryptionKeys("") })
+	require.NoError(t, common.SetSecretEncryptionKeys("old-master"))
+
+	channel := &Channel{Name: "vertex", Key: "sk-secret", Models: "gpt-4o", Group: "default"}
+	require.NoError(t, DB.Create(channel).Error)
+	require.Equal(t, "sk-secret", channel.Key)
+	raw := rawColumn(t, "SELECT key FROM channels WHERE id = ?", channel.Id)
+	require.True(t, common.IsEncryptedSecret(raw))
+
+	loaded, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, "sk-secret", loaded.Key)
+
+	require.NoError(t, UpdateChannelKey(nil, channel.Id, "sk-rotated"))
+	loaded, err = GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, "sk-rotated", loaded.Key)
+
+	option := &Option{Key: "StripeApiSecret", Value: "stripe-secret"}
+	require.NoError(t, DB.Save(option).Error)
+	require.Equal(t, "stripe-secret", option.Value)
+	require.True(t, common.IsEncryptedSecret(rawColumn(t, "SELECT value FROM options WHERE key = ?", "StripeApiSecret")))
+	require.NoError(t, DB.Save(&Option{Key: "GroupRatio", Value: "{}"}).Error)
+	require.Equal(t, "{}", rawColumn(t, "SELECT value FROM options WHERE key = ?", "GroupRatio"))
+
+	provider := &CustomOAuthProvider{Name: "SSO", Slug: "sso", ClientSecret: "client-secret"}
+	require.NoError(t, DB.Create(provider).Error)
+	require.True(t, common.IsEncryptedSecret(rawColumn(t, "SELECT client_secret FROM custom_oauth_providers WHERE id = ?", provider.Id)))
+
+	user := &User{Username: "hook", Password: "password"}
+	user.SetSetting(dto.UserSetting{WebhookSecret: "hook-secret"})
+	require.NotContains(t, user.Setting, "hook-secret")
+	require.Equal(t, "hook-secret", user.GetSetting().WebhookSecret)
+	require.NoError(t, DB.Create(user).Error)
+
+	// 轮换主密钥后重新加密全部数据
+	require.NoError(t, common.SetSecretEncryptionKeys("new-master", "old-master"))
+	require.NoError(t, StartSecretRotation())
+	require.Eventually(t, func() bool { return !GetSecretRotationStatus().Running }, 5*time.Second, 10*time.Millisecond)
+	status := GetSecretRotationStatus()
+	require.Empty(t, status.Error)
+	require.Equal(t, map[string]int{"channels": 1, "custom_oauth_providers": 1, "options": 1, "users": 1}, status.Updated)
+
+	require.NoError(t, common.SetSecretEncryptionKeys("new-master"))
+	loaded, err = GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, "sk-rotated", loaded.Key)
+	require.False(t, common.NeedsSecretReencryption(rawColumn(t, "SELECT value FROM options WHERE key = ?", "StripeApiSecret")))
+	loadedProvider, err := GetCustomOAuthProviderById(provider.Id)
+	require.NoError(t, err)
+	require.Equal(t, "client-secret", loadedProvider.ClientSecret)
+	reloaded, err := GetUserById(user.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, "hook-secret", reloaded.GetSetting().WebhookSecret)
+}
+
+func TestSearchChannelsByKeyWithEncryption(t *testing.T) {
+	truncateTables(t)
+	t.Cleanup(func() { _ = common.SetSecretEncryptionKeys("") })
+
+	require.NoError(t, DB.Create(&Channel{Name: "plain", Key: "sk-search", Models: "gpt-4o", Group: "default"}).Error)
+	channels, err := SearchChannels("sk-search", "", "", false)
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+
+	// 加密后不再按密钥比对，避免明文与密文比较
+	require.NoError(t, common.SetSecretEncryptionKeys("master"))
+	channels, err = SearchChannels("sk-search", "", "", false)
+	require.NoError(t, err)
+	require.Empty(t, channels)
+	channels, err = SearchChannels("plain", "", "", false)
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+}
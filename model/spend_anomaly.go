@@ -0,0 +1,164 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SpendAnomalyKindVelocity     = "velocity"      // 令牌消费速度异常
+	SpendAnomalyKindUserVelocity = "user_velocity" // 用户整体消费速度异常
+	SpendAnomalyKindNewIp        = "new_ip"
+	SpendAnomalyKindModelSwitch  = "model_switch"
+)
+
+const (
+	SpendAnomalyStatusPending   = "pending"   // 待审核
+	SpendAnomalyStatusConfirmed = "confirmed" // 用户确认为本人操作
+	SpendAnomalyStatusDismissed = "dismissed" // 管理员忽略
+	SpendAnomalyStatusResolved  = "resolved"  // 管理员已处理
+)
+
+var ErrSpendAnomalyNotFound = errors.New("spend anomaly not found")
+
+// SpendAnomaly 检测到的异常消费，进入管理员审核队列
+type SpendAnomaly struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	TokenId       int    `json:"token_id" gorm:"index"`
+	TokenName     string `json:"token_name" gorm:"type:varchar(64)"`
+	Kind          string `json:"kind" gorm:"type:varchar(32)"`
+	Detail        string `json:"detail" gorm:"type:text"`
+	WindowQuota   int    `json:"window_quota"`
+	BaselineQuota int    `json:"baseline_quota"`
+	// Action 检测时执行的处理方式
+	Action     string `json:"action" gorm:"type:varchar(16)"`
+	Status     string `json:"status" gorm:"type:varchar(16);index"`
+	ReviewedBy int    `json:"reviewed_by"`
+	ReviewNote string `json:"review_note" gorm:"type:varchar(255)"`
+	ReviewedAt int64  `json:"reviewed_at" gorm:"bigint"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// TokenSpend 一段时间内令牌的消费汇总
+type TokenSpend struct {
+	TokenId   int    `json:"token_id"`
+	UserId    int    `json:"user_id"`
+	TokenName string `json:"token_name"`
+	Quota     int    `json:"quota"`
+	Count     int    `json:"count"`
+}
+
+// GetTokenSpends 按令牌汇总 [start, end) 内的消费
+func GetTokenSpends(start int64, end int64) (spends []TokenSpend, err error) {
+	err = LOG_DB.Model(&Log{}).
+		Select("token_id, user_id, max(token_name) as token_name, COALESCE(sum(quota), 0) as quota, count(*) as count").
+		Where("type = ? AND created_at >= ? AND created_at < ? AND token_id > 0", LogTypeConsume, start, end).
+		Group("token_id, user_id").Scan(&spends).Error
+	return spends, err
+}
+
+// GetUserSpends 按用户汇总 [start, end) 内的消费
+func GetUserSpends(start int64, end int64) (spends []TokenSpend, err error) {
+	err = LOG_DB.Model(&Log{}).
+		Select("user_id, COALESCE(sum(quota), 0) as quota, count(*) as count").
+		Where("type = ? AND created_at >= ? AND created_at < ?", LogTypeConsume, start, end).
+		Group("user_id").Scan(&spends).Error
+	return spends, err
+}
+
+// GetSpendBetween 返回令牌（tokenId 不为 0）或用户在 [start, end) 内的消费额度与次数
+func GetSpendBetween(userId int, tokenId int, start int64, end int64) (quota int, count int, err error) {
+	var row TokenSpend
+	tx := LOG_DB.Model(&Log{}).Select("COALESCE(sum(quota), 0) as quota, count(*) as count").
+		Where("type = ? AND created_at >= ? AND created_at < ? AND user_id = ?", LogTypeConsume, start, end, userId)
+	if tokenId != 0 {
+		tx = tx.Where("token_id = ?", tokenId)
+	}
+	err = tx.Scan(&row).Error
+	return row.Quota, row.Count, err
+}
+
+// GetTokenLogValues 返回令牌在 [start, end) 内使用过的 IP 或模型
+func GetTokenLogValues(tokenId int, column string, start int64, end int64) ([]string, error) {
+	if column != "ip" && column != "model_name" {
+		return nil, fmt.Errorf("unsupported column %q", column)
+	}
+	var values []string
+	err := LOG_DB.Model(&Log{}).Distinct(column).
+		Where("type = ? AND token_id = ? AND created_at >= ? AND created_at < ? AND "+column+" <> ''",
+			LogTypeConsume, tokenId, start, end).
+		Pluck(column, &values).Error
+	return values, err
+}
+
+// HasRecentSpendAnomaly 判断冷却时间内是否已记录同类异常
+func HasRecentSpendAnomaly(userId int, tokenId int, kind string, since int64) (bool, error) {
+	var count int64
+	err := DB.Model(&SpendAnomaly{}).
+		Where("user_id = ? AND token_id = ? AND kind = ? AND created_at >= ?", userId, tokenId, kind, since).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (anomaly *SpendAnomaly) Insert() error {
+	anomaly.CreatedAt = common.GetTimestamp()
+	if anomaly.Status == "" {
+		anomaly.Status = SpendAnomalyStatusPending
+	}
+	return DB.Create(anomaly).Error
+}
+
+func GetSpendAnomalyById(id int) (*SpendAnomaly, error) {
+	var anomaly SpendAnomaly
+	if err := DB.First(&anomaly, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSpendAnomalyNotFound
+		}
+		return nil, err
+	}
+	return &anomaly, nil
+}
+
+// GetSpendAnomalies 分页查询异常记录，userId 为 0 时查询全部用户
+func GetSpendAnomalies(userId int, status string, startIdx int, num int) (anomalies []*SpendAnomaly, total int64, err error) {
+	tx := DB.Model(&SpendAnomaly{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&anomalies).Error
+	return anomalies, total, err
+}
+
+// ReviewSpendAnomaly 更新异常记录的处理状态
+func ReviewSpendAnomaly(id int, status string, reviewerId int, note string) error {
+	return DB.Model(&SpendAnomaly{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      status,
+		"reviewed_by": reviewerId,
+		"review_note": note,
+		"reviewed_at": common.GetTimestamp(),
+	}).Error
+}
+
+// SetTokenStatus 修改令牌状态并同步缓存
+func SetTokenStatus(tokenId int, status int) (*Token, error) {
+	token, err := GetTokenById(tokenId)
+	if err != nil {
+		return nil, err
+	}
+	token.Status = status
+	if err := token.SelectUpdate(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
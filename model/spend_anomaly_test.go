@@ -0,0 +1,71 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func insertConsumeLog(t *testing.T, userId int, tokenId int, quota int, modelName string, ip string, createdAt int64) {
+	t.Helper()
+	require.NoError(t, LOG_DB.Create(&Log{
+		UserId:    userId,
+		TokenId:   tokenId,
+		TokenName: "t",
+		Type:      LogTypeConsume,
+		Quota:     quota,
+		ModelName: modelName,
+		Ip:        ip,
+		CreatedAt: createdAt,
+	}).Error)
+}
+
+func TestSpendAnomalyQueries(t *testing.T) {
+	truncateTables(t)
+	now := int64(1_000_000)
+	insertConsumeLog(t, 1, 10, 100, "gpt-4o", "1.1.1.1", now-3600)
+	insertConsumeLog(t, 1, 10, 5000, "o1", "2.2.2.2", now-60)
+	insertConsumeLog(t, 1, 11, 300, "gpt-4o", "", now-30)
+
+	spends, err := GetTokenSpends(now-600, now)
+	require.NoError(t, err)
+	require.Len(t, spends, 2)
+
+	quota, count, err := GetSpendBetween(1, 10, now-7200, now-600)
+	require.NoError(t, err)
+	require.Equal(t, 100, quota)
+	require.Equal(t, 1, count)
+
+	quota, _, err = GetSpendBetween(1, 0, now-600, now)
+	require.NoError(t, err)
+	require.Equal(t, 5300, quota)
+
+	ips, err := GetTokenLogValues(10, "ip", now-600, now)
+	require.NoError(t, err)
+	require.Equal(t, []string{"2.2.2.2"}, ips)
+	_, err = GetTokenLogValues(10, "content", now-600, now)
+	require.Error(t, err)
+}
+
+func TestSpendAnomalySuspendToken(t *testing.T) {
+	truncateTables(t)
+	token := &Token{UserId: 1, Key: "spendanomalykey", Name: "t", Status: common.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}
+	require.NoError(t, DB.Create(token).Error)
+
+	_, err := SetTokenStatus(token.Id, common.TokenStatusSuspended)
+	require.NoError(t, err)
+	_, err = ValidateUserToken("spendanomalykey")
+	require.ErrorContains(t, err, "异常消费")
+
+	anomaly := &SpendAnomaly{UserId: 1, TokenId: token.Id, Kind: SpendAnomalyKindVelocity}
+	require.NoError(t, anomaly.Insert())
+	exists, err := HasRecentSpendAnomaly(1, token.Id, SpendAnomalyKindVelocity, anomaly.CreatedAt)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	require.NoError(t, ReviewSpendAnomaly(anomaly.Id, SpendAnomalyStatusConfirmed, 1, ""))
+	got, err := GetSpendAnomalyById(anomaly.Id)
+	require.NoError(t, err)
+	require.Equal(t, SpendAnomalyStatusConfirmed, got.Status)
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+// StatementModelUsage 账单期内按模型汇总的用量
+type StatementModelUsage struct {
+	ModelName        string `json:"model_name"`
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	Quota            int64  `json:"quota"`
+}
+
+// StatementRedemption 账单期内兑换的兑换码
+type StatementRedemption struct {
+	Id           int    `json:"id"`
+	Name         string `json:"name"`
+	Quota        int    `json:"quota"`
+	RedeemedTime int64  `json:"redeemed_time"`
+}
+
+// GetUserModelUsage 从消费日志按模型汇总用户在 [start, end) 内的用量
+func GetUserModelUsage(userId int, startTimestamp int64, endTimestamp int64) (usages []StatementModelUsage, err error) {
+	err = LOG_DB.Model(&Log{}).
+		Select("model_name, count(*) as requests, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, sum(quota) as quota").
+		Where("user_id = ? AND type = ? AND created_at >= ? AND created_at < ?", userId, LogTypeConsume, startTimestamp, endTimestamp).
+		Group("model_name").
+		Order("quota desc").
+		Scan(&usages).Error
+	return usages, err
+}
+
+// GetUserSuccessfulTopUps 返回用户在 [start, end) 内完成的充值，包含订阅订单对应的记录
+func GetUserSuccessfulTopUps(userId int, startTimestamp int64, endTimestamp int64) (topUps []*TopUp, err error) {
+	err = DB.Where("user_id = ? AND status = ? AND complete_time >= ? AND complete_time < ?",
+		userId, common.TopUpStatusSuccess, startTimestamp, endTimestamp).
+		Order("complete_time asc").Find(&topUps).Error
+	return topUps, err
+}
+
+// GetUserSuccessfulSubscriptionOrders 返回用户在 [start, end) 内完成的订阅订单
+func GetUserSuccessfulSubscriptionOrders(userId int, startTimestamp int64, endTimestamp int64) (orders []*SubscriptionOrder, err error) {
+	err = DB.Where("user_id = ? AND status = ? AND complete_time >= ? AND complete_time < ?",
+		userId, common.TopUpStatusSuccess, startTimestamp, endTimestamp).
+		Order("complete_time asc").Find(&orders).Error
+	return orders, err
+}
+
+// GetUserRedemptionsBetween 返回用户在 [start, end) 内兑换的兑换码，已删除的兑换码同样计入
+func GetUserRedemptionsBetween(userId int, startTimestamp int64, endTimestamp int64) (redemptions []StatementRedemption, err error) {
+	err = DB.Unscoped().Model(&Redemption{}).
+		Select("id, name, quota, redeemed_time").
+		Where("used_user_id = ? AND redeemed_time >= ? AND redeemed_time < ?", userId, startTimestamp, endTimestamp).
+		Order("redeemed_time asc").
+		Scan(&redemptions).Error
+	return redemptions, err
+}
+
+// GetStatementUserIds 返回 [start, end) 内有消费或充值记录的用户
+func GetStatementUserIds(startTimestamp int64, endTimestamp int64) ([]int, error) {
+	var consumeUserIds []int
+	err := LOG_DB.Model(&Log{}).
+		Where("type = ? AND created_at >= ? AND created_at < ?", LogTypeConsume, startTimestamp, endTimestamp).
+		Distinct().Pluck("user_id", &consumeUserIds).Error
+	if err != nil {
+		return nil, err
+	}
+	var topUpUserIds []int
+	err = DB.Model(&TopUp{}).
+		Where("status = ? AND complete_time >= ? AND complete_time < ?", common.TopUpStatusSuccess, startTimestamp, endTimestamp).
+		Distinct().Pluck("user_id", &topUpUserIds).Error
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int]struct{}, len(consumeUserIds)+len(topUpUserIds))
+	userIds := make([]int, 0, len(consumeUserIds)+len(topUpUserIds))
+	for _, id := range append(consumeUserIds, topUpUserIds...) {
+		if _, ok := seen[id]; ok || id == 0 {
+			continue
+		}
+		seen[id] = struct{}{}
+		userIds = append(userIds, id)
+	}
+	return userIds, nil
+}
@@ -567,6 +567,7 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
 	if logUserId > 0 {
 		msg := fmt.Sprintf("订阅购买成功，套餐: %s，支付金额: %.2f，支付方式: %s", logPlanTitle, logMoney, logPaymentMethod)
 		RecordLog(logUserId, LogTypeTopup, msg)
+		IssueInvoiceAfterPayment(tradeNo)
 	}
 	return nil
 }
@@ -946,10 +947,18 @@ func maybeResetUserSubscriptionWithPlanTx(tx *gorm.DB, sub *UserSubscription, pl
 		}
 		return nil
 	}
+	restored := sub.AmountUsed
 	sub.AmountUsed = 0
 	sub.LastResetTime = base.Unix()
 	sub.NextResetTime = next
-	return tx.Save(sub).Error
+	if err := tx.Save(sub).Error; err != nil {
+		return err
+	}
+	return recordSubscriptionLedgerTx(tx, sub, restored, QuotaLedgerMeta{
+		Type:           QuotaLedgerTypeSubscriptionReset,
+		IdempotencyKey: fmt.Sprintf("subscription_reset:%d:%d", sub.Id, sub.LastResetTime),
+		ReferenceId:    strconv.Itoa(sub.Id),
+	})
 }
 
 // PreConsumeUserSubscription pre-consumes from any active subscription total quota.
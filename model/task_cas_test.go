@@ -26,6 +26,7 @@ func TestMain(m *testing.M) {
 	common.RedisEnabled = false
 	common.BatchUpdateEnabled = false
 	common.LogConsumeEnabled = true
+	initCol()
 
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -33,7 +34,11 @@ func TestMain(m *testing.M) {
 	}
 	sqlDB.SetMaxOpenConns(1)
 
-	if err := db.AutoMigrate(&Task{}, &User{}, &Token{}, &Log{}, &Channel{}); err != nil {
+	if err := db.AutoMigrate(&Task{}, &User{}, &Token{}, &Log{}, &Channel{}, &QuotaLedger{},
+		&TopUp{}, &SubscriptionOrder{}, &Invoice{}, &InvoiceSequence{}, &PaymentEvent{},
+		&CreditBucket{}, &CreditBucketUsage{},
+		&Redemption{}, &RedemptionCampaign{}, &RedemptionUse{}, &RedemptionGroupGrant{}, &SpendAnomaly{}, &UserMonthlyQuota{},
+		&Role{}, &UserRole{}, &AuditLog{}, &Option{}, &CustomOAuthProvider{}, &Ability{}); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
 
@@ -48,6 +53,25 @@ func truncateTables(t *testing.T) {
 		DB.Exec("DELETE FROM tokens")
 		DB.Exec("DELETE FROM logs")
 		DB.Exec("DELETE FROM channels")
+		DB.Exec("DELETE FROM quota_ledgers")
+		DB.Exec("DELETE FROM top_ups")
+		DB.Exec("DELETE FROM subscription_orders")
+		DB.Exec("DELETE FROM invoices")
+		DB.Exec("DELETE FROM invoice_sequences")
+		DB.Exec("DELETE FROM payment_events")
+		DB.Exec("DELETE FROM credit_buckets")
+		DB.Exec("DELETE FROM credit_bucket_usages")
+		DB.Exec("DELETE FROM redemptions")
+		DB.Exec("DELETE FROM redemption_campaigns")
+		DB.Exec("DELETE FROM redemption_uses")
+		DB.Exec("DELETE FROM redemption_group_grants")
+		DB.Exec("DELETE FROM spend_anomalies")
+		DB.Exec("DELETE FROM user_monthly_quotas")
+		DB.Exec("DELETE FROM roles")
+		DB.Exec("DELETE FROM user_roles")
+		DB.Exec("DELETE FROM audit_logs")
+		DB.Exec("DELETE FROM options")
+		DB.Exec("DELETE FROM custom_oauth_providers")
 	})
 }
 
@@ -12,23 +12,28 @@ import (
 )
 
 type Token struct {
-	Id                 int            `json:"id"`
-	UserId             int            `json:"user_id" gorm:"index"`
-	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"`
-	Status             int            `json:"status" gorm:"default:1"`
-	Name               string         `json:"name" gorm:"index" `
-	CreatedTime        int64          `json:"created_time" gorm:"bigint"`
-	AccessedTime       int64          `json:"accessed_time" gorm:"bigint"`
-	ExpiredTime        int64          `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
-	RemainQuota        int            `json:"remain_quota" gorm:"default:0"`
-	UnlimitedQuota     bool           `json:"unlimited_quota"`
-	ModelLimitsEnabled bool           `json:"model_limits_enabled"`
-	ModelLimits        string         `json:"model_limits" gorm:"type:text"`
-	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
-	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
-	Group              string         `json:"group" gorm:"default:''"`
-	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
-	DeletedAt          gorm.DeletedAt `gorm:"index"`
+	Id                 int     `json:"id"`
+	UserId             int     `json:"user_id" gorm:"index"`
+	Key                string  `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Status             int     `json:"status" gorm:"default:1"`
+	Name               string  `json:"name" gorm:"index" `
+	CreatedTime        int64   `json:"created_time" gorm:"bigint"`
+	AccessedTime       int64   `json:"accessed_time" gorm:"bigint"`
+	ExpiredTime        int64   `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	RemainQuota        int     `json:"remain_quota" gorm:"default:0"`
+	UnlimitedQuota     bool    `json:"unlimited_quota"`
+	ModelLimitsEnabled bool    `json:"model_limits_enabled"`
+	ModelLimits        string  `json:"model_limits" gorm:"type:text"`
+	AllowIps           *string `json:"allow_ips" gorm:"default:''"`
+	UsedQuota          int     `json:"used_quota" gorm:"default:0"` // used quota
+	Group              string  `json:"group" gorm:"default:''"`
+	CrossGroupRetry    bool    `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
+	// 单个终端用户在该令牌下的限制，0 表示不限制
+	EndUserRPM        int            `json:"end_user_rpm" gorm:"default:0"`
+	EndUserTPM        int            `json:"end_user_tpm" gorm:"default:0"`
+	EndUserDailyQuota int            `json:"end_user_daily_quota" gorm:"default:0"`
+	DataResidency     string         `json:"data_residency" gorm:"type:varchar(255);default:''"` // 允许的数据驻留区域，逗号分隔
+	DeletedAt         gorm.DeletedAt `gorm:"index"`
 }
 
 func (token *Token) Clean() {
@@ -197,6 +202,8 @@ func ValidateUserToken(key string) (token *Token, err error) {
 			return token, errors.New("该令牌额度已用尽 TokenStatusExhausted[sk-" + keyPrefix + "***" + keySuffix + "]")
 		} else if token.Status == common.TokenStatusExpired {
 			return token, errors.New("该令牌已过期")
+		} else if token.Status == common.TokenStatusSuspended {
+			return token, errors.New("该令牌因异常消费已暂停，请登录控制台确认后恢复")
 		}
 		if token.Status != common.TokenStatusEnabled {
 			return token, errors.New("该令牌状态不可用")
@@ -304,7 +311,8 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry",
+		"end_user_rpm", "end_user_tpm", "end_user_daily_quota", "data_residency").Updates(token).Error
 	return err
 }
 
@@ -481,3 +489,28 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 
 	return len(tokens), nil
 }
+
+// DisableUserTokens 禁用用户的全部可用令牌，返回禁用数量
+func DisableUserTokens(userId int) (int, error) {
+	var tokens []Token
+	if err := DB.Where("user_id = ? AND status <> ?", userId, common.TokenStatusDisabled).Find(&tokens).Error; err != nil {
+		return 0, err
+	}
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+	if err := DB.Model(&Token{}).Where("user_id = ? AND status <> ?", userId, common.TokenStatusDisabled).
+		Update("status", common.TokenStatusDisabled).Error; err != nil {
+		return 0, err
+	}
+
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			for _, t := range tokens {
+				_ = cacheDeleteToken(t.Key)
+			}
+		})
+	}
+
+	return len(tokens), nil
+}
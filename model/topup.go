@@ -21,6 +21,10 @@ type TopUp struct {
 	CreateTime       int64   `json:"create_time"`
 	CompleteTime     int64   `json:"complete_time"`
 	Status           string  `json:"status"`
+	// RefundedMoney 已退款或被拒付扣回的支付金额
+	RefundedMoney     float64 `json:"refunded_money" gorm:"default:0"`
+	// ProviderReference 支付渠道侧的单号（如 Stripe PaymentIntent），用于匹配退款与争议通知
+	ProviderReference string  `json:"provider_reference,omitempty" gorm:"type:varchar(255);index;default:''"`
 }
 
 func (topUp *TopUp) Insert() error {
@@ -90,6 +94,9 @@ func Recharge(referenceId string, customerId string) (err error) {
 		if err != nil {
 			return err
 		}
+		if err := RecordQuotaLedger(tx, topUp.UserId, int(quota), topUpLedgerMeta(topUp)); err != nil {
+			return err
+		}
 
 		return nil
 	})
@@ -100,6 +107,7 @@ func Recharge(referenceId string, customerId string) (err error) {
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(int(quota)), topUp.Amount))
+	IssueInvoiceAfterPayment(topUp.TradeNo)
 
 	return nil
 }
@@ -292,6 +300,9 @@ func ManualCompleteTopUp(tradeNo string) error {
 		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
 			return err
 		}
+		if err := RecordQuotaLedger(tx, topUp.UserId, quotaToAdd, topUpLedgerMeta(topUp)); err != nil {
+			return err
+		}
 
 		userId = topUp.UserId
 		payMoney = topUp.Money
@@ -304,6 +315,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 
 	// 事务外记录日志，避免阻塞
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney))
+	IssueInvoiceAfterPayment(tradeNo)
 	return nil
 }
 func RechargeCreem(referenceId string, customerEmail string, customerName string) (err error) {
@@ -364,7 +376,7 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 			return err
 		}
 
-		return nil
+		return RecordQuotaLedger(tx, topUp.UserId, int(quota), topUpLedgerMeta(topUp))
 	})
 
 	if err != nil {
@@ -373,6 +385,7 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money))
+	IssueInvoiceAfterPayment(topUp.TradeNo)
 
 	return nil
 }
@@ -420,6 +433,9 @@ func RechargeWaffo(tradeNo string) (err error) {
 		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
 			return err
 		}
+		if err := RecordQuotaLedger(tx, topUp.UserId, quotaToAdd, topUpLedgerMeta(topUp)); err != nil {
+			return err
+		}
 
 		return nil
 	})
@@ -431,7 +447,26 @@ func RechargeWaffo(tradeNo string) (err error) {
 
 	if quotaToAdd > 0 {
 		RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("Waffo充值成功，充值额度: %v，支付金额: %.2f", logger.FormatQuota(quotaToAdd), topUp.Money))
+		IssueInvoiceAfterPayment(topUp.TradeNo)
 	}
 
 	return nil
 }
+
+// topUpLedgerMeta 以订单号作为幂等键，同一订单只会入账一次
+func topUpLedgerMeta(topUp *TopUp) QuotaLedgerMeta {
+	return QuotaLedgerMeta{
+		Type:           QuotaLedgerTypeTopUp,
+		IdempotencyKey: "topup:" + topUp.TradeNo,
+		ReferenceId:    topUp.TradeNo,
+		Remark:         topUp.PaymentMethod,
+	}
+}
+
+// SetTopUpProviderReference 记录支付渠道侧单号，供退款与争议通知反查订单
+func SetTopUpProviderReference(tradeNo string, reference string) error {
+	if tradeNo == "" || reference == "" {
+		return nil
+	}
+	return DB.Model(&TopUp{}).Where("trade_no = ?", tradeNo).Update("provider_reference", reference).Error
+}
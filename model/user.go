@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -32,6 +33,7 @@ type User struct {
 	GitHubId         string         `json:"github_id" gorm:"column:github_id;index"`
 	DiscordId        string         `json:"discord_id" gorm:"column:discord_id;index"`
 	OidcId           string         `json:"oidc_id" gorm:"column:oidc_id;index"`
+	LdapId           string         `json:"ldap_id" gorm:"column:ldap_id;index"`
 	WeChatId         string         `json:"wechat_id" gorm:"column:wechat_id;index"`
 	TelegramId       string         `json:"telegram_id" gorm:"column:telegram_id;index"`
 	VerificationCode string         `json:"verification_code" gorm:"-:all"`                                    // this field is only for Email verification, don't save it to database!
@@ -50,17 +52,20 @@ type User struct {
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	Remark           string         `json:"remark,omitempty" gorm:"type:varchar(255)" validate:"max=255"`
 	StripeCustomer   string         `json:"stripe_customer" gorm:"type:varchar(64);column:stripe_customer;index"`
+	CreatedTime      int64          `json:"created_time" gorm:"bigint;default:0"`               // 注册时间，早期用户为 0
+	DataResidency    string         `json:"data_residency" gorm:"type:varchar(255);default:''"` // 允许的数据驻留区域，逗号分隔，为空表示不限制
 }
 
 func (user *User) ToBaseUser() *UserBase {
 	cache := &UserBase{
-		Id:       user.Id,
-		Group:    user.Group,
-		Quota:    user.Quota,
-		Status:   user.Status,
-		Username: user.Username,
-		Setting:  user.Setting,
-		Email:    user.Email,
+		Id:            user.Id,
+		Group:         user.Group,
+		Quota:         user.Quota,
+		Status:        user.Status,
+		Username:      user.Username,
+		Setting:       user.Setting,
+		Email:         user.Email,
+		DataResidency: user.DataResidency,
 	}
 	return cache
 }
@@ -77,17 +82,35 @@ func (user *User) SetAccessToken(token string) {
 }
 
 func (user *User) GetSetting() dto.UserSetting {
+	return decodeUserSetting(user.Setting)
+}
+
+// decodeUserSetting 解析用户设置并解密其中的 Webhook 密钥
+func decodeUserSetting(raw string) dto.UserSetting {
 	setting := dto.UserSetting{}
-	if user.Setting != "" {
-		err := json.Unmarshal([]byte(user.Setting), &setting)
+	if raw != "" {
+		err := json.Unmarshal([]byte(raw), &setting)
 		if err != nil {
 			common.SysLog("failed to unmarshal setting: " + err.Error())
 		}
 	}
+	if secret, err := common.DecryptSecret(setting.WebhookSecret); err != nil {
+		common.SysLog("failed to decrypt webhook secret: " + err.Error())
+		setting.WebhookSecret = ""
+	} else {
+		setting.WebhookSecret = secret
+	}
 	return setting
 }
 
+// SetSetting 保存用户设置，Webhook 密钥加密后保存
 func (user *User) SetSetting(setting dto.UserSetting) {
+	secret, err := common.EncryptSecret(setting.WebhookSecret)
+	if err != nil {
+		common.SysLog("failed to encrypt webhook secret: " + err.Error())
+		return
+	}
+	setting.WebhookSecret = secret
 	settingBytes, err := json.Marshal(setting)
 	if err != nil {
 		common.SysLog("failed to marshal setting: " + err.Error())
@@ -371,6 +394,9 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 	if err := tx.Save(user).Error; err != nil {
 		return err
 	}
+	if err := RecordQuotaLedger(tx, user.Id, quota, QuotaLedgerMeta{Type: QuotaLedgerTypeAffiliate}); err != nil {
+		return err
+	}
 
 	// 提交事务
 	return tx.Commit().Error
@@ -387,6 +413,7 @@ func (user *User) Insert(inviterId int) error {
 	user.Quota = common.QuotaForNewUser
 	//user.SetAccessToken(common.GetUUID())
 	user.AffCode = common.GetRandomString(4)
+	user.CreatedTime = common.GetTimestamp()
 
 	// 初始化用户设置，包括默认的边栏配置
 	if user.Setting == "" {
@@ -420,7 +447,11 @@ func (user *User) Insert(inviterId int) error {
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
+			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true, QuotaLedgerMeta{
+				Type:           QuotaLedgerTypeInvite,
+				IdempotencyKey: fmt.Sprintf("invite:%d", user.Id),
+				ReferenceId:    strconv.Itoa(inviterId),
+			})
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", logger.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
@@ -445,6 +476,7 @@ func (user *User) InsertWithTx(tx *gorm.DB, inviterId int) error {
 	}
 	user.Quota = common.QuotaForNewUser
 	user.AffCode = common.GetRandomString(4)
+	user.CreatedTime = common.GetTimestamp()
 
 	// 初始化用户设置
 	if user.Setting == "" {
@@ -481,7 +513,11 @@ func (user *User) FinalizeOAuthUserCreation(inviterId int) {
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
+			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true, QuotaLedgerMeta{
+				Type:           QuotaLedgerTypeInvite,
+				IdempotencyKey: fmt.Sprintf("invite:%d", user.Id),
+				ReferenceId:    strconv.Itoa(inviterId),
+			})
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", logger.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
@@ -520,18 +556,29 @@ func (user *User) Edit(updatePassword bool) error {
 
 	newUser := *user
 	updates := map[string]interface{}{
-		"username":     newUser.Username,
-		"display_name": newUser.DisplayName,
-		"group":        newUser.Group,
-		"quota":        newUser.Quota,
-		"remark":       newUser.Remark,
+		"username":       newUser.Username,
+		"display_name":   newUser.DisplayName,
+		"group":          newUser.Group,
+		"quota":          newUser.Quota,
+		"remark":         newUser.Remark,
+		"data_residency": strings.Join(ParseRegions(newUser.DataResidency), ","),
 	}
 	if updatePassword {
 		updates["password"] = newUser.Password
 	}
 
 	DB.First(&user, user.Id)
-	if err = DB.Model(user).Updates(updates).Error; err != nil {
+	delta := newUser.Quota - user.Quota
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if delta == 0 {
+			return nil
+		}
+		return RecordQuotaLedger(tx, user.Id, delta, QuotaLedgerMeta{Type: QuotaLedgerTypeAdmin})
+	})
+	if err != nil {
 		return err
 	}
 
@@ -549,6 +596,7 @@ func (user *User) ClearBinding(bindingType string) error {
 		"github":   "github_id",
 		"discord":  "discord_id",
 		"oidc":     "oidc_id",
+		"ldap":     "ldap_id",
 		"wechat":   "wechat_id",
 		"telegram": "telegram_id",
 		"linuxdo":  "linux_do_id",
@@ -657,6 +705,14 @@ func (user *User) FillUserByOidcId() error {
 	return nil
 }
 
+func (user *User) FillUserByLdapId() error {
+	if user.LdapId == "" {
+		return errors.New("ldap id 为空！")
+	}
+	DB.Where(User{LdapId: user.LdapId}).First(user)
+	return nil
+}
+
 func (user *User) FillUserByWeChatId() error {
 	if user.WeChatId == "" {
 		return errors.New("WeChat id 为空！")
@@ -696,6 +752,10 @@ func IsOidcIdAlreadyTaken(oidcId string) bool {
 	return DB.Where("oidc_id = ?", oidcId).Find(&User{}).RowsAffected == 1
 }
 
+func IsLdapIdAlreadyTaken(ldapId string) bool {
+	return DB.Where("ldap_id = ?", ldapId).Find(&User{}).RowsAffected == 1
+}
+
 func IsTelegramIdAlreadyTaken(telegramId string) bool {
 	return DB.Unscoped().Where("telegram_id = ?", telegramId).Find(&User{}).RowsAffected == 1
 }
@@ -805,6 +865,54 @@ func GetUserEmail(id int) (email string, err error) {
 	return email, err
 }
 
+// UpdateUserGroup 更新用户分组并同步缓存，分组未变化时不写库
+func UpdateUserGroup(user *User, group string) error {
+	if group == "" || group == user.Group {
+		return nil
+	}
+	if err := DB.Model(&User{}).Where("id = ?", user.Id).Updates(map[string]interface{}{"group": group}).Error; err != nil {
+		return err
+	}
+	user.Group = group
+	return updateUserGroupCache(user.Id, group)
+}
+
+// ApplyUserMapping 将身份映射结果写入用户：网关分组、内置管理员标记与自定义角色
+func ApplyUserMapping(user *User, group string, role int, roleIds []int) error {
+	updates := map[string]interface{}{}
+	if group != "" && group != user.Group {
+		updates["group"] = group
+		user.Group = group
+	}
+	if user.Role != common.RoleRootUser && role != user.Role {
+		updates["role"] = role
+		user.Role = role
+	}
+	if len(updates) > 0 {
+		if err := DB.Model(&User{}).Where("id = ?", user.Id).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := updateUserCache(*user); err != nil {
+			common.SysError("failed to update user cache: " + err.Error())
+		}
+	}
+	return SetUserRoles(user.Id, roleIds)
+}
+
+// UpdateUserExtraUsableGroups 覆盖用户设置中的额外可用分组
+func UpdateUserExtraUsableGroups(user *User, groups []string) error {
+	setting := user.GetSetting()
+	if slices.Equal(setting.ExtraUsableGroups, groups) {
+		return nil
+	}
+	setting.ExtraUsableGroups = groups
+	user.SetSetting(setting)
+	if err := DB.Model(&User{}).Where("id = ?", user.Id).Update("setting", user.Setting).Error; err != nil {
+		return err
+	}
+	return updateUserCache(*user)
+}
+
 // GetUserGroup gets group from Redis first, falls back to DB if needed
 func GetUserGroup(id int, fromDB bool) (group string, err error) {
 	defer func() {
@@ -871,7 +979,7 @@ func GetUserSetting(id int, fromDB bool) (settingMap dto.UserSetting, err error)
 	return userBase.GetSetting(), nil
 }
 
-func IncreaseUserQuota(id int, quota int, db bool) (err error) {
+func IncreaseUserQuota(id int, quota int, db bool, meta ...QuotaLedgerMeta) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -881,6 +989,9 @@ func IncreaseUserQuota(id int, quota int, db bool) (err error) {
 			common.SysLog("failed to increase user quota: " + err.Error())
 		}
 	})
+	if quotaLedgerActive() {
+		return updateUserQuotaWithLedger(id, quota, pickQuotaLedgerMeta(meta, QuotaLedgerTypeAdjust))
+	}
 	if !db && common.BatchUpdateEnabled {
 		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
 		return nil
@@ -896,7 +1007,7 @@ func increaseUserQuota(id int, quota int) (err error) {
 	return err
 }
 
-func DecreaseUserQuota(id int, quota int) (err error) {
+func DecreaseUserQuota(id int, quota int, meta ...QuotaLedgerMeta) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -906,6 +1017,9 @@ func DecreaseUserQuota(id int, quota int) (err error) {
 			common.SysLog("failed to decrease user quota: " + err.Error())
 		}
 	})
+	if quotaLedgerActive() {
+		return updateUserQuotaWithLedger(id, -quota, pickQuotaLedgerMeta(meta, QuotaLedgerTypeAdjust))
+	}
 	if common.BatchUpdateEnabled {
 		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
 		return nil
@@ -921,14 +1035,14 @@ func decreaseUserQuota(id int, quota int) (err error) {
 	return err
 }
 
-func DeltaUpdateUserQuota(id int, delta int) (err error) {
+func DeltaUpdateUserQuota(id int, delta int, meta ...QuotaLedgerMeta) (err error) {
 	if delta == 0 {
 		return nil
 	}
 	if delta > 0 {
-		return IncreaseUserQuota(id, delta, false)
+		return IncreaseUserQuota(id, delta, false, meta...)
 	} else {
-		return DecreaseUserQuota(id, -delta)
+		return DecreaseUserQuota(id, -delta, meta...)
 	}
 }
 
@@ -962,6 +1076,7 @@ func updateUserUsedQuotaAndRequestCount(id int, quota int, count int) {
 		common.SysLog("failed to update user used quota and request count: " + err.Error())
 		return
 	}
+	addUserMonthlyQuota(id, quota)
 
 	//// 更新缓存
 	//if err := invalidateUserCache(id); err != nil {
@@ -977,7 +1092,9 @@ func updateUserUsedQuota(id int, quota int) {
 	).Error
 	if err != nil {
 		common.SysLog("failed to update user used quota: " + err.Error())
+		return
 	}
+	addUserMonthlyQuota(id, quota)
 }
 
 func updateUserRequestCount(id int, count int) {
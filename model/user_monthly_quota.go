@@ -0,0 +1,72 @@
+package model
+
+import (
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 月度消费额度缓存时长，分组定价规则按用量分档时允许短暂的统计延迟
+const userMonthlyQuotaCacheTTL = 5 * time.Minute
+
+// UserMonthlyQuota 用户按月累计的消费额度，在结算累加 used_quota 时同步更新，不依赖消费日志；
+// 统计周期按分组定价规则的时区划分，启用定价规则后开始累计
+type UserMonthlyQuota struct {
+	UserId     int   `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	MonthStart int64 `json:"month_start" gorm:"primaryKey;autoIncrement:false"`
+	Quota      int   `json:"quota" gorm:"default:0"`
+}
+
+type userMonthlyQuotaEntry struct {
+	monthStart int64
+	quota      int
+	expiresAt  time.Time
+}
+
+var userMonthlyQuotaCache sync.Map // map[int]userMonthlyQuotaEntry
+
+// addUserMonthlyQuota 累加用户当月消费额度，未启用分组定价规则时跳过
+func addUserMonthlyQuota(userId int, quota int) {
+	settings := ratio_setting.GetGroupPricingRuleSettings()
+	if !settings.Enabled || quota == 0 {
+		return
+	}
+	monthStart := settings.MonthStart(time.Now()).Unix()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserMonthlyQuota{UserId: userId, MonthStart: monthStart}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&UserMonthlyQuota{}).Where("user_id = ? and month_start = ?", userId, monthStart).
+			Update("quota", gorm.Expr("quota + ?", quota)).Error
+	})
+	if err != nil {
+		common.SysLog("failed to update user monthly quota: " + err.Error())
+	}
+}
+
+// GetUserMonthlyConsumeQuota 返回用户自 monthStart 起的累计消费额度，结果在内存中缓存
+func GetUserMonthlyConsumeQuota(userId int, monthStart int64) (int, error) {
+	if value, ok := userMonthlyQuotaCache.Load(userId); ok {
+		entry := value.(userMonthlyQuotaEntry)
+		if entry.monthStart == monthStart && time.Now().Before(entry.expiresAt) {
+			return entry.quota, nil
+		}
+	}
+	var quota int
+	err := DB.Model(&UserMonthlyQuota{}).Select("coalesce(sum(quota),0)").
+		Where("user_id = ? and month_start = ?", userId, monthStart).Scan(&quota).Error
+	if err != nil {
+		return 0, err
+	}
+	userMonthlyQuotaCache.Store(userId, userMonthlyQuotaEntry{
+		monthStart: monthStart,
+		quota:      quota,
+		expiresAt:  time.Now().Add(userMonthlyQuotaCacheTTL),
+	})
+	return quota, nil
+}
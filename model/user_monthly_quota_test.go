@@ -0,0 +1,36 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserMonthlyQuotaCountsWithoutConsumeLogs(t *testing.T) {
+	truncateTables(t)
+	settings := ratio_setting.GetGroupPricingRuleSettings()
+	oldEnabled, oldLogConsume := settings.Enabled, common.LogConsumeEnabled
+	settings.Enabled = true
+	common.LogConsumeEnabled = false
+	t.Cleanup(func() {
+		settings.Enabled = oldEnabled
+		common.LogConsumeEnabled = oldLogConsume
+	})
+
+	user := &User{Username: "monthly", Password: "password"}
+	require.NoError(t, DB.Create(user).Error)
+	UpdateUserUsedQuotaAndRequestCount(user.Id, 300)
+	UpdateUserUsedQuotaAndRequestCount(user.Id, 200)
+
+	monthStart := settings.MonthStart(time.Now()).Unix()
+	quota, err := GetUserMonthlyConsumeQuota(user.Id, monthStart)
+	require.NoError(t, err)
+	require.Equal(t, 500, quota)
+
+	quota, err = GetUserMonthlyConsumeQuota(user.Id, monthStart-1)
+	require.NoError(t, err)
+	require.Zero(t, quota)
+}
@@ -0,0 +1,78 @@
+package oauth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/samber/lo"
+)
+
+// claimMapping maps user info claims to gateway group, roles and usable groups.
+// Rules use the same condition format as the access policy.
+type claimMapping struct {
+	// DefaultGroup is applied when no rule with a group matches; empty keeps the current group
+	DefaultGroup string             `json:"default_group"`
+	Rules        []claimMappingRule `json:"rules"`
+}
+
+type claimMappingRule struct {
+	Policy       accessPolicy `json:"policy"`
+	Group        string       `json:"group"`
+	Roles        []string     `json:"roles"`
+	UsableGroups []string     `json:"usable_groups"`
+}
+
+func parseClaimMapping(raw string) (*claimMapping, error) {
+	var mapping claimMapping
+	if err := common.UnmarshalJsonStr(raw, &mapping); err != nil {
+		return nil, err
+	}
+	for index := range mapping.Rules {
+		if err := validateAccessPolicy(&mapping.Rules[index].Policy); err != nil {
+			return nil, fmt.Errorf("invalid rule[%d]: %w", index, err)
+		}
+	}
+	return &mapping, nil
+}
+
+// evaluateClaimMapping returns the mapping for the user info body: the first matching rule decides the
+// group, roles and usable groups are the union of all matching rules. Roles and usable groups are only
+// synced when at least one rule configures them, so providers that only map groups keep manual role grants.
+func evaluateClaimMapping(body string, mapping *claimMapping) *dto.IdentityMapping {
+	result := &dto.IdentityMapping{
+		Roles:        make([]string, 0),
+		UsableGroups: make([]string, 0),
+	}
+	for _, rule := range mapping.Rules {
+		result.SyncRoles = result.SyncRoles || len(rule.Roles) > 0
+		result.SyncUsableGroups = result.SyncUsableGroups || len(rule.UsableGroups) > 0
+		if allowed, _ := evaluateAccessPolicy(body, &rule.Policy); !allowed {
+			continue
+		}
+		if result.Group == "" {
+			result.Group = rule.Group
+		}
+		result.Roles = append(result.Roles, rule.Roles...)
+		result.UsableGroups = append(result.UsableGroups, rule.UsableGroups...)
+	}
+	if result.Group == "" {
+		result.Group = mapping.DefaultGroup
+	}
+	result.Roles = lo.Uniq(result.Roles)
+	result.UsableGroups = lo.Uniq(result.UsableGroups)
+	return result
+}
+
+// mapClaims evaluates the raw claim mapping configuration against the user info body; empty config returns nil
+func mapClaims(raw string, body string) (*dto.IdentityMapping, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	mapping, err := parseClaimMapping(raw)
+	if err != nil {
+		return nil, err
+	}
+	return evaluateClaimMapping(body, mapping), nil
+}
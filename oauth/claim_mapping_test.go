@@ -0,0 +1,43 @@
+package oauth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateClaimMapping(t *testing.T) {
+	mapping, err := parseClaimMapping(`{
+		"default_group": "default",
+		"rules": [
+			{"policy": {"conditions": [{"field": "groups", "op": "contains", "value": "ml-team"}]}, "group": "gpu", "usable_groups": ["gpu-batch"]},
+			{"policy": {"conditions": [{"field": "email", "op": "contains", "value": "@example.com"}]}, "group": "staff", "roles": ["admin", "auditor"]},
+			{"policy": {"conditions": [{"field": "department", "op": "eq", "value": "finance"}]}, "roles": ["auditor"], "usable_groups": ["reports"]}
+		]
+	}`)
+	require.NoError(t, err)
+
+	result := evaluateClaimMapping(`{"email":"a@example.com","groups":["ml-team"],"department":"finance"}`, mapping)
+	require.Equal(t, "gpu", result.Group)
+	require.Equal(t, []string{"admin", "auditor"}, result.Roles)
+	require.Equal(t, []string{"gpu-batch", "reports"}, result.UsableGroups)
+	require.True(t, result.SyncRoles)
+	require.True(t, result.SyncUsableGroups)
+
+	// 不再满足任何规则时回到默认分组并清空角色与可用分组，使身份提供方的变更生效
+	result = evaluateClaimMapping(`{"email":"a@other.org","groups":[]}`, mapping)
+	require.Equal(t, "default", result.Group)
+	require.Empty(t, result.Roles)
+	require.Empty(t, result.UsableGroups)
+	require.True(t, result.SyncRoles)
+
+	mapping, err = parseClaimMapping(`{"rules":[{"policy":{"conditions":[{"field":"groups","op":"contains","value":"vip"}]},"group":"vip"}]}`)
+	require.NoError(t, err)
+	result = evaluateClaimMapping(`{"groups":["staff"]}`, mapping)
+	require.Equal(t, "", result.Group)
+	require.False(t, result.SyncRoles)
+	require.False(t, result.SyncUsableGroups)
+
+	_, err = parseClaimMapping(`{"rules":[{"policy":{"conditions":[{"field":"groups","op":"bogus"}]},"group":"vip"}]}`)
+	require.Error(t, err)
+}
@@ -279,14 +279,22 @@ func (p *GenericOAuthProvider) GetUserInfo(ctx context.Context, token *OAuthToke
 		}
 	}
 
+	mapping, err := mapClaims(p.config.ClaimMappings, bodyStr)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("[OAuth-Generic-%s] invalid claim mappings: %s", p.config.Slug, err.Error()))
+		return nil, NewOAuthErrorWithRaw(i18n.MsgOAuthGetUserErr, nil, "invalid claim mappings configuration")
+	}
+
 	return &OAuthUser{
 		ProviderUserID: userId,
 		Username:       username,
 		DisplayName:    displayName,
 		Email:          email,
+		EmailVerified:  gjson.Get(bodyStr, "email_verified").Bool(),
 		Extra: map[string]any{
 			"provider": p.config.Slug,
 		},
+		Mapping: mapping,
 	}, nil
 }
 
@@ -0,0 +1,273 @@
+package oauth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/go-ldap/ldap/v3"
+)
+
+func init() {
+	RegisterPasswordProvider("ldap", &LDAPProvider{})
+}
+
+// LDAPProvider authenticates users against LDAP / Active Directory with a search-then-bind flow
+type LDAPProvider struct{}
+
+func (p *LDAPProvider) GetName() string {
+	return "LDAP"
+}
+
+func (p *LDAPProvider) IsEnabled() bool {
+	settings := system_setting.GetLDAPSettings()
+	return settings.Enabled && settings.ServerURL != "" && settings.SearchBase != ""
+}
+
+func (p *LDAPProvider) AutoProvision() bool {
+	return system_setting.GetLDAPSettings().AutoProvision
+}
+
+func (p *LDAPProvider) Authenticate(ctx context.Context, username string, password string) (*OAuthUser, error) {
+	settings := system_setting.GetLDAPSettings()
+	username = strings.TrimSpace(username)
+	// 空密码会被服务器视为匿名绑定而成功，必须提前拒绝
+	if username == "" || password == "" {
+		return nil, NewOAuthError(i18n.MsgOAuthInvalidLogin, map[string]any{"Provider": p.GetName()})
+	}
+
+	conn, err := dialLDAP(settings)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("[LDAP] connect error: %s", err.Error()))
+		return nil, NewOAuthErrorWithRaw(i18n.MsgOAuthConnectFailed, map[string]any{"Provider": p.GetName()}, err.Error())
+	}
+	defer conn.Close()
+
+	if settings.BindDN != "" {
+		if err := conn.Bind(settings.BindDN, settings.BindPassword); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("[LDAP] service account bind error: %s", err.Error()))
+			return nil, NewOAuthErrorWithRaw(i18n.MsgOAuthConnectFailed, map[string]any{"Provider": p.GetName()}, err.Error())
+		}
+	}
+
+	entry, err := searchLDAPUser(conn, settings, username)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("[LDAP] search error: %s", err.Error()))
+		return nil, NewOAuthErrorWithRaw(i18n.MsgOAuthGetUserErr, nil, err.Error())
+	}
+	if entry == nil {
+		logger.LogDebug(ctx, "[LDAP] user not found: %s", username)
+		return nil, NewOAuthError(i18n.MsgOAuthInvalidLogin, map[string]any{"Provider": p.GetName()})
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			logger.LogDebug(ctx, "[LDAP] invalid credentials: dn=%s", entry.DN)
+			return nil, NewOAuthError(i18n.MsgOAuthInvalidLogin, map[string]any{"Provider": p.GetName()})
+		}
+		logger.LogError(ctx, fmt.Sprintf("[LDAP] user bind error: %s", err.Error()))
+		return nil, NewOAuthErrorWithRaw(i18n.MsgOAuthConnectFailed, map[string]any{"Provider": p.GetName()}, err.Error())
+	}
+
+	providerUserID := strings.ToLower(entry.GetAttributeValue(settings.UsernameAttribute))
+	if providerUserID == "" {
+		logger.LogError(ctx, fmt.Sprintf("[LDAP] empty username attribute %s: dn=%s", settings.UsernameAttribute, entry.DN))
+		return nil, NewOAuthError(i18n.MsgOAuthUserInfoEmpty, map[string]any{"Provider": p.GetName()})
+	}
+
+	body, err := ldapEntryJSON(entry)
+	if err != nil {
+		return nil, err
+	}
+	if policyRaw := strings.TrimSpace(settings.AccessPolicy); policyRaw != "" {
+		policy, err := parseAccessPolicy(policyRaw)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("[LDAP] invalid access policy: %s", err.Error()))
+			return nil, NewOAuthErrorWithRaw(i18n.MsgOAuthGetUserErr, nil, "invalid access policy configuration")
+		}
+		allowed, failure := evaluateAccessPolicy(body, policy)
+		if !allowed {
+			logger.LogWarn(ctx, fmt.Sprintf("[LDAP] access denied by policy: dn=%s field=%s op=%s expected=%v current=%v",
+				entry.DN, failure.Field, failure.Op, failure.Expected, failure.Current))
+			return nil, &AccessDeniedError{Message: renderAccessDeniedMessage(settings.AccessDeniedMessage, p.GetName(), body, failure)}
+		}
+	}
+
+	group, err := matchLDAPGroupMapping(body, settings.GroupMappings)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("[LDAP] invalid group mapping: %s", err.Error()))
+		return nil, NewOAuthErrorWithRaw(i18n.MsgOAuthGetUserErr, nil, "invalid group mapping configuration")
+	}
+
+	logger.LogDebug(ctx, "[LDAP] Authenticate success: dn=%s, username=%s, group=%s", entry.DN, providerUserID, group)
+
+	user := &OAuthUser{
+		ProviderUserID: providerUserID,
+		Username:       entry.GetAttributeValue(settings.UsernameAttribute),
+		DisplayName:    entry.GetAttributeValue(settings.DisplayNameAttribute),
+		Email:          entry.GetAttributeValue(settings.EmailAttribute),
+		Extra: map[string]any{
+			"dn": entry.DN,
+		},
+	}
+	if group != "" {
+		user.Mapping = &dto.IdentityMapping{Group: group}
+	}
+	return user, nil
+}
+
+func (p *LDAPProvider) IsUserIDTaken(providerUserID string) bool {
+	return model.IsLdapIdAlreadyTaken(providerUserID)
+}
+
+func (p *LDAPProvider) FillUserByProviderID(user *model.User, providerUserID string) error {
+	user.LdapId = providerUserID
+	return user.FillUserByLdapId()
+}
+
+func (p *LDAPProvider) SetProviderUserID(user *model.User, providerUserID string) {
+	user.LdapId = providerUserID
+}
+
+func (p *LDAPProvider) GetProviderPrefix() string {
+	return "ldap_"
+}
+
+func dialLDAP(settings *system_setting.LDAPSettings) (*ldap.Conn, error) {
+	timeout := time.Duration(settings.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	serverURL, err := url.Parse(settings.ServerURL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         serverURL.Hostname(),
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+	conn, err := ldap.DialURL(settings.ServerURL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+	if settings.StartTLS && serverURL.Scheme == "ldap" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// searchLDAPUser 按过滤器查找唯一的用户条目，未找到返回 nil，匹配多条视为配置错误
+func searchLDAPUser(conn *ldap.Conn, settings *system_setting.LDAPSettings, username string) (*ldap.Entry, error) {
+	filter := strings.ReplaceAll(settings.SearchFilter, "{username}", ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		settings.SearchBase,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, settings.Timeout, false,
+		filter, []string{"*"}, nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, nil
+	case 1:
+		return result.Entries[0], nil
+	default:
+		return nil, errors.New("search filter matched more than one entry")
+	}
+}
+
+// ldapEntryJSON 将条目转换为访问策略可用的 JSON：单值属性为字符串，多值属性为数组，dn 为条目 DN
+func ldapEntryJSON(entry *ldap.Entry) (string, error) {
+	data := map[string]any{"dn": entry.DN}
+	for _, attr := range entry.Attributes {
+		if len(attr.Values) == 1 {
+			data[attr.Name] = attr.Values[0]
+		} else {
+			data[attr.Name] = attr.Values
+		}
+	}
+	body, err := common.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// matchLDAPGroupMapping 返回第一个满足条件的映射分组，均不满足时返回空字符串
+func matchLDAPGroupMapping(body string, mappings []system_setting.LDAPGroupMapping) (string, error) {
+	for _, mapping := range mappings {
+		if mapping.Group == "" || strings.TrimSpace(mapping.AccessPolicy) == "" {
+			continue
+		}
+		policy, err := parseAccessPolicy(mapping.AccessPolicy)
+		if err != nil {
+			return "", fmt.Errorf("group %s: %w", mapping.Group, err)
+		}
+		if allowed, _ := evaluateAccessPolicy(body, policy); allowed {
+			return mapping.Group, nil
+		}
+	}
+	return "", nil
+}
+
+// ValidateLDAPOption 校验单个 LDAP 设置项，key 不含 "ldap." 前缀
+func ValidateLDAPOption(key string, value string) error {
+	switch key {
+	case "server_url":
+		if value == "" {
+			return nil
+		}
+		serverURL, err := url.Parse(value)
+		if err != nil || (serverURL.Scheme != "ldap" && serverURL.Scheme != "ldaps") || serverURL.Host == "" {
+			return errors.New("server url must be ldap://host:port or ldaps://host:port")
+		}
+	case "search_filter":
+		if !strings.Contains(value, "{username}") {
+			return errors.New("search filter must contain {username}")
+		}
+	case "access_policy":
+		if strings.TrimSpace(value) == "" {
+			return nil
+		}
+		if _, err := parseAccessPolicy(value); err != nil {
+			return fmt.Errorf("invalid access policy: %w", err)
+		}
+	case "group_mappings":
+		var mappings []system_setting.LDAPGroupMapping
+		if err := common.UnmarshalJsonStr(value, &mappings); err != nil {
+			return err
+		}
+		for _, mapping := range mappings {
+			if mapping.Group == "" {
+				return errors.New("group mapping requires a group")
+			}
+			if _, err := parseAccessPolicy(mapping.AccessPolicy); err != nil {
+				return fmt.Errorf("invalid group mapping %s: %w", mapping.Group, err)
+			}
+		}
+	}
+	return nil
+}
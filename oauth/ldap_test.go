@@ -0,0 +1,105 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/jimlambrt/gldap"
+	"github.com/jimlambrt/gldap/testdirectory"
+	"github.com/stretchr/testify/require"
+)
+
+func startTestLDAP(t *testing.T) *system_setting.LDAPSettings {
+	t.Helper()
+	directory := testdirectory.Start(t)
+	adminGroup := "cn=admins,ou=groups,dc=example,dc=org"
+	users := testdirectory.NewUsers(t, []string{"alice"}, testdirectory.WithMembersOf(t, adminGroup, "cn=staff,ou=groups,dc=example,dc=org"))
+	users = append(users, testdirectory.NewUsers(t, []string{"bob"}, testdirectory.WithMembersOf(t, "cn=staff,ou=groups,dc=example,dc=org"))...)
+	users = append(users, gldap.NewEntry("cn=svc,ou=people,dc=example,dc=org", map[string][]string{"password": {"svc-password"}}))
+	directory.SetUsers(users...)
+
+	settings := system_setting.GetLDAPSettings()
+	original := *settings
+	t.Cleanup(func() { *settings = original })
+	*settings = system_setting.LDAPSettings{
+		Enabled:              true,
+		ServerURL:            fmt.Sprintf("ldaps://%s:%d", directory.Host(), directory.Port()),
+		InsecureSkipVerify:   true,
+		BindDN:               "cn=svc,ou=people,dc=example,dc=org",
+		BindPassword:         "svc-password",
+		SearchBase:           "ou=people,dc=example,dc=org",
+		SearchFilter:         "(cn={username})",
+		UsernameAttribute:    "name",
+		DisplayNameAttribute: "name",
+		EmailAttribute:       "email",
+		GroupMappings: []system_setting.LDAPGroupMapping{
+			{Group: "vip", AccessPolicy: `{"conditions":[{"field":"memberOf","op":"contains","value":"` + adminGroup + `"}]}`},
+			{Group: "staff", AccessPolicy: `{"conditions":[{"field":"dn","op":"exists"}]}`},
+		},
+		AutoProvision: true,
+		Timeout:       5,
+	}
+	return settings
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	settings := startTestLDAP(t)
+	provider := GetPasswordProvider("ldap")
+	require.NotNil(t, provider)
+	require.True(t, provider.IsEnabled())
+
+	user, err := provider.Authenticate(context.Background(), "alice", "password")
+	require.NoError(t, err)
+	require.Equal(t, "alice", user.ProviderUserID)
+	require.Equal(t, "alice@example.com", user.Email)
+	require.Equal(t, "cn=alice,ou=people,dc=example,dc=org", user.Extra["dn"])
+	require.Equal(t, "vip", user.Mapping.Group)
+
+	user, err = provider.Authenticate(context.Background(), "bob", "password")
+	require.NoError(t, err)
+	require.Equal(t, "staff", user.Mapping.Group)
+
+	for _, tc := range []struct{ username, password string }{
+		{"alice", "wrong"},
+		{"alice", ""},
+		{"nobody", "password"},
+	} {
+		_, err = provider.Authenticate(context.Background(), tc.username, tc.password)
+		var oauthErr *OAuthError
+		require.ErrorAs(t, err, &oauthErr, tc.username)
+		require.Equal(t, i18n.MsgOAuthInvalidLogin, oauthErr.MsgKey)
+	}
+
+	// 过滤器中的特殊字符必须被转义，不能匹配到其他用户
+	_, err = provider.Authenticate(context.Background(), "*", "password")
+	require.Error(t, err)
+
+	settings.AccessPolicy = `{"conditions":[{"field":"memberOf","op":"contains","value":"cn=admins,ou=groups,dc=example,dc=org"}]}`
+	settings.AccessDeniedMessage = "{{provider}} access denied"
+	_, err = provider.Authenticate(context.Background(), "bob", "password")
+	var deniedErr *AccessDeniedError
+	require.ErrorAs(t, err, &deniedErr)
+	require.Equal(t, "LDAP access denied", deniedErr.Message)
+
+	_, err = provider.Authenticate(context.Background(), "alice", "password")
+	require.NoError(t, err)
+
+	settings.BindPassword = "wrong"
+	_, err = provider.Authenticate(context.Background(), "alice", "password")
+	var connErr *OAuthError
+	require.ErrorAs(t, err, &connErr)
+	require.Equal(t, i18n.MsgOAuthConnectFailed, connErr.MsgKey)
+}
+
+func TestValidateLDAPOption(t *testing.T) {
+	require.NoError(t, ValidateLDAPOption("server_url", "ldaps://dc.example.org:636"))
+	require.Error(t, ValidateLDAPOption("server_url", "https://dc.example.org"))
+	require.Error(t, ValidateLDAPOption("search_filter", "(uid=alice)"))
+	require.NoError(t, ValidateLDAPOption("access_policy", ""))
+	require.Error(t, ValidateLDAPOption("access_policy", `{"conditions":[{"field":"dn","op":"bogus"}]}`))
+	require.NoError(t, ValidateLDAPOption("group_mappings", `[{"group":"vip","access_policy":"{\"conditions\":[{\"field\":\"dn\",\"op\":\"exists\"}]}"}]`))
+	require.Error(t, ValidateLDAPOption("group_mappings", `[{"group":"","access_policy":"{}"}]`))
+}
@@ -7,11 +7,28 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// Provider defines the interface for OAuth providers
-type Provider interface {
+// UserBinder defines how a provider identity is associated with local user accounts
+type UserBinder interface {
 	// GetName returns the display name of the provider (e.g., "GitHub", "Discord")
 	GetName() string
 
+	// IsUserIDTaken checks if the provider user ID is already associated with an account
+	IsUserIDTaken(providerUserID string) bool
+
+	// FillUserByProviderID fills the user model by provider user ID
+	FillUserByProviderID(user *model.User, providerUserID string) error
+
+	// SetProviderUserID sets the provider user ID on the user model
+	SetProviderUserID(user *model.User, providerUserID string)
+
+	// GetProviderPrefix returns the prefix for auto-generated usernames (e.g., "github_")
+	GetProviderPrefix() string
+}
+
+// Provider defines the interface for OAuth providers
+type Provider interface {
+	UserBinder
+
 	// IsEnabled returns whether this OAuth provider is enabled
 	IsEnabled() bool
 
@@ -21,16 +38,19 @@ type Provider interface {
 
 	// GetUserInfo retrieves user information using the access token
 	GetUserInfo(ctx context.Context, token *OAuthToken) (*OAuthUser, error)
+}
 
-	// IsUserIDTaken checks if the provider user ID is already associated with an account
-	IsUserIDTaken(providerUserID string) bool
+// PasswordProvider defines the interface for providers that verify a username and password
+// directly (e.g., LDAP) instead of redirecting to an authorization server
+type PasswordProvider interface {
+	UserBinder
 
-	// FillUserByProviderID fills the user model by provider user ID
-	FillUserByProviderID(user *model.User, providerUserID string) error
+	// IsEnabled returns whether this provider is enabled
+	IsEnabled() bool
 
-	// SetProviderUserID sets the provider user ID on the user model
-	SetProviderUserID(user *model.User, providerUserID string)
+	// Authenticate verifies the credentials and returns the user info
+	Authenticate(ctx context.Context, username string, password string) (*OAuthUser, error)
 
-	// GetProviderPrefix returns the prefix for auto-generated usernames (e.g., "github_")
-	GetProviderPrefix() string
+	// AutoProvision returns whether accounts are created on first login regardless of the registration switch
+	AutoProvision() bool
 }
@@ -9,8 +9,9 @@ import (
 )
 
 var (
-	providers = make(map[string]Provider)
-	mu        sync.RWMutex
+	providers         = make(map[string]Provider)
+	passwordProviders = make(map[string]PasswordProvider)
+	mu                sync.RWMutex
 	// customProviderSlugs tracks which providers are custom (can be unregistered)
 	customProviderSlugs = make(map[string]bool)
 )
@@ -45,6 +46,20 @@ func GetProvider(name string) Provider {
 	return providers[name]
 }
 
+// RegisterPasswordProvider registers a username/password provider with the given name
+func RegisterPasswordProvider(name string, provider PasswordProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	passwordProviders[name] = provider
+}
+
+// GetPasswordProvider returns the username/password provider for the given name
+func GetPasswordProvider(name string) PasswordProvider {
+	mu.RLock()
+	defer mu.RUnlock()
+	return passwordProviders[name]
+}
+
 // GetAllProviders returns all registered OAuth providers
 func GetAllProviders() map[string]Provider {
 	mu.RLock()
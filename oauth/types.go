@@ -1,5 +1,7 @@
 package oauth
 
+import "github.com/QuantumNous/new-api/dto"
+
 // OAuthToken represents the token received from OAuth provider
 type OAuthToken struct {
 	AccessToken  string `json:"access_token"`
@@ -20,8 +22,12 @@ type OAuthUser struct {
 	DisplayName string
 	// Email is the email from the OAuth provider
 	Email string
+	// EmailVerified is the email_verified claim, required for linking to a provisioned account by email
+	EmailVerified bool
 	// Extra contains any additional provider-specific data
 	Extra map[string]any
+	// Mapping is the group/role mapping derived from provider claims, nil when not configured
+	Mapping *dto.IdentityMapping
 }
 
 // OAuthError represents a translatable OAuth error
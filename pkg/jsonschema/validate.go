@@ -0,0 +1,351 @@
+// Package jsonschema implements the subset of JSON Schema used by OpenAI-style
+// structured outputs (response_format.json_schema): type, enum, const, properties,
+// required, additionalProperties, items, string/number/array bounds, anyOf/oneOf/allOf
+// and local $ref into $defs/definitions.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxRefDepth guards against recursive schemas expanding forever.
+const maxRefDepth = 64
+
+type validator struct {
+	root   map[string]any
+	errors []string
+}
+
+// Validate checks a decoded JSON value against a decoded JSON schema and returns
+// the list of violations; an empty result means the value is valid.
+func Validate(schema any, value any) []string {
+	root, _ := schema.(map[string]any)
+	v := &validator{root: root}
+	v.validate(schema, value, "$", 0)
+	return v.errors
+}
+
+// ValidateJSON decodes raw JSON and validates it against schema.
+func ValidateJSON(schema any, raw []byte) []string {
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return []string{fmt.Sprintf("$: invalid JSON: %s", err.Error())}
+	}
+	return Validate(schema, value)
+}
+
+func (v *validator) addError(path string, format string, args ...any) {
+	v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) validate(schemaValue any, value any, path string, depth int) {
+	if depth > maxRefDepth {
+		v.addError(path, "schema nesting too deep")
+		return
+	}
+	switch s := schemaValue.(type) {
+	case bool:
+		if !s {
+			v.addError(path, "value is not allowed")
+		}
+		return
+	case map[string]any:
+		v.validateObjectSchema(s, value, path, depth)
+	}
+}
+
+func (v *validator) validateObjectSchema(schema map[string]any, value any, path string, depth int) {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, found := v.resolveRef(ref)
+		if !found {
+			v.addError(path, "unresolvable $ref %q", ref)
+			return
+		}
+		v.validate(resolved, value, path, depth+1)
+	}
+
+	if types, ok := schemaTypes(schema["type"]); ok {
+		matched := false
+		for _, t := range types {
+			if matchesType(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.addError(path, "expected type %s, got %s", strings.Join(types, " or "), typeName(value))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, candidate := range enum {
+			if jsonEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.addError(path, "value is not one of the allowed enum values")
+		}
+	}
+	if constValue, ok := schema["const"]; ok && !jsonEqual(constValue, value) {
+		v.addError(path, "value does not match const")
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		v.validateObject(schema, typed, path, depth)
+	case []any:
+		v.validateArray(schema, typed, path, depth)
+	case string:
+		v.validateString(schema, typed, path)
+	case float64:
+		v.validateNumber(schema, typed, path)
+	}
+
+	if allOf, ok := schema["allOf"].([]any); ok {
+		for _, sub := range allOf {
+			v.validate(sub, value, path, depth+1)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		if v.countMatches(anyOf, value, path, depth) == 0 {
+			v.addError(path, "value does not match any schema in anyOf")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		if matches := v.countMatches(oneOf, value, path, depth); matches != 1 {
+			v.addError(path, "value must match exactly one schema in oneOf, matched %d", matches)
+		}
+	}
+	if not, ok := schema["not"]; ok {
+		sub := &validator{root: v.root}
+		sub.validate(not, value, path, depth+1)
+		if len(sub.errors) == 0 {
+			v.addError(path, "value must not match schema in not")
+		}
+	}
+}
+
+func (v *validator) countMatches(schemas []any, value any, path string, depth int) int {
+	matches := 0
+	for _, sub := range schemas {
+		subValidator := &validator{root: v.root}
+		subValidator.validate(sub, value, path, depth+1)
+		if len(subValidator.errors) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+func (v *validator) validateObject(schema map[string]any, object map[string]any, path string, depth int) {
+	properties, _ := schema["properties"].(map[string]any)
+	if required, ok := schema["required"].([]any); ok {
+		for _, item := range required {
+			name, ok := item.(string)
+			if !ok {
+				continue
+			}
+			if _, exists := object[name]; !exists {
+				v.addError(path, "missing required property %q", name)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		childPath := path + "." + key
+		if propertySchema, ok := properties[key]; ok {
+			v.validate(propertySchema, object[key], childPath, depth+1)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.addError(path, "unexpected property %q", key)
+			}
+		case map[string]any:
+			v.validate(additional, object[key], childPath, depth+1)
+		}
+	}
+
+	if minProperties, ok := number(schema["minProperties"]); ok && float64(len(object)) < minProperties {
+		v.addError(path, "expected at least %v properties", minProperties)
+	}
+	if maxProperties, ok := number(schema["maxProperties"]); ok && float64(len(object)) > maxProperties {
+		v.addError(path, "expected at most %v properties", maxProperties)
+	}
+}
+
+func (v *validator) validateArray(schema map[string]any, array []any, path string, depth int) {
+	prefixItems, _ := schema["prefixItems"].([]any)
+	for i, item := range array {
+		childPath := fmt.Sprintf("%s[%d]", path, i)
+		if i < len(prefixItems) {
+			v.validate(prefixItems[i], item, childPath, depth+1)
+			continue
+		}
+		if items, ok := schema["items"]; ok {
+			v.validate(items, item, childPath, depth+1)
+		}
+	}
+	if minItems, ok := number(schema["minItems"]); ok && float64(len(array)) < minItems {
+		v.addError(path, "expected at least %v items, got %d", minItems, len(array))
+	}
+	if maxItems, ok := number(schema["maxItems"]); ok && float64(len(array)) > maxItems {
+		v.addError(path, "expected at most %v items, got %d", maxItems, len(array))
+	}
+	if unique, ok := schema["uniqueItems"].(bool); ok && unique {
+		for i := 0; i < len(array); i++ {
+			for j := i + 1; j < len(array); j++ {
+				if jsonEqual(array[i], array[j]) {
+					v.addError(path, "items %d and %d are not unique", i, j)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validateString(schema map[string]any, s string, path string) {
+	length := float64(utf8.RuneCountInString(s))
+	if minLength, ok := number(schema["minLength"]); ok && length < minLength {
+		v.addError(path, "expected length >= %v", minLength)
+	}
+	if maxLength, ok := number(schema["maxLength"]); ok && length > maxLength {
+		v.addError(path, "expected length <= %v", maxLength)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err == nil && !re.MatchString(s) {
+			v.addError(path, "value does not match pattern %q", pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(schema map[string]any, n float64, path string) {
+	if minimum, ok := number(schema["minimum"]); ok && n < minimum {
+		v.addError(path, "expected >= %v", minimum)
+	}
+	if maximum, ok := number(schema["maximum"]); ok && n > maximum {
+		v.addError(path, "expected <= %v", maximum)
+	}
+	if exclusiveMinimum, ok := number(schema["exclusiveMinimum"]); ok && n <= exclusiveMinimum {
+		v.addError(path, "expected > %v", exclusiveMinimum)
+	}
+	if exclusiveMaximum, ok := number(schema["exclusiveMaximum"]); ok && n >= exclusiveMaximum {
+		v.addError(path, "expected < %v", exclusiveMaximum)
+	}
+	if multipleOf, ok := number(schema["multipleOf"]); ok && multipleOf > 0 {
+		quotient := n / multipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			v.addError(path, "expected a multiple of %v", multipleOf)
+		}
+	}
+}
+
+func (v *validator) resolveRef(ref string) (any, bool) {
+	if ref == "#" {
+		return v.root, v.root != nil
+	}
+	if !strings.HasPrefix(ref, "#/") || v.root == nil {
+		return nil, false
+	}
+	var current any = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = object[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func schemaTypes(raw any) ([]string, bool) {
+	switch t := raw.(type) {
+	case string:
+		return []string{t}, true
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types, len(types) > 0
+	}
+	return nil, false
+}
+
+func matchesType(schemaType string, value any) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	}
+	return true
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func number(raw any) (float64, bool) {
+	n, ok := raw.(float64)
+	return n, ok
+}
+
+func jsonEqual(a, b any) bool {
+	aJson, errA := json.Marshal(a)
+	bJson, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aJson) == string(bJson)
+}
@@ -0,0 +1,54 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mustSchema(t *testing.T, raw string) any {
+	t.Helper()
+	var schema any
+	require.NoError(t, json.Unmarshal([]byte(raw), &schema))
+	return schema
+}
+
+func TestValidateJSON(t *testing.T) {
+	schema := mustSchema(t, `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0},
+			"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "maxItems": 2},
+			"status": {"enum": ["active", "inactive"]},
+			"nickname": {"type": ["string", "null"]}
+		},
+		"required": ["name", "age"],
+		"additionalProperties": false,
+		"$defs": {"tag": {"type": "string"}}
+	}`)
+
+	require.Empty(t, ValidateJSON(schema, []byte(`{"name":"a","age":3,"tags":["x"],"status":"active","nickname":null}`)))
+
+	errors := ValidateJSON(schema, []byte(`{"name":"","age":1.5,"tags":["x",2,"z"],"status":"gone","extra":true}`))
+	require.ElementsMatch(t, []string{
+		"$.name: expected length >= 1",
+		"$.age: expected type integer, got number",
+		"$.tags[1]: expected type string, got number",
+		"$.tags: expected at most 2 items, got 3",
+		"$.status: value is not one of the allowed enum values",
+		`$: unexpected property "extra"`,
+	}, errors)
+
+	require.Equal(t, []string{`$: missing required property "age"`}, ValidateJSON(schema, []byte(`{"name":"a"}`)))
+	require.Len(t, ValidateJSON(schema, []byte(`{"name":`)), 1)
+}
+
+func TestValidateCombinators(t *testing.T) {
+	schema := mustSchema(t, `{"anyOf": [{"type": "string"}, {"type": "object", "required": ["id"]}]}`)
+
+	require.Empty(t, Validate(schema, "x"))
+	require.Empty(t, Validate(schema, map[string]any{"id": 1.0}))
+	require.Equal(t, []string{"$: value does not match any schema in anyOf"}, Validate(schema, 3.0))
+}
@@ -523,6 +523,9 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	if info.ChannelMeta != nil {
+		service.ObserveChannelRateLimit(info.ChannelId, info.ChannelMultiKeyIndex, info.ChannelIsMultiKey, info.ChannelSetting.Capacity, resp.Header)
+	}
 
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
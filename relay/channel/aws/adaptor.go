@@ -72,6 +72,7 @@ func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayIn
 			request.Messages[i] = message
 		}
 	}
+	claude.ApplyPromptCachePolicy(info, request)
 	return request, nil
 }
 
@@ -127,6 +128,7 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to convert openai request to claude request")
 	}
+	claude.ApplyPromptCachePolicy(info, claudeReq)
 	info.UpstreamModelName = claudeReq.Model
 	return claudeReq, err
 }
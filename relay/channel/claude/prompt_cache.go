@@ -0,0 +1,234 @@
+package claude
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+)
+
+// Anthropic 单个请求最多允许 4 个 cache_control 断点
+// https://docs.anthropic.com/en/docs/build-with-claude/prompt-caching
+const claudeMaxCacheBreakpoints = 4
+
+// 1h 缓存 TTL 最初以 beta 发布，携带该标记以兼容仍要求它的上游
+const claudeExtendedCacheTTLBeta = "extended-cache-ttl-2025-04-11"
+
+// resolvePromptCacheSettings 渠道配置优先（显式关闭也会覆盖分组配置），其次按使用分组取配置
+func resolvePromptCacheSettings(info *relaycommon.RelayInfo) *dto.ClaudePromptCacheSettings {
+	if info == nil {
+		return nil
+	}
+	if info.ChannelMeta != nil && info.ChannelOtherSettings.ClaudePromptCache != nil {
+		if !info.ChannelOtherSettings.ClaudePromptCache.Enabled {
+			return nil
+		}
+		return info.ChannelOtherSettings.ClaudePromptCache
+	}
+	return model_setting.GetClaudeSettings().GetPromptCacheSettings(info.UsingGroup)
+}
+
+// ApplyPromptCachePolicy 按渠道/分组策略自动为 Claude 请求注入 cache_control 断点。
+// 断点依次放在工具定义、system 提示词和最后 N 条消息上，且与客户端自带的断点合计不超过上限。
+// Anthropic 要求 1h 断点全部位于 5m 断点之前，注入时按客户端断点的位置降级或跳过。
+func ApplyPromptCachePolicy(info *relaycommon.RelayInfo, request *dto.ClaudeRequest) {
+	if info == nil || request == nil {
+		return
+	}
+	info.PromptCacheBreakpoints = 0
+	info.PromptCacheTTL = ""
+
+	settings := resolvePromptCacheSettings(info)
+	if settings == nil {
+		return
+	}
+
+	budget := claudeMaxCacheBreakpoints - countClaudeCacheBreakpoints(request)
+	if budget <= 0 {
+		return
+	}
+	ttl := settings.GetTTL()
+	firstShort, lastLong := locateClaudeCacheBreakpoints(request)
+
+	injected := 0
+	// inject 在第 segment 段（0 为工具定义，1 为 system，2 起为消息）注入断点
+	inject := func(segment int, content any) (any, bool) {
+		segmentTTL := ttl
+		if segmentTTL == dto.ClaudePromptCacheTTL1h && firstShort >= 0 && segment >= firstShort {
+			segmentTTL = dto.ClaudePromptCacheTTL5m
+		}
+		if segmentTTL == dto.ClaudePromptCacheTTL5m && segment < lastLong {
+			return content, false
+		}
+		content, ok := markLastBlockCacheControl(content, buildClaudeCacheControl(segmentTTL))
+		if ok {
+			if injected == 0 {
+				// 首个注入的断点 TTL 最长
+				info.PromptCacheTTL = segmentTTL
+			}
+			injected++
+		}
+		return content, ok
+	}
+	if settings.CacheTools && budget > injected {
+		request.Tools, _ = inject(0, request.Tools)
+	}
+	if settings.CacheSystem && budget > injected {
+		request.System, _ = inject(1, request.System)
+	}
+	for i, turns := len(request.Messages)-1, 0; i >= 0 && turns < settings.CacheLastTurns && budget > injected; i-- {
+		turns++
+		request.Messages[i].Content, _ = inject(2+i, request.Messages[i].Content)
+	}
+	info.PromptCacheBreakpoints = injected
+}
+
+// setPromptCacheBetaHeader 注入了 1h 断点时在 anthropic-beta 中追加扩展 TTL 标记
+func setPromptCacheBetaHeader(info *relaycommon.RelayInfo, req *http.Header) {
+	if info == nil || info.PromptCacheTTL != dto.ClaudePromptCacheTTL1h {
+		return
+	}
+	betas := req.Get("anthropic-beta")
+	for _, beta := range strings.Split(betas, ",") {
+		if strings.TrimSpace(beta) == claudeExtendedCacheTTLBeta {
+			return
+		}
+	}
+	if betas != "" {
+		betas += ","
+	}
+	req.Set("anthropic-beta", betas+claudeExtendedCacheTTLBeta)
+}
+
+func buildClaudeCacheControl(ttl string) json.RawMessage {
+	if ttl == dto.ClaudePromptCacheTTL1h {
+		return json.RawMessage(`{"type":"ephemeral","ttl":"1h"}`)
+	}
+	return json.RawMessage(`{"type":"ephemeral"}`)
+}
+
+// parseClaudeContentBlocks 将 system/tools/content 统一解析为原始 JSON 块，保留未知字段
+func parseClaudeContentBlocks(content any) ([]map[string]json.RawMessage, bool) {
+	if content == nil {
+		return nil, false
+	}
+	if _, ok := content.(string); ok {
+		return nil, false
+	}
+	blocks, err := common.Any2Type[[]map[string]json.RawMessage](content)
+	if err != nil {
+		return nil, false
+	}
+	return blocks, true
+}
+
+func countClaudeCacheBreakpoints(request *dto.ClaudeRequest) int {
+	count := 0
+	countBlocks := func(content any) {
+		blocks, ok := parseClaudeContentBlocks(content)
+		if !ok {
+			return
+		}
+		for _, block := range blocks {
+			if hasClaudeCacheControl(block) {
+				count++
+			}
+		}
+	}
+	countBlocks(request.Tools)
+	countBlocks(request.System)
+	for _, message := range request.Messages {
+		countBlocks(message.Content)
+	}
+	return count
+}
+
+func hasClaudeCacheControl(block map[string]json.RawMessage) bool {
+	cacheControl, ok := block["cache_control"]
+	return ok && len(cacheControl) > 0 && string(cacheControl) != "null"
+}
+
+// locateClaudeCacheBreakpoints 返回客户端第一个 5m 断点与最后一个 1h 断点所在的段，不存在时为 -1
+func locateClaudeCacheBreakpoints(request *dto.ClaudeRequest) (firstShort int, lastLong int) {
+	firstShort, lastLong = -1, -1
+	locate := func(segment int, content any) {
+		blocks, ok := parseClaudeContentBlocks(content)
+		if !ok {
+			return
+		}
+		for _, block := range blocks {
+			if !hasClaudeCacheControl(block) {
+				continue
+			}
+			var cacheControl struct {
+				TTL string `json:"ttl"`
+			}
+			_ = common.Unmarshal(block["cache_control"], &cacheControl)
+			if cacheControl.TTL == dto.ClaudePromptCacheTTL1h {
+				lastLong = segment
+			} else if firstShort < 0 {
+				firstShort = segment
+			}
+		}
+	}
+	locate(0, request.Tools)
+	locate(1, request.System)
+	for i, message := range request.Messages {
+		locate(2+i, message.Content)
+	}
+	return firstShort, lastLong
+}
+
+// markLastBlockCacheControl 在最后一个可缓存的块上设置 cache_control。
+// 字符串内容会被转换为单个 text 块；thinking 块与空 text 块不能携带 cache_control，会被跳过。
+func markLastBlockCacheControl(content any, cacheControl json.RawMessage) (any, bool) {
+	if text, ok := content.(string); ok {
+		if strings.TrimSpace(text) == "" {
+			return content, false
+		}
+		textJson, err := common.Marshal(text)
+		if err != nil {
+			return content, false
+		}
+		return []map[string]json.RawMessage{{
+			"type":          json.RawMessage(`"text"`),
+			"text":          textJson,
+			"cache_control": cacheControl,
+		}}, true
+	}
+
+	blocks, ok := parseClaudeContentBlocks(content)
+	if !ok {
+		return content, false
+	}
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block := blocks[i]
+		var blockType string
+		if rawType, exists := block["type"]; exists {
+			_ = common.Unmarshal(rawType, &blockType)
+		}
+		if blockType == "thinking" || blockType == "redacted_thinking" {
+			continue
+		}
+		if blockType == "text" {
+			var text string
+			if rawText, exists := block["text"]; exists {
+				_ = common.Unmarshal(rawText, &text)
+			}
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+		}
+		if hasClaudeCacheControl(block) {
+			// 末尾已有断点，无需重复注入
+			return content, false
+		}
+		block["cache_control"] = cacheControl
+		return blocks, true
+	}
+	return content, false
+}
@@ -0,0 +1,172 @@
+package claude
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+func newPromptCacheRelayInfo(settings *dto.ClaudePromptCacheSettings) *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelOtherSettings: dto.ChannelOtherSettings{ClaudePromptCache: settings},
+		},
+	}
+}
+
+func TestApplyPromptCachePolicy_InjectsBreakpoints(t *testing.T) {
+	info := newPromptCacheRelayInfo(&dto.ClaudePromptCacheSettings{
+		Enabled:        true,
+		TTL:            dto.ClaudePromptCacheTTL1h,
+		CacheSystem:    true,
+		CacheTools:     true,
+		CacheLastTurns: 1,
+	})
+	request := &dto.ClaudeRequest{
+		System: "you are a helpful assistant",
+		Tools:  []any{&dto.Tool{Name: "get_weather", InputSchema: map[string]any{"type": "object"}}},
+		Messages: []dto.ClaudeMessage{
+			{Role: "user", Content: "hello"},
+			{Role: "assistant", Content: "hi"},
+			{Role: "user", Content: []dto.ClaudeMediaMessage{{Type: "text", Text: common.GetPointer("weather?")}}},
+		},
+	}
+
+	ApplyPromptCachePolicy(info, request)
+
+	if info.PromptCacheBreakpoints != 3 {
+		t.Fatalf("PromptCacheBreakpoints = %d, want 3", info.PromptCacheBreakpoints)
+	}
+	if info.PromptCacheTTL != dto.ClaudePromptCacheTTL1h {
+		t.Fatalf("PromptCacheTTL = %s, want 1h", info.PromptCacheTTL)
+	}
+	body, err := common.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(body), `"cache_control":{"type":"ephemeral","ttl":"1h"}`); got != 3 {
+		t.Fatalf("cache_control count = %d, want 3, body: %s", got, body)
+	}
+	if !request.Messages[0].IsStringContent() {
+		t.Fatal("earlier turns should not be touched")
+	}
+}
+
+func TestApplyPromptCachePolicy_RespectsBreakpointLimit(t *testing.T) {
+	info := newPromptCacheRelayInfo(&dto.ClaudePromptCacheSettings{
+		Enabled:        true,
+		CacheSystem:    true,
+		CacheLastTurns: 4,
+	})
+	request := &dto.ClaudeRequest{}
+	common.Unmarshal([]byte(`{
+		"system": [{"type":"text","text":"sys","cache_control":{"type":"ephemeral"}}],
+		"messages": [
+			{"role":"user","content":[{"type":"text","text":"a","cache_control":{"type":"ephemeral"}}]},
+			{"role":"assistant","content":[{"type":"thinking","thinking":"t","signature":"s"},{"type":"text","text":"b"}]},
+			{"role":"user","content":"c"}
+		]
+	}`), request)
+
+	ApplyPromptCachePolicy(info, request)
+
+	if info.PromptCacheBreakpoints != 2 {
+		t.Fatalf("PromptCacheBreakpoints = %d, want 2", info.PromptCacheBreakpoints)
+	}
+	if got := countClaudeCacheBreakpoints(request); got != claudeMaxCacheBreakpoints {
+		t.Fatalf("total breakpoints = %d, want %d", got, claudeMaxCacheBreakpoints)
+	}
+	blocks, ok := parseClaudeContentBlocks(request.Messages[1].Content)
+	if !ok || len(blocks) != 2 {
+		t.Fatalf("unexpected assistant content: %v", request.Messages[1].Content)
+	}
+	if hasClaudeCacheControl(blocks[0]) || !hasClaudeCacheControl(blocks[1]) {
+		t.Fatal("breakpoint should skip thinking block and land on the text block")
+	}
+}
+
+func TestApplyPromptCachePolicy_ChannelDisabledOverridesGroup(t *testing.T) {
+	info := newPromptCacheRelayInfo(&dto.ClaudePromptCacheSettings{Enabled: false})
+	request := &dto.ClaudeRequest{System: "sys"}
+
+	ApplyPromptCachePolicy(info, request)
+
+	if info.PromptCacheBreakpoints != 0 {
+		t.Fatalf("PromptCacheBreakpoints = %d, want 0", info.PromptCacheBreakpoints)
+	}
+	if _, ok := request.System.(string); !ok {
+		t.Fatal("system should be left untouched")
+	}
+}
+
+func TestApplyPromptCachePolicy_KeepsLongTTLBeforeShortTTL(t *testing.T) {
+	info := newPromptCacheRelayInfo(&dto.ClaudePromptCacheSettings{
+		Enabled:        true,
+		TTL:            dto.ClaudePromptCacheTTL1h,
+		CacheTools:     true,
+		CacheSystem:    true,
+		CacheLastTurns: 1,
+	})
+	request := &dto.ClaudeRequest{}
+	common.Unmarshal([]byte(`{
+		"tools": [{"name":"get_weather","input_schema":{"type":"object"}}],
+		"system": [{"type":"text","text":"sys","cache_control":{"type":"ephemeral"}}],
+		"messages": [{"role":"user","content":"hello"}]
+	}`), request)
+
+	ApplyPromptCachePolicy(info, request)
+
+	// 客户端的 5m 断点位于 system，之后注入的断点降级为 5m
+	body, err := common.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(body), `"ttl":"1h"`); got != 1 {
+		t.Fatalf("1h breakpoints = %d, want 1, body: %s", got, body)
+	}
+	if info.PromptCacheBreakpoints != 2 || info.PromptCacheTTL != dto.ClaudePromptCacheTTL1h {
+		t.Fatalf("breakpoints = %d, ttl = %s, want 2 and 1h", info.PromptCacheBreakpoints, info.PromptCacheTTL)
+	}
+	blocks, _ := parseClaudeContentBlocks(request.Messages[0].Content)
+	if string(blocks[0]["cache_control"]) != `{"type":"ephemeral"}` {
+		t.Fatalf("last turn cache_control = %s, want 5m", blocks[0]["cache_control"])
+	}
+
+	header := http.Header{}
+	header.Set("anthropic-beta", "computer-use-2025-01-24")
+	setPromptCacheBetaHeader(info, &header)
+	setPromptCacheBetaHeader(info, &header)
+	if got := header.Get("anthropic-beta"); got != "computer-use-2025-01-24,"+claudeExtendedCacheTTLBeta {
+		t.Fatalf("anthropic-beta = %s", got)
+	}
+}
+
+func TestApplyPromptCachePolicy_SkipsShortTTLBeforeClientLongTTL(t *testing.T) {
+	info := newPromptCacheRelayInfo(&dto.ClaudePromptCacheSettings{
+		Enabled:     true,
+		CacheSystem: true,
+	})
+	request := &dto.ClaudeRequest{}
+	common.Unmarshal([]byte(`{
+		"system": "sys",
+		"messages": [{"role":"user","content":[{"type":"text","text":"a","cache_control":{"type":"ephemeral","ttl":"1h"}}]}]
+	}`), request)
+
+	ApplyPromptCachePolicy(info, request)
+
+	if info.PromptCacheBreakpoints != 0 {
+		t.Fatalf("PromptCacheBreakpoints = %d, want 0", info.PromptCacheBreakpoints)
+	}
+	if _, ok := request.System.(string); !ok {
+		t.Fatal("system should be left untouched")
+	}
+	header := http.Header{}
+	setPromptCacheBetaHeader(info, &header)
+	if header.Get("anthropic-beta") != "" {
+		t.Fatal("beta header should only be set for injected 1h breakpoints")
+	}
+}
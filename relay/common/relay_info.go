@@ -57,6 +57,14 @@ type ResponsesUsageInfo struct {
 	BuiltInTools map[string]*BuildInToolInfo
 }
 
+type StructuredOutputResult struct {
+	Attempts       int
+	Valid          bool
+	Mode           string
+	Errors         []string
+	StrictRejected bool
+}
+
 type ChannelMeta struct {
 	ChannelType          int
 	ChannelId            int
@@ -150,6 +158,16 @@ type RelayInfo struct {
 	RuntimeHeadersOverride                map[string]interface{}
 	UseRuntimeHeadersOverride             bool
 	ParamOverrideAudit                    []string
+	// PromptCacheBreakpoints / PromptCacheTTL record cache_control breakpoints injected by the gateway.
+	PromptCacheBreakpoints int
+	PromptCacheTTL         string
+	// StructuredOutput records gateway-side json_schema validation and repair attempts.
+	StructuredOutput *StructuredOutputResult
+	// RequestedModelName is the model requested by the client when a fallback model is served (OriginModelName).
+	RequestedModelName string
+	// VirtualModelName / VirtualModelRule record the virtual model resolved into OriginModelName and the matched rule.
+	VirtualModelName string
+	VirtualModelRule string
 
 	PriceData types.PriceData
 
@@ -452,7 +470,8 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		UserQuota:  common.GetContextKeyInt(c, constant.ContextKeyUserQuota),
 		UserEmail:  common.GetContextKeyString(c, constant.ContextKeyUserEmail),
 
-		OriginModelName: common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		OriginModelName:    common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		RequestedModelName: common.GetContextKeyString(c, constant.ContextKeyRequestedModel),
 
 		TokenId:        common.GetContextKeyInt(c, constant.ContextKeyTokenId),
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
@@ -106,6 +106,17 @@ func PingData(c *gin.Context) error {
 	return FlushWriter(c)
 }
 
+// ErrorEvent 事件流已开始后以 SSE error 事件返回错误
+func ErrorEvent(c *gin.Context, object interface{}) error {
+	jsonData, err := common.Marshal(object)
+	if err != nil {
+		return fmt.Errorf("error marshalling object: %w", err)
+	}
+	c.Render(-1, common.CustomEvent{Data: "event: error\n"})
+	c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonData)})
+	return FlushWriter(c)
+}
+
 func ObjectData(c *gin.Context, object interface{}) error {
 	if object == nil {
 		return errors.New("object is nil")
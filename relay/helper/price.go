@@ -2,9 +2,11 @@ package helper
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
@@ -45,10 +47,41 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 	return groupRatioInfo
 }
 
+// HandleGroupPricingRules 计算叠加在分组倍率之上的定价规则（月度用量档位、时段折扣、模型覆盖）。
+// 仅用于按量计费，按次计费的任务已有独立的 OtherRatios 调整流程。
+func HandleGroupPricingRules(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) (float64, []string) {
+	settings := ratio_setting.GetGroupPricingRuleSettings()
+	if !settings.Enabled {
+		return 1, nil
+	}
+	return settings.Evaluate(ratio_setting.GroupPricingInput{
+		Group: relayInfo.UsingGroup,
+		Model: relayInfo.OriginModelName,
+		Now:   time.Now(),
+		MonthlyQuota: func(monthStart time.Time) int {
+			quota, err := model.GetUserMonthlyConsumeQuota(relayInfo.UserId, monthStart.Unix())
+			if err != nil {
+				logger.LogError(ctx, fmt.Sprintf("failed to get monthly consume quota for user %d: %s", relayInfo.UserId, err.Error()))
+			}
+			return quota
+		},
+	})
+}
+
+func applyGroupPricingRules(priceData *types.PriceData, ratio float64, rules []string) {
+	if len(rules) == 0 {
+		return
+	}
+	priceData.AddOtherRatio(ratio_setting.GroupPricingRuleRatioKey, ratio)
+	priceData.GroupPricingRules = rules
+	priceData.QuotaToPreConsume = int(float64(priceData.QuotaToPreConsume) * ratio)
+}
+
 func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens int, meta *types.TokenCountMeta) (types.PriceData, error) {
 	modelPrice, usePrice := ratio_setting.GetModelPrice(info.OriginModelName, false)
 
 	groupRatioInfo := HandleGroupRatio(c, info)
+	ruleRatio, rules := HandleGroupPricingRules(c, info)
 
 	var preConsumedQuota int
 	var modelRatio float64
@@ -61,6 +94,7 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	var audioRatio float64
 	var audioCompletionRatio float64
 	var freeModel bool
+	var pricingTiers []types.PricingTier
 	if !usePrice {
 		preConsumedTokens := common.Max(promptTokens, common.PreConsumedQuota)
 		if meta.MaxTokens != 0 {
@@ -88,6 +122,11 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		audioRatio = ratio_setting.GetAudioRatio(info.OriginModelName)
 		audioCompletionRatio = ratio_setting.GetAudioCompletionRatio(info.OriginModelName)
 		ratio := modelRatio * groupRatioInfo.GroupRatio
+		// 预扣按估算的提示 tokens 选档，结算时再按实际用量重新选档
+		pricingTiers, _ = ratio_setting.GetModelPricingTiers(info.OriginModelName)
+		if tier := types.SelectPricingTier(pricingTiers, promptTokens); tier != nil {
+			ratio = tier.ModelRatio * groupRatioInfo.GroupRatio
+		}
 		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
 		if meta.ImagePriceRatio != 0 {
@@ -131,6 +170,10 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		CacheCreation1hRatio: cacheCreationRatio1h,
 		QuotaToPreConsume:    preConsumedQuota,
 	}
+	if len(pricingTiers) > 0 {
+		priceData.SetPricingTiers(pricingTiers, promptTokens)
+	}
+	applyGroupPricingRules(&priceData, ruleRatio, rules)
 
 	if common.DebugEnabled {
 		println(fmt.Sprintf("model_price_helper result: %s", priceData.ToSetting()))
@@ -0,0 +1,244 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResponseCapture 临时替换 gin 的 ResponseWriter，缓存 adaptor 写给下游的内容，
+// 供网关在返回客户端之前对完整响应做二次处理（如工具调用模拟、结构化输出校验）。
+type ResponseCapture struct {
+	gin.ResponseWriter
+	c      *gin.Context
+	origin gin.ResponseWriter
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func CaptureResponse(c *gin.Context) *ResponseCapture {
+	capture := &ResponseCapture{
+		ResponseWriter: c.Writer,
+		c:              c,
+		origin:         c.Writer,
+		header:         make(http.Header),
+		status:         http.StatusOK,
+	}
+	c.Writer = capture
+	return capture
+}
+
+// Release 恢复原始 ResponseWriter
+func (w *ResponseCapture) Release() {
+	w.c.Writer = w.origin
+	// adaptor 在缓存期间设置的 SSE 头部不会落到真实连接上，清除标记以便后续重新设置
+	if w.c.Keys != nil {
+		delete(w.c.Keys, "event_stream_headers_set")
+	}
+}
+
+func (w *ResponseCapture) Header() http.Header {
+	return w.header
+}
+
+func (w *ResponseCapture) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *ResponseCapture) WriteHeaderNow() {}
+
+func (w *ResponseCapture) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *ResponseCapture) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *ResponseCapture) Status() int {
+	return w.status
+}
+
+func (w *ResponseCapture) Size() int {
+	return w.body.Len()
+}
+
+func (w *ResponseCapture) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (w *ResponseCapture) Flush() {}
+
+func (w *ResponseCapture) Body() []byte {
+	return w.body.Bytes()
+}
+
+// WriteThrough 将缓存的响应原样写回客户端
+func (w *ResponseCapture) WriteThrough() {
+	for key, values := range w.header {
+		for _, value := range values {
+			w.origin.Header().Add(key, value)
+		}
+	}
+	w.origin.WriteHeader(w.status)
+	_, _ = w.origin.Write(w.body.Bytes())
+}
+
+// ParseCapturedChatCompletion 将缓存的 chat completion 响应（JSON 或 SSE）还原为单个非流式响应。
+// 仅处理 index 为 0 的 choice。
+func ParseCapturedChatCompletion(body []byte) (*dto.OpenAITextResponse, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, false
+	}
+	if trimmed[0] == '{' {
+		var response dto.OpenAITextResponse
+		if err := common.Unmarshal(trimmed, &response); err != nil {
+			return nil, false
+		}
+		if response.Error != nil || len(response.Choices) == 0 {
+			return nil, false
+		}
+		return &response, true
+	}
+
+	response := &dto.OpenAITextResponse{
+		Object: "chat.completion",
+	}
+	var content, reasoning strings.Builder
+	finishReason := ""
+	chunks := 0
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := common.UnmarshalJsonStr(data, &chunk); err != nil {
+			return nil, false
+		}
+		chunks++
+		if response.Id == "" {
+			response.Id = chunk.Id
+			response.Model = chunk.Model
+			response.Created = chunk.Created
+		}
+		if chunk.Usage != nil {
+			response.Usage = *chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			content.WriteString(choice.Delta.GetContentString())
+			reasoning.WriteString(choice.Delta.GetReasoningContent())
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+	if scanner.Err() != nil || chunks == 0 {
+		return nil, false
+	}
+	message := dto.Message{
+		Role:             "assistant",
+		ReasoningContent: reasoning.String(),
+	}
+	message.SetStringContent(content.String())
+	response.Choices = []dto.OpenAITextResponseChoice{{
+		Index:        0,
+		Message:      message,
+		FinishReason: finishReason,
+	}}
+	return response, true
+}
+
+// WriteChatCompletion 将非流式 chat completion 响应写回客户端；stream 为 true 时按 SSE chunk 输出。
+func WriteChatCompletion(c *gin.Context, response *dto.OpenAITextResponse, stream bool, includeUsage bool) error {
+	if !stream {
+		jsonData, err := common.Marshal(response)
+		if err != nil {
+			return err
+		}
+		c.Writer.Header().Set("Content-Type", "application/json")
+		c.Writer.WriteHeader(http.StatusOK)
+		_, err = c.Writer.Write(jsonData)
+		return err
+	}
+
+	SetEventStreamHeaders(c)
+	created := common.GetTimestamp()
+	id := response.Id
+	if id == "" {
+		id = GetResponseID(c)
+	}
+	for _, choice := range response.Choices {
+		start := GenerateStartEmptyResponse(id, created, response.Model, nil)
+		start.Choices[0].Index = choice.Index
+		if choice.ReasoningContent != "" {
+			start.Choices[0].Delta.SetReasoningContent(choice.ReasoningContent)
+		}
+		if err := ObjectData(c, start); err != nil {
+			return err
+		}
+		if text := choice.StringContent(); text != "" {
+			chunk := GenerateStartEmptyResponse(id, created, response.Model, nil)
+			chunk.Choices[0].Index = choice.Index
+			chunk.Choices[0].Delta.Role = ""
+			chunk.Choices[0].Delta.SetContentString(text)
+			if err := ObjectData(c, chunk); err != nil {
+				return err
+			}
+		}
+		for i, toolCall := range parseToolCallResponses(choice.Message) {
+			toolCall.SetIndex(i)
+			chunk := GenerateStartEmptyResponse(id, created, response.Model, nil)
+			chunk.Choices[0].Index = choice.Index
+			chunk.Choices[0].Delta.Role = ""
+			chunk.Choices[0].Delta.Content = nil
+			chunk.Choices[0].Delta.ToolCalls = []dto.ToolCallResponse{toolCall}
+			if err := ObjectData(c, chunk); err != nil {
+				return err
+			}
+		}
+		stop := GenerateStopResponse(id, created, response.Model, choice.FinishReason)
+		stop.Choices[0].Index = choice.Index
+		if err := ObjectData(c, stop); err != nil {
+			return err
+		}
+	}
+	if includeUsage {
+		usageChunk := GenerateFinalUsageResponse(id, created, response.Model, response.Usage)
+		if err := ObjectData(c, usageChunk); err != nil {
+			return err
+		}
+	}
+	Done(c)
+	return nil
+}
+
+func parseToolCallResponses(message dto.Message) []dto.ToolCallResponse {
+	if len(message.ToolCalls) == 0 {
+		return nil
+	}
+	var toolCalls []dto.ToolCallResponse
+	if err := common.Unmarshal(message.ToolCalls, &toolCalls); err != nil {
+		return nil
+	}
+	return toolCalls
+}
@@ -0,0 +1,76 @@
+package relay
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validateStructuredOutput 校验第一个 choice 的内容，失败时先做确定性修复，
+// reprompt 模式下再携带校验错误重新请求，最多 maxRepairAttempts 次。
+func (e *toolEmulation) validateStructuredOutput(c *gin.Context, info *relaycommon.RelayInfo, response *dto.OpenAITextResponse,
+	totalUsage *dto.Usage, resend func(request *dto.GeneralOpenAIRequest) (any, *types.NewAPIError)) *dto.OpenAITextResponse {
+	result := &relaycommon.StructuredOutputResult{
+		Attempts: 1,
+		Mode:     e.repairMode,
+	}
+	info.StructuredOutput = result
+
+	content := response.Choices[0].Message.StringContent()
+	errors := e.validateWithFixup(response, &content)
+	if len(errors) > 0 && e.repairMode == model_setting.StructuredOutputRepairModeReprompt {
+		for i := 0; i < e.maxRepairAttempts && len(errors) > 0; i++ {
+			repairRequest, err := service.BuildStructuredOutputRepairRequest(e.baseRequest, content, errors)
+			if err != nil {
+				break
+			}
+			_, repaired, usage, newAPIError := e.capture(c, func() (any, *types.NewAPIError) {
+				return resend(repairRequest)
+			})
+			if textUsage, ok := usage.(*dto.Usage); ok {
+				service.AddUsage(totalUsage, textUsage)
+			}
+			result.Attempts++
+			if newAPIError != nil {
+				logger.LogWarn(c, fmt.Sprintf("structured output repair attempt %d failed: %s", i+1, newAPIError.Error()))
+				break
+			}
+			if repaired == nil || len(repaired.Choices[0].ParseToolCalls()) > 0 {
+				break
+			}
+			response = repaired
+			content = response.Choices[0].Message.StringContent()
+			errors = e.validateWithFixup(response, &content)
+		}
+	}
+
+	result.Valid = len(errors) == 0
+	result.Errors = errors
+	result.StrictRejected = !result.Valid && e.strictMode
+	return response
+}
+
+// validateWithFixup 校验内容，不合法时尝试确定性修复，修复成功则回写到响应中
+func (e *toolEmulation) validateWithFixup(response *dto.OpenAITextResponse, content *string) []string {
+	errors := service.ValidateStructuredOutput(e.schema, *content)
+	if len(errors) == 0 {
+		return nil
+	}
+	fixed, ok := service.FixupStructuredOutput(*content)
+	if !ok {
+		return errors
+	}
+	if fixedErrors := service.ValidateStructuredOutput(e.schema, fixed); len(fixedErrors) < len(errors) {
+		*content = fixed
+		response.Choices[0].Message.SetStringContent(fixed)
+		return fixedErrors
+	}
+	return errors
+}
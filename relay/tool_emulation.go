@@ -0,0 +1,134 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+// toolEmulation 记录工具调用模拟所需的请求期状态，结构化输出校验同样需要缓存完整响应，共用该流程
+type toolEmulation struct {
+	clientStream bool
+	// toolNames 非空表示开启了工具调用模拟
+	toolNames map[string]struct{}
+	// schema 非空表示需要校验 response_format: json_schema
+	schema            any
+	repairMode        string
+	maxRepairAttempts int
+	strictMode        bool
+	// baseRequest 修复请求基于的原始请求快照
+	baseRequest *dto.GeneralOpenAIRequest
+}
+
+// prepareToolEmulation 渠道开启 emulate_tools 且请求携带 tools，或开启了结构化输出校验且请求指定了 json_schema 时，
+// 改写请求并强制上游非流式，响应由网关缓存后再按客户端原始的流式设置输出。
+func prepareToolEmulation(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) *toolEmulation {
+	if info == nil || request == nil || info.RelayMode != relayconstant.RelayModeChatCompletions {
+		return nil
+	}
+	emulation := &toolEmulation{
+		clientStream: info.IsStream,
+	}
+	if info.ChannelSetting.EmulateTools && len(request.Tools) > 0 {
+		emulation.toolNames = service.ApplyToolEmulation(request)
+		// 重试时复用同一个 RelayInfo，转换链只记录一次
+		if !lo.Contains(info.RequestConversionChain, types.RelayFormatOpenAIEmulatedTools) {
+			info.AppendRequestConversion(types.RelayFormatOpenAIEmulatedTools)
+		}
+	}
+	if settings := model_setting.GetStructuredOutputSettings(); settings.IsChannelEnabled(info.ChannelType) {
+		if schema, ok := service.GetResponseFormatSchema(request); ok {
+			if baseRequest, err := common.DeepCopy(request); err == nil {
+				emulation.schema = schema
+				emulation.repairMode = settings.RepairMode
+				emulation.maxRepairAttempts = settings.GetMaxRepairAttempts()
+				emulation.strictMode = settings.StrictMode
+				emulation.baseRequest = baseRequest
+				emulation.baseRequest.Stream = nil
+				emulation.baseRequest.StreamOptions = nil
+			}
+		}
+	}
+	if emulation.toolNames == nil && emulation.schema == nil {
+		return nil
+	}
+	request.Stream = nil
+	request.StreamOptions = nil
+	info.IsStream = false
+	return emulation
+}
+
+// restore 恢复客户端的流式设置，避免影响重试
+func (e *toolEmulation) restore(info *relaycommon.RelayInfo) {
+	if e == nil || info == nil {
+		return
+	}
+	info.IsStream = e.clientStream
+}
+
+// capture 缓存一次 adaptor 输出并解析为 chat completion，模拟格式的调用还原为 tool_calls
+func (e *toolEmulation) capture(c *gin.Context, do func() (any, *types.NewAPIError)) (*helper.ResponseCapture, *dto.OpenAITextResponse, any, *types.NewAPIError) {
+	capture := helper.CaptureResponse(c)
+	usage, newAPIError := do()
+	capture.Release()
+	if newAPIError != nil {
+		return capture, nil, usage, newAPIError
+	}
+	response, ok := helper.ParseCapturedChatCompletion(capture.Body())
+	if !ok {
+		return capture, nil, usage, nil
+	}
+	if e.toolNames != nil {
+		service.ApplyEmulatedToolCalls(response, e.toolNames)
+	}
+	return capture, response, usage, nil
+}
+
+// doResponse 缓存 adaptor 输出，完成工具调用还原与结构化输出校验后写回客户端。
+// resend 用于结构化输出的重新请求，返回的 usage 已合并所有修复请求。
+func (e *toolEmulation) doResponse(c *gin.Context, info *relaycommon.RelayInfo, do func() (any, *types.NewAPIError),
+	resend func(request *dto.GeneralOpenAIRequest) (any, *types.NewAPIError)) (any, *types.NewAPIError) {
+	defer e.restore(info)
+	capture, response, usage, newAPIError := e.capture(c, do)
+	if newAPIError != nil {
+		return usage, newAPIError
+	}
+	if response == nil {
+		capture.WriteThrough()
+		return usage, nil
+	}
+	totalUsage := &dto.Usage{}
+	if textUsage, ok := usage.(*dto.Usage); ok && textUsage != nil {
+		*totalUsage = *textUsage
+	}
+
+	if e.schema != nil && len(response.Choices[0].ParseToolCalls()) == 0 {
+		response = e.validateStructuredOutput(c, info, response, totalUsage, resend)
+		if result := info.StructuredOutput; result != nil && result.StrictRejected {
+			// 原始请求与修复请求均已产生上游消耗，先按实际用量结算并记录尝试次数，再向客户端返回错误；
+			// 结算后预扣费不会再被退还
+			service.PostTextConsumeQuota(c, info, totalUsage, nil)
+			return nil, types.NewOpenAIError(
+				fmt.Errorf("structured output does not conform to the requested json_schema after %d attempts: %v", result.Attempts, result.Errors),
+				types.ErrorCodeStructuredOutputInvalid, http.StatusUnprocessableEntity, types.ErrOptionWithSkipRetry())
+		}
+	}
+
+	response.Usage = *totalUsage
+	if err := helper.WriteChatCompletion(c, response, e.clientStream, info.ShouldIncludeUsage); err != nil {
+		logger.LogError(c, fmt.Sprintf("write emulated tool calls response failed: %s", err.Error()))
+	}
+	return totalUsage, nil
+}
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/controller"
 	"github.com/QuantumNous/new-api/middleware"
 
@@ -17,13 +18,14 @@ func SetApiRouter(router *gin.Engine) {
 	apiRouter.Use(gzip.Gzip(gzip.DefaultCompression))
 	apiRouter.Use(middleware.BodyStorageCleanup()) // 清理请求体存储
 	apiRouter.Use(middleware.GlobalAPIRateLimit())
+	apiRouter.Use(middleware.AuditManagement())
 	{
 		apiRouter.GET("/setup", controller.GetSetup)
 		apiRouter.POST("/setup", controller.PostSetup)
 		apiRouter.GET("/status", controller.GetStatus)
 		apiRouter.GET("/uptime/status", controller.GetUptimeKumaStatus)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
-		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
+		apiRouter.GET("/status/test", middleware.PermissionAuth(constant.PermissionStatsRead), controller.TestStatus)
 		apiRouter.GET("/notice", controller.GetNotice)
 		apiRouter.GET("/user-agreement", controller.GetUserAgreement)
 		apiRouter.GET("/privacy-policy", controller.GetPrivacyPolicy)
@@ -58,6 +60,7 @@ func SetApiRouter(router *gin.Engine) {
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Login)
 			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.Verify2FALogin)
+			userRoute.POST("/login/ldap", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.LDAPLogin)
 			userRoute.POST("/passkey/login/begin", middleware.CriticalRateLimit(), controller.PasskeyLoginBegin)
 			userRoute.POST("/passkey/login/finish", middleware.CriticalRateLimit(), controller.PasskeyLoginFinish)
 			//userRoute.POST("/tokenlog", middleware.CriticalRateLimit(), controller.TokenLog)
@@ -84,7 +87,7 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.GET("/topup/info", controller.GetTopUpInfo)
 				selfRoute.GET("/topup/self", controller.GetUserTopUps)
-				selfRoute.POST("/topup", middleware.CriticalRateLimit(), controller.TopUp)
+				selfRoute.POST("/topup", middleware.CriticalRateLimit(), middleware.RedeemRateLimit(), controller.TopUp)
 				selfRoute.POST("/pay", middleware.CriticalRateLimit(), controller.RequestEpay)
 				selfRoute.POST("/amount", controller.RequestAmount)
 				selfRoute.POST("/stripe/pay", middleware.CriticalRateLimit(), controller.RequestStripePay)
@@ -92,6 +95,7 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.RequestCreemPay)
 				selfRoute.POST("/waffo/pay", middleware.CriticalRateLimit(), controller.RequestWaffoPay)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
+				selfRoute.GET("/self/credits", controller.GetSelfCreditBreakdown)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
 
 				// 2FA routes
@@ -111,25 +115,29 @@ func SetApiRouter(router *gin.Engine) {
 			}
 
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
+			adminRoute.Use(middleware.PermissionAuth(constant.PermissionUserRead, constant.PermissionUserWrite, constant.PermissionUserQuotaAdjust, constant.PermissionPaymentManage))
 			{
-				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/topup", controller.GetAllTopUps)
-				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
-				adminRoute.GET("/search", controller.SearchUsers)
-				adminRoute.GET("/:id/oauth/bindings", controller.GetUserOAuthBindingsByAdmin)
-				adminRoute.DELETE("/:id/oauth/bindings/:provider_id", controller.UnbindCustomOAuthByAdmin)
-				adminRoute.DELETE("/:id/bindings/:binding_type", controller.AdminClearUserBinding)
-				adminRoute.GET("/:id", controller.GetUser)
-				adminRoute.POST("/", controller.CreateUser)
-				adminRoute.POST("/manage", controller.ManageUser)
-				adminRoute.PUT("/", controller.UpdateUser)
-				adminRoute.DELETE("/:id", controller.DeleteUser)
-				adminRoute.DELETE("/:id/reset_passkey", controller.AdminResetPasskey)
+				adminRoute.GET("/", middleware.RequirePermission(constant.PermissionUserRead), controller.GetAllUsers)
+				adminRoute.GET("/topup", middleware.RequirePermission(constant.PermissionPaymentManage), controller.GetAllTopUps)
+				adminRoute.POST("/topup/complete", middleware.RequirePermission(constant.PermissionPaymentManage), controller.AdminCompleteTopUp)
+				adminRoute.GET("/search", middleware.RequirePermission(constant.PermissionUserRead), controller.SearchUsers)
+				adminRoute.GET("/:id/oauth/bindings", middleware.RequirePermission(constant.PermissionUserRead), controller.GetUserOAuthBindingsByAdmin)
+				adminRoute.DELETE("/:id/oauth/bindings/:provider_id", middleware.RequirePermission(constant.PermissionUserWrite), controller.UnbindCustomOAuthByAdmin)
+				adminRoute.DELETE("/:id/bindings/:binding_type", middleware.RequirePermission(constant.PermissionUserWrite), controller.AdminClearUserBinding)
+				adminRoute.GET("/:id/credits", middleware.RequirePermission(constant.PermissionUserRead), controller.GetUserCreditBreakdown)
+				adminRoute.GET("/:id/roles", middleware.RequirePermission(constant.PermissionUserRead), controller.GetUserRoles)
+				adminRoute.PUT("/:id/roles", middleware.RequirePermission(constant.PermissionRoleManage), controller.SetUserRoles)
+				adminRoute.GET("/:id", middleware.RequirePermission(constant.PermissionUserRead, constant.PermissionUserQuotaAdjust), controller.GetUser)
+				adminRoute.POST("/", middleware.RequirePermission(constant.PermissionUserWrite), controller.CreateUser)
+				adminRoute.POST("/manage", middleware.RequirePermission(constant.PermissionUserWrite), controller.ManageUser)
+				// 仅有额度调整权限时只能修改额度
+				adminRoute.PUT("/", middleware.RequirePermission(constant.PermissionUserWrite, constant.PermissionUserQuotaAdjust), controller.UpdateUser)
+				adminRoute.DELETE("/:id", middleware.RequirePermission(constant.PermissionUserWrite), controller.DeleteUser)
+				adminRoute.DELETE("/:id/reset_passkey", middleware.RequirePermission(constant.PermissionUserWrite), controller.AdminResetPasskey)
 
 				// Admin 2FA routes
-				adminRoute.GET("/2fa/stats", controller.Admin2FAStats)
-				adminRoute.DELETE("/:id/2fa", controller.AdminDisable2FA)
+				adminRoute.GET("/2fa/stats", middleware.RequirePermission(constant.PermissionUserRead), controller.Admin2FAStats)
+				adminRoute.DELETE("/:id/2fa", middleware.RequirePermission(constant.PermissionUserWrite), controller.AdminDisable2FA)
 			}
 		}
 
@@ -145,7 +153,7 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestCreemPay)
 		}
 		subscriptionAdminRoute := apiRouter.Group("/subscription/admin")
-		subscriptionAdminRoute.Use(middleware.AdminAuth())
+		subscriptionAdminRoute.Use(middleware.PermissionAuth(constant.PermissionPaymentManage))
 		{
 			subscriptionAdminRoute.GET("/plans", controller.AdminListSubscriptionPlans)
 			subscriptionAdminRoute.POST("/plans", controller.AdminCreateSubscriptionPlan)
@@ -160,25 +168,73 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionAdminRoute.DELETE("/user_subscriptions/:id", controller.AdminDeleteUserSubscription)
 		}
 
+		invoiceRoute := apiRouter.Group("/invoice")
+		invoiceRoute.Use(middleware.UserAuth())
+		{
+			invoiceRoute.GET("/self", controller.GetSelfInvoices)
+			invoiceRoute.GET("/self/statement", controller.GetSelfStatement)
+			invoiceRoute.GET("/self/:id/download", controller.DownloadSelfInvoice)
+			invoiceRoute.POST("/self/issue", controller.IssueSelfInvoice)
+		}
+		invoiceAdminRoute := apiRouter.Group("/invoice/admin")
+		invoiceAdminRoute.Use(middleware.PermissionAuth(constant.PermissionPaymentManage))
+		{
+			invoiceAdminRoute.GET("/", controller.AdminListInvoices)
+			invoiceAdminRoute.GET("/statement", controller.AdminGetStatement)
+			invoiceAdminRoute.POST("/statement/send", controller.AdminSendStatement)
+			invoiceAdminRoute.POST("/issue", controller.AdminIssueInvoice)
+			invoiceAdminRoute.GET("/:id/download", controller.AdminDownloadInvoice)
+			invoiceAdminRoute.POST("/:id/regenerate", controller.AdminRegenerateInvoice)
+			invoiceAdminRoute.POST("/:id/void", controller.AdminVoidInvoice)
+		}
+
+		paymentReversalRoute := apiRouter.Group("/payment/reversal")
+		paymentReversalRoute.Use(middleware.PermissionAuth(constant.PermissionPaymentManage))
+		{
+			paymentReversalRoute.GET("/", controller.GetPaymentEvents)
+			paymentReversalRoute.POST("/", controller.AdminApplyPaymentReversal)
+		}
+
+		spendAnomalyRoute := apiRouter.Group("/spend_anomaly")
+		spendAnomalyRoute.Use(middleware.UserAuth())
+		{
+			spendAnomalyRoute.GET("/self", controller.GetSelfSpendAnomalies)
+			spendAnomalyRoute.POST("/self/:id/confirm", controller.ConfirmSpendAnomaly)
+		}
+		spendAnomalyAdminRoute := apiRouter.Group("/spend_anomaly")
+		spendAnomalyAdminRoute.Use(middleware.PermissionAuth(constant.PermissionUserRead))
+		{
+			spendAnomalyAdminRoute.GET("/", controller.GetSpendAnomalies)
+			spendAnomalyAdminRoute.POST("/:id/review", middleware.RequirePermission(constant.PermissionUserWrite), controller.ReviewSpendAnomaly)
+		}
+		apiRouter.GET("/audit_log/", middleware.PermissionAuth(constant.PermissionAuditRead), controller.GetAuditLogs)
+		configBundleRoute := apiRouter.Group("/config")
+		configBundleRoute.Use(middleware.PermissionAuth(constant.PermissionConfigManage))
+		{
+			configBundleRoute.POST("/export", controller.ExportConfigBundle)
+			configBundleRoute.POST("/import", controller.ImportConfigBundle)
+		}
+		apiRouter.GET("/admission_queue/stats", middleware.PermissionAuth(constant.PermissionStatsRead), controller.GetAdmissionQueueStats)
+
 		// Subscription payment callbacks (no auth)
 		apiRouter.POST("/subscription/epay/notify", controller.SubscriptionEpayNotify)
 		apiRouter.GET("/subscription/epay/notify", controller.SubscriptionEpayNotify)
 		apiRouter.GET("/subscription/epay/return", controller.SubscriptionEpayReturn)
 		apiRouter.POST("/subscription/epay/return", controller.SubscriptionEpayReturn)
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
+		optionRoute.Use(middleware.PermissionAuth(constant.PermissionOptionRead, constant.PermissionOptionWrite))
 		{
-			optionRoute.GET("/", controller.GetOptions)
-			optionRoute.PUT("/", controller.UpdateOption)
-			optionRoute.GET("/channel_affinity_cache", controller.GetChannelAffinityCacheStats)
-			optionRoute.DELETE("/channel_affinity_cache", controller.ClearChannelAffinityCache)
-			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
-			optionRoute.POST("/migrate_console_setting", controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
+			optionRoute.GET("/", middleware.RequirePermission(constant.PermissionOptionRead), controller.GetOptions)
+			optionRoute.PUT("/", middleware.RequirePermission(constant.PermissionOptionWrite), controller.UpdateOption)
+			optionRoute.GET("/channel_affinity_cache", middleware.RequirePermission(constant.PermissionOptionRead), controller.GetChannelAffinityCacheStats)
+			optionRoute.DELETE("/channel_affinity_cache", middleware.RequirePermission(constant.PermissionOptionWrite), controller.ClearChannelAffinityCache)
+			optionRoute.POST("/rest_model_ratio", middleware.RequirePermission(constant.PermissionOptionWrite), controller.ResetModelRatio)
+			optionRoute.POST("/migrate_console_setting", middleware.RequirePermission(constant.PermissionOptionWrite), controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
 		}
 
-		// Custom OAuth provider management (root only)
+		// Custom OAuth provider management
 		customOAuthRoute := apiRouter.Group("/custom-oauth-provider")
-		customOAuthRoute.Use(middleware.RootAuth())
+		customOAuthRoute.Use(middleware.PermissionAuth(constant.PermissionSystemManage))
 		{
 			customOAuthRoute.POST("/discovery", controller.FetchCustomOAuthDiscovery)
 			customOAuthRoute.GET("/", controller.GetCustomOAuthProviders)
@@ -188,7 +244,7 @@ func SetApiRouter(router *gin.Engine) {
 			customOAuthRoute.DELETE("/:id", controller.DeleteCustomOAuthProvider)
 		}
 		performanceRoute := apiRouter.Group("/performance")
-		performanceRoute.Use(middleware.RootAuth())
+		performanceRoute.Use(middleware.PermissionAuth(constant.PermissionSystemManage))
 		{
 			performanceRoute.GET("/stats", controller.GetPerformanceStats)
 			performanceRoute.DELETE("/disk_cache", controller.ClearDiskCache)
@@ -196,55 +252,73 @@ func SetApiRouter(router *gin.Engine) {
 			performanceRoute.POST("/gc", controller.ForceGC)
 			performanceRoute.GET("/logs", controller.GetLogFiles)
 			performanceRoute.DELETE("/logs", controller.CleanupLogFiles)
+			performanceRoute.GET("/invalidation", controller.GetInvalidationStatus)
+		}
+		secretEncryptionRoute := apiRouter.Group("/secret_encryption")
+		secretEncryptionRoute.Use(middleware.PermissionAuth(constant.PermissionSystemManage))
+		{
+			secretEncryptionRoute.GET("/", controller.GetSecretEncryptionStatus)
+			secretEncryptionRoute.POST("/rotate", controller.StartSecretRotation)
 		}
 		ratioSyncRoute := apiRouter.Group("/ratio_sync")
-		ratioSyncRoute.Use(middleware.RootAuth())
+		ratioSyncRoute.Use(middleware.PermissionAuth(constant.PermissionOptionWrite))
 		{
 			ratioSyncRoute.GET("/channels", controller.GetSyncableChannels)
 			ratioSyncRoute.POST("/fetch", controller.FetchUpstreamRatios)
 		}
+		roleRoute := apiRouter.Group("/role")
+		roleRoute.Use(middleware.PermissionAuth(constant.PermissionRoleManage))
+		{
+			roleRoute.GET("/permissions", controller.GetPermissionCatalog)
+			roleRoute.GET("/", controller.GetRoles)
+			roleRoute.GET("/:id", controller.GetRole)
+			roleRoute.POST("/", controller.CreateRole)
+			roleRoute.PUT("/", controller.UpdateRole)
+			roleRoute.DELETE("/:id", controller.DeleteRole)
+		}
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
+		channelRoute.Use(middleware.PermissionAuth(constant.PermissionChannelRead))
 		{
 			channelRoute.GET("/", controller.GetAllChannels)
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ChannelListModels)
 			channelRoute.GET("/models_enabled", controller.EnabledListModels)
 			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
-			channelRoute.GET("/test", controller.TestAllChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.POST("/tag/disabled", controller.DisableTagChannels)
-			channelRoute.POST("/tag/enabled", controller.EnableTagChannels)
-			channelRoute.PUT("/tag", controller.EditTagChannels)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
-			channelRoute.POST("/batch", controller.DeleteChannelBatch)
-			channelRoute.POST("/fix", controller.FixChannelsAbilities)
-			channelRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
-			channelRoute.POST("/fetch_models", controller.FetchModels)
-			channelRoute.POST("/codex/oauth/start", controller.StartCodexOAuth)
-			channelRoute.POST("/codex/oauth/complete", controller.CompleteCodexOAuth)
-			channelRoute.POST("/:id/codex/oauth/start", controller.StartCodexOAuthForChannel)
-			channelRoute.POST("/:id/codex/oauth/complete", controller.CompleteCodexOAuthForChannel)
-			channelRoute.POST("/:id/codex/refresh", controller.RefreshCodexChannelCredential)
+			channelRoute.GET("/:id/capacity", controller.GetChannelCapacity)
+			channelRoute.POST("/:id/key", middleware.RequirePermission(constant.PermissionChannelKeyView), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
+			channelRoute.GET("/test", middleware.RequirePermission(constant.PermissionChannelWrite), controller.TestAllChannels)
+			channelRoute.GET("/test/:id", middleware.RequirePermission(constant.PermissionChannelWrite), controller.TestChannel)
+			channelRoute.GET("/update_balance", middleware.RequirePermission(constant.PermissionChannelWrite), controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/:id", middleware.RequirePermission(constant.PermissionChannelWrite), controller.UpdateChannelBalance)
+			channelRoute.POST("/", middleware.RequirePermission(constant.PermissionChannelWrite), controller.AddChannel)
+			channelRoute.PUT("/", middleware.RequirePermission(constant.PermissionChannelWrite), controller.UpdateChannel)
+			channelRoute.DELETE("/disabled", middleware.RequirePermission(constant.PermissionChannelWrite), controller.DeleteDisabledChannel)
+			channelRoute.POST("/tag/disabled", middleware.RequirePermission(constant.PermissionChannelWrite), controller.DisableTagChannels)
+			channelRoute.POST("/tag/enabled", middleware.RequirePermission(constant.PermissionChannelWrite), controller.EnableTagChannels)
+			channelRoute.PUT("/tag", middleware.RequirePermission(constant.PermissionChannelWrite), controller.EditTagChannels)
+			channelRoute.DELETE("/:id", middleware.RequirePermission(constant.PermissionChannelWrite), controller.DeleteChannel)
+			channelRoute.POST("/batch", middleware.RequirePermission(constant.PermissionChannelWrite), controller.DeleteChannelBatch)
+			channelRoute.POST("/fix", middleware.RequirePermission(constant.PermissionChannelWrite), controller.FixChannelsAbilities)
+			channelRoute.GET("/fetch_models/:id", middleware.RequirePermission(constant.PermissionChannelWrite), controller.FetchUpstreamModels)
+			channelRoute.POST("/fetch_models", middleware.RequirePermission(constant.PermissionChannelWrite), controller.FetchModels)
+			channelRoute.POST("/codex/oauth/start", middleware.RequirePermission(constant.PermissionChannelWrite), controller.StartCodexOAuth)
+			channelRoute.POST("/codex/oauth/complete", middleware.RequirePermission(constant.PermissionChannelWrite), controller.CompleteCodexOAuth)
+			channelRoute.POST("/:id/codex/oauth/start", middleware.RequirePermission(constant.PermissionChannelWrite), controller.StartCodexOAuthForChannel)
+			channelRoute.POST("/:id/codex/oauth/complete", middleware.RequirePermission(constant.PermissionChannelWrite), controller.CompleteCodexOAuthForChannel)
+			channelRoute.POST("/:id/codex/refresh", middleware.RequirePermission(constant.PermissionChannelWrite), controller.RefreshCodexChannelCredential)
 			channelRoute.GET("/:id/codex/usage", controller.GetCodexChannelUsage)
-			channelRoute.POST("/ollama/pull", controller.OllamaPullModel)
-			channelRoute.POST("/ollama/pull/stream", controller.OllamaPullModelStream)
-			channelRoute.DELETE("/ollama/delete", controller.OllamaDeleteModel)
+			channelRoute.POST("/ollama/pull", middleware.RequirePermission(constant.PermissionChannelWrite), controller.OllamaPullModel)
+			channelRoute.POST("/ollama/pull/stream", middleware.RequirePermission(constant.PermissionChannelWrite), controller.OllamaPullModelStream)
+			channelRoute.DELETE("/ollama/delete", middleware.RequirePermission(constant.PermissionChannelWrite), controller.OllamaDeleteModel)
 			channelRoute.GET("/ollama/version/:id", controller.OllamaVersion)
-			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
+			channelRoute.POST("/batch/tag", middleware.RequirePermission(constant.PermissionChannelWrite), controller.BatchSetChannelTag)
 			channelRoute.GET("/tag/models", controller.GetTagModels)
-			channelRoute.POST("/copy/:id", controller.CopyChannel)
-			channelRoute.POST("/multi_key/manage", controller.ManageMultiKeys)
-			channelRoute.POST("/upstream_updates/apply", controller.ApplyChannelUpstreamModelUpdates)
-			channelRoute.POST("/upstream_updates/apply_all", controller.ApplyAllChannelUpstreamModelUpdates)
-			channelRoute.POST("/upstream_updates/detect", controller.DetectChannelUpstreamModelUpdates)
-			channelRoute.POST("/upstream_updates/detect_all", controller.DetectAllChannelUpstreamModelUpdates)
+			channelRoute.POST("/copy/:id", middleware.RequirePermission(constant.PermissionChannelWrite), controller.CopyChannel)
+			channelRoute.POST("/multi_key/manage", middleware.RequirePermission(constant.PermissionChannelWrite), controller.ManageMultiKeys)
+			channelRoute.POST("/upstream_updates/apply", middleware.RequirePermission(constant.PermissionChannelWrite), controller.ApplyChannelUpstreamModelUpdates)
+			channelRoute.POST("/upstream_updates/apply_all", middleware.RequirePermission(constant.PermissionChannelWrite), controller.ApplyAllChannelUpstreamModelUpdates)
+			channelRoute.POST("/upstream_updates/detect", middleware.RequirePermission(constant.PermissionChannelWrite), controller.DetectChannelUpstreamModelUpdates)
+			channelRoute.POST("/upstream_updates/detect_all", middleware.RequirePermission(constant.PermissionChannelWrite), controller.DetectAllChannelUpstreamModelUpdates)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -270,7 +344,7 @@ func SetApiRouter(router *gin.Engine) {
 		}
 
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
+		redemptionRoute.Use(middleware.PermissionAuth(constant.PermissionRedemption))
 		{
 			redemptionRoute.GET("/", controller.GetAllRedemptions)
 			redemptionRoute.GET("/search", controller.SearchRedemptions)
@@ -278,20 +352,29 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.POST("/", controller.AddRedemption)
 			redemptionRoute.PUT("/", controller.UpdateRedemption)
 			redemptionRoute.DELETE("/invalid", controller.DeleteInvalidRedemption)
+			redemptionRoute.GET("/campaign", controller.GetRedemptionCampaigns)
+			redemptionRoute.POST("/campaign", controller.AddRedemptionCampaign)
+			redemptionRoute.PUT("/campaign", controller.UpdateRedemptionCampaign)
+			redemptionRoute.GET("/campaign/:id", controller.GetRedemptionCampaign)
+			redemptionRoute.GET("/campaign/:id/stats", controller.GetRedemptionCampaignStats)
+			redemptionRoute.POST("/campaign/:id/codes", controller.GenerateRedemptionCampaignCodes)
+			redemptionRoute.GET("/campaign/:id/codes/export", controller.ExportRedemptionCampaignCodes)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
 		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", middleware.PermissionAuth(constant.PermissionLogReadAll), controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(constant.PermissionLogDelete), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.PermissionAuth(constant.PermissionLogReadAll), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/channel_affinity_usage_cache", middleware.AdminAuth(), controller.GetChannelAffinityUsageCacheStats)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/end_user", middleware.PermissionAuth(constant.PermissionLogReadAll), controller.GetEndUserStats)
+		logRoute.GET("/self/end_user", middleware.UserAuth(), controller.GetSelfEndUserStats)
+		logRoute.GET("/channel_affinity_usage_cache", middleware.PermissionAuth(constant.PermissionLogReadAll), controller.GetChannelAffinityUsageCacheStats)
+		logRoute.GET("/search", middleware.PermissionAuth(constant.PermissionLogReadAll), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), middleware.SearchRateLimit(), controller.SearchUserLogs)
 
 		dataRoute := apiRouter.Group("/data")
-		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
+		dataRoute.GET("/", middleware.PermissionAuth(constant.PermissionStatsRead), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
 
 		logRoute.Use(middleware.CORS(), middleware.CriticalRateLimit())
@@ -299,13 +382,13 @@ func SetApiRouter(router *gin.Engine) {
 			logRoute.GET("/token", middleware.TokenAuthReadOnly(), controller.GetLogByKey)
 		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		groupRoute.Use(middleware.PermissionAuth(constant.PermissionChannelRead, constant.PermissionUserRead, constant.PermissionModelManage, constant.PermissionRedemption))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
 
 		prefillGroupRoute := apiRouter.Group("/prefill_group")
-		prefillGroupRoute.Use(middleware.AdminAuth())
+		prefillGroupRoute.Use(middleware.PermissionAuth(constant.PermissionModelManage))
 		{
 			prefillGroupRoute.GET("/", controller.GetPrefillGroups)
 			prefillGroupRoute.POST("/", controller.CreatePrefillGroup)
@@ -313,18 +396,38 @@ func SetApiRouter(router *gin.Engine) {
 			prefillGroupRoute.DELETE("/:id", controller.DeletePrefillGroup)
 		}
 
+		virtualModelRoute := apiRouter.Group("/virtual_model")
+		virtualModelRoute.Use(middleware.PermissionAuth(constant.PermissionModelManage))
+		{
+			virtualModelRoute.POST("/evaluate", controller.EvaluateVirtualModel)
+		}
+
+		groupPricingRoute := apiRouter.Group("/group_pricing")
+		groupPricingRoute.Use(middleware.PermissionAuth(constant.PermissionModelManage))
+		{
+			groupPricingRoute.POST("/simulate", controller.SimulateGroupPricing)
+		}
+
+		quotaLedgerRoute := apiRouter.Group("/quota_ledger")
+		quotaLedgerRoute.Use(middleware.PermissionAuth(constant.PermissionUserRead, constant.PermissionPaymentManage))
+		{
+			quotaLedgerRoute.GET("/user/:id", middleware.RequirePermission(constant.PermissionUserRead), controller.GetUserQuotaLedger)
+			quotaLedgerRoute.GET("/reconcile", middleware.RequirePermission(constant.PermissionPaymentManage), controller.GetQuotaLedgerReconcileReport)
+			quotaLedgerRoute.POST("/reconcile", middleware.RequirePermission(constant.PermissionPaymentManage), controller.RunQuotaLedgerReconcile)
+		}
+
 		mjRoute := apiRouter.Group("/mj")
 		mjRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourney)
-		mjRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourney)
+		mjRoute.GET("/", middleware.PermissionAuth(constant.PermissionLogReadAll), controller.GetAllMidjourney)
 
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
-			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.GET("/", middleware.PermissionAuth(constant.PermissionLogReadAll), controller.GetAllTask)
 		}
 
 		vendorRoute := apiRouter.Group("/vendors")
-		vendorRoute.Use(middleware.AdminAuth())
+		vendorRoute.Use(middleware.PermissionAuth(constant.PermissionModelManage))
 		{
 			vendorRoute.GET("/", controller.GetAllVendors)
 			vendorRoute.GET("/search", controller.SearchVendors)
@@ -335,7 +438,7 @@ func SetApiRouter(router *gin.Engine) {
 		}
 
 		modelsRoute := apiRouter.Group("/models")
-		modelsRoute.Use(middleware.AdminAuth())
+		modelsRoute.Use(middleware.PermissionAuth(constant.PermissionModelManage))
 		{
 			modelsRoute.GET("/sync_upstream/preview", controller.SyncUpstreamPreview)
 			modelsRoute.POST("/sync_upstream", controller.SyncUpstreamModels)
@@ -350,7 +453,7 @@ func SetApiRouter(router *gin.Engine) {
 
 		// Deployments (model deployment management)
 		deploymentsRoute := apiRouter.Group("/deployments")
-		deploymentsRoute.Use(middleware.AdminAuth())
+		deploymentsRoute.Use(middleware.PermissionAuth(constant.PermissionDeployment))
 		{
 			deploymentsRoute.GET("/settings", controller.GetModelDeploymentSettings)
 			deploymentsRoute.POST("/settings/test-connection", controller.TestIoNetConnection)
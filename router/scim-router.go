@@ -0,0 +1,33 @@
+package router
+
+import (
+	"github.com/QuantumNous/new-api/controller"
+	"github.com/QuantumNous/new-api/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetSCIMRouter SCIM 2.0 开通接口，供身份提供方创建、更新与停用用户和组
+func SetSCIMRouter(router *gin.Engine) {
+	scimRouter := router.Group("/scim/v2")
+	scimRouter.Use(middleware.RouteTag("scim"))
+	scimRouter.Use(middleware.GlobalAPIRateLimit())
+	scimRouter.Use(middleware.SCIMAuth())
+	{
+		scimRouter.GET("/ServiceProviderConfig", controller.GetSCIMServiceProviderConfig)
+
+		scimRouter.GET("/Users", controller.GetSCIMUsers)
+		scimRouter.POST("/Users", controller.CreateSCIMUser)
+		scimRouter.GET("/Users/:id", controller.GetSCIMUser)
+		scimRouter.PUT("/Users/:id", controller.UpdateSCIMUser)
+		scimRouter.PATCH("/Users/:id", controller.UpdateSCIMUser)
+		scimRouter.DELETE("/Users/:id", controller.DeleteSCIMUser)
+
+		scimRouter.GET("/Groups", controller.GetSCIMGroups)
+		scimRouter.POST("/Groups", controller.CreateSCIMGroup)
+		scimRouter.GET("/Groups/:id", controller.GetSCIMGroup)
+		scimRouter.PUT("/Groups/:id", controller.UpdateSCIMGroup)
+		scimRouter.PATCH("/Groups/:id", controller.UpdateSCIMGroup)
+		scimRouter.DELETE("/Groups/:id", controller.DeleteSCIMGroup)
+	}
+}
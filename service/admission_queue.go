@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+var (
+	ErrAdmissionQueueFull   = errors.New("上游容量已满，排队人数过多，请稍后重试")
+	ErrAdmissionWaitTimeout = errors.New("上游容量已满，排队等待超时，请稍后重试")
+)
+
+// AdmissionRequest 一次准入申请
+type AdmissionRequest struct {
+	Model string
+	Group string
+	// FlowKey 公平调度的单位（用户或分组），Weight 为其权重
+	FlowKey string
+	Weight  int
+	MaxWait time.Duration
+	// KeepAlive 排队期间按 KeepAliveInterval 调用，用于流式请求保活
+	KeepAlive         func() error
+	KeepAliveInterval time.Duration
+}
+
+// AdmissionTicket 已准入的请求，处理结束后必须 Release
+type AdmissionTicket struct {
+	queue    *admissionQueue
+	request  AdmissionRequest
+	released atomic.Bool
+	// Wait 累计排队时间
+	Wait time.Duration
+}
+
+// AdmissionQueueStats 队列运行状态
+type AdmissionQueueStats struct {
+	Model       string  `json:"model"`
+	Group       string  `json:"group"`
+	Limit       int     `json:"limit"`
+	Inflight    int     `json:"inflight"`
+	Waiting     int     `json:"waiting"`
+	Admitted    int64   `json:"admitted"`
+	Queued      int64   `json:"queued"`
+	Timeouts    int64   `json:"timeouts"`
+	Rejected    int64   `json:"rejected"`
+	AvgWaitMs   float64 `json:"avg_wait_ms"`
+	MaxWaitMs   int64   `json:"max_wait_ms"`
+	CoolingDown bool    `json:"cooling_down"`
+}
+
+type admissionWaiter struct {
+	ready    chan struct{}
+	admitted bool
+	seq      uint64
+}
+
+// admissionFlow 一个公平调度单位，virtualTime 越小越先放行
+type admissionFlow struct {
+	weight      int
+	virtualTime float64
+	waiters     []*admissionWaiter
+}
+
+type admissionQueue struct {
+	mu            sync.Mutex
+	model         string
+	group         string
+	limit         int
+	inflight      int
+	waiting       int
+	virtualTime   float64
+	seq           uint64
+	flows         map[string]*admissionFlow
+	cooldownUntil time.Time
+
+	admitted  int64
+	queued    int64
+	timeouts  int64
+	rejected  int64
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+var admissionQueues sync.Map // model|group -> *admissionQueue
+
+func getAdmissionQueue(model string, group string) *admissionQueue {
+	key := model + "|" + group
+	if q, ok := admissionQueues.Load(key); ok {
+		return q.(*admissionQueue)
+	}
+	q, _ := admissionQueues.LoadOrStore(key, &admissionQueue{
+		model: model,
+		group: group,
+		flows: make(map[string]*admissionFlow),
+	})
+	return q.(*admissionQueue)
+}
+
+func (q *admissionQueue) canAdmitLocked() bool {
+	if time.Now().Before(q.cooldownUntil) {
+		return false
+	}
+	return q.limit <= 0 || q.inflight < q.limit
+}
+
+// dispatchLocked 按加权虚拟时间依次放行等待中的请求
+func (q *admissionQueue) dispatchLocked() {
+	for q.waiting > 0 && q.canAdmitLocked() {
+		var best *admissionFlow
+		for key, flow := range q.flows {
+			if len(flow.waiters) == 0 {
+				if flow.virtualTime <= q.virtualTime {
+					delete(q.flows, key)
+				}
+				continue
+			}
+			// 虚拟时间相同时先到先放行
+			if best == nil || flow.virtualTime < best.virtualTime ||
+				(flow.virtualTime == best.virtualTime && flow.waiters[0].seq < best.waiters[0].seq) {
+				best = flow
+			}
+		}
+		if best == nil {
+			return
+		}
+		w := best.waiters[0]
+		best.waiters = best.waiters[1:]
+		q.virtualTime = best.virtualTime
+		best.virtualTime += 1 / float64(best.weight)
+		q.waiting--
+		q.inflight++
+		q.admitted++
+		w.admitted = true
+		close(w.ready)
+	}
+}
+
+func (q *admissionQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.inflight > 0 {
+		q.inflight--
+	}
+	q.dispatchLocked()
+}
+
+// cancelLocked 移除未放行的等待者，已放行时返回 true
+func (q *admissionQueue) cancelLocked(flowKey string, w *admissionWaiter) bool {
+	if w.admitted {
+		return true
+	}
+	if flow, ok := q.flows[flowKey]; ok {
+		for i, waiter := range flow.waiters {
+			if waiter == w {
+				flow.waiters = append(flow.waiters[:i], flow.waiters[i+1:]...)
+				q.waiting--
+				break
+			}
+		}
+	}
+	return false
+}
+
+func (q *admissionQueue) markSaturated(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	until := time.Now().Add(d)
+	if !until.After(q.cooldownUntil) {
+		return
+	}
+	q.cooldownUntil = until
+	time.AfterFunc(d, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.dispatchLocked()
+	})
+}
+
+func (q *admissionQueue) acquire(ctx context.Context, req AdmissionRequest, limit int, maxLength int) (time.Duration, error) {
+	weight := req.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	q.mu.Lock()
+	q.limit = limit
+	if q.waiting == 0 && q.canAdmitLocked() {
+		q.inflight++
+		q.admitted++
+		q.mu.Unlock()
+		return 0, nil
+	}
+	if req.MaxWait <= 0 || (maxLength > 0 && q.waiting >= maxLength) {
+		q.rejected++
+		q.mu.Unlock()
+		return 0, ErrAdmissionQueueFull
+	}
+	q.seq++
+	w := &admissionWaiter{ready: make(chan struct{}), seq: q.seq}
+	flow, ok := q.flows[req.FlowKey]
+	if !ok {
+		flow = &admissionFlow{virtualTime: q.virtualTime}
+		q.flows[req.FlowKey] = flow
+	} else if len(flow.waiters) == 0 && flow.virtualTime < q.virtualTime {
+		// 空闲期间不累积额度，避免突发请求长期占用
+		flow.virtualTime = q.virtualTime
+	}
+	flow.weight = weight
+	flow.waiters = append(flow.waiters, w)
+	q.waiting++
+	q.queued++
+	q.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(req.MaxWait)
+	defer timer.Stop()
+	var tick <-chan time.Time
+	if req.KeepAlive != nil && req.KeepAliveInterval > 0 {
+		ticker := time.NewTicker(req.KeepAliveInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var err error
+	for err == nil {
+		select {
+		case <-w.ready:
+			return q.recordWait(start), nil
+		case <-tick:
+			if keepAliveErr := req.KeepAlive(); keepAliveErr != nil {
+				tick = nil
+			}
+		case <-timer.C:
+			err = ErrAdmissionWaitTimeout
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	q.mu.Lock()
+	admitted := q.cancelLocked(req.FlowKey, w)
+	if !admitted {
+		q.timeouts++
+	}
+	q.mu.Unlock()
+	if admitted {
+		return q.recordWait(start), nil
+	}
+	return time.Since(start), err
+}
+
+func (q *admissionQueue) recordWait(start time.Time) time.Duration {
+	wait := time.Since(start)
+	q.mu.Lock()
+	q.totalWait += wait
+	if wait > q.maxWait {
+		q.maxWait = wait
+	}
+	q.mu.Unlock()
+	return wait
+}
+
+// AcquireAdmission 申请准入，容量不足时按公平调度排队等待
+func AcquireAdmission(ctx context.Context, req AdmissionRequest) (*AdmissionTicket, error) {
+	setting := operation_setting.GetAdmissionQueueSetting()
+	q := getAdmissionQueue(req.Model, req.Group)
+	wait, err := q.acquire(ctx, req, setting.GetConcurrency(req.Model), setting.MaxQueueLength)
+	if err != nil {
+		return nil, err
+	}
+	return &AdmissionTicket{queue: q, request: req, Wait: wait}, nil
+}
+
+// Release 释放准入名额，可重复调用
+func (t *AdmissionTicket) Release() {
+	if t == nil || !t.released.CompareAndSwap(false, true) {
+		return
+	}
+	t.queue.release()
+}
+
+// Requeue 上游全部限流时暂停队列并重新排队，remaining 为剩余可等待时间
+func (t *AdmissionTicket) Requeue(ctx context.Context, remaining time.Duration) error {
+	setting := operation_setting.GetAdmissionQueueSetting()
+	t.queue.markSaturated(time.Duration(setting.SaturationCooldownSeconds) * time.Second)
+	t.Release()
+	req := t.request
+	req.MaxWait = remaining
+	wait, err := t.queue.acquire(ctx, req, setting.GetConcurrency(req.Model), setting.MaxQueueLength)
+	t.Wait += wait
+	if err != nil {
+		return err
+	}
+	t.released.Store(false)
+	return nil
+}
+
+// RemainingWait 返回本次请求剩余可排队时间
+func (t *AdmissionTicket) RemainingWait() time.Duration {
+	return t.request.MaxWait - t.Wait
+}
+
+// GetAdmissionQueueStats 返回所有队列的运行状态
+func GetAdmissionQueueStats() []AdmissionQueueStats {
+	stats := make([]AdmissionQueueStats, 0)
+	admissionQueues.Range(func(_, value any) bool {
+		q := value.(*admissionQueue)
+		q.mu.Lock()
+		s := AdmissionQueueStats{
+			Model:       q.model,
+			Group:       q.group,
+			Limit:       q.limit,
+			Inflight:    q.inflight,
+			Waiting:     q.waiting,
+			Admitted:    q.admitted,
+			Queued:      q.queued,
+			Timeouts:    q.timeouts,
+			Rejected:    q.rejected,
+			MaxWaitMs:   q.maxWait.Milliseconds(),
+			CoolingDown: time.Now().Before(q.cooldownUntil),
+		}
+		if q.queued > q.timeouts {
+			s.AvgWaitMs = float64(q.totalWait.Milliseconds()) / float64(q.queued-q.timeouts)
+		}
+		q.mu.Unlock()
+		stats = append(stats, s)
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Model != stats[j].Model {
+			return stats[i].Model < stats[j].Model
+		}
+		return stats[i].Group < stats[j].Group
+	})
+	return stats
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmissionQueueFairShare(t *testing.T) {
+	q := &admissionQueue{flows: make(map[string]*admissionFlow)}
+	_, err := q.acquire(context.Background(), AdmissionRequest{FlowKey: "a"}, 1, 0)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(flow string) {
+		q.mu.Lock()
+		seq := q.seq
+		q.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := q.acquire(context.Background(), AdmissionRequest{FlowKey: flow, MaxWait: 5 * time.Second}, 1, 0)
+			require.NoError(t, err)
+			mu.Lock()
+			order = append(order, flow)
+			mu.Unlock()
+		}()
+		require.Eventually(t, func() bool {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			return q.seq == seq+1
+		}, time.Second, time.Millisecond)
+	}
+	// a 突发三个请求后 b 才到达，b 不应排在 a 的全部请求之后
+	enqueue("a")
+	enqueue("a")
+	enqueue("a")
+	enqueue("b")
+
+	for i := 0; i < 4; i++ {
+		q.release()
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(order) == i+1
+		}, time.Second, time.Millisecond)
+	}
+	wg.Wait()
+	require.Equal(t, []string{"a", "b", "a", "a"}, order)
+}
+
+func TestAdmissionQueueTimeoutAndSaturation(t *testing.T) {
+	q := &admissionQueue{flows: make(map[string]*admissionFlow)}
+	_, err := q.acquire(context.Background(), AdmissionRequest{FlowKey: "a"}, 1, 0)
+	require.NoError(t, err)
+
+	_, err = q.acquire(context.Background(), AdmissionRequest{FlowKey: "b", MaxWait: 20 * time.Millisecond}, 1, 0)
+	require.ErrorIs(t, err, ErrAdmissionWaitTimeout)
+	_, err = q.acquire(context.Background(), AdmissionRequest{FlowKey: "b"}, 1, 0)
+	require.ErrorIs(t, err, ErrAdmissionQueueFull)
+	require.Equal(t, 0, q.waiting)
+
+	// 限流冷却期内即使有空闲名额也不放行
+	q.release()
+	q.markSaturated(50 * time.Millisecond)
+	wait, err := q.acquire(context.Background(), AdmissionRequest{FlowKey: "b", MaxWait: time.Second}, 1, 0)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, wait, 40*time.Millisecond)
+	require.Equal(t, 1, q.inflight)
+}
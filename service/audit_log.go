@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// AuditRequiredKey 请求经过了管理权限校验，需要审计
+	AuditRequiredKey = "audit_required"
+	// AuditRecordedKey 接口已显式记录审计日志
+	AuditRecordedKey = "audit_recorded"
+
+	auditMask = "******"
+)
+
+// AuditChange 单个字段的变更前后值
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+var auditSecretSuffixes = []string{"key", "secret", "token", "password", "credential", "credentials"}
+
+// isAuditSecretField 判断字段是否需要脱敏，如渠道密钥、OAuth client secret
+func isAuditSecretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range auditSecretSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditOptionFields 判断对象是否为 {"key": ..., "value": ...} 形式的配置项（如 /api/option 的请求体），
+// 返回配置项名称；此时 key 为配置名称无需脱敏，value 按配置项是否为密钥类配置脱敏
+func auditOptionFields(fields map[string]any) (string, bool) {
+	key, ok := fields["key"].(string)
+	if !ok || len(fields) != 2 {
+		return "", false
+	}
+	_, hasValue := fields["value"]
+	return key, hasValue
+}
+
+// maskAuditValue 递归脱敏对象中的敏感字段
+func maskAuditValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		if optionKey, ok := auditOptionFields(v); ok {
+			masked := map[string]any{"key": optionKey, "value": maskAuditValue(v["value"])}
+			if (model.IsSecretOption(optionKey) || isAuditSecretField(optionKey)) && v["value"] != nil && v["value"] != "" {
+				masked["value"] = auditMask
+			}
+			return masked
+		}
+		masked := make(map[string]any, len(v))
+		for key, item := range v {
+			if isAuditSecretField(key) && item != nil && item != "" {
+				masked[key] = auditMask
+			} else {
+				masked[key] = maskAuditValue(item)
+			}
+		}
+		return masked
+	case []any:
+		masked := make([]any, len(v))
+		for i, item := range v {
+			masked[i] = maskAuditValue(item)
+		}
+		return masked
+	default:
+		return value
+	}
+}
+
+// toAuditMap 将对象转换为字段表，非对象类型放在 value 字段下
+func toAuditMap(value any) map[string]any {
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Pointer && reflect.ValueOf(value).IsNil()) {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		var raw any
+		_ = json.Unmarshal(data, &raw)
+		return map[string]any{"value": raw}
+	}
+	return fields
+}
+
+// BuildAuditDiff 对比变更前后的对象，返回发生变化的字段，敏感字段只保留是否变化
+func BuildAuditDiff(before any, after any) map[string]AuditChange {
+	beforeFields := toAuditMap(before)
+	afterFields := toAuditMap(after)
+	diff := make(map[string]AuditChange)
+	for key, value := range beforeFields {
+		if afterValue, ok := afterFields[key]; !ok || !reflect.DeepEqual(value, afterValue) {
+			diff[key] = AuditChange{Before: value, After: afterFields[key]}
+		}
+	}
+	for key, value := range afterFields {
+		if _, ok := beforeFields[key]; !ok {
+			diff[key] = AuditChange{After: value}
+		}
+	}
+	for key, change := range diff {
+		if isAuditSecretField(key) {
+			if change.Before != nil && change.Before != "" {
+				change.Before = auditMask
+			}
+			if change.After != nil && change.After != "" {
+				change.After = auditMask
+			}
+		} else {
+			change.Before = maskAuditValue(change.Before)
+			change.After = maskAuditValue(change.After)
+		}
+		diff[key] = change
+	}
+	return diff
+}
+
+// RecordAudit 记录一次管理变更，新增时 before 为 nil，删除时 after 为 nil
+func RecordAudit(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	c.Set(AuditRecordedKey, true)
+	if !operation_setting.GetAuditLogSetting().Enabled {
+		return
+	}
+	recordAudit(c, action, targetType, targetId, before, after)
+}
+
+// RecordAuditAlways 不受审计开关限制地记录变更，用于审计配置自身，确保关闭审计日志的操作也被记录
+func RecordAuditAlways(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	c.Set(AuditRecordedKey, true)
+	recordAudit(c, action, targetType, targetId, before, after)
+}
+
+func recordAudit(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	diff := BuildAuditDiff(before, after)
+	if before != nil && after != nil && len(diff) == 0 {
+		return
+	}
+	saveAuditLog(c, action, targetType, fmt.Sprint(targetId), diff)
+}
+
+// RecordAuditRequest 为未显式记录的管理写操作补充审计，内容为脱敏后的请求参数
+func RecordAuditRequest(c *gin.Context, body []byte) {
+	if !operation_setting.GetAuditLogSetting().Enabled {
+		return
+	}
+	var request any
+	if len(body) > 0 && json.Unmarshal(body, &request) != nil {
+		request = nil
+	}
+	if len(c.Request.URL.RawQuery) > 0 {
+		query := make(map[string]any)
+		for key, values := range c.Request.URL.Query() {
+			query[key] = strings.Join(values, ",")
+		}
+		request = map[string]any{"query": query, "body": request}
+	}
+	targetType := strings.TrimPrefix(c.FullPath(), "/api/")
+	if idx := strings.Index(targetType, "/"); idx >= 0 {
+		targetType = targetType[:idx]
+	}
+	diff := map[string]AuditChange{"request": {After: maskAuditValue(request)}}
+	saveAuditLog(c, "request", targetType, c.Param("id"), diff)
+}
+
+func saveAuditLog(c *gin.Context, action string, targetType string, targetId string, diff map[string]AuditChange) {
+	data, err := json.Marshal(diff)
+	if err != nil {
+		common.SysError("failed to marshal audit diff: " + err.Error())
+		return
+	}
+	auditLog := &model.AuditLog{
+		ActorId:    c.GetInt("id"),
+		ActorName:  c.GetString("username"),
+		ActorRole:  c.GetInt("role"),
+		Ip:         c.ClientIP(),
+		Method:     c.Request.Method,
+		Route:      c.Request.URL.Path,
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetId,
+		Diff:       string(data),
+		StatusCode: c.Writer.Status(),
+	}
+	if err := auditLog.Insert(); err != nil {
+		common.SysError("failed to record audit log: " + err.Error())
+		return
+	}
+	forwardAuditLog(auditLog, diff)
+}
+
+// forwardAuditLog 将审计事件异步转发到 Webhook
+func forwardAuditLog(auditLog *model.AuditLog, diff map[string]AuditChange) {
+	setting := operation_setting.GetAuditLogSetting()
+	if !setting.WebhookEnabled || setting.WebhookUrl == "" {
+		return
+	}
+	fields := make([]string, 0, len(diff))
+	for key := range diff {
+		fields = append(fields, key)
+	}
+	sort.Strings(fields)
+	target := auditLog.TargetType
+	if auditLog.TargetId != "" {
+		target += "#" + auditLog.TargetId
+	}
+	content := fmt.Sprintf("%s(%d) %s %s，操作 %s，对象 %s，变更字段：%s",
+		auditLog.ActorName, auditLog.ActorId, auditLog.Method, auditLog.Route, auditLog.Action, target, strings.Join(fields, ", "))
+	notify := dto.NewNotify(dto.NotifyTypeAuditLog, "管理操作审计", content, nil)
+	url, secret := setting.WebhookUrl, setting.WebhookSecret
+	gopool.Go(func() {
+		if err := SendWebhookNotify(url, secret, notify); err != nil {
+			common.SysError("failed to forward audit log: " + err.Error())
+		}
+	})
+}
+
+var auditLogCleanupOnce sync.Once
+
+// StartAuditLogCleanupTask 按保留天数定期清理审计日志
+func StartAuditLogCleanupTask() {
+	auditLogCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), "audit log cleanup task started")
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				days := operation_setting.GetAuditLogSetting().RetentionDays
+				if days <= 0 {
+					continue
+				}
+				before := time.Now().AddDate(0, 0, -days).Unix()
+				n, err := model.DeleteAuditLogsBefore(before)
+				if err != nil {
+					common.SysError("audit log cleanup failed: " + err.Error())
+					continue
+				}
+				if n > 0 {
+					common.SysLog(fmt.Sprintf("audit log cleanup: %d logs deleted", n))
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildAuditDiffMasksSecrets(t *testing.T) {
+	type channel struct {
+		Name    string         `json:"name"`
+		Key     string         `json:"key"`
+		Weight  int            `json:"weight"`
+		Setting map[string]any `json:"setting"`
+	}
+	before := &channel{Name: "a", Key: "sk-old", Weight: 1, Setting: map[string]any{"api_key": "x"}}
+	after := &channel{Name: "b", Key: "sk-new", Weight: 1, Setting: map[string]any{"api_key": "y"}}
+
+	diff := BuildAuditDiff(before, after)
+	require.Len(t, diff, 3)
+	require.Equal(t, AuditChange{Before: "a", After: "b"}, diff["name"])
+	require.Equal(t, AuditChange{Before: auditMask, After: auditMask}, diff["key"])
+	require.Equal(t, map[string]any{"api_key": auditMask}, diff["setting"].After)
+
+	created := BuildAuditDiff(nil, map[string]string{"GitHubClientSecret": "s", "ModelRatio": "{}"})
+	require.Equal(t, AuditChange{After: auditMask}, created["GitHubClientSecret"])
+	require.Equal(t, AuditChange{After: "{}"}, created["ModelRatio"])
+
+	require.Empty(t, BuildAuditDiff(before, before))
+}
+
+func TestMaskAuditValueMasksSecretOptions(t *testing.T) {
+	masked := maskAuditValue(map[string]any{"key": "StripeApiSecret", "value": "sk_live_x"})
+	require.Equal(t, map[string]any{"key": "StripeApiSecret", "value": auditMask}, masked)
+
+	masked = maskAuditValue(map[string]any{"key": "audit_log_setting.webhook_secret", "value": "s"})
+	require.Equal(t, auditMask, masked.(map[string]any)["value"])
+
+	masked = maskAuditValue(map[string]any{"key": "ModelRatio", "value": "{}"})
+	require.Equal(t, "{}", masked.(map[string]any)["value"])
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const maxChannelRateLimitBlock = 10 * time.Minute
+
+var channelInflight sync.Map // channel id -> *atomic.Int64，仅统计本实例
+
+// AcquireChannelSlot 占用渠道与密钥的容量名额，超过上限时返回 false
+func AcquireChannelSlot(channelId int, keyIndex int, tokens int) (func(), bool) {
+	channel, err := model.CacheGetChannel(channelId)
+	if err != nil {
+		return func() {}, true
+	}
+	defaultConcurrency := 0
+	if setting := operation_setting.GetAdmissionQueueSetting(); setting.Enabled {
+		defaultConcurrency = setting.ChannelConcurrency
+	}
+	release, ok := model.AcquireChannelCapacity(channel, keyIndex, tokens, defaultConcurrency)
+	if !ok {
+		return nil, false
+	}
+	value, _ := channelInflight.LoadOrStore(channelId, &atomic.Int64{})
+	counter := value.(*atomic.Int64)
+	counter.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			counter.Add(-1)
+			release()
+		})
+	}, true
+}
+
+// GetChannelInflight 返回本实例各渠道当前并发数
+func GetChannelInflight() map[string]int64 {
+	result := make(map[string]int64)
+	channelInflight.Range(func(key, value any) bool {
+		if n := value.(*atomic.Int64).Load(); n > 0 {
+			result[strconv.Itoa(key.(int))] = n
+		}
+		return true
+	})
+	return result
+}
+
+// parseRateLimitReset 解析 x-ratelimit-reset-* 的取值，支持 "6m0s"、"20ms" 与秒数
+func parseRateLimitReset(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return 0
+}
+
+func parseRateLimitHeader(header http.Header, name string) (int64, bool) {
+	value := header.Get(name)
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return n, err == nil
+}
+
+// ObserveChannelRateLimit 从上游 x-ratelimit-* 响应头学习渠道限制，额度耗尽时暂停到重置
+func ObserveChannelRateLimit(channelId int, keyIndex int, isMultiKey bool, capacity *dto.ChannelCapacity, header http.Header) {
+	if capacity == nil || !capacity.LearnFromHeaders || header == nil {
+		return
+	}
+	rpm, _ := parseRateLimitHeader(header, "x-ratelimit-limit-requests")
+	tpm, _ := parseRateLimitHeader(header, "x-ratelimit-limit-tokens")
+	if rpm > 0 || tpm > 0 {
+		model.SetChannelLearnedLimits(channelId, keyIndex, isMultiKey, rpm, tpm)
+	}
+
+	var block time.Duration
+	if remaining, ok := parseRateLimitHeader(header, "x-ratelimit-remaining-requests"); ok && remaining <= 0 {
+		block = max(block, parseRateLimitReset(header.Get("x-ratelimit-reset-requests")))
+	}
+	if remaining, ok := parseRateLimitHeader(header, "x-ratelimit-remaining-tokens"); ok && remaining <= 0 {
+		block = max(block, parseRateLimitReset(header.Get("x-ratelimit-reset-tokens")))
+	}
+	if block <= 0 {
+		return
+	}
+	model.BlockChannelCapacity(channelId, keyIndex, isMultiKey, min(max(block, time.Second), maxChannelRateLimitBlock))
+}
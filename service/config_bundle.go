@@ -0,0 +1,851 @@
+package service
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/oauth"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// ConfigBundleVersion 当前配置包格式版本
+const ConfigBundleVersion = 1
+
+// 配置包中密钥的导出方式
+const (
+	ConfigSecretOmit      = "omit"
+	ConfigSecretPlain     = "plain"
+	ConfigSecretEncrypted = "encrypted"
+)
+
+// 配置导入模式：merge 只新增和更新，replace 还会删除或停用配置包中不存在的记录
+const (
+	ConfigImportMerge   = "merge"
+	ConfigImportReplace = "replace"
+)
+
+const (
+	ConfigSectionOptions              = "options"
+	ConfigSectionVendors              = "vendors"
+	ConfigSectionModels               = "models"
+	ConfigSectionPrefillGroups        = "prefill_groups"
+	ConfigSectionSubscriptionPlans    = "subscription_plans"
+	ConfigSectionCustomOAuthProviders = "custom_oauth_providers"
+	ConfigSectionChannels             = "channels"
+)
+
+// ConfigSections 配置包包含的全部分区，按导入顺序排列
+var ConfigSections = []string{
+	ConfigSectionVendors,
+	ConfigSectionModels,
+	ConfigSectionPrefillGroups,
+	ConfigSectionSubscriptionPlans,
+	ConfigSectionCustomOAuthProviders,
+	ConfigSectionChannels,
+	ConfigSectionOptions,
+}
+
+const (
+	configSecretPrefix  = "enc:"
+	configKeyIterations = 100000
+)
+
+// configIgnoredFields 运行时字段与各环境不同的字段，不导出也不参与对比
+var configIgnoredFields = []string{
+	"id", "created_time", "updated_time", "created_at", "updated_at",
+	"test_time", "response_time", "balance", "balance_updated_time", "used_quota",
+	"vendor_id", "bound_channels", "enable_groups", "quota_types", "matched_models", "matched_count",
+}
+
+var errConfigDryRun = errors.New("config import dry run")
+
+// ConfigBundle 声明式配置包。渠道能力由渠道的模型与分组生成，分组倍率等运行配置包含在 options 中。
+// 为 nil 的分区表示未导出，导入时跳过
+type ConfigBundle struct {
+	Version    int    `json:"version"`
+	ExportedAt int64  `json:"exported_at"`
+	SecretMode string `json:"secret_mode"`
+	// SecretSalt 加密导出时用于由口令派生密钥
+	SecretSalt string `json:"secret_salt,omitempty"`
+
+	Options              map[string]string         `json:"options"`
+	Vendors              []*model.Vendor           `json:"vendors"`
+	Models               []*BundleModel            `json:"models"`
+	PrefillGroups        []*model.PrefillGroup     `json:"prefill_groups"`
+	SubscriptionPlans    []*model.SubscriptionPlan `json:"subscription_plans"`
+	CustomOAuthProviders []*BundleOAuthProvider    `json:"custom_oauth_providers"`
+	Channels             []*model.Channel          `json:"channels"`
+}
+
+// BundleModel 模型元数据，供应商按名称关联
+type BundleModel struct {
+	model.Model
+	Vendor string `json:"vendor,omitempty"`
+}
+
+// BundleOAuthProvider 自定义 OAuth 提供商，client secret 按密钥导出方式处理
+type BundleOAuthProvider struct {
+	model.CustomOAuthProvider
+	ClientSecret string `json:"client_secret"`
+}
+
+type ConfigExportOptions struct {
+	Sections   []string
+	SecretMode string
+	Passphrase string
+}
+
+type ConfigImportOptions struct {
+	Mode       string
+	DryRun     bool
+	Passphrase string
+}
+
+// ConfigChange 导入时单条记录的变更，action 为 create、update、delete 或 disable
+type ConfigChange struct {
+	Section string                 `json:"section"`
+	Action  string                 `json:"action"`
+	Name    string                 `json:"name"`
+	Diff    map[string]AuditChange `json:"diff,omitempty"`
+}
+
+type ConfigImportResult struct {
+	Mode    string         `json:"mode"`
+	DryRun  bool           `json:"dry_run"`
+	Changes []ConfigChange `json:"changes"`
+}
+
+func newConfigCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("加密的配置包需要提供口令")
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, configKeyIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealConfigSecret(aead cipher.AEAD, value string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return configSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openConfigSecret(aead cipher.AEAD, value string) (string, error) {
+	if !strings.HasPrefix(value, configSecretPrefix) {
+		return "", errors.New("密钥未加密")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, configSecretPrefix))
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", errors.New("密钥格式错误")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("口令错误或密钥已损坏")
+	}
+	return string(plain), nil
+}
+
+// transformSecrets 对配置包中的全部密钥执行转换，返回空字符串表示不保留该密钥
+func (b *ConfigBundle) transformSecrets(fn func(value string) (string, error)) error {
+	var err error
+	for _, channel := range b.Channels {
+		if channel.Key, err = fn(channel.Key); err != nil {
+			return fmt.Errorf("渠道 %s：%w", channel.Name, err)
+		}
+	}
+	for _, provider := range b.CustomOAuthProviders {
+		if provider.ClientSecret, err = fn(provider.ClientSecret); err != nil {
+			return fmt.Errorf("OAuth 提供商 %s：%w", provider.Slug, err)
+		}
+	}
+	for key, value := range b.Options {
+		if !model.IsSecretOption(key) {
+			continue
+		}
+		if value, err = fn(value); err != nil {
+			return fmt.Errorf("配置项 %s：%w", key, err)
+		}
+		if value == "" {
+			delete(b.Options, key)
+		} else {
+			b.Options[key] = value
+		}
+	}
+	return nil
+}
+
+// ExportConfigBundle 导出配置包
+func ExportConfigBundle(opts ConfigExportOptions) (*ConfigBundle, error) {
+	sections := opts.Sections
+	if len(sections) == 0 {
+		sections = ConfigSections
+	}
+	for _, section := range sections {
+		if !slices.Contains(ConfigSections, section) {
+			return nil, fmt.Errorf("未知的配置分区：%s", section)
+		}
+	}
+	if opts.SecretMode == "" {
+		opts.SecretMode = ConfigSecretOmit
+	}
+	bundle := &ConfigBundle{
+		Version:    ConfigBundleVersion,
+		ExportedAt: common.GetTimestamp(),
+		SecretMode: opts.SecretMode,
+	}
+
+	vendorNames := make(map[int]string)
+	vendors := make([]*model.Vendor, 0)
+	if err := model.DB.Order("id").Find(&vendors).Error; err != nil {
+		return nil, err
+	}
+	for _, vendor := range vendors {
+		vendorNames[vendor.Id] = vendor.Name
+	}
+	for _, section := range sections {
+		switch section {
+		case ConfigSectionVendors:
+			bundle.Vendors = vendors
+		case ConfigSectionModels:
+			models, err := loadBundleModels(model.DB, vendorNames)
+			if err != nil {
+				return nil, err
+			}
+			bundle.Models = models
+		case ConfigSectionPrefillGroups:
+			bundle.PrefillGroups = make([]*model.PrefillGroup, 0)
+			if err := model.DB.Order("id").Find(&bundle.PrefillGroups).Error; err != nil {
+				return nil, err
+			}
+		case ConfigSectionSubscriptionPlans:
+			bundle.SubscriptionPlans = make([]*model.SubscriptionPlan, 0)
+			if err := model.DB.Order("id").Find(&bundle.SubscriptionPlans).Error; err != nil {
+				return nil, err
+			}
+		case ConfigSectionCustomOAuthProviders:
+			providers, err := loadBundleOAuthProviders(model.DB)
+			if err != nil {
+				return nil, err
+			}
+			bundle.CustomOAuthProviders = providers
+		case ConfigSectionChannels:
+			bundle.Channels = make([]*model.Channel, 0)
+			if err := model.DB.Order("id").Find(&bundle.Channels).Error; err != nil {
+				return nil, err
+			}
+		case ConfigSectionOptions:
+			options, err := model.AllOption()
+			if err != nil {
+				return nil, err
+			}
+			bundle.Options = make(map[string]string, len(options))
+			for _, option := range options {
+				bundle.Options[option.Key] = option.Value
+			}
+		}
+	}
+	switch opts.SecretMode {
+	case ConfigSecretPlain:
+	case ConfigSecretOmit:
+		_ = bundle.transformSecrets(func(string) (string, error) { return "", nil })
+	case ConfigSecretEncrypted:
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		aead, err := newConfigCipher(opts.Passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+		bundle.SecretSalt = base64.StdEncoding.EncodeToString(salt)
+		err = bundle.transformSecrets(func(value string) (string, error) {
+			if value == "" {
+				return "", nil
+			}
+			return sealConfigSecret(aead, value)
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("未知的密钥导出方式：%s", opts.SecretMode)
+	}
+	return bundle, nil
+}
+
+func loadBundleModels(tx *gorm.DB, vendorNames map[int]string) ([]*BundleModel, error) {
+	var models []*model.Model
+	if err := tx.Order("id").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	items := make([]*BundleModel, 0, len(models))
+	for _, m := range models {
+		items = append(items, &BundleModel{Model: *m, Vendor: vendorNames[m.VendorID]})
+	}
+	return items, nil
+}
+
+func loadBundleOAuthProviders(tx *gorm.DB) ([]*BundleOAuthProvider, error) {
+	var providers []*model.CustomOAuthProvider
+	if err := tx.Order("id").Find(&providers).Error; err != nil {
+		return nil, err
+	}
+	items := make([]*BundleOAuthProvider, 0, len(providers))
+	for _, provider := range providers {
+		items = append(items, &BundleOAuthProvider{CustomOAuthProvider: *provider, ClientSecret: provider.ClientSecret})
+	}
+	return items, nil
+}
+
+// stripConfigFields 删除记录中的运行时字段
+func stripConfigFields(fields map[string]any) {
+	for _, key := range configIgnoredFields {
+		delete(fields, key)
+	}
+}
+
+// MarshalConfigBundle 将配置包序列化为 json 或 yaml，去掉 id 与运行时字段
+func MarshalConfigBundle(bundle *ConfigBundle, format string) ([]byte, error) {
+	fields := toAuditMap(bundle)
+	for _, section := range ConfigSections {
+		records, ok := fields[section].([]any)
+		if !ok {
+			continue
+		}
+		for _, record := range records {
+			if item, ok := record.(map[string]any); ok {
+				stripConfigFields(item)
+			}
+		}
+	}
+	switch format {
+	case "", "yaml", "yml":
+		return yaml.Marshal(fields)
+	case "json":
+		return json.MarshalIndent(fields, "", "  ")
+	default:
+		return nil, fmt.Errorf("不支持的格式：%s", format)
+	}
+}
+
+// ParseConfigBundle 解析 json 或 yaml 格式的配置包
+func ParseConfigBundle(data []byte) (*ConfigBundle, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("配置包为空")
+	}
+	if data[0] != '{' {
+		var raw any
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("解析 yaml 失败：%w", err)
+		}
+		converted, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	}
+	var bundle ConfigBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("解析配置包失败：%w", err)
+	}
+	if bundle.Version <= 0 || bundle.Version > ConfigBundleVersion {
+		return nil, fmt.Errorf("不支持的配置包版本：%d", bundle.Version)
+	}
+	return &bundle, nil
+}
+
+// configDiff 对比两条记录，忽略运行时字段；配置包中未携带的密钥视为保持不变
+func configDiff(before any, after any) map[string]AuditChange {
+	beforeFields := toAuditMap(before)
+	afterFields := toAuditMap(after)
+	stripConfigFields(beforeFields)
+	stripConfigFields(afterFields)
+	for key, value := range afterFields {
+		if isAuditSecretField(key) && value == "" {
+			delete(beforeFields, key)
+			delete(afterFields, key)
+		}
+	}
+	return BuildAuditDiff(beforeFields, afterFields)
+}
+
+// configSection 按自然键同步一个分区的记录
+type configSection[T any] struct {
+	name   string
+	key    func(item T) string
+	create func(tx *gorm.DB, item T) error
+	update func(tx *gorm.DB, existing T, item T) error
+	// remove 替换模式下处理配置包中不存在的记录，removeAction 为 delete 或 disable
+	remove       func(tx *gorm.DB, existing T) error
+	removeAction string
+	// skipRemove 已处于删除或停用状态的记录无需再处理
+	skipRemove func(existing T) bool
+}
+
+func (s configSection[T]) apply(tx *gorm.DB, incoming []T, existing []T, replace bool) ([]ConfigChange, error) {
+	current := make(map[string]T, len(existing))
+	duplicated := make(map[string]bool)
+	for _, item := range existing {
+		name := s.key(item)
+		if _, ok := current[name]; ok {
+			duplicated[name] = true
+		}
+		current[name] = item
+	}
+	changes := make([]ConfigChange, 0)
+	seen := make(map[string]bool, len(incoming))
+	for _, item := range incoming {
+		name := s.key(item)
+		if name == "" {
+			return nil, fmt.Errorf("%s 中存在名称为空的记录", s.name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s 中存在重复的记录：%s", s.name, name)
+		}
+		seen[name] = true
+		if duplicated[name] {
+			return nil, fmt.Errorf("%s 中存在多个名为 %s 的记录，无法按名称匹配", s.name, name)
+		}
+		old, ok := current[name]
+		if !ok {
+			if err := s.create(tx, item); err != nil {
+				return nil, fmt.Errorf("%s 新增 %s 失败：%w", s.name, name, err)
+			}
+			changes = append(changes, ConfigChange{Section: s.name, Action: "create", Name: name, Diff: configDiff(nil, item)})
+			continue
+		}
+		item, err := mergeConfigRecord(old, item)
+		if err != nil {
+			return nil, fmt.Errorf("%s 解析 %s 失败：%w", s.name, name, err)
+		}
+		diff := configDiff(old, item)
+		if len(diff) == 0 {
+			continue
+		}
+		if err := s.update(tx, old, item); err != nil {
+			return nil, fmt.Errorf("%s 更新 %s 失败：%w", s.name, name, err)
+		}
+		changes = append(changes, ConfigChange{Section: s.name, Action: "update", Name: name, Diff: diff})
+	}
+	if !replace {
+		return changes, nil
+	}
+	for _, old := range existing {
+		name := s.key(old)
+		if seen[name] || (s.skipRemove != nil && s.skipRemove(old)) {
+			continue
+		}
+		if err := s.remove(tx, old); err != nil {
+			return nil, fmt.Errorf("%s 移除 %s 失败：%w", s.name, name, err)
+		}
+		changes = append(changes, ConfigChange{Section: s.name, Action: s.removeAction, Name: name})
+	}
+	return changes, nil
+}
+
+// mergeConfigRecord 以现有记录为基础覆盖配置包中的非空字段，未填写的可选字段保持不变
+func mergeConfigRecord[T any](existing T, item T) (T, error) {
+	var merged T
+	fields := toAuditMap(existing)
+	for key, value := range toAuditMap(item) {
+		if value != nil {
+			fields[key] = value
+		}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return merged, err
+	}
+	err = json.Unmarshal(data, &merged)
+	return merged, err
+}
+
+// createConfigRecord 新增记录后整体回写，避免带默认值的零值字段（如停用状态）在创建时被忽略
+func createConfigRecord(tx *gorm.DB, record any) error {
+	if err := tx.Create(record).Error; err != nil {
+		return err
+	}
+	return tx.Save(record).Error
+}
+
+// ImportConfigBundle 在单个事务中导入配置包，试运行时返回变更后回滚
+func ImportConfigBundle(bundle *ConfigBundle, opts ConfigImportOptions) (*ConfigImportResult, error) {
+	if opts.Mode == "" {
+		opts.Mode = ConfigImportMerge
+	}
+	if opts.Mode != ConfigImportMerge && opts.Mode != ConfigImportReplace {
+		return nil, fmt.Errorf("未知的导入模式：%s", opts.Mode)
+	}
+	if bundle.SecretMode == ConfigSecretEncrypted {
+		salt, err := base64.StdEncoding.DecodeString(bundle.SecretSalt)
+		if err != nil || len(salt) == 0 {
+			return nil, errors.New("配置包缺少有效的 secret_salt")
+		}
+		aead, err := newConfigCipher(opts.Passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+		err = bundle.transformSecrets(func(value string) (string, error) {
+			if value == "" {
+				return "", nil
+			}
+			return openConfigSecret(aead, value)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &ConfigImportResult{Mode: opts.Mode, DryRun: opts.DryRun, Changes: make([]ConfigChange, 0)}
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		changes, err := applyConfigBundle(tx, bundle, opts.Mode == ConfigImportReplace)
+		if err != nil {
+			return err
+		}
+		result.Changes = changes
+		if opts.DryRun {
+			return errConfigDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errConfigDryRun) {
+		return nil, err
+	}
+	if !opts.DryRun && len(result.Changes) > 0 {
+		refreshConfigCaches(result.Changes)
+	}
+	return result, nil
+}
+
+func applyConfigBundle(tx *gorm.DB, bundle *ConfigBundle, replace bool) ([]ConfigChange, error) {
+	changes := make([]ConfigChange, 0)
+	collect := func(items []ConfigChange, err error) error {
+		if err != nil {
+			return err
+		}
+		changes = append(changes, items...)
+		return nil
+	}
+	now := common.GetTimestamp()
+
+	if bundle.Vendors != nil {
+		var existing []*model.Vendor
+		if err := tx.Order("id").Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		section := configSection[*model.Vendor]{
+			name: ConfigSectionVendors,
+			key:  func(v *model.Vendor) string { return v.Name },
+			create: func(tx *gorm.DB, v *model.Vendor) error {
+				v.Id, v.CreatedTime, v.UpdatedTime = 0, now, now
+				return createConfigRecord(tx, v)
+			},
+			update: func(tx *gorm.DB, old *model.Vendor, v *model.Vendor) error {
+				v.Id, v.CreatedTime, v.UpdatedTime = old.Id, old.CreatedTime, now
+				return tx.Save(v).Error
+			},
+			remove:       func(tx *gorm.DB, old *model.Vendor) error { return tx.Delete(old).Error },
+			removeAction: "delete",
+		}
+		if err := collect(section.apply(tx, bundle.Vendors, existing, replace)); err != nil {
+			return nil, err
+		}
+	}
+
+	if bundle.Models != nil {
+		var vendors []*model.Vendor
+		if err := tx.Find(&vendors).Error; err != nil {
+			return nil, err
+		}
+		vendorNames := make(map[int]string, len(vendors))
+		vendorIds := make(map[string]int, len(vendors))
+		for _, vendor := range vendors {
+			vendorNames[vendor.Id] = vendor.Name
+			vendorIds[vendor.Name] = vendor.Id
+		}
+		resolveVendor := func(m *BundleModel) error {
+			m.VendorID = 0
+			if m.Vendor == "" {
+				return nil
+			}
+			id, ok := vendorIds[m.Vendor]
+			if !ok {
+				return fmt.Errorf("供应商 %s 不存在", m.Vendor)
+			}
+			m.VendorID = id
+			return nil
+		}
+		existing, err := loadBundleModels(tx, vendorNames)
+		if err != nil {
+			return nil, err
+		}
+		section := configSection[*BundleModel]{
+			name: ConfigSectionModels,
+			key:  func(m *BundleModel) string { return m.ModelName },
+			create: func(tx *gorm.DB, m *BundleModel) error {
+				if err := resolveVendor(m); err != nil {
+					return err
+				}
+				m.Id, m.CreatedTime, m.UpdatedTime = 0, now, now
+				return createConfigRecord(tx, &m.Model)
+			},
+			update: func(tx *gorm.DB, old *BundleModel, m *BundleModel) error {
+				if err := resolveVendor(m); err != nil {
+					return err
+				}
+				m.Id, m.CreatedTime, m.UpdatedTime = old.Id, old.CreatedTime, now
+				return tx.Save(&m.Model).Error
+			},
+			remove:       func(tx *gorm.DB, old *BundleModel) error { return tx.Delete(&old.Model).Error },
+			removeAction: "delete",
+		}
+		if err := collect(section.apply(tx, bundle.Models, existing, replace)); err != nil {
+			return nil, err
+		}
+	}
+
+	if bundle.PrefillGroups != nil {
+		var existing []*model.PrefillGroup
+		if err := tx.Order("id").Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		section := configSection[*model.PrefillGroup]{
+			name: ConfigSectionPrefillGroups,
+			key:  func(g *model.PrefillGroup) string { return g.Name },
+			create: func(tx *gorm.DB, g *model.PrefillGroup) error {
+				g.Id, g.CreatedTime, g.UpdatedTime = 0, now, now
+				return createConfigRecord(tx, g)
+			},
+			update: func(tx *gorm.DB, old *model.PrefillGroup, g *model.PrefillGroup) error {
+				g.Id, g.CreatedTime, g.UpdatedTime = old.Id, old.CreatedTime, now
+				return tx.Save(g).Error
+			},
+			remove:       func(tx *gorm.DB, old *model.PrefillGroup) error { return tx.Delete(old).Error },
+			removeAction: "delete",
+		}
+		if err := collect(section.apply(tx, bundle.PrefillGroups, existing, replace)); err != nil {
+			return nil, err
+		}
+	}
+
+	// 已售出的套餐仍被订阅引用，替换模式下只停用不删除
+	if bundle.SubscriptionPlans != nil {
+		var existing []*model.SubscriptionPlan
+		if err := tx.Order("id").Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		section := configSection[*model.SubscriptionPlan]{
+			name: ConfigSectionSubscriptionPlans,
+			key:  func(p *model.SubscriptionPlan) string { return p.Title },
+			create: func(tx *gorm.DB, p *model.SubscriptionPlan) error {
+				p.Id = 0
+				return createConfigRecord(tx, p)
+			},
+			update: func(tx *gorm.DB, old *model.SubscriptionPlan, p *model.SubscriptionPlan) error {
+				p.Id, p.CreatedAt = old.Id, old.CreatedAt
+				return tx.Save(p).Error
+			},
+			remove: func(tx *gorm.DB, old *model.SubscriptionPlan) error {
+				return tx.Model(old).Update("enabled", false).Error
+			},
+			removeAction: "disable",
+			skipRemove:   func(old *model.SubscriptionPlan) bool { return !old.Enabled },
+		}
+		if err := collect(section.apply(tx, bundle.SubscriptionPlans, existing, replace)); err != nil {
+			return nil, err
+		}
+	}
+
+	// 已有用户绑定的提供商替换模式下只停用不删除
+	if bundle.CustomOAuthProviders != nil {
+		existing, err := loadBundleOAuthProviders(tx)
+		if err != nil {
+			return nil, err
+		}
+		section := configSection[*BundleOAuthProvider]{
+			name: ConfigSectionCustomOAuthProviders,
+			key:  func(p *BundleOAuthProvider) string { return p.Slug },
+			create: func(tx *gorm.DB, p *BundleOAuthProvider) error {
+				if p.ClientSecret == "" {
+					return errors.New("缺少 client_secret")
+				}
+				p.Id = 0
+				p.CustomOAuthProvider.ClientSecret = p.ClientSecret
+				return createConfigRecord(tx, &p.CustomOAuthProvider)
+			},
+			update: func(tx *gorm.DB, old *BundleOAuthProvider, p *BundleOAuthProvider) error {
+				if p.ClientSecret == "" {
+					p.ClientSecret = old.ClientSecret
+				}
+				p.Id, p.CreatedAt = old.Id, old.CreatedAt
+				p.CustomOAuthProvider.ClientSecret = p.ClientSecret
+				return tx.Save(&p.CustomOAuthProvider).Error
+			},
+			remove: func(tx *gorm.DB, old *BundleOAuthProvider) error {
+				return tx.Model(&old.CustomOAuthProvider).Update("enabled", false).Error
+			},
+			removeAction: "disable",
+			skipRemove:   func(old *BundleOAuthProvider) bool { return !old.Enabled },
+		}
+		if err := collect(section.apply(tx, bundle.CustomOAuthProviders, existing, replace)); err != nil {
+			return nil, err
+		}
+	}
+
+	if bundle.Channels != nil {
+		var existing []*model.Channel
+		if err := tx.Order("id").Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		section := configSection[*model.Channel]{
+			name: ConfigSectionChannels,
+			key:  func(c *model.Channel) string { return c.Name },
+			create: func(tx *gorm.DB, c *model.Channel) error {
+				if c.Key == "" {
+					return errors.New("缺少渠道密钥")
+				}
+				c.Id, c.CreatedTime = 0, now
+				c.TestTime, c.ResponseTime, c.Balance, c.BalanceUpdatedTime, c.UsedQuota = 0, 0, 0, 0, 0
+				if err := createConfigRecord(tx, c); err != nil {
+					return err
+				}
+				return c.AddAbilities(tx)
+			},
+			update: func(tx *gorm.DB, old *model.Channel, c *model.Channel) error {
+				if c.Key == "" {
+					c.Key = old.Key
+				}
+				c.Id, c.CreatedTime = old.Id, old.CreatedTime
+				c.TestTime, c.ResponseTime = old.TestTime, old.ResponseTime
+				c.Balance, c.BalanceUpdatedTime, c.UsedQuota = old.Balance, old.BalanceUpdatedTime, old.UsedQuota
+				if err := tx.Save(c).Error; err != nil {
+					return err
+				}
+				return c.UpdateAbilities(tx)
+			},
+			remove: func(tx *gorm.DB, old *model.Channel) error {
+				if err := tx.Where("channel_id = ?", old.Id).Delete(&model.Ability{}).Error; err != nil {
+					return err
+				}
+				return tx.Delete(old).Error
+			},
+			removeAction: "delete",
+		}
+		if err := collect(section.apply(tx, bundle.Channels, existing, replace)); err != nil {
+			return nil, err
+		}
+	}
+
+	// 配置项始终按合并处理：未写入数据库的配置项使用默认值，删除记录并不能恢复默认值
+	if bundle.Options != nil {
+		if err := collect(applyConfigOptions(tx, bundle.Options)); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+func applyConfigOptions(tx *gorm.DB, options map[string]string) ([]ConfigChange, error) {
+	var existing []*model.Option
+	if err := tx.Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	current := make(map[string]string, len(existing))
+	for _, option := range existing {
+		current[option.Key] = option.Value
+	}
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// 与单项更新共用校验，试运行同样会校验全部选项
+	for _, key := range keys {
+		if err := ValidateOptionUpdate(key, options[key], options); err != nil {
+			return nil, fmt.Errorf("%s 校验 %s 失败：%w", ConfigSectionOptions, key, err)
+		}
+	}
+
+	changes := make([]ConfigChange, 0)
+	for _, key := range keys {
+		value := options[key]
+		old, ok := current[key]
+		if ok && old == value {
+			continue
+		}
+		if err := tx.Save(&model.Option{Key: key, Value: value}).Error; err != nil {
+			return nil, fmt.Errorf("%s 更新 %s 失败：%w", ConfigSectionOptions, key, err)
+		}
+		change := AuditChange{Before: old, After: value}
+		if model.IsSecretOption(key) {
+			change = AuditChange{Before: auditMask, After: auditMask}
+		}
+		action := "update"
+		if !ok {
+			action = "create"
+		}
+		changes = append(changes, ConfigChange{
+			Section: ConfigSectionOptions,
+			Action:  action,
+			Name:    key,
+			Diff:    map[string]AuditChange{"value": change},
+		})
+	}
+	return changes, nil
+}
+
+// refreshConfigCaches 导入提交后刷新受影响的内存缓存
+func refreshConfigCaches(changes []ConfigChange) {
+	sections := make(map[string]bool)
+	for _, change := range changes {
+		sections[change.Section] = true
+	}
+	if sections[ConfigSectionOptions] {
+		model.ReloadOptions()
+	}
+	if sections[ConfigSectionChannels] {
+		model.InitChannelCache()
+	}
+	if sections[ConfigSectionSubscriptionPlans] {
+		var plans []*model.SubscriptionPlan
+		if err := model.DB.Select("id").Find(&plans).Error; err == nil {
+			for _, plan := range plans {
+				model.InvalidateSubscriptionPlanCache(plan.Id)
+			}
+		}
+	}
+	if sections[ConfigSectionCustomOAuthProviders] {
+		if err := oauth.ReloadCustomProviders(); err != nil {
+			common.SysError("failed to reload custom oauth providers: " + err.Error())
+		}
+	}
+	if sections[ConfigSectionVendors] || sections[ConfigSectionModels] || sections[ConfigSectionChannels] || sections[ConfigSectionOptions] {
+		model.RefreshPricing()
+	}
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+func seedConfigBundle(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		for _, table := range []string{"channels", "abilities", "options", "vendors", "models"} {
+			model.DB.Exec("DELETE FROM " + table)
+		}
+	})
+	common.OptionMap = make(map[string]string)
+
+	vendor := &model.Vendor{Name: "OpenAI", Status: 1}
+	require.NoError(t, model.DB.Create(vendor).Error)
+	require.NoError(t, model.DB.Create(&model.Model{ModelName: "gpt-4o", VendorID: vendor.Id, Status: 1}).Error)
+	channel := &model.Channel{Name: "prod-openai", Key: "sk-prod", Models: "gpt-4o", Group: "default", Status: 1, UsedQuota: 500}
+	require.NoError(t, channel.Insert())
+	require.NoError(t, model.DB.Create(&model.Option{Key: "GroupRatio", Value: `{"default":1}`}).Error)
+	require.NoError(t, model.DB.Create(&model.Option{Key: "StripeApiSecret", Value: "stripe-secret"}).Error)
+}
+
+func exportConfigContent(t *testing.T, opts ConfigExportOptions, format string) string {
+	t.Helper()
+	bundle, err := ExportConfigBundle(opts)
+	require.NoError(t, err)
+	data, err := MarshalConfigBundle(bundle, format)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func importConfigContent(t *testing.T, content string, opts ConfigImportOptions) (*ConfigImportResult, error) {
+	t.Helper()
+	bundle, err := ParseConfigBundle([]byte(content))
+	require.NoError(t, err)
+	return ImportConfigBundle(bundle, opts)
+}
+
+func TestConfigBundleExportSecrets(t *testing.T) {
+	seedConfigBundle(t)
+
+	content := exportConfigContent(t, ConfigExportOptions{}, "yaml")
+	require.NotContains(t, content, "sk-prod")
+	require.NotContains(t, content, "stripe-secret")
+	require.NotContains(t, content, "used_quota")
+	require.Contains(t, content, "vendor: OpenAI")
+
+	content = exportConfigContent(t, ConfigExportOptions{SecretMode: ConfigSecretEncrypted, Passphrase: "pass"}, "json")
+	require.NotContains(t, content, "sk-prod")
+	require.Contains(t, content, configSecretPrefix)
+
+	_, err := importConfigContent(t, content, ConfigImportOptions{Passphrase: "wrong"})
+	require.Error(t, err)
+
+	// 同一环境导入自身的导出内容不应产生变更
+	result, err := importConfigContent(t, content, ConfigImportOptions{Passphrase: "pass"})
+	require.NoError(t, err)
+	require.Empty(t, result.Changes)
+}
+
+func TestConfigBundleImport(t *testing.T) {
+	seedConfigBundle(t)
+
+	content := exportConfigContent(t, ConfigExportOptions{Sections: []string{ConfigSectionChannels}}, "yaml")
+	bundle, err := ParseConfigBundle([]byte(content))
+	require.NoError(t, err)
+	bundle.Channels[0].Models = "gpt-4o,gpt-4o-mini"
+	bundle.Channels = append(bundle.Channels, &model.Channel{Name: "staging-openai", Key: "sk-staging", Models: "gpt-4o", Group: "default", Status: 1})
+	data, err := MarshalConfigBundle(bundle, "yaml")
+	require.NoError(t, err)
+	content = string(data)
+
+	result, err := importConfigContent(t, content, ConfigImportOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Len(t, result.Changes, 2)
+	require.Equal(t, "update", result.Changes[0].Action)
+	require.Contains(t, result.Changes[0].Diff, "models")
+	require.Equal(t, "create", result.Changes[1].Action)
+	require.Equal(t, "******", result.Changes[1].Diff["key"].After)
+
+	var count int64
+	model.DB.Model(&model.Channel{}).Count(&count)
+	require.EqualValues(t, 1, count, "试运行不写入数据库")
+
+	_, err = importConfigContent(t, content, ConfigImportOptions{})
+	require.NoError(t, err)
+	var prod model.Channel
+	require.NoError(t, model.DB.Where("name = ?", "prod-openai").First(&prod).Error)
+	require.Equal(t, "sk-prod", prod.Key, "未携带的密钥保持不变")
+	require.EqualValues(t, 500, prod.UsedQuota)
+	model.DB.Model(&model.Ability{}).Where("channel_id = ?", prod.Id).Count(&count)
+	require.EqualValues(t, 2, count)
+
+	// 替换模式删除配置包中不存在的渠道及其能力
+	content = `version: 1
+secret_mode: plain
+channels:
+  - name: staging-openai
+    key: sk-staging
+    models: gpt-4o
+    group: default
+    status: 1
+`
+	result, err = importConfigContent(t, content, ConfigImportOptions{Mode: ConfigImportReplace})
+	require.NoError(t, err)
+	require.Len(t, result.Changes, 1)
+	require.Equal(t, "delete", result.Changes[0].Action)
+	model.DB.Model(&model.Ability{}).Where("channel_id = ?", prod.Id).Count(&count)
+	require.EqualValues(t, 0, count)
+
+	_, err = importConfigContent(t, "version: 1\nchannels:\n  - name: no-key\n", ConfigImportOptions{})
+	require.Error(t, err)
+}
+
+func TestConfigBundleImportValidatesOptions(t *testing.T) {
+	seedConfigBundle(t)
+
+	// 试运行同样校验选项，非法值不会出现在变更中
+	_, err := importConfigContent(t, "version: 1\noptions:\n  invoice_setting.tax_rate: \"2\"\n", ConfigImportOptions{DryRun: true})
+	require.ErrorContains(t, err, "invoice_setting.tax_rate")
+
+	_, err = importConfigContent(t, "version: 1\noptions:\n  TurnstileCheckEnabled: \"true\"\n", ConfigImportOptions{})
+	require.Error(t, err)
+	var count int64
+	model.DB.Model(&model.Option{}).Where("key = ?", "TurnstileCheckEnabled").Count(&count)
+	require.Zero(t, count)
+
+	// 依赖的选项在同一个配置包中提供时允许启用
+	result, err := importConfigContent(t, "version: 1\noptions:\n  TurnstileCheckEnabled: \"true\"\n  TurnstileSiteKey: site\n", ConfigImportOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Len(t, result.Changes, 2)
+}
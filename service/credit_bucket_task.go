@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	creditBucketSweepTickInterval = 1 * time.Minute
+	creditBucketSweepBatchSize    = 200
+	// 扣除明细只用于请求退款与结算返还，保留 7 天足够
+	creditBucketUsageRetention = 7 * 24 * time.Hour
+)
+
+var (
+	creditBucketSweepOnce    sync.Once
+	creditBucketSweepRunning atomic.Bool
+	creditBucketSweepLast    atomic.Int64
+)
+
+func StartCreditBucketExpireTask() {
+	creditBucketSweepOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), "credit bucket expire task started")
+			ticker := time.NewTicker(creditBucketSweepTickInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				setting := operation_setting.GetCreditBucketSetting()
+				if !setting.Enabled || setting.SweepIntervalMinutes <= 0 {
+					continue
+				}
+				interval := time.Duration(setting.SweepIntervalMinutes) * time.Minute
+				if time.Since(time.Unix(creditBucketSweepLast.Load(), 0)) < interval {
+					continue
+				}
+				runCreditBucketSweep()
+			}
+		})
+	})
+}
+
+func runCreditBucketSweep() {
+	if !creditBucketSweepRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer creditBucketSweepRunning.Store(false)
+
+	now := common.GetTimestamp()
+	creditBucketSweepLast.Store(now)
+	total := 0
+	for {
+		n, err := model.ExpireCreditBuckets(now, creditBucketSweepBatchSize)
+		if err != nil {
+			common.SysError("credit bucket expire failed: " + err.Error())
+			break
+		}
+		total += n
+		if n < creditBucketSweepBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		common.SysLog(fmt.Sprintf("credit bucket expire: %d buckets expired", total))
+	}
+	if err := model.CleanupCreditBucketUsages(now - int64(creditBucketUsageRetention.Seconds())); err != nil {
+		common.SysError("credit bucket usage cleanup failed: " + err.Error())
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+var ErrDataResidencyConflict = errors.New("data residency policies of user, token, group and request have no region in common")
+
+// DataResidencyDecision 数据驻留策略的判定结果，记录在日志管理员信息中供审计
+type DataResidencyDecision struct {
+	// Regions 生效的允许区域，为各来源策略的交集
+	Regions []string `json:"regions"`
+	// Sources 各来源的策略：user、token、group:<分组>、request
+	Sources map[string][]string `json:"sources"`
+	// ChannelId 与 ChannelRegions 为最终选择的渠道及其区域标签
+	ChannelId      int      `json:"channel_id,omitempty"`
+	ChannelRegions []string `json:"channel_regions,omitempty"`
+}
+
+// intersectRegions 计算两组区域的交集，层级区域取更具体的一方，如 eu 与 eu-west-1 的交集为 eu-west-1
+func intersectRegions(a []string, b []string) []string {
+	result := make([]string, 0)
+	for _, x := range a {
+		for _, y := range b {
+			if model.RegionWithin(x, y) {
+				result = append(result, x)
+			} else if model.RegionWithin(y, x) {
+				result = append(result, y)
+			}
+		}
+	}
+	return lo.Uniq(result)
+}
+
+// ResolveDataResidency 合并用户、令牌、分组与请求头的驻留策略，未配置任何策略时返回 nil；
+// 各策略没有共同区域时返回 ErrDataResidencyConflict，请求应直接拒绝
+func ResolveDataResidency(c *gin.Context, usingGroup string) (*DataResidencyDecision, error) {
+	setting := operation_setting.GetDataResidencySetting()
+	sources := make(map[string][]string)
+	if regions := model.ParseRegions(common.GetContextKeyString(c, constant.ContextKeyUserDataResidency)); len(regions) > 0 {
+		sources["user"] = regions
+	}
+	if regions := model.ParseRegions(common.GetContextKeyString(c, constant.ContextKeyTokenDataResidency)); len(regions) > 0 {
+		sources["token"] = regions
+	}
+	// 自动分组按用户分组的策略判定
+	groups := []string{common.GetContextKeyString(c, constant.ContextKeyUserGroup)}
+	if usingGroup != "auto" {
+		groups = append(groups, usingGroup)
+	}
+	for _, group := range lo.Uniq(groups) {
+		if regions := model.NormalizeRegions(setting.GroupRegions[group]); len(regions) > 0 {
+			sources["group:"+group] = regions
+		}
+	}
+	if setting.HeaderName != "" {
+		if regions := model.ParseRegions(c.GetHeader(setting.HeaderName)); len(regions) > 0 {
+			sources["request"] = regions
+		}
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+	keys := lo.Keys(sources)
+	slices.Sort(keys)
+	var regions []string
+	for _, key := range keys {
+		if regions == nil {
+			regions = sources[key]
+			continue
+		}
+		regions = intersectRegions(regions, sources[key])
+	}
+	decision := &DataResidencyDecision{Regions: regions, Sources: sources}
+	if len(regions) == 0 {
+		return decision, ErrDataResidencyConflict
+	}
+	return decision, nil
+}
+
+// GetDataResidencyRegions 返回请求生效的允许区域，未配置策略时返回 nil
+func GetDataResidencyRegions(c *gin.Context) []string {
+	decision, ok := common.GetContextKeyType[*DataResidencyDecision](c, constant.ContextKeyDataResidency)
+	if !ok || decision == nil {
+		return nil
+	}
+	return decision.Regions
+}
+
+// MarkDataResidencyChannel 记录最终选择的渠道，重试时覆盖
+func MarkDataResidencyChannel(c *gin.Context, channel *model.Channel) {
+	decision, ok := common.GetContextKeyType[*DataResidencyDecision](c, constant.ContextKeyDataResidency)
+	if !ok || decision == nil || channel == nil {
+		return
+	}
+	decision.ChannelId = channel.Id
+	decision.ChannelRegions = channel.GetRegions()
+}
+
+func AppendDataResidencyAdminInfo(c *gin.Context, adminInfo map[string]interface{}) {
+	if c == nil || adminInfo == nil {
+		return
+	}
+	decision, ok := common.GetContextKeyType[*DataResidencyDecision](c, constant.ContextKeyDataResidency)
+	if !ok || decision == nil {
+		return
+	}
+	adminInfo["data_residency"] = decision
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveDataResidency(t *testing.T) {
+	setting := operation_setting.GetDataResidencySetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.GroupRegions = map[string][]string{"eu-customers": {"EU"}}
+
+	newContext := func(userRegions string, tokenRegions string, header string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		if header != "" {
+			c.Request.Header.Set(setting.HeaderName, header)
+		}
+		common.SetContextKey(c, constant.ContextKeyUserGroup, "eu-customers")
+		common.SetContextKey(c, constant.ContextKeyUserDataResidency, userRegions)
+		common.SetContextKey(c, constant.ContextKeyTokenDataResidency, tokenRegions)
+		return c
+	}
+
+	decision, err := ResolveDataResidency(newContext("", "", ""), "default")
+	require.NoError(t, err)
+	require.Equal(t, []string{"eu"}, decision.Regions)
+	require.Equal(t, map[string][]string{"group:eu-customers": {"eu"}}, decision.Sources)
+
+	// 令牌与请求头只能在分组策略的基础上收窄
+	decision, err = ResolveDataResidency(newContext("eu,us", "eu-west-1,eu-central-1", "eu-west-1"), "default")
+	require.NoError(t, err)
+	require.Equal(t, []string{"eu-west-1"}, decision.Regions)
+	require.Len(t, decision.Sources, 4)
+
+	decision, err = ResolveDataResidency(newContext("", "", "us"), "default")
+	require.ErrorIs(t, err, ErrDataResidencyConflict)
+	require.Empty(t, decision.Regions)
+
+	setting.GroupRegions = map[string][]string{}
+	decision, err = ResolveDataResidency(newContext("", "", ""), "default")
+	require.NoError(t, err)
+	require.Nil(t, decision)
+	require.Nil(t, GetDataResidencyRegions(newContext("", "", "")))
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NormalizeEndUserId 去除首尾空白，按配置对终端用户标识做哈希；未开启哈希时超长的标识同样哈希，
+// 避免如 Claude Code 的 metadata.user_id 等长标识导致请求失败
+func NormalizeEndUserId(raw string) string {
+	id := strings.TrimSpace(raw)
+	if id == "" {
+		return ""
+	}
+	setting := operation_setting.GetEndUserSetting()
+	if setting.HashIdentifiers || (setting.MaxLength > 0 && len(id) > setting.MaxLength) {
+		secret := setting.HashSecret
+		if secret == "" {
+			secret = common.CryptoSecret
+		}
+		return common.GenerateHMACWithKey([]byte(secret), id)
+	}
+	return id
+}
+
+// RecordEndUserUsage 结算后计入终端用户的 token 与额度消耗，令牌未配置终端用户限制时跳过
+func RecordEndUserUsage(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, tokens int, quota int) {
+	endUser := common.GetContextKeyString(ctx, constant.ContextKeyEndUser)
+	if endUser == "" {
+		return
+	}
+	limit, ok := common.GetContextKeyType[model.EndUserLimit](ctx, constant.ContextKeyTokenEndUserLimit)
+	if !ok || !limit.Enabled() {
+		return
+	}
+	model.RecordEndUserUsage(relayInfo.TokenId, endUser, tokens, quota)
+}
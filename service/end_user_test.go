@@ -0,0 +1,37 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeEndUserId(t *testing.T) {
+	setting := operation_setting.GetEndUserSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+
+	setting.HashIdentifiers = false
+	setting.MaxLength = 8
+	setting.HashSecret = "pepper"
+	require.Equal(t, "cust-1", NormalizeEndUserId("  cust-1 "))
+	// 超长标识哈希后记录而不是拒绝请求
+	long := NormalizeEndUserId(strings.Repeat("x", 9))
+	require.Len(t, long, 64)
+	require.Equal(t, long, NormalizeEndUserId(strings.Repeat("x", 9)))
+
+	// 哈希后不再记录原始标识，同一标识得到稳定结果，不受长度限制
+	setting.HashIdentifiers = true
+	hashed := NormalizeEndUserId("customer@example.com")
+	require.Len(t, hashed, 64)
+	require.NotContains(t, hashed, "customer")
+	again := NormalizeEndUserId("customer@example.com")
+	require.Equal(t, hashed, again)
+	setting.HashSecret = "other"
+	rotated := NormalizeEndUserId("customer@example.com")
+	require.NotEqual(t, hashed, rotated)
+
+	require.Empty(t, NormalizeEndUserId(""))
+}
@@ -27,8 +27,10 @@ type FundingSource interface {
 // ---------------------------------------------------------------------------
 
 type WalletFunding struct {
-	userId   int
-	consumed int // 实际预扣的用户额度
+	userId    int
+	requestId string
+	tokenId   int
+	consumed  int // 实际预扣的用户额度
 }
 
 func (w *WalletFunding) Source() string { return BillingSourceWallet }
@@ -37,7 +39,7 @@ func (w *WalletFunding) PreConsume(amount int) error {
 	if amount <= 0 {
 		return nil
 	}
-	if err := model.DecreaseUserQuota(w.userId, amount); err != nil {
+	if err := model.DecreaseUserQuota(w.userId, amount, w.ledgerMeta(model.QuotaLedgerTypePreConsume)); err != nil {
 		return err
 	}
 	w.consumed = amount
@@ -48,10 +50,7 @@ func (w *WalletFunding) Settle(delta int) error {
 	if delta == 0 {
 		return nil
 	}
-	if delta > 0 {
-		return model.DecreaseUserQuota(w.userId, delta)
-	}
-	return model.IncreaseUserQuota(w.userId, -delta, false)
+	return model.DeltaUpdateUserQuota(w.userId, -delta, w.ledgerMeta(model.QuotaLedgerTypeSettle))
 }
 
 func (w *WalletFunding) Refund() error {
@@ -60,7 +59,20 @@ func (w *WalletFunding) Refund() error {
 	}
 	// IncreaseUserQuota 是 quota += N 的非幂等操作，不能重试，否则会多退额度。
 	// 订阅的 RefundSubscriptionPreConsume 有 requestId 幂等保护所以可以重试。
-	return model.IncreaseUserQuota(w.userId, w.consumed, false)
+	return model.IncreaseUserQuota(w.userId, w.consumed, false, w.ledgerMeta(model.QuotaLedgerTypeRefund))
+}
+
+// ledgerMeta 同一请求的预扣、结算、退款各只入账一次
+func (w *WalletFunding) ledgerMeta(ledgerType string) model.QuotaLedgerMeta {
+	meta := model.QuotaLedgerMeta{
+		Type:      ledgerType,
+		RequestId: w.requestId,
+		TokenId:   w.tokenId,
+	}
+	if w.requestId != "" {
+		meta.IdempotencyKey = ledgerType + ":" + w.requestId
+	}
+	return meta
 }
 
 // ---------------------------------------------------------------------------
@@ -3,6 +3,7 @@ package service
 import (
 	"strings"
 
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 )
@@ -36,6 +37,17 @@ func GetUserUsableGroups(userGroup string) map[string]string {
 	return groupsCopy
 }
 
+// GetUserUsableGroupsWithSetting 在分组可用分组基础上加入用户设置中由身份映射授予的额外分组
+func GetUserUsableGroupsWithSetting(userGroup string, userSetting dto.UserSetting) map[string]string {
+	groupsCopy := GetUserUsableGroups(userGroup)
+	for _, group := range userSetting.ExtraUsableGroups {
+		if _, ok := groupsCopy[group]; !ok {
+			groupsCopy[group] = setting.GetUsableGroupDescription(group)
+		}
+	}
+	return groupsCopy
+}
+
 func GroupInUserUsableGroups(userGroup, groupName string) bool {
 	_, ok := GetUserUsableGroups(userGroup)[groupName]
 	return ok
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// IdentityMappingState 受身份映射控制的用户属性，用于审计前后对比
+type IdentityMappingState struct {
+	Group        string   `json:"group"`
+	Role         int      `json:"role"`
+	Roles        []string `json:"roles"`
+	UsableGroups []string `json:"usable_groups"`
+}
+
+// resolveMappedRoles 将映射中的角色名称拆分为内置角色等级与自定义角色 ID，不存在的自定义角色忽略
+func resolveMappedRoles(names []string) (int, []int, error) {
+	role := common.RoleCommonUser
+	roleNames := make([]string, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case constant.BuiltInRoleAdmin:
+			role = common.RoleAdminUser
+		case constant.BuiltInRoleCommon, constant.BuiltInRoleRoot:
+		default:
+			roleNames = append(roleNames, name)
+		}
+	}
+	roleIds, err := model.GetRoleIdsByNames(roleNames)
+	return role, roleIds, err
+}
+
+func getIdentityMappingState(user *model.User) (*IdentityMappingState, error) {
+	roles, err := model.GetUserRoles(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	state := &IdentityMappingState{
+		Group:        user.Group,
+		Role:         user.Role,
+		Roles:        make([]string, 0, len(roles)),
+		UsableGroups: slices.Clone(user.GetSetting().ExtraUsableGroups),
+	}
+	for _, role := range roles {
+		state.Roles = append(state.Roles, role.Name)
+	}
+	return state, nil
+}
+
+// ApplyIdentityMapping 将身份提供方的映射结果同步到用户，返回同步前后的状态供审计记录
+func ApplyIdentityMapping(user *model.User, mapping *dto.IdentityMapping) (*IdentityMappingState, *IdentityMappingState, error) {
+	before, err := getIdentityMappingState(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mapping.SyncRoles {
+		role, roleIds, err := resolveMappedRoles(mapping.Roles)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := model.ApplyUserMapping(user, mapping.Group, role, roleIds); err != nil {
+			return nil, nil, err
+		}
+	} else if err := model.UpdateUserGroup(user, mapping.Group); err != nil {
+		return nil, nil, err
+	}
+	if mapping.SyncUsableGroups {
+		if err := model.UpdateUserExtraUsableGroups(user, mapping.UsableGroups); err != nil {
+			return nil, nil, err
+		}
+	}
+	after, err := getIdentityMappingState(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
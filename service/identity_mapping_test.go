@@ -0,0 +1,56 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyIdentityMapping(t *testing.T) {
+	t.Cleanup(func() {
+		for _, table := range []string{"users", "roles", "user_roles"} {
+			model.DB.Exec("DELETE FROM " + table)
+		}
+	})
+	role := &model.Role{Name: "auditor", Permissions: "user.read"}
+	require.NoError(t, role.Insert())
+	user := &model.User{Username: "oidc_alice", Password: "password123", Group: "default", Role: common.RoleCommonUser, Status: common.UserStatusEnabled}
+	require.NoError(t, model.DB.Create(user).Error)
+
+	before, after, err := ApplyIdentityMapping(user, &dto.IdentityMapping{
+		Group:            "vip",
+		Roles:            []string{"admin", "auditor", "missing"},
+		UsableGroups:     []string{"gpu-batch"},
+		SyncRoles:        true,
+		SyncUsableGroups: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "default", before.Group)
+	require.Empty(t, before.Roles)
+	require.Equal(t, "vip", after.Group)
+	require.Equal(t, common.RoleAdminUser, after.Role)
+	require.Equal(t, []string{"auditor"}, after.Roles)
+	require.Equal(t, []string{"gpu-batch"}, after.UsableGroups)
+
+	stored, err := model.GetUserById(user.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, "vip", stored.Group)
+	require.Equal(t, []string{"gpu-batch"}, stored.GetSetting().ExtraUsableGroups)
+	require.Contains(t, GetUserUsableGroupsWithSetting(stored.Group, stored.GetSetting()), "gpu-batch")
+
+	// 身份提供方移除授权后，下一次登录撤销角色与额外分组；未同步角色时保持原有角色
+	_, after, err = ApplyIdentityMapping(stored, &dto.IdentityMapping{Group: "default", SyncRoles: true, SyncUsableGroups: true})
+	require.NoError(t, err)
+	require.Equal(t, "default", after.Group)
+	require.Equal(t, common.RoleCommonUser, after.Role)
+	require.Empty(t, after.Roles)
+	require.Empty(t, after.UsableGroups)
+
+	_, after, err = ApplyIdentityMapping(stored, &dto.IdentityMapping{Group: "vip"})
+	require.NoError(t, err)
+	require.Equal(t, "vip", after.Group)
+	require.Equal(t, common.RoleCommonUser, after.Role)
+}
@@ -0,0 +1,328 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const statementMonthLayout = "2006-01"
+
+// StatementPayment 账单中的一笔充值或订阅支付
+type StatementPayment struct {
+	TradeNo       string  `json:"trade_no"`
+	Description   string  `json:"description"`
+	PaymentMethod string  `json:"payment_method"`
+	Money         float64 `json:"money"`
+	CompleteTime  int64   `json:"complete_time"`
+}
+
+// MonthlyStatement 用户月度账单
+type MonthlyStatement struct {
+	UserId        int                         `json:"user_id"`
+	Username      string                      `json:"username"`
+	Month         string                      `json:"month"`
+	PeriodStart   int64                       `json:"period_start"`
+	PeriodEnd     int64                       `json:"period_end"`
+	Usage         []model.StatementModelUsage `json:"usage"`
+	TotalRequests int64                       `json:"total_requests"`
+	TotalQuota    int64                       `json:"total_quota"`
+	TopUps        []StatementPayment          `json:"topups"`
+	Subscriptions []StatementPayment          `json:"subscriptions"`
+	Redemptions   []model.StatementRedemption `json:"redemptions"`
+	TotalPaid     float64                     `json:"total_paid"`
+	Currency      string                      `json:"currency"`
+	GeneratedAt   int64                       `json:"generated_at"`
+}
+
+// ParseStatementMonth 解析 YYYY-MM，返回该月 [start, end) 的时间戳，为空时取上个月
+func ParseStatementMonth(month string) (string, int64, int64, error) {
+	if month == "" {
+		now := time.Now()
+		month = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, -1, 0).Format(statementMonthLayout)
+	}
+	start, err := time.ParseInLocation(statementMonthLayout, month, time.Local)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid month %q, expected YYYY-MM", month)
+	}
+	return month, start.Unix(), start.AddDate(0, 1, 0).Unix(), nil
+}
+
+// BuildMonthlyStatement 汇总用户当月的模型用量、充值、兑换码与订阅支付
+func BuildMonthlyStatement(userId int, month string) (*MonthlyStatement, error) {
+	month, start, end, err := ParseStatementMonth(month)
+	if err != nil {
+		return nil, err
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return nil, err
+	}
+	statement := &MonthlyStatement{
+		UserId:      userId,
+		Username:    user.Username,
+		Month:       month,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Currency:    operation_setting.GetInvoiceSetting().Currency,
+		GeneratedAt: common.GetTimestamp(),
+	}
+
+	if statement.Usage, err = model.GetUserModelUsage(userId, start, end); err != nil {
+		return nil, err
+	}
+	for _, usage := range statement.Usage {
+		statement.TotalRequests += usage.Requests
+		statement.TotalQuota += usage.Quota
+	}
+
+	orders, err := model.GetUserSuccessfulSubscriptionOrders(userId, start, end)
+	if err != nil {
+		return nil, err
+	}
+	subscriptionTradeNos := make(map[string]struct{}, len(orders))
+	for _, order := range orders {
+		subscriptionTradeNos[order.TradeNo] = struct{}{}
+		description := "订阅套餐"
+		if plan, err := model.GetSubscriptionPlanById(order.PlanId); err == nil && plan.Title != "" {
+			description = "订阅套餐: " + plan.Title
+		}
+		statement.Subscriptions = append(statement.Subscriptions, StatementPayment{
+			TradeNo:       order.TradeNo,
+			Description:   description,
+			PaymentMethod: order.PaymentMethod,
+			Money:         order.Money,
+			CompleteTime:  order.CompleteTime,
+		})
+		statement.TotalPaid += order.Money
+	}
+
+	// 订阅订单同时会写入一条充值记录，这里跳过避免重复计算
+	topUps, err := model.GetUserSuccessfulTopUps(userId, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, topUp := range topUps {
+		if _, ok := subscriptionTradeNos[topUp.TradeNo]; ok {
+			continue
+		}
+		statement.TopUps = append(statement.TopUps, StatementPayment{
+			TradeNo:       topUp.TradeNo,
+			Description:   "额度充值",
+			PaymentMethod: topUp.PaymentMethod,
+			Money:         topUp.Money,
+			CompleteTime:  topUp.CompleteTime,
+		})
+		statement.TotalPaid += topUp.Money
+	}
+
+	if statement.Redemptions, err = model.GetUserRedemptionsBetween(userId, start, end); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+var documentFuncs = template.FuncMap{
+	"date": func(ts int64) string {
+		if ts == 0 {
+			return "-"
+		}
+		return time.Unix(ts, 0).Format("2006-01-02 15:04")
+	},
+	"money": func(v float64) string {
+		return fmt.Sprintf("%.2f", v)
+	},
+	"quota": func(v int64) string {
+		return logger.FormatQuota(int(v))
+	},
+	"percent": func(v float64) string {
+		return fmt.Sprintf("%.2f%%", v*100)
+	},
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(documentFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Invoice {{.Invoice.InvoiceNo}}</title>
+<style>body{font-family:sans-serif;max-width:720px;margin:32px auto;color:#222}table{width:100%;border-collapse:collapse}td,th{padding:6px 8px;border-bottom:1px solid #ddd;text-align:left}.right{text-align:right}.void{color:#c00;font-weight:bold}</style>
+</head><body>
+<h1>INVOICE {{.Invoice.InvoiceNo}}</h1>
+{{if eq .Invoice.Status "void"}}<p class="void">VOID{{if .Invoice.VoidReason}}: {{.Invoice.VoidReason}}{{end}}</p>{{end}}
+<table>
+<tr><td><strong>{{.Seller.Name}}</strong><br>{{.Seller.Address}}{{if .Seller.TaxId}}<br>Tax ID: {{.Seller.TaxId}}{{end}}{{if .Seller.Email}}<br>{{.Seller.Email}}{{end}}</td>
+<td class="right">Issued: {{date .Invoice.IssuedAt}}<br>Paid: {{date .Invoice.PaidAt}}<br>Payment: {{.Invoice.PaymentMethod}}<br>Reference: {{.Invoice.TradeNo}}</td></tr>
+</table>
+<p>Bill to: {{.Username}}{{if .Email}} &lt;{{.Email}}&gt;{{end}}</p>
+<table>
+<tr><th>Description</th><th class="right">Amount ({{.Invoice.Currency}})</th></tr>
+<tr><td>{{.Invoice.Description}}</td><td class="right">{{money .Invoice.Subtotal}}</td></tr>
+{{if gt .Invoice.TaxRate 0.0}}<tr><td>{{.Invoice.TaxName}} ({{percent .Invoice.TaxRate}})</td><td class="right">{{money .Invoice.TaxAmount}}</td></tr>{{end}}
+<tr><th>Total</th><th class="right">{{money .Invoice.Total}}</th></tr>
+</table>
+{{if .Seller.Footer}}<p>{{.Seller.Footer}}</p>{{end}}
+</body></html>`))
+
+var statementTemplate = template.Must(template.New("statement").Funcs(documentFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Statement {{.Statement.Month}}</title>
+<style>body{font-family:sans-serif;max-width:720px;margin:32px auto;color:#222}table{width:100%;border-collapse:collapse;margin-bottom:24px}td,th{padding:6px 8px;border-bottom:1px solid #ddd;text-align:left}.right{text-align:right}</style>
+</head><body>
+<h1>{{.SystemName}} 月度账单 {{.Statement.Month}}</h1>
+<p>{{.Seller.Name}}{{if .Seller.TaxId}} · Tax ID: {{.Seller.TaxId}}{{end}}</p>
+<p>用户: {{.Statement.Username}} (ID {{.Statement.UserId}})<br>账期: {{date .Statement.PeriodStart}} ~ {{date .Statement.PeriodEnd}}</p>
+<h2>模型用量</h2>
+<table>
+<tr><th>模型</th><th class="right">请求数</th><th class="right">输入 tokens</th><th class="right">输出 tokens</th><th class="right">消费</th></tr>
+{{range .Statement.Usage}}<tr><td>{{.ModelName}}</td><td class="right">{{.Requests}}</td><td class="right">{{.PromptTokens}}</td><td class="right">{{.CompletionTokens}}</td><td class="right">{{quota .Quota}}</td></tr>
+{{else}}<tr><td colspan="5">无</td></tr>{{end}}
+<tr><th>合计</th><th class="right">{{.Statement.TotalRequests}}</th><th></th><th></th><th class="right">{{quota .Statement.TotalQuota}}</th></tr>
+</table>
+<h2>充值</h2>
+<table>
+<tr><th>时间</th><th>订单号</th><th>支付方式</th><th class="right">金额 ({{.Statement.Currency}})</th></tr>
+{{range .Statement.TopUps}}<tr><td>{{date .CompleteTime}}</td><td>{{.TradeNo}}</td><td>{{.PaymentMethod}}</td><td class="right">{{money .Money}}</td></tr>
+{{else}}<tr><td colspan="4">无</td></tr>{{end}}
+</table>
+<h2>订阅</h2>
+<table>
+<tr><th>时间</th><th>套餐</th><th>支付方式</th><th class="right">金额 ({{.Statement.Currency}})</th></tr>
+{{range .Statement.Subscriptions}}<tr><td>{{date .CompleteTime}}</td><td>{{.Description}}</td><td>{{.PaymentMethod}}</td><td class="right">{{money .Money}}</td></tr>
+{{else}}<tr><td colspan="4">无</td></tr>{{end}}
+</table>
+<h2>兑换码</h2>
+<table>
+<tr><th>时间</th><th>名称</th><th class="right">额度</th></tr>
+{{range .Statement.Redemptions}}<tr><td>{{date .RedeemedTime}}</td><td>{{.Name}}</td><td class="right">{{quota .Quota}}</td></tr>
+{{else}}<tr><td colspan="3">无</td></tr>{{end}}
+</table>
+<p><strong>本月支付合计: {{money .Statement.TotalPaid}} {{.Statement.Currency}}</strong></p>
+{{if .Seller.Footer}}<p>{{.Seller.Footer}}</p>{{end}}
+</body></html>`))
+
+// RenderInvoiceHTML 渲染发票 HTML，开票方信息取开具时的快照
+func RenderInvoiceHTML(inv *model.Invoice) ([]byte, error) {
+	user, err := model.GetUserById(inv.UserId, false)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = invoiceTemplate.Execute(&buf, map[string]interface{}{
+		"Invoice":  inv,
+		"Seller":   inv.GetSeller(),
+		"Username": user.Username,
+		"Email":    user.Email,
+	})
+	return buf.Bytes(), err
+}
+
+// RenderStatementHTML 渲染月度账单 HTML，开票方信息取当前设置
+func RenderStatementHTML(statement *MonthlyStatement) ([]byte, error) {
+	setting := operation_setting.GetInvoiceSetting()
+	var buf bytes.Buffer
+	err := statementTemplate.Execute(&buf, map[string]interface{}{
+		"Statement":  statement,
+		"SystemName": common.SystemName,
+		"Seller": model.InvoiceSeller{
+			Name:   setting.CompanyName,
+			TaxId:  setting.CompanyTaxId,
+			Footer: setting.Footer,
+		},
+	})
+	return buf.Bytes(), err
+}
+
+// SendMonthlyStatement 生成并发送用户月度账单邮件
+func SendMonthlyStatement(userId int, month string) error {
+	email, err := model.GetUserEmail(userId)
+	if err != nil {
+		return err
+	}
+	if email == "" {
+		return errors.New("用户未绑定邮箱")
+	}
+	statement, err := BuildMonthlyStatement(userId, month)
+	if err != nil {
+		return err
+	}
+	content, err := RenderStatementHTML(statement)
+	if err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("%s %s 月度账单", common.SystemName, statement.Month)
+	return common.SendEmail(subject, email, string(content))
+}
+
+const monthlyStatementTickInterval = 1 * time.Hour
+
+var (
+	monthlyStatementOnce    sync.Once
+	monthlyStatementRunning atomic.Bool
+)
+
+// StartMonthlyStatementTask 每月初向上月有消费或充值的用户发送账单
+func StartMonthlyStatementTask() {
+	monthlyStatementOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("monthly statement task started: tick=%s", monthlyStatementTickInterval))
+			ticker := time.NewTicker(monthlyStatementTickInterval)
+			defer ticker.Stop()
+
+			runMonthlyStatementOnce()
+			for range ticker.C {
+				runMonthlyStatementOnce()
+			}
+		})
+	})
+}
+
+func runMonthlyStatementOnce() {
+	setting := operation_setting.GetInvoiceSetting()
+	if !setting.StatementEmailEnabled {
+		return
+	}
+	if !monthlyStatementRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer monthlyStatementRunning.Store(false)
+
+	month, start, end, err := ParseStatementMonth("")
+	if err != nil || setting.LastStatementMonth == month {
+		return
+	}
+	ctx := context.Background()
+	userIds, err := model.GetStatementUserIds(start, end)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("monthly statement task failed: %v", err))
+		return
+	}
+	// 先记录月份，避免发送中途重启导致重复发送
+	if err := model.UpdateOption("invoice_setting.last_statement_month", month); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("monthly statement task failed to save progress: %v", err))
+		return
+	}
+	sent := 0
+	for _, userId := range userIds {
+		email, err := model.GetUserEmail(userId)
+		if err != nil || email == "" {
+			continue
+		}
+		if err := SendMonthlyStatement(userId, month); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to send monthly statement to user %d: %v", userId, err))
+			continue
+		}
+		sent++
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("monthly statements for %s sent: %d/%d", month, sent, len(userIds)))
+}
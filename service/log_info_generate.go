@@ -7,6 +7,7 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -50,6 +51,10 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
 
+	if waitMs := common.GetContextKeyInt(ctx, constant.ContextKeyAdmissionWaitMs); waitMs > 0 {
+		other["admission_wait_ms"] = waitMs
+	}
+
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
 		other["is_system_prompt_overwritten"] = true
@@ -69,6 +74,7 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	}
 
 	AppendChannelAffinityAdminInfo(ctx, adminInfo)
+	AppendDataResidencyAdminInfo(ctx, adminInfo)
 
 	other["admin_info"] = adminInfo
 	appendRequestPath(ctx, relayInfo, other)
@@ -76,9 +82,91 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	appendFinalRequestFormat(relayInfo, other)
 	appendBillingInfo(relayInfo, other)
 	appendParamOverrideInfo(relayInfo, other)
+	appendPromptCacheInfo(relayInfo, other)
+	appendStructuredOutputInfo(relayInfo, other)
+	appendModelFallbackInfo(relayInfo, other)
+	appendVirtualModelInfo(relayInfo, other)
+	appendPricingTierInfo(relayInfo, other)
+	appendGroupPricingRuleInfo(relayInfo, other)
 	return other
 }
 
+func appendGroupPricingRuleInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || len(relayInfo.PriceData.GroupPricingRules) == 0 {
+		return
+	}
+	other["group_pricing_rule"] = map[string]interface{}{
+		"ratio": relayInfo.PriceData.OtherRatios[ratio_setting.GroupPricingRuleRatioKey],
+		"rules": relayInfo.PriceData.GroupPricingRules,
+	}
+}
+
+func appendPricingTierInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || relayInfo.PriceData.PricingTier == nil {
+		return
+	}
+	other["pricing_tier"] = map[string]interface{}{
+		"threshold":        relayInfo.PriceData.PricingTier.Threshold,
+		"model_ratio":      relayInfo.PriceData.ModelRatio,
+		"completion_ratio": relayInfo.PriceData.CompletionRatio,
+	}
+}
+
+func appendVirtualModelInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || relayInfo.VirtualModelName == "" {
+		return
+	}
+	virtualModel := map[string]interface{}{
+		"name":           relayInfo.VirtualModelName,
+		"resolved_model": relayInfo.OriginModelName,
+	}
+	if relayInfo.VirtualModelRule != "" {
+		virtualModel["rule"] = relayInfo.VirtualModelRule
+	}
+	other["virtual_model"] = virtualModel
+}
+
+func appendModelFallbackInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || relayInfo.RequestedModelName == "" || relayInfo.RequestedModelName == relayInfo.OriginModelName {
+		return
+	}
+	other["model_fallback"] = map[string]interface{}{
+		"requested_model": relayInfo.RequestedModelName,
+		"served_model":    relayInfo.OriginModelName,
+	}
+}
+
+func appendStructuredOutputInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || relayInfo.StructuredOutput == nil {
+		return
+	}
+	result := relayInfo.StructuredOutput
+	info := map[string]interface{}{
+		"attempts": result.Attempts,
+		"valid":    result.Valid,
+		"mode":     result.Mode,
+	}
+	if len(result.Errors) > 0 {
+		info["errors"] = result.Errors
+	}
+	if result.StrictRejected {
+		info["strict_rejected"] = true
+	}
+	other["structured_output"] = info
+}
+
+func appendPromptCacheInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || relayInfo.PromptCacheBreakpoints == 0 {
+		return
+	}
+	// prompt_cache_auto: cache_control breakpoints injected by the gateway; cache read/write
+	// tokens are recorded in cache_tokens / cache_creation_tokens as usual.
+	other["prompt_cache_auto"] = map[string]interface{}{
+		"breakpoints": relayInfo.PromptCacheBreakpoints,
+		"ttl":         relayInfo.PromptCacheTTL,
+	}
+}
+
 func appendParamOverrideInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
 	if relayInfo == nil || other == nil || len(relayInfo.ParamOverrideAudit) == 0 {
 		return
@@ -158,6 +246,8 @@ func appendRequestConversionChain(relayInfo *relaycommon.RelayInfo, other map[st
 			chain = append(chain, "Google Gemini")
 		case types.RelayFormatOpenAIResponses:
 			chain = append(chain, "OpenAI Responses")
+		case types.RelayFormatOpenAIEmulatedTools:
+			chain = append(chain, "Emulated Tools")
 		default:
 			chain = append(chain, string(f))
 		}
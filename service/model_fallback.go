@@ -0,0 +1,85 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServedModelHeader 发生模型回退时返回实际服务的模型
+const ServedModelHeader = "X-New-Api-Served-Model"
+
+// IsModelAllowedForToken 检查令牌的模型限制是否允许该模型
+func IsModelAllowedForToken(c *gin.Context, modelName string) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	tokenModelLimit, ok := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+	if !ok {
+		return false
+	}
+	_, ok = tokenModelLimit[ratio_setting.FormatMatchingModelName(modelName)]
+	return ok
+}
+
+// InitModelFallbackChain 根据客户端 models 字段与分组回退链构造备选模型列表并保存到上下文。
+// 客户端指定的模型优先，其后为管理员配置的分组回退链；令牌不允许的模型会被跳过。
+func InitModelFallbackChain(c *gin.Context, group string, requestedModel string, clientModels []string) []string {
+	settings := model_setting.GetModelFallbackSettings()
+	if !settings.Enabled || requestedModel == "" {
+		return nil
+	}
+	candidates := make([]string, 0, len(clientModels))
+	if settings.AllowClientModels {
+		candidates = append(candidates, clientModels...)
+	}
+	candidates = append(candidates, settings.GetGroupChain(group, requestedModel)...)
+
+	maxHops := settings.GetMaxHops()
+	seen := map[string]struct{}{requestedModel: {}}
+	chain := make([]string, 0, maxHops)
+	for _, candidate := range candidates {
+		if len(chain) >= maxHops {
+			break
+		}
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "" {
+			continue
+		}
+		if _, ok := seen[candidate]; ok {
+			continue
+		}
+		seen[candidate] = struct{}{}
+		if !IsModelAllowedForToken(c, candidate) {
+			continue
+		}
+		chain = append(chain, candidate)
+	}
+	if len(chain) > 0 {
+		common.SetContextKey(c, constant.ContextKeyModelFallbackChain, chain)
+	}
+	return chain
+}
+
+// NextModelFallback 取出下一个备选模型
+func NextModelFallback(c *gin.Context) (string, bool) {
+	chain := common.GetContextKeyStringSlice(c, constant.ContextKeyModelFallbackChain)
+	if len(chain) == 0 {
+		return "", false
+	}
+	common.SetContextKey(c, constant.ContextKeyModelFallbackChain, chain[1:])
+	return chain[0], true
+}
+
+// MarkModelFallback 记录客户端最初请求的模型，并通过响应头返回实际服务的模型
+func MarkModelFallback(c *gin.Context, requestedModel string, servedModel string) {
+	if common.GetContextKeyString(c, constant.ContextKeyRequestedModel) == "" {
+		common.SetContextKey(c, constant.ContextKeyRequestedModel, requestedModel)
+	}
+	c.Header(ServedModelHeader, servedModel)
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitModelFallbackChain(t *testing.T) {
+	settings := model_setting.GetModelFallbackSettings()
+	original := *settings
+	t.Cleanup(func() { *settings = original })
+	settings.Enabled = true
+	settings.AllowClientModels = true
+	settings.MaxHops = 3
+	settings.GroupChains = map[string]map[string][]string{
+		"vip": {"claude-sonnet": {"claude-haiku", "gpt-4o"}},
+		"*":   {"claude-sonnet": {"gpt-4o-mini"}},
+	}
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	common.SetContextKey(ctx, constant.ContextKeyTokenModelLimitEnabled, true)
+	common.SetContextKey(ctx, constant.ContextKeyTokenModelLimit, map[string]bool{
+		"claude-sonnet": true, "claude-haiku": true, "gpt-4o": true, "o3": true,
+	})
+
+	chain := InitModelFallbackChain(ctx, "vip", "claude-sonnet", []string{"o3", "claude-sonnet", "forbidden-model", "claude-haiku"})
+	require.Equal(t, []string{"o3", "claude-haiku", "gpt-4o"}, chain)
+
+	next, ok := NextModelFallback(ctx)
+	require.True(t, ok)
+	require.Equal(t, "o3", next)
+	require.Equal(t, []string{"claude-haiku", "gpt-4o"}, common.GetContextKeyStringSlice(ctx, constant.ContextKeyModelFallbackChain))
+
+	MarkModelFallback(ctx, "claude-sonnet", next)
+	MarkModelFallback(ctx, "o3", "claude-haiku")
+	require.Equal(t, "claude-sonnet", common.GetContextKeyString(ctx, constant.ContextKeyRequestedModel))
+	require.Equal(t, "claude-haiku", ctx.Writer.Header().Get(ServedModelHeader))
+}
+
+func TestInitModelFallbackChainDisabled(t *testing.T) {
+	settings := model_setting.GetModelFallbackSettings()
+	original := *settings
+	t.Cleanup(func() { *settings = original })
+	settings.Enabled = false
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	require.Empty(t, InitModelFallbackChain(ctx, "default", "gpt-4o", []string{"gpt-4o-mini"}))
+	_, ok := NextModelFallback(ctx)
+	require.False(t, ok)
+}
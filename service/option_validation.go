@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/console_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// optionValue 依赖其他选项的校验优先使用同批提交的值，其次使用当前值
+func optionValue(pending map[string]string, key string, current string) string {
+	if value, ok := pending[key]; ok {
+		return value
+	}
+	return current
+}
+
+// ValidateOptionUpdate 校验选项的新值，单项更新与配置导入共用；pending 为同批提交的全部选项，单项更新时为 nil
+func ValidateOptionUpdate(key string, value string, pending map[string]string) error {
+	switch key {
+	case "GitHubOAuthEnabled":
+		if value == "true" && optionValue(pending, "GitHubClientId", common.GitHubClientId) == "" {
+			return errors.New("无法启用 GitHub OAuth，请先填入 GitHub Client Id 以及 GitHub Client Secret！")
+		}
+	case "discord.enabled":
+		if value == "true" && optionValue(pending, "discord.client_id", system_setting.GetDiscordSettings().ClientId) == "" {
+			return errors.New("无法启用 Discord OAuth，请先填入 Discord Client Id 以及 Discord Client Secret！")
+		}
+	case "oidc.enabled":
+		if value == "true" && optionValue(pending, "oidc.client_id", system_setting.GetOIDCSettings().ClientId) == "" {
+			return errors.New("无法启用 OIDC 登录，请先填入 OIDC Client Id 以及 OIDC Client Secret！")
+		}
+	case "oidc.claim_mappings":
+		if err := model.ValidateClaimMappings(value); err != nil {
+			return errors.New("OIDC 声明映射设置失败: " + err.Error())
+		}
+	case "ldap.enabled":
+		settings := system_setting.GetLDAPSettings()
+		if value == "true" && (optionValue(pending, "ldap.server_url", settings.ServerURL) == "" || optionValue(pending, "ldap.search_base", settings.SearchBase) == "") {
+			return errors.New("无法启用 LDAP 登录，请先填入 LDAP 服务器地址以及搜索基准 DN！")
+		}
+	case "ldap.server_url", "ldap.search_filter", "ldap.access_policy", "ldap.group_mappings":
+		if err := oauth.ValidateLDAPOption(strings.TrimPrefix(key, "ldap."), value); err != nil {
+			return errors.New("LDAP 设置失败: " + err.Error())
+		}
+	case "LinuxDOOAuthEnabled":
+		if value == "true" && optionValue(pending, "LinuxDOClientId", common.LinuxDOClientId) == "" {
+			return errors.New("无法启用 LinuxDO OAuth，请先填入 LinuxDO Client Id 以及 LinuxDO Client Secret！")
+		}
+	case "EmailDomainRestrictionEnabled":
+		if value == "true" && optionValue(pending, "EmailDomainWhitelist", strings.Join(common.EmailDomainWhitelist, ",")) == "" {
+			return errors.New("无法启用邮箱域名限制，请先填入限制的邮箱域名！")
+		}
+	case "WeChatAuthEnabled":
+		if value == "true" && optionValue(pending, "WeChatServerAddress", common.WeChatServerAddress) == "" {
+			return errors.New("无法启用微信登录，请先填入微信登录相关配置信息！")
+		}
+	case "TurnstileCheckEnabled":
+		if value == "true" && optionValue(pending, "TurnstileSiteKey", common.TurnstileSiteKey) == "" {
+			return errors.New("无法启用 Turnstile 校验，请先填入 Turnstile 校验相关配置信息！")
+		}
+	case "TelegramOAuthEnabled":
+		if value == "true" && optionValue(pending, "TelegramBotToken", common.TelegramBotToken) == "" {
+			return errors.New("无法启用 Telegram OAuth，请先填入 Telegram Bot Token！")
+		}
+	case "GroupRatio":
+		return ratio_setting.CheckGroupRatio(value)
+	case "ImageRatio":
+		if err := ratio_setting.ValidateRatioJSONString(value); err != nil {
+			return errors.New("图片倍率设置失败: " + err.Error())
+		}
+	case "AudioRatio":
+		if err := ratio_setting.ValidateRatioJSONString(value); err != nil {
+			return errors.New("音频倍率设置失败: " + err.Error())
+		}
+	case "AudioCompletionRatio":
+		if err := ratio_setting.ValidateRatioJSONString(value); err != nil {
+			return errors.New("音频补全倍率设置失败: " + err.Error())
+		}
+	case "CreateCacheRatio":
+		if err := ratio_setting.ValidateRatioJSONString(value); err != nil {
+			return errors.New("缓存创建倍率设置失败: " + err.Error())
+		}
+	case "ModelPricingTiers":
+		if err := ratio_setting.ValidateModelPricingTiers(value); err != nil {
+			return errors.New("上下文分档倍率设置失败: " + err.Error())
+		}
+	case "group_pricing_rule.rules", "group_pricing_rule.timezone", "group_pricing_rule.combine_mode":
+		if err := ratio_setting.ValidateGroupPricingRuleOption(strings.TrimPrefix(key, "group_pricing_rule."), value); err != nil {
+			return errors.New("分组定价规则设置失败: " + err.Error())
+		}
+	case "invoice_setting.tax_rate":
+		taxRate, err := strconv.ParseFloat(value, 64)
+		if err != nil || taxRate < 0 || taxRate >= 1 {
+			return errors.New("税率必须在 0 到 1 之间")
+		}
+	case "spend_anomaly_setting.enabled":
+		if value == "true" && optionValue(pending, "LogConsumeEnabled", strconv.FormatBool(common.LogConsumeEnabled)) != "true" {
+			return errors.New("异常消费检测依赖消费日志，请先开启消费日志")
+		}
+	case "spend_anomaly_setting.velocity_action", "spend_anomaly_setting.signal_action":
+		if !operation_setting.IsValidSpendAnomalyAction(value) {
+			return errors.New("无效的异常消费处理方式")
+		}
+	case "admission_queue_setting.fair_share_by":
+		if value != operation_setting.AdmissionFairShareByUser && value != operation_setting.AdmissionFairShareByGroup {
+			return errors.New("无效的公平调度方式")
+		}
+	case "credit_bucket_setting.consume_order":
+		if !operation_setting.IsValidCreditBucketOrder(value) {
+			return errors.New("无效的额度消耗顺序")
+		}
+	case "end_user_setting.max_length":
+		// 终端用户标识记录在日志中，长度不能超过日志字段长度
+		maxLength, err := strconv.Atoi(value)
+		if err != nil || maxLength < 1 || maxLength > 128 {
+			return errors.New("终端用户标识最大长度需在 1 到 128 之间")
+		}
+	case "data_residency_setting.group_regions":
+		var groupRegions map[string][]string
+		if err := common.UnmarshalJsonStr(value, &groupRegions); err != nil {
+			return errors.New("分组数据驻留区域格式错误，应为分组到区域列表的映射")
+		}
+	case "payment_reversal_setting.policy":
+		if value != operation_setting.PaymentReversalPolicyAllowNegative && value != operation_setting.PaymentReversalPolicySuspend {
+			return errors.New("无效的退款处理策略")
+		}
+	case "ModelRequestRateLimitGroup":
+		return setting.CheckModelRequestRateLimitGroup(value)
+	case "AutomaticDisableStatusCodes", "AutomaticRetryStatusCodes":
+		_, err := operation_setting.ParseHTTPStatusCodeRanges(value)
+		return err
+	case "console_setting.api_info":
+		return console_setting.ValidateConsoleSettings(value, "ApiInfo")
+	case "console_setting.announcements":
+		return console_setting.ValidateConsoleSettings(value, "Announcements")
+	case "console_setting.faq":
+		return console_setting.ValidateConsoleSettings(value, "FAQ")
+	case "console_setting.uptime_kuma_groups":
+		return console_setting.ValidateConsoleSettings(value, "UptimeKumaGroups")
+	}
+	return nil
+}
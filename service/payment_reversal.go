@@ -0,0 +1,94 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// HandlePaymentReversal 处理渠道的退款、争议与订阅取消通知，重复事件直接返回。
+// 关闭处理时返回 nil，调用方仍应向渠道确认收到通知。
+func HandlePaymentReversal(r model.PaymentReversal) (*model.PaymentReversalResult, error) {
+	setting := operation_setting.GetPaymentReversalSetting()
+	if !setting.Enabled {
+		common.SysLog(fmt.Sprintf("payment reversal handling disabled, ignore %s event %s", r.Provider, r.EventId))
+		return nil, nil
+	}
+	result, err := model.ApplyPaymentReversal(r)
+	if err != nil {
+		if errors.Is(err, model.ErrPaymentReversalTargetNotFound) {
+			common.SysLog(fmt.Sprintf("payment reversal %s event %s: order not found, trade_no=%s, reference=%s",
+				r.Provider, r.EventId, r.TradeNo, r.ProviderReference))
+		}
+		return nil, err
+	}
+	if result.Duplicate {
+		return result, nil
+	}
+
+	downgrade := ""
+	if result.SubscriptionId > 0 {
+		msg, err := model.AdminInvalidateUserSubscription(result.SubscriptionId)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to invalidate subscription %d for %s: %s", result.SubscriptionId, result.TradeNo, err.Error()))
+		}
+		downgrade = msg
+	}
+	if result.QuotaDelta != 0 {
+		model.RecordLog(result.UserId, model.LogTypeTopup, fmt.Sprintf("支付%s（%s），订单 %s，额度调整 %s",
+			paymentReversalKindName(r.Kind), r.Provider, result.TradeNo, logger.LogQuota(result.QuotaDelta)))
+	}
+
+	if setting.NotifyAdmin {
+		content := fmt.Sprintf("渠道：%s\n事件：%s\n订单：%s\n用户：%d\n订单状态：%s\n额度调整：%d",
+			r.Provider, r.EventId, result.TradeNo, result.UserId, result.Status, result.QuotaDelta)
+		if r.Reason != "" {
+			content += "\n原因：" + r.Reason
+		}
+		if result.SubscriptionId > 0 {
+			content += fmt.Sprintf("\n已失效订阅：%d %s", result.SubscriptionId, downgrade)
+		}
+		if result.UserSuspended {
+			content += "\n用户余额为负，已被禁用"
+		}
+		NotifyRootUser(dto.NotifyTypePaymentReversal, "支付"+paymentReversalKindName(r.Kind)+"通知", content)
+	}
+	return result, nil
+}
+
+// FlagPaymentReversalForReview 记录无法自动处理的撤销通知并提醒管理员核实，不调整额度与订单状态，
+// 核实后可通过手动登记接口处理。
+func FlagPaymentReversalForReview(r model.PaymentReversal, detail string) {
+	setting := operation_setting.GetPaymentReversalSetting()
+	if !setting.Enabled {
+		common.SysLog(fmt.Sprintf("payment reversal handling disabled, ignore %s event %s", r.Provider, r.EventId))
+		return
+	}
+	common.SysLog(fmt.Sprintf("payment reversal %s event %s needs manual review: trade_no=%s, reference=%s, %s",
+		r.Provider, r.EventId, r.TradeNo, r.ProviderReference, detail))
+	if setting.NotifyAdmin {
+		content := fmt.Sprintf("渠道：%s\n事件：%s\n订单：%s\n渠道订单：%s\n%s\n未自动扣回额度，请核实后手动登记",
+			r.Provider, r.EventId, r.TradeNo, r.ProviderReference, detail)
+		NotifyRootUser(dto.NotifyTypePaymentReversal, "支付"+paymentReversalKindName(r.Kind)+"待人工处理", content)
+	}
+}
+
+func paymentReversalKindName(kind string) string {
+	switch kind {
+	case model.PaymentReversalRefund:
+		return "退款"
+	case model.PaymentReversalDispute:
+		return "争议"
+	case model.PaymentReversalDisputeWon:
+		return "争议胜诉"
+	case model.PaymentReversalSubscriptionCancel:
+		return "订阅取消"
+	default:
+		return kind
+	}
+}
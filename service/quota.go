@@ -136,7 +136,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 		GroupRatio: actualGroupRatio,
 	}
 
-	quota := calculateAudioQuota(quotaInfo)
+	quota := applyGroupPricingRuleRatio(relayInfo, calculateAudioQuota(quotaInfo))
 
 	if userQuota < quota {
 		return fmt.Errorf("user quota is not enough, user quota: %s, need quota: %s", logger.FormatQuota(userQuota), logger.FormatQuota(quota))
@@ -189,7 +189,7 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 		GroupRatio: groupRatio,
 	}
 
-	quota := calculateAudioQuota(quotaInfo)
+	quota := applyGroupPricingRuleRatio(relayInfo, calculateAudioQuota(quotaInfo))
 
 	totalTokens := usage.TotalTokens
 	var logContent string
@@ -219,6 +219,7 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	}
 	other := GenerateWssOtherInfo(ctx, relayInfo, usage, modelRatio, groupRatio,
 		completionRatio.InexactFloat64(), audioRatio.InexactFloat64(), audioCompletionRatio.InexactFloat64(), modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
+	RecordEndUserUsage(ctx, relayInfo, usage.TotalTokens, quota)
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     usage.InputTokens,
@@ -235,6 +236,15 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	})
 }
 
+// applyGroupPricingRuleRatio 音频/实时结算不经过 OtherRatios，单独叠加分组定价规则倍率
+func applyGroupPricingRuleRatio(relayInfo *relaycommon.RelayInfo, quota int) int {
+	ratio, ok := relayInfo.PriceData.OtherRatios[ratio_setting.GroupPricingRuleRatioKey]
+	if !ok || ratio <= 0 {
+		return quota
+	}
+	return int(decimal.NewFromInt(int64(quota)).Mul(decimal.NewFromFloat(ratio)).Round(0).IntPart())
+}
+
 func CalcOpenRouterCacheCreateTokens(usage dto.Usage, priceData types.PriceData) int {
 	if priceData.CacheCreationRatio == 1 {
 		return 0
@@ -290,7 +300,7 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 		GroupRatio: groupRatio,
 	}
 
-	quota := calculateAudioQuota(quotaInfo)
+	quota := applyGroupPricingRuleRatio(relayInfo, calculateAudioQuota(quotaInfo))
 
 	totalTokens := usage.TotalTokens
 	var logContent string
@@ -324,6 +334,7 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	}
 	other := GenerateAudioOtherInfo(ctx, relayInfo, usage, modelRatio, groupRatio,
 		completionRatio.InexactFloat64(), audioRatio.InexactFloat64(), audioCompletionRatio.InexactFloat64(), modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
+	RecordEndUserUsage(ctx, relayInfo, usage.PromptTokens+usage.CompletionTokens, quota)
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     usage.PromptTokens,
@@ -380,11 +391,11 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		}
 	} else {
 		// Wallet
-		if quota > 0 {
-			err = model.DecreaseUserQuota(relayInfo.UserId, quota)
-		} else {
-			err = model.IncreaseUserQuota(relayInfo.UserId, -quota, false)
-		}
+		err = model.DeltaUpdateUserQuota(relayInfo.UserId, -quota, model.QuotaLedgerMeta{
+			Type:      model.QuotaLedgerTypeSettle,
+			RequestId: relayInfo.RequestId,
+			TokenId:   relayInfo.TokenId,
+		})
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const quotaLedgerReconcileTickInterval = 1 * time.Minute
+
+// QuotaLedgerReconcileReport 最近一次对账结果
+type QuotaLedgerReconcileReport struct {
+	StartedAt  int64                    `json:"started_at"`
+	FinishedAt int64                    `json:"finished_at"`
+	Drifts     []model.QuotaLedgerDrift `json:"drifts"`
+	Error      string                   `json:"error,omitempty"`
+}
+
+var (
+	quotaLedgerReconcileOnce    sync.Once
+	quotaLedgerReconcileRunning atomic.Bool
+	quotaLedgerReconcileLast    atomic.Int64
+	quotaLedgerReconcileReport  atomic.Pointer[QuotaLedgerReconcileReport]
+)
+
+func StartQuotaLedgerReconcileTask() {
+	quotaLedgerReconcileOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), "quota ledger reconcile task started")
+			ticker := time.NewTicker(quotaLedgerReconcileTickInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				setting := operation_setting.GetQuotaLedgerSetting()
+				if !setting.Enabled || setting.ReconcileIntervalMinutes <= 0 {
+					continue
+				}
+				interval := time.Duration(setting.ReconcileIntervalMinutes) * time.Minute
+				if time.Since(time.Unix(quotaLedgerReconcileLast.Load(), 0)) < interval {
+					continue
+				}
+				_, _ = RunQuotaLedgerReconcile()
+			}
+		})
+	})
+}
+
+// RunQuotaLedgerReconcile 立即执行一次对账，已有对账在运行时返回错误
+func RunQuotaLedgerReconcile() (*QuotaLedgerReconcileReport, error) {
+	if !quotaLedgerReconcileRunning.CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("quota ledger reconcile is already running")
+	}
+	defer quotaLedgerReconcileRunning.Store(false)
+
+	report := &QuotaLedgerReconcileReport{StartedAt: common.GetTimestamp()}
+	drifts, err := model.ReconcileQuotaLedger(operation_setting.GetQuotaLedgerSetting().DriftThreshold)
+	report.FinishedAt = common.GetTimestamp()
+	report.Drifts = drifts
+	if err != nil {
+		report.Error = err.Error()
+	}
+	quotaLedgerReconcileLast.Store(report.FinishedAt)
+	quotaLedgerReconcileReport.Store(report)
+
+	if err != nil {
+		common.SysError("quota ledger reconcile failed: " + err.Error())
+		return report, err
+	}
+	for _, drift := range drifts {
+		common.SysLog(fmt.Sprintf("quota ledger drift: user_id=%d, quota=%d, ledger_balance=%d, ledger_sum=%d, drift=%d",
+			drift.UserId, drift.Quota, drift.LedgerBalance, drift.LedgerSum, drift.Drift))
+	}
+	return report, nil
+}
+
+// GetQuotaLedgerReconcileReport 返回最近一次对账结果，尚未执行过时返回 nil
+func GetQuotaLedgerReconcileReport() *QuotaLedgerReconcileReport {
+	return quotaLedgerReconcileReport.Load()
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const redemptionGroupGrantTickInterval = 1 * time.Minute
+
+var redemptionGroupGrantOnce sync.Once
+
+// StartRedemptionGroupGrantTask 定期恢复兑换码临时分组到期的用户
+func StartRedemptionGroupGrantTask() {
+	redemptionGroupGrantOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), "redemption group grant task started")
+			ticker := time.NewTicker(redemptionGroupGrantTickInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				n, err := model.ExpireRedemptionGroupGrants(common.GetTimestamp())
+				if err != nil {
+					common.SysError("redemption group grant expire failed: " + err.Error())
+					continue
+				}
+				if n > 0 {
+					common.SysLog(fmt.Sprintf("redemption group grant: %d grants expired", n))
+				}
+			}
+		})
+	})
+}
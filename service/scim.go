@@ -0,0 +1,830 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// SCIMError 按 RFC 7644 3.12 返回给身份提供方的错误
+type SCIMError struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+func (e *SCIMError) Response() *dto.SCIMError {
+	return &dto.SCIMError{
+		Schemas:  []string{dto.SCIMSchemaError},
+		Status:   strconv.Itoa(e.Status),
+		ScimType: e.ScimType,
+		Detail:   e.Detail,
+	}
+}
+
+func NewSCIMError(status int, scimType string, detail string) *SCIMError {
+	return &SCIMError{Status: status, ScimType: scimType, Detail: detail}
+}
+
+// SCIMErrorFrom 将内部错误转换为 SCIM 错误
+func SCIMErrorFrom(err error) *SCIMError {
+	var scimErr *SCIMError
+	switch {
+	case errors.As(err, &scimErr):
+		return scimErr
+	case errors.Is(err, model.ErrScimUserNotFound), errors.Is(err, model.ErrScimGroupNotFound):
+		return NewSCIMError(http.StatusNotFound, "", err.Error())
+	default:
+		return NewSCIMError(http.StatusInternalServerError, "", err.Error())
+	}
+}
+
+var scimFilterRegex = regexp.MustCompile(`(?i)^\s*([a-z.]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+var (
+	scimUserFilterColumns  = map[string]string{"username": "user_name", "externalid": "external_id", "emails.value": "email", "emails": "email"}
+	scimGroupFilterColumns = map[string]string{"displayname": "display_name", "externalid": "external_id"}
+)
+
+// parseSCIMFilter 仅支持身份提供方常用的 attr eq "value" 形式
+func parseSCIMFilter(filter string, columns map[string]string) (string, string, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", "", nil
+	}
+	matches := scimFilterRegex.FindStringSubmatch(filter)
+	if matches == nil {
+		return "", "", NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidFilter, "unsupported filter: "+filter)
+	}
+	column, ok := columns[strings.ToLower(matches[1])]
+	if !ok {
+		return "", "", NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidFilter, "unsupported filter attribute: "+matches[1])
+	}
+	value, err := strconv.Unquote(`"` + matches[2] + `"`)
+	if err != nil {
+		return "", "", NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidFilter, "invalid filter value")
+	}
+	return column, value, nil
+}
+
+// normalizeSCIMPage 将 1 起始的 startIndex 与 count 转为偏移量
+func normalizeSCIMPage(startIndex int, count int) (int, int, int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > dto.SCIMMaxPageSize {
+		count = dto.SCIMMaxPageSize
+	}
+	return startIndex, startIndex - 1, count
+}
+
+func scimTime(timestamp int64) string {
+	if timestamp <= 0 {
+		return ""
+	}
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
+
+func scimLocation(resource string, id int) string {
+	return fmt.Sprintf("%s/scim/v2/%s/%d", strings.TrimSuffix(system_setting.ServerAddress, "/"), resource, id)
+}
+
+func parseSCIMId(id string) (int, error) {
+	value, err := strconv.Atoi(id)
+	if err != nil || value <= 0 {
+		return 0, NewSCIMError(http.StatusNotFound, "", "resource "+id+" not found")
+	}
+	return value, nil
+}
+
+func buildSCIMUser(user *model.User, scimUser *model.ScimUser) (*dto.SCIMUser, error) {
+	groups, err := model.GetUserScimGroups(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	active := user.Status == common.UserStatusEnabled
+	resource := &dto.SCIMUser{
+		Schemas:     []string{dto.SCIMSchemaUser},
+		Id:          strconv.Itoa(user.Id),
+		ExternalId:  scimUser.ExternalId,
+		UserName:    scimUser.UserName,
+		DisplayName: user.DisplayName,
+		Active:      &active,
+		Meta: &dto.SCIMMeta{
+			ResourceType: dto.SCIMResourceTypeUser,
+			Created:      scimTime(scimUser.CreatedTime),
+			LastModified: scimTime(scimUser.UpdatedTime),
+			Location:     scimLocation("Users", user.Id),
+		},
+	}
+	if user.DisplayName != "" {
+		resource.Name = &dto.SCIMName{Formatted: user.DisplayName}
+	}
+	if user.Email != "" {
+		resource.Emails = []dto.SCIMMultiValue{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	for _, group := range groups {
+		resource.Groups = append(resource.Groups, dto.SCIMMultiValue{
+			Value:   strconv.Itoa(group.Id),
+			Display: group.DisplayName,
+			Ref:     scimLocation("Groups", group.Id),
+		})
+	}
+	return resource, nil
+}
+
+func getSCIMUser(id int) (*model.User, *model.ScimUser, error) {
+	scimUser, err := model.GetScimUserByUserId(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := model.GetUserById(id, true)
+	if err != nil {
+		return nil, nil, model.ErrScimUserNotFound
+	}
+	return user, scimUser, nil
+}
+
+func ListSCIMUsers(filter string, startIndex int, count int) (*dto.SCIMListResponse, error) {
+	column, value, err := parseSCIMFilter(filter, scimUserFilterColumns)
+	if err != nil {
+		return nil, err
+	}
+	startIndex, offset, count := normalizeSCIMPage(startIndex, count)
+	scimUsers, total, err := model.SearchScimUsers(column, value, offset, count)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]any, 0, len(scimUsers))
+	for _, scimUser := range scimUsers {
+		user, err := model.GetUserById(scimUser.UserId, true)
+		if err != nil {
+			continue
+		}
+		resource, err := buildSCIMUser(user, scimUser)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	return &dto.SCIMListResponse{
+		Schemas:      []string{dto.SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+func GetSCIMUser(id string) (*dto.SCIMUser, error) {
+	userId, err := parseSCIMId(id)
+	if err != nil {
+		return nil, err
+	}
+	user, scimUser, err := getSCIMUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	return buildSCIMUser(user, scimUser)
+}
+
+// pickSCIMUsername 优先使用 userName 作为网关用户名，过长或已被占用时沿用原用户名或自动生成
+func pickSCIMUsername(userName string, current string) (string, error) {
+	if userName == current {
+		return current, nil
+	}
+	if len(userName) <= model.UserNameMaxLength {
+		exists, err := model.CheckUserExistOrDeleted(userName, "")
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return userName, nil
+		}
+	}
+	if current != "" {
+		return current, nil
+	}
+	return "scim_" + strconv.Itoa(model.GetMaxUserId()+1), nil
+}
+
+func scimDisplayName(resource *dto.SCIMUser) string {
+	name := resource.DisplayName
+	if name == "" && resource.Name != nil {
+		name = resource.Name.Formatted
+		if name == "" {
+			name = strings.TrimSpace(resource.Name.GivenName + " " + resource.Name.FamilyName)
+		}
+	}
+	if name == "" {
+		name = resource.UserName
+	}
+	if runes := []rune(name); len(runes) > model.UserNameMaxLength {
+		name = string(runes[:model.UserNameMaxLength])
+	}
+	return name
+}
+
+func validateSCIMUser(resource *dto.SCIMUser, userId int) error {
+	resource.UserName = strings.TrimSpace(resource.UserName)
+	if resource.UserName == "" {
+		return NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidValue, "userName is required")
+	}
+	taken, err := model.IsScimUserNameTaken(resource.UserName, userId)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return NewSCIMError(http.StatusConflict, dto.SCIMErrorUniqueness, "userName "+resource.UserName+" already exists")
+	}
+	return nil
+}
+
+func CreateSCIMUser(resource *dto.SCIMUser) (*dto.SCIMUser, error) {
+	if err := validateSCIMUser(resource, 0); err != nil {
+		return nil, err
+	}
+	username, err := pickSCIMUsername(resource.UserName, "")
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{
+		Username:    username,
+		Password:    common.GetRandomString(32),
+		DisplayName: scimDisplayName(resource),
+		Email:       resource.PrimaryEmail(),
+		Role:        common.RoleCommonUser,
+		Status:      common.UserStatusEnabled,
+	}
+	if resource.Active != nil && !*resource.Active {
+		user.Status = common.UserStatusDisabled
+	}
+	scimUser := &model.ScimUser{UserName: resource.UserName, ExternalId: resource.ExternalId}
+	if err := model.CreateScimUser(user, scimUser); err != nil {
+		return nil, err
+	}
+	return buildSCIMUser(user, scimUser)
+}
+
+// saveSCIMUser 用完整的资源覆盖用户属性，停用时吊销全部令牌
+func saveSCIMUser(user *model.User, scimUser *model.ScimUser, resource *dto.SCIMUser) (*dto.SCIMUser, error) {
+	if err := validateSCIMUser(resource, user.Id); err != nil {
+		return nil, err
+	}
+	username, err := pickSCIMUsername(resource.UserName, user.Username)
+	if err != nil {
+		return nil, err
+	}
+	wasActive := user.Status == common.UserStatusEnabled
+	user.Username = username
+	user.DisplayName = scimDisplayName(resource)
+	user.Email = resource.PrimaryEmail()
+	if resource.Active != nil {
+		if *resource.Active {
+			user.Status = common.UserStatusEnabled
+		} else if user.Role != common.RoleRootUser {
+			user.Status = common.UserStatusDisabled
+		}
+	}
+	scimUser.UserName = resource.UserName
+	scimUser.ExternalId = resource.ExternalId
+	if err := model.UpdateScimUser(user, scimUser); err != nil {
+		return nil, err
+	}
+	if wasActive && user.Status == common.UserStatusDisabled {
+		revokeSCIMUserTokens(user.Id)
+	}
+	return buildSCIMUser(user, scimUser)
+}
+
+func revokeSCIMUserTokens(userId int) {
+	count, err := model.DisableUserTokens(userId)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to revoke tokens of scim user %d: %s", userId, err.Error()))
+		return
+	}
+	if count > 0 {
+		model.RecordLog(userId, model.LogTypeSystem, fmt.Sprintf("SCIM 停用账号，已禁用 %d 个令牌", count))
+	}
+}
+
+func ReplaceSCIMUser(id string, resource *dto.SCIMUser) (*dto.SCIMUser, error) {
+	userId, err := parseSCIMId(id)
+	if err != nil {
+		return nil, err
+	}
+	user, scimUser, err := getSCIMUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	return saveSCIMUser(user, scimUser, resource)
+}
+
+func PatchSCIMUser(id string, request *dto.SCIMPatchRequest) (*dto.SCIMUser, error) {
+	userId, err := parseSCIMId(id)
+	if err != nil {
+		return nil, err
+	}
+	user, scimUser, err := getSCIMUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := buildSCIMUser(user, scimUser)
+	if err != nil {
+		return nil, err
+	}
+	for _, operation := range request.Operations {
+		if err := applySCIMUserOperation(resource, operation); err != nil {
+			return nil, err
+		}
+	}
+	return saveSCIMUser(user, scimUser, resource)
+}
+
+// applySCIMUserOperation 将 PATCH 操作应用到当前资源上，未支持的属性忽略
+func applySCIMUserOperation(resource *dto.SCIMUser, operation dto.SCIMPatchOperation) error {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidSyntax, "unsupported op: "+operation.Op)
+	}
+	if operation.Path == "" {
+		if op == "remove" {
+			return NewSCIMError(http.StatusBadRequest, dto.SCIMErrorNoTarget, "remove requires a path")
+		}
+		var values map[string]json.RawMessage
+		if err := common.Unmarshal(operation.Value, &values); err != nil {
+			return NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidValue, "value must be an object")
+		}
+		for path, value := range values {
+			if err := setSCIMUserAttribute(resource, path, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if op == "remove" {
+		return setSCIMUserAttribute(resource, operation.Path, nil)
+	}
+	return setSCIMUserAttribute(resource, operation.Path, operation.Value)
+}
+
+func setSCIMUserAttribute(resource *dto.SCIMUser, path string, value json.RawMessage) error {
+	path = strings.ToLower(strings.TrimPrefix(path, dto.SCIMSchemaUser+":"))
+	switch {
+	case path == "active":
+		active, err := parseSCIMBool(value)
+		if err != nil {
+			return err
+		}
+		resource.Active = &active
+	case path == "username":
+		return unmarshalSCIMString(value, &resource.UserName)
+	case path == "displayname":
+		return unmarshalSCIMString(value, &resource.DisplayName)
+	case path == "externalid":
+		return unmarshalSCIMString(value, &resource.ExternalId)
+	case path == "name":
+		resource.Name = &dto.SCIMName{}
+		if value != nil {
+			if err := common.Unmarshal(value, resource.Name); err != nil {
+				return NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidValue, "invalid name")
+			}
+		}
+		resource.DisplayName = ""
+	case strings.HasPrefix(path, "name."):
+		if resource.Name == nil {
+			resource.Name = &dto.SCIMName{}
+		}
+		var target *string
+		switch strings.TrimPrefix(path, "name.") {
+		case "formatted":
+			target = &resource.Name.Formatted
+		case "givenname":
+			target = &resource.Name.GivenName
+			resource.Name.Formatted = ""
+		case "familyname":
+			target = &resource.Name.FamilyName
+			resource.Name.Formatted = ""
+		default:
+			return nil
+		}
+		if err := unmarshalSCIMString(value, target); err != nil {
+			return err
+		}
+		resource.DisplayName = ""
+	case path == "emails":
+		resource.Emails = nil
+		if value != nil {
+			if err := common.Unmarshal(value, &resource.Emails); err != nil {
+				return NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidValue, "invalid emails")
+			}
+		}
+	case strings.HasPrefix(path, "emails[") && strings.HasSuffix(path, "].value"):
+		var email string
+		if err := unmarshalSCIMString(value, &email); err != nil {
+			return err
+		}
+		resource.Emails = nil
+		if email != "" {
+			resource.Emails = []dto.SCIMMultiValue{{Value: email, Primary: true}}
+		}
+	}
+	return nil
+}
+
+func unmarshalSCIMString(value json.RawMessage, target *string) error {
+	*target = ""
+	if value == nil {
+		return nil
+	}
+	if err := common.Unmarshal(value, target); err != nil {
+		return NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidValue, "value must be a string")
+	}
+	return nil
+}
+
+// parseSCIMBool 兼容部分身份提供方将布尔值以 "True"/"False" 字符串发送
+func parseSCIMBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := common.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := common.Unmarshal(value, &s); err == nil {
+		if parsed, err := strconv.ParseBool(s); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidValue, "active must be a boolean")
+}
+
+// DeleteSCIMUser 删除用户：吊销令牌、移出所有组并软删除账号
+func DeleteSCIMUser(id string) error {
+	userId, err := parseSCIMId(id)
+	if err != nil {
+		return err
+	}
+	user, _, err := getSCIMUser(userId)
+	if err != nil {
+		return err
+	}
+	if user.Role == common.RoleRootUser {
+		return NewSCIMError(http.StatusBadRequest, dto.SCIMErrorMutability, "root user cannot be deleted")
+	}
+	revokeSCIMUserTokens(user.Id)
+	return model.DeleteScimUser(user)
+}
+
+func buildSCIMGroup(group *model.ScimGroup) (*dto.SCIMGroup, error) {
+	memberIds, err := model.GetScimGroupMemberIds(group.Id)
+	if err != nil {
+		return nil, err
+	}
+	resource := &dto.SCIMGroup{
+		Schemas:     []string{dto.SCIMSchemaGroup},
+		Id:          strconv.Itoa(group.Id),
+		ExternalId:  group.ExternalId,
+		DisplayName: group.DisplayName,
+		Meta: &dto.SCIMMeta{
+			ResourceType: dto.SCIMResourceTypeGroup,
+			Created:      scimTime(group.CreatedTime),
+			LastModified: scimTime(group.UpdatedTime),
+			Location:     scimLocation("Groups", group.Id),
+		},
+	}
+	for _, memberId := range memberIds {
+		scimUser, err := model.GetScimUserByUserId(memberId)
+		if err != nil {
+			continue
+		}
+		resource.Members = append(resource.Members, dto.SCIMMultiValue{
+			Value:   strconv.Itoa(memberId),
+			Display: scimUser.UserName,
+			Ref:     scimLocation("Users", memberId),
+		})
+	}
+	return resource, nil
+}
+
+func ListSCIMGroups(filter string, startIndex int, count int) (*dto.SCIMListResponse, error) {
+	column, value, err := parseSCIMFilter(filter, scimGroupFilterColumns)
+	if err != nil {
+		return nil, err
+	}
+	startIndex, offset, count := normalizeSCIMPage(startIndex, count)
+	groups, total, err := model.SearchScimGroups(column, value, offset, count)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]any, 0, len(groups))
+	for _, group := range groups {
+		resource, err := buildSCIMGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	return &dto.SCIMListResponse{
+		Schemas:      []string{dto.SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+func getSCIMGroup(id string) (*model.ScimGroup, error) {
+	groupId, err := parseSCIMId(id)
+	if err != nil {
+		return nil, err
+	}
+	return model.GetScimGroupById(groupId)
+}
+
+func GetSCIMGroup(id string) (*dto.SCIMGroup, error) {
+	group, err := getSCIMGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	return buildSCIMGroup(group)
+}
+
+// scimMemberIds 解析成员 ID，只接受由 SCIM 开通的用户
+func scimMemberIds(members []dto.SCIMMultiValue) ([]int, error) {
+	userIds := make([]int, 0, len(members))
+	for _, member := range members {
+		userId, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return nil, NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidValue, "invalid member "+member.Value)
+		}
+		if !slices.Contains(userIds, userId) {
+			userIds = append(userIds, userId)
+		}
+	}
+	existing, err := model.GetExistingScimUserIds(userIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, userId := range userIds {
+		if !slices.Contains(existing, userId) {
+			return nil, NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidValue, fmt.Sprintf("member %d not found", userId))
+		}
+	}
+	return userIds, nil
+}
+
+func validateSCIMGroup(resource *dto.SCIMGroup, id int) error {
+	resource.DisplayName = strings.TrimSpace(resource.DisplayName)
+	if resource.DisplayName == "" {
+		return NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidValue, "displayName is required")
+	}
+	taken, err := model.IsScimGroupNameTaken(resource.DisplayName, id)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return NewSCIMError(http.StatusConflict, dto.SCIMErrorUniqueness, "group "+resource.DisplayName+" already exists")
+	}
+	return nil
+}
+
+func CreateSCIMGroup(resource *dto.SCIMGroup) (*dto.SCIMGroup, error) {
+	if err := validateSCIMGroup(resource, 0); err != nil {
+		return nil, err
+	}
+	memberIds, err := scimMemberIds(resource.Members)
+	if err != nil {
+		return nil, err
+	}
+	group := &model.ScimGroup{DisplayName: resource.DisplayName, ExternalId: resource.ExternalId}
+	if err := model.SaveScimGroup(group, memberIds); err != nil {
+		return nil, err
+	}
+	syncSCIMUsersMapping(memberIds)
+	return buildSCIMGroup(group)
+}
+
+func ReplaceSCIMGroup(id string, resource *dto.SCIMGroup) (*dto.SCIMGroup, error) {
+	group, err := getSCIMGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSCIMGroup(resource, group.Id); err != nil {
+		return nil, err
+	}
+	memberIds, err := scimMemberIds(resource.Members)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := model.GetScimGroupMemberIds(group.Id)
+	if err != nil {
+		return nil, err
+	}
+	group.DisplayName = resource.DisplayName
+	group.ExternalId = resource.ExternalId
+	if err := model.SaveScimGroup(group, memberIds); err != nil {
+		return nil, err
+	}
+	syncSCIMUsersMapping(append(previous, memberIds...))
+	return buildSCIMGroup(group)
+}
+
+func PatchSCIMGroup(id string, request *dto.SCIMPatchRequest) (*dto.SCIMGroup, error) {
+	group, err := getSCIMGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := model.GetScimGroupMemberIds(group.Id)
+	if err != nil {
+		return nil, err
+	}
+	// 组名变化会影响全部成员的映射，因此原成员始终需要重新同步
+	affected := slices.Clone(previous)
+	for _, operation := range request.Operations {
+		changed, err := applySCIMGroupOperation(group, operation)
+		if err != nil {
+			return nil, err
+		}
+		affected = append(affected, changed...)
+	}
+	if err := model.SaveScimGroup(group, nil); err != nil {
+		return nil, err
+	}
+	syncSCIMUsersMapping(affected)
+	return buildSCIMGroup(group)
+}
+
+var scimMemberPathRegex = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]*)"\s*\]$`)
+
+// applySCIMGroupOperation 执行单个 PATCH 操作，返回成员变动的用户 ID
+func applySCIMGroupOperation(group *model.ScimGroup, operation dto.SCIMPatchOperation) ([]int, error) {
+	op := strings.ToLower(operation.Op)
+	path := strings.TrimPrefix(operation.Path, dto.SCIMSchemaGroup+":")
+	if op != "add" && op != "replace" && op != "remove" {
+		return nil, NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidSyntax, "unsupported op: "+operation.Op)
+	}
+	if matches := scimMemberPathRegex.FindStringSubmatch(path); matches != nil {
+		if op != "remove" {
+			return nil, NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidPath, "unsupported path: "+path)
+		}
+		userId, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidValue, "invalid member "+matches[1])
+		}
+		return []int{userId}, model.RemoveScimGroupMembers(group.Id, []int{userId})
+	}
+	if path == "" {
+		if op == "remove" {
+			return nil, NewSCIMError(http.StatusBadRequest, dto.SCIMErrorNoTarget, "remove requires a path")
+		}
+		var values map[string]json.RawMessage
+		if err := common.Unmarshal(operation.Value, &values); err != nil {
+			return nil, NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidValue, "value must be an object")
+		}
+		var affected []int
+		for key, value := range values {
+			changed, err := applySCIMGroupOperation(group, dto.SCIMPatchOperation{Op: op, Path: key, Value: value})
+			if err != nil {
+				return nil, err
+			}
+			affected = append(affected, changed...)
+		}
+		return affected, nil
+	}
+	switch strings.ToLower(path) {
+	case "displayname":
+		if op == "remove" {
+			return nil, NewSCIMError(http.StatusBadRequest, dto.SCIMErrorMutability, "displayName is required")
+		}
+		resource := &dto.SCIMGroup{}
+		if err := unmarshalSCIMString(operation.Value, &resource.DisplayName); err != nil {
+			return nil, err
+		}
+		if err := validateSCIMGroup(resource, group.Id); err != nil {
+			return nil, err
+		}
+		group.DisplayName = resource.DisplayName
+		return nil, nil
+	case "externalid":
+		if op == "remove" {
+			group.ExternalId = ""
+			return nil, nil
+		}
+		return nil, unmarshalSCIMString(operation.Value, &group.ExternalId)
+	case "members":
+		var members []dto.SCIMMultiValue
+		if operation.Value != nil {
+			if err := common.Unmarshal(operation.Value, &members); err != nil {
+				return nil, NewSCIMError(http.StatusBadRequest, dto.SCIMErrorInvalidValue, "invalid members")
+			}
+		}
+		switch op {
+		case "remove":
+			if len(members) == 0 {
+				previous, err := model.GetScimGroupMemberIds(group.Id)
+				if err != nil {
+					return nil, err
+				}
+				return previous, model.SaveScimGroup(group, []int{})
+			}
+			userIds := make([]int, 0, len(members))
+			for _, member := range members {
+				if userId, err := strconv.Atoi(member.Value); err == nil {
+					userIds = append(userIds, userId)
+				}
+			}
+			return userIds, model.RemoveScimGroupMembers(group.Id, userIds)
+		case "add":
+			userIds, err := scimMemberIds(members)
+			if err != nil {
+				return nil, err
+			}
+			return userIds, model.AddScimGroupMembers(group.Id, userIds)
+		default:
+			userIds, err := scimMemberIds(members)
+			if err != nil {
+				return nil, err
+			}
+			return userIds, model.SaveScimGroup(group, userIds)
+		}
+	}
+	return nil, nil
+}
+
+func DeleteSCIMGroup(id string) error {
+	group, err := getSCIMGroup(id)
+	if err != nil {
+		return err
+	}
+	memberIds, err := model.GetScimGroupMemberIds(group.Id)
+	if err != nil {
+		return err
+	}
+	if err := model.DeleteScimGroup(group.Id); err != nil {
+		return err
+	}
+	syncSCIMUsersMapping(memberIds)
+	return nil
+}
+
+func syncSCIMUsersMapping(userIds []int) {
+	for _, userId := range slices.Compact(slices.Sorted(slices.Values(userIds))) {
+		if err := SyncSCIMUserMapping(userId); err != nil {
+			common.SysError(fmt.Sprintf("failed to sync scim group mapping for user %d: %s", userId, err.Error()))
+		}
+	}
+}
+
+// SyncSCIMUserMapping 根据用户所属 SCIM 组与设置中的映射更新网关分组、管理员标记与自定义角色。
+// 未配置任何映射时不修改用户
+func SyncSCIMUserMapping(userId int) error {
+	mappings := system_setting.GetSCIMSettings().GroupMappings
+	if len(mappings) == 0 {
+		return nil
+	}
+	if _, err := model.GetScimUserByUserId(userId); err != nil {
+		return nil
+	}
+	user, err := model.GetUserById(userId, true)
+	if err != nil {
+		return err
+	}
+	groups, err := model.GetUserScimGroups(userId)
+	if err != nil {
+		return err
+	}
+	gatewayGroup := ""
+	roleNames := make([]string, 0)
+	for _, group := range groups {
+		mapping, ok := mappings[group.DisplayName]
+		if !ok {
+			continue
+		}
+		if gatewayGroup == "" {
+			gatewayGroup = mapping.Group
+		}
+		roleNames = append(roleNames, mapping.Roles...)
+	}
+	role, roleIds, err := resolveMappedRoles(roleNames)
+	if err != nil {
+		return err
+	}
+	return model.ApplyUserMapping(user, gatewayGroup, role, roleIds)
+}
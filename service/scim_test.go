@@ -0,0 +1,100 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSCIMFilter(t *testing.T) {
+	column, value, err := parseSCIMFilter(`userName eq "alice@example.com"`, scimUserFilterColumns)
+	require.NoError(t, err)
+	require.Equal(t, "user_name", column)
+	require.Equal(t, "alice@example.com", value)
+
+	column, value, err = parseSCIMFilter(`DisplayName EQ "Eng \"Core\""`, scimGroupFilterColumns)
+	require.NoError(t, err)
+	require.Equal(t, "display_name", column)
+	require.Equal(t, `Eng "Core"`, value)
+
+	_, _, err = parseSCIMFilter(`userName sw "a"`, scimUserFilterColumns)
+	require.Equal(t, http.StatusBadRequest, SCIMErrorFrom(err).Status)
+	_, _, err = parseSCIMFilter(`title eq "a"`, scimUserFilterColumns)
+	require.Equal(t, dto.SCIMErrorInvalidFilter, SCIMErrorFrom(err).ScimType)
+}
+
+func TestSCIMProvisioningLifecycle(t *testing.T) {
+	t.Cleanup(func() {
+		for _, table := range []string{"users", "tokens", "logs", "roles", "user_roles", "scim_users", "scim_groups", "scim_group_members"} {
+			model.DB.Exec("DELETE FROM " + table)
+		}
+		system_setting.GetSCIMSettings().GroupMappings = map[string]system_setting.SCIMGroupMapping{}
+	})
+	role := &model.Role{Name: "billing", Permissions: "user.read"}
+	require.NoError(t, role.Insert())
+	system_setting.GetSCIMSettings().GroupMappings = map[string]system_setting.SCIMGroupMapping{
+		"Engineering": {Group: "vip", Roles: []string{"billing", "admin"}},
+	}
+
+	active := true
+	user, err := CreateSCIMUser(&dto.SCIMUser{
+		UserName:   "alice@example.com",
+		ExternalId: "okta-1",
+		Name:       &dto.SCIMName{Formatted: "Alice"},
+		Emails:     []dto.SCIMMultiValue{{Value: "alice@example.com", Primary: true}},
+		Active:     &active,
+	})
+	require.NoError(t, err)
+	_, err = CreateSCIMUser(&dto.SCIMUser{UserName: "alice@example.com"})
+	require.Equal(t, http.StatusConflict, SCIMErrorFrom(err).Status)
+
+	list, err := ListSCIMUsers(`externalId eq "okta-1"`, 1, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, list.TotalResults)
+
+	group, err := CreateSCIMGroup(&dto.SCIMGroup{DisplayName: "Engineering", Members: []dto.SCIMMultiValue{{Value: user.Id}}})
+	require.NoError(t, err)
+	require.Len(t, group.Members, 1)
+
+	userId := common.String2Int(user.Id)
+	stored, err := model.GetUserById(userId, true)
+	require.NoError(t, err)
+	require.Equal(t, "vip", stored.Group)
+	require.Equal(t, common.RoleAdminUser, stored.Role)
+	roles, err := model.GetUserRoles(userId)
+	require.NoError(t, err)
+	require.Len(t, roles, 1)
+
+	// 移出组后撤销映射的角色
+	_, err = PatchSCIMGroup(group.Id, &dto.SCIMPatchRequest{Operations: []dto.SCIMPatchOperation{
+		{Op: "remove", Path: `members[value eq "` + user.Id + `"]`},
+	}})
+	require.NoError(t, err)
+	stored, err = model.GetUserById(userId, true)
+	require.NoError(t, err)
+	require.Equal(t, common.RoleCommonUser, stored.Role)
+	roles, err = model.GetUserRoles(userId)
+	require.NoError(t, err)
+	require.Empty(t, roles)
+
+	// 停用账号时吊销令牌
+	require.NoError(t, model.DB.Create(&model.Token{UserId: userId, Key: "scim-token-key", Status: common.TokenStatusEnabled}).Error)
+	user, err = PatchSCIMUser(user.Id, &dto.SCIMPatchRequest{Operations: []dto.SCIMPatchOperation{
+		{Op: "Replace", Path: "active", Value: json.RawMessage(`"False"`)},
+	}})
+	require.NoError(t, err)
+	require.False(t, *user.Active)
+	var token model.Token
+	require.NoError(t, model.DB.Where("user_id = ?", userId).First(&token).Error)
+	require.Equal(t, common.TokenStatusDisabled, token.Status)
+
+	require.NoError(t, DeleteSCIMUser(user.Id))
+	_, err = GetSCIMUser(user.Id)
+	require.Equal(t, http.StatusNotFound, SCIMErrorFrom(err).Status)
+}
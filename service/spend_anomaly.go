@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const spendAnomalyTickInterval = 1 * time.Minute
+
+var (
+	spendAnomalyOnce    sync.Once
+	spendAnomalyRunning atomic.Bool
+	spendAnomalyLast    atomic.Int64
+)
+
+// StartSpendAnomalyTask 定期检测令牌异常消费
+func StartSpendAnomalyTask() {
+	spendAnomalyOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), "spend anomaly task started")
+			ticker := time.NewTicker(spendAnomalyTickInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				setting := operation_setting.GetSpendAnomalySetting()
+				if !setting.Enabled || setting.IntervalMinutes <= 0 || !common.LogConsumeEnabled {
+					continue
+				}
+				interval := time.Duration(setting.IntervalMinutes) * time.Minute
+				if time.Since(time.Unix(spendAnomalyLast.Load(), 0)) < interval {
+					continue
+				}
+				if !spendAnomalyRunning.CompareAndSwap(false, true) {
+					continue
+				}
+				now := common.GetTimestamp()
+				n, err := RunSpendAnomalyDetection(now)
+				spendAnomalyLast.Store(now)
+				spendAnomalyRunning.Store(false)
+				if err != nil {
+					common.SysError("spend anomaly detection failed: " + err.Error())
+					continue
+				}
+				if n > 0 {
+					common.SysLog(fmt.Sprintf("spend anomaly: %d anomalies detected", n))
+				}
+			}
+		})
+	})
+}
+
+// RunSpendAnomalyDetection 以 now 为窗口终点执行一次检测，返回新记录的异常数
+func RunSpendAnomalyDetection(now int64) (int, error) {
+	// 消费速度、新 IP 与模型切换均从消费日志统计，没有日志时无法检测
+	if !common.LogConsumeEnabled {
+		return 0, fmt.Errorf("spend anomaly detection requires consume logs")
+	}
+	setting := operation_setting.GetSpendAnomalySetting()
+	if setting.WindowMinutes <= 0 || setting.BaselineHours <= 0 {
+		return 0, fmt.Errorf("invalid spend anomaly window")
+	}
+	windowStart := now - int64(setting.WindowMinutes)*60
+	baselineStart := windowStart - int64(setting.BaselineHours)*3600
+	// 基线按窗口长度折算为每窗口平均消费
+	baselineWindows := setting.BaselineHours * 60 / setting.WindowMinutes
+	if baselineWindows <= 0 {
+		baselineWindows = 1
+	}
+
+	spends, err := model.GetTokenSpends(windowStart, now)
+	if err != nil {
+		return 0, err
+	}
+	detected := 0
+	for _, spend := range spends {
+		baselineQuota, baselineCount, err := model.GetSpendBetween(spend.UserId, spend.TokenId, baselineStart, windowStart)
+		if err != nil {
+			return detected, err
+		}
+		baselineAvg := baselineQuota / baselineWindows
+		if isSpendVelocityAnomaly(setting, spend.Quota, baselineAvg) {
+			if recordSpendAnomaly(setting, &model.SpendAnomaly{
+				UserId:        spend.UserId,
+				TokenId:       spend.TokenId,
+				TokenName:     spend.TokenName,
+				Kind:          model.SpendAnomalyKindVelocity,
+				Detail:        fmt.Sprintf("%d 分钟内消费 %s，基线平均 %s", setting.WindowMinutes, logger.FormatQuota(spend.Quota), logger.FormatQuota(baselineAvg)),
+				WindowQuota:   spend.Quota,
+				BaselineQuota: baselineAvg,
+				Action:        setting.VelocityAction,
+			}, now) {
+				detected++
+			}
+		}
+		// 没有历史使用记录的新令牌不做 IP 与模型比对
+		if baselineCount == 0 {
+			continue
+		}
+		if setting.DetectNewIp {
+			newIps, err := newTokenLogValues(spend.TokenId, "ip", baselineStart, windowStart, now)
+			if err != nil {
+				return detected, err
+			}
+			if len(newIps) > 0 && recordSpendAnomaly(setting, &model.SpendAnomaly{
+				UserId:      spend.UserId,
+				TokenId:     spend.TokenId,
+				TokenName:   spend.TokenName,
+				Kind:        model.SpendAnomalyKindNewIp,
+				Detail:      "新的请求 IP：" + strings.Join(newIps, ", "),
+				WindowQuota: spend.Quota,
+				Action:      setting.SignalAction,
+			}, now) {
+				detected++
+			}
+		}
+		if setting.DetectModelSwitch {
+			newModels, err := newTokenLogValues(spend.TokenId, "model_name", baselineStart, windowStart, now)
+			if err != nil {
+				return detected, err
+			}
+			if len(newModels) > 0 && recordSpendAnomaly(setting, &model.SpendAnomaly{
+				UserId:      spend.UserId,
+				TokenId:     spend.TokenId,
+				TokenName:   spend.TokenName,
+				Kind:        model.SpendAnomalyKindModelSwitch,
+				Detail:      "首次使用模型：" + strings.Join(newModels, ", "),
+				WindowQuota: spend.Quota,
+				Action:      setting.SignalAction,
+			}, now) {
+				detected++
+			}
+		}
+	}
+
+	// 用户维度只做通知，避免误停用户所有令牌
+	userSpends, err := model.GetUserSpends(windowStart, now)
+	if err != nil {
+		return detected, err
+	}
+	for _, spend := range userSpends {
+		baselineQuota, _, err := model.GetSpendBetween(spend.UserId, 0, baselineStart, windowStart)
+		if err != nil {
+			return detected, err
+		}
+		baselineAvg := baselineQuota / baselineWindows
+		if isSpendVelocityAnomaly(setting, spend.Quota, baselineAvg) && recordSpendAnomaly(setting, &model.SpendAnomaly{
+			UserId:        spend.UserId,
+			Kind:          model.SpendAnomalyKindUserVelocity,
+			Detail:        fmt.Sprintf("账户 %d 分钟内消费 %s，基线平均 %s", setting.WindowMinutes, logger.FormatQuota(spend.Quota), logger.FormatQuota(baselineAvg)),
+			WindowQuota:   spend.Quota,
+			BaselineQuota: baselineAvg,
+			Action:        operation_setting.SpendAnomalyActionNotify,
+		}, now) {
+			detected++
+		}
+	}
+	return detected, nil
+}
+
+func isSpendVelocityAnomaly(setting *operation_setting.SpendAnomalySetting, windowQuota int, baselineAvg int) bool {
+	if windowQuota < setting.MinWindowQuota {
+		return false
+	}
+	return float64(windowQuota) > float64(baselineAvg)*setting.SpendMultiplier
+}
+
+// newTokenLogValues 返回窗口内出现但基线内未出现的取值，基线为空时视为未记录
+func newTokenLogValues(tokenId int, column string, baselineStart int64, windowStart int64, now int64) ([]string, error) {
+	known, err := model.GetTokenLogValues(tokenId, column, baselineStart, windowStart)
+	if err != nil || len(known) == 0 {
+		return nil, err
+	}
+	current, err := model.GetTokenLogValues(tokenId, column, windowStart, now)
+	if err != nil {
+		return nil, err
+	}
+	knownSet := make(map[string]struct{}, len(known))
+	for _, v := range known {
+		knownSet[v] = struct{}{}
+	}
+	var fresh []string
+	for _, v := range current {
+		if _, ok := knownSet[v]; !ok {
+			fresh = append(fresh, v)
+		}
+	}
+	return fresh, nil
+}
+
+// recordSpendAnomaly 记录异常并执行处理方式，冷却期内重复的异常返回 false
+func recordSpendAnomaly(setting *operation_setting.SpendAnomalySetting, anomaly *model.SpendAnomaly, now int64) bool {
+	since := now - int64(setting.CooldownMinutes)*60
+	exists, err := model.HasRecentSpendAnomaly(anomaly.UserId, anomaly.TokenId, anomaly.Kind, since)
+	if err != nil {
+		common.SysError("spend anomaly cooldown check failed: " + err.Error())
+		return false
+	}
+	if exists {
+		return false
+	}
+	if anomaly.TokenId == 0 {
+		anomaly.Action = operation_setting.SpendAnomalyActionNotify
+	}
+	if err := anomaly.Insert(); err != nil {
+		common.SysError("failed to record spend anomaly: " + err.Error())
+		return false
+	}
+
+	var status int
+	switch anomaly.Action {
+	case operation_setting.SpendAnomalyActionConfirm:
+		status = common.TokenStatusSuspended
+	case operation_setting.SpendAnomalyActionDisable:
+		status = common.TokenStatusDisabled
+	}
+	if status != 0 {
+		if _, err := model.SetTokenStatus(anomaly.TokenId, status); err != nil {
+			common.SysError(fmt.Sprintf("failed to update token %d status for spend anomaly: %s", anomaly.TokenId, err.Error()))
+		}
+	}
+	notifySpendAnomaly(anomaly)
+	return true
+}
+
+func spendAnomalyActionText(action string) string {
+	switch action {
+	case operation_setting.SpendAnomalyActionConfirm:
+		return "令牌已暂停，请在控制台确认是否为本人操作后恢复。"
+	case operation_setting.SpendAnomalyActionDisable:
+		return "令牌已被禁用，如有疑问请联系管理员。"
+	}
+	return "如非本人操作，请尽快禁用或删除该令牌。"
+}
+
+func notifySpendAnomaly(anomaly *model.SpendAnomaly) {
+	user, err := model.GetUserById(anomaly.UserId, false)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to load user %d for spend anomaly notify: %s", anomaly.UserId, err.Error()))
+		return
+	}
+	subject := "检测到异常消费"
+	content := anomaly.Detail
+	if anomaly.TokenName != "" {
+		content = fmt.Sprintf("令牌「%s」%s", anomaly.TokenName, content)
+	}
+	content += "。" + spendAnomalyActionText(anomaly.Action)
+	if err := NotifyUser(user.Id, user.Email, user.GetSetting(), dto.NewNotify(dto.NotifyTypeSpendAnomaly, subject, content, nil)); err != nil {
+		common.SysLog(fmt.Sprintf("failed to notify spend anomaly: %s", err.Error()))
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/jsonschema"
+)
+
+// 结构化输出：对 response_format: json_schema 的最终输出做网关侧校验，
+// 失败时按配置进行确定性修复或携带校验错误重新请求。
+
+// maxReportedSchemaErrors 限制写入提示词与日志的校验错误条数
+const maxReportedSchemaErrors = 10
+
+// GetResponseFormatSchema 返回请求中 json_schema 类型 response_format 的 schema
+func GetResponseFormatSchema(request *dto.GeneralOpenAIRequest) (any, bool) {
+	if request == nil || request.ResponseFormat == nil || request.ResponseFormat.Type != "json_schema" {
+		return nil, false
+	}
+	if len(request.ResponseFormat.JsonSchema) == 0 {
+		return nil, false
+	}
+	var format dto.FormatJsonSchema
+	if err := common.Unmarshal(request.ResponseFormat.JsonSchema, &format); err != nil || format.Schema == nil {
+		return nil, false
+	}
+	// schema 可能被编码为字符串
+	if raw, ok := format.Schema.(string); ok {
+		var schema any
+		if err := common.UnmarshalJsonStr(raw, &schema); err != nil {
+			return nil, false
+		}
+		return schema, true
+	}
+	return format.Schema, true
+}
+
+// ValidateStructuredOutput 校验内容是否符合 schema，返回校验错误列表
+func ValidateStructuredOutput(schema any, content string) []string {
+	errors := jsonschema.ValidateJSON(schema, []byte(strings.TrimSpace(content)))
+	if len(errors) > maxReportedSchemaErrors {
+		errors = errors[:maxReportedSchemaErrors]
+	}
+	return errors
+}
+
+// FixupStructuredOutput 对内容做确定性的 JSON 修复，修复后仍需重新校验
+func FixupStructuredOutput(content string) (string, bool) {
+	repaired, ok := RepairJSON(content)
+	if !ok || repaired == strings.TrimSpace(content) {
+		return "", false
+	}
+	return repaired, true
+}
+
+// BuildStructuredOutputRepairRequest 基于原始请求构造修复请求：追加上一轮不合法的输出与校验错误
+func BuildStructuredOutputRepairRequest(request *dto.GeneralOpenAIRequest, invalidContent string, errors []string) (*dto.GeneralOpenAIRequest, error) {
+	repairRequest, err := common.DeepCopy(request)
+	if err != nil {
+		return nil, err
+	}
+	assistantMessage := dto.Message{Role: "assistant"}
+	assistantMessage.SetStringContent(invalidContent)
+
+	var prompt strings.Builder
+	prompt.WriteString("Your previous reply does not conform to the required JSON schema. Validation errors:\n")
+	for _, e := range errors {
+		prompt.WriteString(fmt.Sprintf("- %s\n", e))
+	}
+	prompt.WriteString("Reply again with only the corrected JSON value, without code fences or any other text.")
+	userMessage := dto.Message{Role: "user"}
+	userMessage.SetStringContent(prompt.String())
+
+	repairRequest.Messages = append(repairRequest.Messages, assistantMessage, userMessage)
+	return repairRequest, nil
+}
+
+// AddUsage 将 delta 累加到 total，用于多次上游请求合并计费
+func AddUsage(total *dto.Usage, delta *dto.Usage) {
+	if total == nil || delta == nil {
+		return
+	}
+	total.PromptTokens += delta.PromptTokens
+	total.CompletionTokens += delta.CompletionTokens
+	total.TotalTokens += delta.TotalTokens
+	total.PromptCacheHitTokens += delta.PromptCacheHitTokens
+	total.InputTokens += delta.InputTokens
+	total.OutputTokens += delta.OutputTokens
+	total.ClaudeCacheCreation5mTokens += delta.ClaudeCacheCreation5mTokens
+	total.ClaudeCacheCreation1hTokens += delta.ClaudeCacheCreation1hTokens
+
+	total.PromptTokensDetails.CachedTokens += delta.PromptTokensDetails.CachedTokens
+	total.PromptTokensDetails.CachedCreationTokens += delta.PromptTokensDetails.CachedCreationTokens
+	total.PromptTokensDetails.TextTokens += delta.PromptTokensDetails.TextTokens
+	total.PromptTokensDetails.AudioTokens += delta.PromptTokensDetails.AudioTokens
+	total.PromptTokensDetails.ImageTokens += delta.PromptTokensDetails.ImageTokens
+
+	total.CompletionTokenDetails.TextTokens += delta.CompletionTokenDetails.TextTokens
+	total.CompletionTokenDetails.AudioTokens += delta.CompletionTokenDetails.AudioTokens
+	total.CompletionTokenDetails.ReasoningTokens += delta.CompletionTokenDetails.ReasoningTokens
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructuredOutputValidateAndFixup(t *testing.T) {
+	request := &dto.GeneralOpenAIRequest{
+		Messages: []dto.Message{{Role: "user", Content: "give me a person"}},
+		ResponseFormat: &dto.ResponseFormat{
+			Type:       "json_schema",
+			JsonSchema: json.RawMessage(`{"name":"person","schema":{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]}}`),
+		},
+	}
+
+	schema, ok := GetResponseFormatSchema(request)
+	require.True(t, ok)
+	require.Empty(t, ValidateStructuredOutput(schema, `{"name":"Ada"}`))
+
+	content := "```json\n{\"name\": \"Ada\",}\n```"
+	require.NotEmpty(t, ValidateStructuredOutput(schema, content))
+	fixed, ok := FixupStructuredOutput(content)
+	require.True(t, ok)
+	require.Empty(t, ValidateStructuredOutput(schema, fixed))
+
+	errors := ValidateStructuredOutput(schema, `{}`)
+	repairRequest, err := BuildStructuredOutputRepairRequest(request, `{}`, errors)
+	require.NoError(t, err)
+	require.Len(t, request.Messages, 1)
+	require.Len(t, repairRequest.Messages, 3)
+	require.Equal(t, "assistant", repairRequest.Messages[1].Role)
+	require.Contains(t, repairRequest.Messages[2].StringContent(), `missing required property "name"`)
+}
+
+func TestGetResponseFormatSchemaIgnoresJsonObject(t *testing.T) {
+	request := &dto.GeneralOpenAIRequest{ResponseFormat: &dto.ResponseFormat{Type: "json_object"}}
+
+	_, ok := GetResponseFormatSchema(request)
+
+	require.False(t, ok)
+}
@@ -81,14 +81,13 @@ func taskIsSubscription(task *model.Task) bool {
 }
 
 // taskAdjustFunding 调整任务的资金来源（钱包或订阅），delta > 0 表示扣费，delta < 0 表示退还。
-func taskAdjustFunding(task *model.Task, delta int) error {
+func taskAdjustFunding(task *model.Task, delta int, meta model.QuotaLedgerMeta) error {
 	if taskIsSubscription(task) {
 		return model.PostConsumeUserSubscriptionDelta(task.PrivateData.SubscriptionId, int64(delta))
 	}
-	if delta > 0 {
-		return model.DecreaseUserQuota(task.UserId, delta)
-	}
-	return model.IncreaseUserQuota(task.UserId, -delta, false)
+	meta.TokenId = task.PrivateData.TokenId
+	meta.ReferenceId = task.TaskID
+	return model.DeltaUpdateUserQuota(task.UserId, -delta, meta)
 }
 
 // taskAdjustTokenQuota 调整任务的令牌额度，delta > 0 表示扣费，delta < 0 表示退还。
@@ -149,7 +148,11 @@ func RefundTaskQuota(ctx context.Context, task *model.Task, reason string) {
 	}
 
 	// 1. 退还资金来源（钱包或订阅）
-	if err := taskAdjustFunding(task, -quota); err != nil {
+	refundMeta := model.QuotaLedgerMeta{
+		Type:           model.QuotaLedgerTypeRefund,
+		IdempotencyKey: "refund:task:" + task.TaskID,
+	}
+	if err := taskAdjustFunding(task, -quota, refundMeta); err != nil {
 		logger.LogWarn(ctx, fmt.Sprintf("退还资金来源失败 task %s: %s", task.TaskID, err.Error()))
 		return
 	}
@@ -199,7 +202,7 @@ func RecalculateTaskQuota(ctx context.Context, task *model.Task, actualQuota int
 	))
 
 	// 调整资金来源
-	if err := taskAdjustFunding(task, quotaDelta); err != nil {
+	if err := taskAdjustFunding(task, quotaDelta, model.QuotaLedgerMeta{Type: model.QuotaLedgerTypeSettle}); err != nil {
 		logger.LogError(ctx, fmt.Sprintf("差额结算资金调整失败 task %s: %s", task.TaskID, err.Error()))
 		return
 	}
@@ -43,6 +43,19 @@ func TestMain(m *testing.M) {
 		&model.Log{},
 		&model.Channel{},
 		&model.UserSubscription{},
+		&model.QuotaLedger{},
+		&model.Ability{},
+		&model.Option{},
+		&model.Vendor{},
+		&model.Model{},
+		&model.PrefillGroup{},
+		&model.SubscriptionPlan{},
+		&model.CustomOAuthProvider{},
+		&model.Role{},
+		&model.UserRole{},
+		&model.ScimUser{},
+		&model.ScimGroup{},
+		&model.ScimGroupMember{},
 	); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
@@ -63,6 +76,7 @@ func truncate(t *testing.T) {
 		model.DB.Exec("DELETE FROM logs")
 		model.DB.Exec("DELETE FROM channels")
 		model.DB.Exec("DELETE FROM user_subscriptions")
+		model.DB.Exec("DELETE FROM quota_ledgers")
 	})
 }
 
@@ -64,6 +64,14 @@ func cacheWriteTokensTotal(summary textQuotaSummary) int {
 	return summary.CacheCreationTokens
 }
 
+// pricingTierPromptTokens 返回用于上下文分档的完整提示 tokens，Claude 语义下 prompt_tokens 不含缓存读写
+func pricingTierPromptTokens(summary textQuotaSummary, legacyClaudeDerived bool) int {
+	if summary.IsClaudeUsageSemantic || legacyClaudeDerived {
+		return summary.PromptTokens + summary.CacheTokens + cacheWriteTokensTotal(summary)
+	}
+	return summary.PromptTokens
+}
+
 func isLegacyClaudeDerivedOpenAIUsage(relayInfo *relaycommon.RelayInfo, usage *dto.Usage) bool {
 	if relayInfo == nil || usage == nil {
 		return false
@@ -114,6 +122,17 @@ func calculateTextQuotaSummary(ctx *gin.Context, relayInfo *relaycommon.RelayInf
 	summary.AudioTokens = usage.PromptTokensDetails.AudioTokens
 	legacyClaudeDerived := isLegacyClaudeDerivedOpenAIUsage(relayInfo, usage)
 
+	if !relayInfo.PriceData.UsePrice && len(relayInfo.PriceData.PricingTiers) > 0 {
+		// 按实际提示 tokens 重新选择上下文分档
+		relayInfo.PriceData.ApplyPricingTier(pricingTierPromptTokens(summary, legacyClaudeDerived))
+		summary.ModelRatio = relayInfo.PriceData.ModelRatio
+		summary.CompletionRatio = relayInfo.PriceData.CompletionRatio
+		summary.CacheRatio = relayInfo.PriceData.CacheRatio
+		summary.CacheCreationRatio = relayInfo.PriceData.CacheCreationRatio
+		summary.CacheCreationRatio5m = relayInfo.PriceData.CacheCreation5mRatio
+		summary.CacheCreationRatio1h = relayInfo.PriceData.CacheCreation1hRatio
+	}
+
 	if relayInfo.ChannelMeta != nil && relayInfo.ChannelType == constant.ChannelTypeOpenRouter {
 		summary.PromptTokens -= summary.CacheTokens
 		isUsingCustomSettings := relayInfo.PriceData.UsePrice || hasCustomModelRatio(summary.ModelName, relayInfo.PriceData.ModelRatio)
@@ -410,6 +429,7 @@ func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 		other["input_tokens_total"] = usage.InputTokens
 	}
 
+	RecordEndUserUsage(ctx, relayInfo, summary.PromptTokens+summary.CompletionTokens, summary.Quota)
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     summary.PromptTokens,
@@ -204,3 +204,56 @@ func TestCalculateTextQuotaSummaryHandlesLegacyClaudeDerivedOpenAIUsage(t *testi
 	// 62 + 3544*0.1 + 586*1.25 + 95*5 = 1624.9 => 1624
 	require.Equal(t, 1624, summary.Quota)
 }
+
+func TestCalculateTextQuotaSummarySelectsPricingTierFromActualUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	cacheRatio := 0.2
+	priceData := types.PriceData{
+		ModelRatio:      1,
+		CompletionRatio: 4,
+		CacheRatio:      0.1,
+		GroupRatioInfo: types.GroupRatioInfo{
+			GroupRatio: 1,
+		},
+	}
+	// 预扣时按估算未超过阈值，使用基础倍率
+	priceData.SetPricingTiers([]types.PricingTier{
+		{Threshold: 1000, ModelRatio: 2, CacheRatio: &cacheRatio},
+	}, 500)
+	require.Nil(t, priceData.PricingTier)
+
+	relayInfo := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatOpenAI,
+		OriginModelName: "gemini-2.5-pro",
+		PriceData:       priceData,
+		StartTime:       time.Now(),
+	}
+	usage := &dto.Usage{
+		PromptTokens:     2000,
+		CompletionTokens: 100,
+		PromptTokensDetails: dto.InputTokenDetails{
+			CachedTokens: 1000,
+		},
+	}
+
+	summary := calculateTextQuotaSummary(ctx, relayInfo, usage)
+
+	require.NotNil(t, relayInfo.PriceData.PricingTier)
+	require.Equal(t, 1000, relayInfo.PriceData.PricingTier.Threshold)
+	require.Equal(t, 2.0, summary.ModelRatio)
+	require.Equal(t, 4.0, summary.CompletionRatio)
+	require.Equal(t, 0.2, summary.CacheRatio)
+	// (1000 + 1000*0.2 + 100*4) * 2
+	require.Equal(t, 3200, summary.Quota)
+
+	// 实际用量回落到阈值以下时恢复基础倍率
+	usage.PromptTokens = 800
+	usage.PromptTokensDetails.CachedTokens = 0
+	summary = calculateTextQuotaSummary(ctx, relayInfo, usage)
+	require.Nil(t, relayInfo.PriceData.PricingTier)
+	require.Equal(t, 1.0, summary.ModelRatio)
+	require.Equal(t, 1200, summary.Quota)
+}
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// 工具调用模拟：为不支持原生 function calling 的上游，将工具定义渲染进提示词，
+// 再从模型输出中解析严格格式的调用块并还原为 OpenAI tool_calls。
+
+const (
+	emulatedToolCallOpenTag    = "<tool_call>"
+	emulatedToolCallCloseTag   = "</tool_call>"
+	emulatedToolResultOpenTag  = "<tool_result"
+	emulatedToolResultCloseTag = "</tool_result>"
+)
+
+var trailingCommaRegex = regexp.MustCompile(`,\s*([}\]])`)
+
+type emulatedToolCall struct {
+	Name      string `json:"name"`
+	Arguments any    `json:"arguments"`
+	// 部分模型会输出 parameters 而不是 arguments
+	Parameters any `json:"parameters,omitempty"`
+}
+
+// ApplyToolEmulation 将请求中的 tools/tool_choice 渲染为系统提示词，并把历史中的
+// tool_calls 与 tool 消息改写为纯文本。返回可被解析为调用的工具名集合；
+// tool_choice 为 none 时仅移除工具定义，返回空集合。
+func ApplyToolEmulation(request *dto.GeneralOpenAIRequest) map[string]struct{} {
+	toolNames := make(map[string]struct{}, len(request.Tools))
+	toolChoice := request.ToolChoice
+	parallelToolCalls := request.ParallelTooCalls
+	tools := request.Tools
+
+	request.Tools = nil
+	request.ToolChoice = nil
+	request.ParallelTooCalls = nil
+	request.Messages = rewriteToolHistoryMessages(request.Messages)
+
+	if choice, ok := toolChoice.(string); ok && choice == "none" {
+		return toolNames
+	}
+
+	definitions := make([]map[string]any, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Type != "" && tool.Type != "function" {
+			continue
+		}
+		if tool.Function.Name == "" {
+			continue
+		}
+		toolNames[tool.Function.Name] = struct{}{}
+		definition := map[string]any{
+			"name": tool.Function.Name,
+		}
+		if tool.Function.Description != "" {
+			definition["description"] = tool.Function.Description
+		}
+		if tool.Function.Parameters != nil {
+			definition["parameters"] = tool.Function.Parameters
+		}
+		definitions = append(definitions, definition)
+	}
+	if len(definitions) == 0 {
+		return toolNames
+	}
+
+	definitionsJson, _ := common.Marshal(definitions)
+	var prompt strings.Builder
+	prompt.WriteString("You can call the following tools. To call a tool, reply with one block per call in exactly this format:\n")
+	prompt.WriteString(emulatedToolCallOpenTag + "\n")
+	prompt.WriteString(`{"name": "<tool name>", "arguments": {<arguments as a JSON object>}}` + "\n")
+	prompt.WriteString(emulatedToolCallCloseTag + "\n")
+	prompt.WriteString("The block content must be valid JSON. Do not wrap blocks in code fences. ")
+	prompt.WriteString("Tool results will be sent back to you inside <tool_result> blocks.\n")
+	switch choice := toolChoice.(type) {
+	case string:
+		if choice == "required" {
+			prompt.WriteString("You must call at least one tool in your reply.\n")
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				prompt.WriteString(fmt.Sprintf("You must call the tool %q in your reply.\n", name))
+			}
+		}
+	}
+	if parallelToolCalls != nil && !*parallelToolCalls {
+		prompt.WriteString("Call at most one tool per reply.\n")
+	}
+	prompt.WriteString("\nAvailable tools:\n")
+	prompt.Write(definitionsJson)
+
+	appendSystemPrompt(request, prompt.String())
+	return toolNames
+}
+
+func appendSystemPrompt(request *dto.GeneralOpenAIRequest, prompt string) {
+	systemRole := request.GetSystemRoleName()
+	for i, message := range request.Messages {
+		if message.Role != "system" && message.Role != "developer" {
+			continue
+		}
+		if message.IsStringContent() {
+			request.Messages[i].SetStringContent(message.StringContent() + "\n\n" + prompt)
+		} else {
+			contents := message.ParseContent()
+			contents = append(contents, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: prompt,
+			})
+			request.Messages[i].SetMediaContent(contents)
+		}
+		return
+	}
+	systemMessage := dto.Message{
+		Role: systemRole,
+	}
+	systemMessage.SetStringContent(prompt)
+	request.Messages = append([]dto.Message{systemMessage}, request.Messages...)
+}
+
+// rewriteToolHistoryMessages 将 assistant 的 tool_calls 与 tool 角色消息转换为模拟格式的纯文本，
+// 连续的工具结果合并为一条 user 消息。
+func rewriteToolHistoryMessages(messages []dto.Message) []dto.Message {
+	toolNamesById := make(map[string]string)
+	rewritten := make([]dto.Message, 0, len(messages))
+	for _, message := range messages {
+		switch {
+		case message.Role == "assistant" && len(message.ToolCalls) > 0:
+			var text strings.Builder
+			text.WriteString(messageText(message))
+			for _, toolCall := range message.ParseToolCalls() {
+				toolNamesById[toolCall.ID] = toolCall.Function.Name
+				arguments := toolCall.Function.Arguments
+				if strings.TrimSpace(arguments) == "" {
+					arguments = "{}"
+				}
+				if text.Len() > 0 {
+					text.WriteString("\n")
+				}
+				text.WriteString(emulatedToolCallOpenTag + "\n")
+				text.WriteString(fmt.Sprintf(`{"name": %q, "arguments": %s}`, toolCall.Function.Name, arguments))
+				text.WriteString("\n" + emulatedToolCallCloseTag)
+			}
+			assistantMessage := dto.Message{Role: "assistant"}
+			assistantMessage.SetStringContent(text.String())
+			rewritten = append(rewritten, assistantMessage)
+		case message.Role == "tool":
+			result := fmt.Sprintf("%s name=%q id=%q>\n%s\n%s", emulatedToolResultOpenTag,
+				toolNamesById[message.ToolCallId], message.ToolCallId, messageText(message), emulatedToolResultCloseTag)
+			if n := len(rewritten); n > 0 && rewritten[n-1].Role == "user" && strings.HasPrefix(rewritten[n-1].StringContent(), emulatedToolResultOpenTag) {
+				rewritten[n-1].SetStringContent(rewritten[n-1].StringContent() + "\n" + result)
+				continue
+			}
+			userMessage := dto.Message{Role: "user"}
+			userMessage.SetStringContent(result)
+			rewritten = append(rewritten, userMessage)
+		default:
+			rewritten = append(rewritten, message)
+		}
+	}
+	return rewritten
+}
+
+func messageText(message dto.Message) string {
+	if message.IsStringContent() {
+		return message.StringContent()
+	}
+	var texts []string
+	for _, content := range message.ParseContent() {
+		if content.Type == dto.ContentTypeText && content.Text != "" {
+			texts = append(texts, content.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ParseEmulatedToolCalls 从模型输出中解析模拟格式的工具调用，返回剩余文本与解析出的调用。
+// 未知工具名或无法修复的 JSON 会保留在文本中。
+func ParseEmulatedToolCalls(content string, toolNames map[string]struct{}) (string, []dto.ToolCallResponse) {
+	var toolCalls []dto.ToolCallResponse
+	var text strings.Builder
+	rest := content
+	for {
+		start := strings.Index(rest, emulatedToolCallOpenTag)
+		if start < 0 {
+			text.WriteString(rest)
+			break
+		}
+		body := rest[start+len(emulatedToolCallOpenTag):]
+		end := strings.Index(body, emulatedToolCallCloseTag)
+		next := ""
+		if end >= 0 {
+			next = body[end+len(emulatedToolCallCloseTag):]
+			body = body[:end]
+		}
+		toolCall, ok := parseEmulatedToolCall(body, toolNames)
+		if ok {
+			text.WriteString(rest[:start])
+			toolCalls = append(toolCalls, toolCall)
+		} else if end >= 0 {
+			text.WriteString(rest[:start+len(emulatedToolCallOpenTag)+end+len(emulatedToolCallCloseTag)])
+		} else {
+			text.WriteString(rest)
+		}
+		if end < 0 {
+			break
+		}
+		rest = next
+	}
+	return strings.TrimSpace(text.String()), toolCalls
+}
+
+func parseEmulatedToolCall(body string, toolNames map[string]struct{}) (dto.ToolCallResponse, bool) {
+	var call emulatedToolCall
+	if !unmarshalWithRepair(body, &call) {
+		return dto.ToolCallResponse{}, false
+	}
+	if _, ok := toolNames[call.Name]; !ok {
+		return dto.ToolCallResponse{}, false
+	}
+	arguments := call.Arguments
+	if arguments == nil {
+		arguments = call.Parameters
+	}
+	argumentsJson := "{}"
+	switch args := arguments.(type) {
+	case nil:
+	case string:
+		// 参数被编码为字符串时，尝试还原为 JSON 对象
+		var parsed map[string]any
+		if unmarshalWithRepair(args, &parsed) {
+			normalized, _ := common.Marshal(parsed)
+			argumentsJson = string(normalized)
+		}
+	default:
+		normalized, err := common.Marshal(args)
+		if err != nil {
+			return dto.ToolCallResponse{}, false
+		}
+		argumentsJson = string(normalized)
+	}
+	return dto.ToolCallResponse{
+		ID:   fmt.Sprintf("call_%s", common.GetRandomString(24)),
+		Type: "function",
+		Function: dto.FunctionResponse{
+			Name:      call.Name,
+			Arguments: argumentsJson,
+		},
+	}, true
+}
+
+// ApplyEmulatedToolCalls 将响应中模拟格式的调用改写为 OpenAI tool_calls，返回是否发生改写
+func ApplyEmulatedToolCalls(response *dto.OpenAITextResponse, toolNames map[string]struct{}) bool {
+	if response == nil || len(toolNames) == 0 {
+		return false
+	}
+	converted := false
+	for i, choice := range response.Choices {
+		text, toolCalls := ParseEmulatedToolCalls(messageText(choice.Message), toolNames)
+		if len(toolCalls) == 0 {
+			continue
+		}
+		converted = true
+		if text == "" {
+			response.Choices[i].Message.SetNullContent()
+		} else {
+			response.Choices[i].Message.SetStringContent(text)
+		}
+		response.Choices[i].Message.SetToolCalls(toolCalls)
+		response.Choices[i].FinishReason = constant.FinishReasonToolCalls
+	}
+	return converted
+}
+
+// RepairJSON 对模型输出的 JSON 做确定性修复，依次尝试：去除代码块标记、截取最外层对象、
+// 删除尾随逗号、补全未闭合的字符串与括号。返回修复后可解析的 JSON 文本。
+func RepairJSON(raw string) (string, bool) {
+	candidate := strings.TrimSpace(raw)
+	if json.Valid([]byte(candidate)) {
+		return candidate, true
+	}
+	candidate = strings.TrimPrefix(candidate, "```json")
+	candidate = strings.TrimPrefix(candidate, "```")
+	candidate = strings.TrimSuffix(candidate, "```")
+	candidate = strings.TrimSpace(candidate)
+	if start := strings.IndexAny(candidate, "{["); start > 0 {
+		candidate = candidate[start:]
+	}
+	if end := strings.LastIndexAny(candidate, "}]"); end >= 0 && end < len(candidate)-1 {
+		candidate = candidate[:end+1]
+	}
+	if json.Valid([]byte(candidate)) {
+		return candidate, true
+	}
+	candidate = trailingCommaRegex.ReplaceAllString(candidate, "$1")
+	if json.Valid([]byte(candidate)) {
+		return candidate, true
+	}
+	candidate = closeUnbalancedJson(candidate)
+	if json.Valid([]byte(candidate)) {
+		return candidate, true
+	}
+	return "", false
+}
+
+func unmarshalWithRepair(raw string, v any) bool {
+	repaired, ok := RepairJSON(raw)
+	if !ok {
+		return false
+	}
+	return common.UnmarshalJsonStr(repaired, v) == nil
+}
+
+func closeUnbalancedJson(s string) string {
+	var stack []byte
+	inString := false
+	escaped := false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				inString = false
+			}
+			continue
+		}
+		switch ch {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) > 0 && stack[len(stack)-1] == ch {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	var b strings.Builder
+	b.WriteString(s)
+	if inString {
+		b.WriteByte('"')
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		b.WriteByte(stack[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyToolEmulationRewritesRequest(t *testing.T) {
+	request := &dto.GeneralOpenAIRequest{
+		Model: "llama3",
+		Messages: []dto.Message{
+			{Role: "system", Content: "be concise"},
+			{Role: "user", Content: "weather in Paris?"},
+			{Role: "assistant", ToolCalls: json.RawMessage(`[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]`)},
+			{Role: "tool", ToolCallId: "call_1", Content: "sunny"},
+		},
+		Tools: []dto.ToolCallRequest{
+			{Type: "function", Function: dto.FunctionRequest{Name: "get_weather", Parameters: map[string]any{"type": "object"}}},
+		},
+		ToolChoice: "required",
+	}
+
+	toolNames := ApplyToolEmulation(request)
+
+	require.Contains(t, toolNames, "get_weather")
+	require.Nil(t, request.Tools)
+	require.Nil(t, request.ToolChoice)
+	require.Len(t, request.Messages, 4)
+	system := request.Messages[0].StringContent()
+	require.True(t, strings.HasPrefix(system, "be concise"))
+	require.Contains(t, system, `"name":"get_weather"`)
+	require.Contains(t, system, "You must call at least one tool")
+	require.Empty(t, request.Messages[2].ToolCalls)
+	require.Contains(t, request.Messages[2].StringContent(), `{"name": "get_weather", "arguments": {"city":"Paris"}}`)
+	require.Equal(t, "user", request.Messages[3].Role)
+	require.Contains(t, request.Messages[3].StringContent(), `name="get_weather" id="call_1"`)
+}
+
+func TestApplyToolEmulationToolChoiceNone(t *testing.T) {
+	request := &dto.GeneralOpenAIRequest{
+		Messages:   []dto.Message{{Role: "user", Content: "hi"}},
+		Tools:      []dto.ToolCallRequest{{Type: "function", Function: dto.FunctionRequest{Name: "f"}}},
+		ToolChoice: "none",
+	}
+
+	toolNames := ApplyToolEmulation(request)
+
+	require.Empty(t, toolNames)
+	require.Len(t, request.Messages, 1)
+}
+
+func TestParseEmulatedToolCallsWithRepair(t *testing.T) {
+	toolNames := map[string]struct{}{"get_weather": {}, "search": {}}
+	content := "Let me check.\n<tool_call>\n```json\n{\"name\": \"get_weather\", \"arguments\": {\"city\": \"Paris\",}}\n```\n</tool_call>\n" +
+		"<tool_call>{\"name\": \"unknown\", \"arguments\": {}}</tool_call>\n" +
+		"<tool_call>{\"name\": \"search\", \"arguments\": \"{\\\"q\\\": \\\"news\\\"}\""
+
+	text, toolCalls := ParseEmulatedToolCalls(content, toolNames)
+
+	require.Len(t, toolCalls, 2)
+	require.Equal(t, "get_weather", toolCalls[0].Function.Name)
+	require.JSONEq(t, `{"city":"Paris"}`, toolCalls[0].Function.Arguments)
+	require.Equal(t, "search", toolCalls[1].Function.Name)
+	require.JSONEq(t, `{"q":"news"}`, toolCalls[1].Function.Arguments)
+	require.True(t, strings.HasPrefix(toolCalls[0].ID, "call_"))
+	require.Contains(t, text, "Let me check.")
+	require.Contains(t, text, `"unknown"`)
+}
+
+func TestApplyEmulatedToolCallsSetsFinishReason(t *testing.T) {
+	message := dto.Message{Role: "assistant"}
+	message.SetStringContent(`<tool_call>{"name":"search","arguments":{"q":"go"}}</tool_call>`)
+	response := &dto.OpenAITextResponse{
+		Choices: []dto.OpenAITextResponseChoice{{Message: message, FinishReason: "stop"}},
+	}
+
+	converted := ApplyEmulatedToolCalls(response, map[string]struct{}{"search": {}})
+
+	require.True(t, converted)
+	require.Equal(t, "tool_calls", response.Choices[0].FinishReason)
+	require.Nil(t, response.Choices[0].Content)
+	require.Len(t, response.Choices[0].ParseToolCalls(), 1)
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BuildVirtualModelFeatures 从请求与 token 预估结果中提取虚拟模型路由所需的特征
+func BuildVirtualModelFeatures(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request, meta *types.TokenCountMeta, promptTokens int) model_setting.VirtualModelFeatures {
+	features := model_setting.VirtualModelFeatures{
+		PromptTokens: promptTokens,
+		Group:        info.UsingGroup,
+	}
+	if c != nil && c.Request != nil {
+		features.Headers = c.Request.Header
+	}
+	if meta != nil {
+		features.HasTools = meta.ToolsCount > 0
+		for _, file := range meta.Files {
+			switch file.FileType {
+			case types.FileTypeImage:
+				features.HasImage = true
+			case types.FileTypeAudio:
+				features.HasAudio = true
+			}
+		}
+	}
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		features.ReasoningEffort = r.ReasoningEffort
+		features.HasTools = features.HasTools || len(r.Tools) > 0
+	case *dto.OpenAIResponsesRequest:
+		if r.Reasoning != nil {
+			features.ReasoningEffort = r.Reasoning.Effort
+		}
+		features.HasTools = features.HasTools || len(r.Tools) > 0 && strings.TrimSpace(string(r.Tools)) != "[]"
+	case *dto.ClaudeRequest:
+		features.HasTools = features.HasTools || r.Tools != nil
+	}
+	return features
+}
+
+// ResolveVirtualModel 将虚拟模型解析为具体模型，成功时更新 RelayInfo 的模型名，后续定价与渠道选择均按具体模型进行。
+// 与跨模型回退一致，令牌不允许的目标模型会被跳过
+func ResolveVirtualModel(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request, meta *types.TokenCountMeta, promptTokens int) (string, bool) {
+	virtualModel := info.OriginModelName
+	features := BuildVirtualModelFeatures(c, info, request, meta, promptTokens)
+	target, rule, ok := model_setting.GetVirtualModelSettings().Resolve(virtualModel, features, func(target string) bool {
+		return IsModelAllowedForToken(c, target)
+	})
+	if !ok {
+		return "", false
+	}
+	info.VirtualModelName = virtualModel
+	info.VirtualModelRule = rule
+	info.OriginModelName = target
+	return target, true
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveVirtualModel(t *testing.T) {
+	settings := model_setting.GetVirtualModelSettings()
+	original := *settings
+	t.Cleanup(func() { *settings = original })
+	hasImage := true
+	settings.Enabled = true
+	settings.Models = map[string]model_setting.VirtualModel{
+		"smart-router": {
+			Rules: []model_setting.VirtualModelRule{
+				{Name: "vision", Target: "gpt-4o", HasImage: &hasImage},
+				{Name: "long", Target: "gpt-4.1", MinPromptTokens: 8000},
+				{Name: "beta", Target: "o3", Header: "X-Route", HeaderValues: []string{"beta"}},
+				{Target: "o4-mini", ReasoningEffort: []string{"high"}},
+			},
+			Default: "gpt-4o-mini",
+		},
+	}
+
+	resolve := func(request dto.Request, meta *types.TokenCountMeta, tokens int, header string) (*relaycommon.RelayInfo, string) {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		if header != "" {
+			ctx.Request.Header.Set("X-Route", header)
+		}
+		info := &relaycommon.RelayInfo{OriginModelName: "smart-router"}
+		target, ok := ResolveVirtualModel(ctx, info, request, meta, tokens)
+		require.True(t, ok)
+		return info, target
+	}
+
+	info, target := resolve(&dto.GeneralOpenAIRequest{}, &types.TokenCountMeta{Files: []*types.FileMeta{{FileType: types.FileTypeImage}}}, 10, "")
+	require.Equal(t, "gpt-4o", target)
+	require.Equal(t, "gpt-4o", info.OriginModelName)
+	require.Equal(t, "smart-router", info.VirtualModelName)
+	require.Equal(t, "vision", info.VirtualModelRule)
+
+	_, target = resolve(&dto.GeneralOpenAIRequest{}, &types.TokenCountMeta{}, 9000, "")
+	require.Equal(t, "gpt-4.1", target)
+
+	_, target = resolve(&dto.GeneralOpenAIRequest{}, &types.TokenCountMeta{}, 10, "beta")
+	require.Equal(t, "o3", target)
+
+	info, target = resolve(&dto.GeneralOpenAIRequest{ReasoningEffort: "high"}, &types.TokenCountMeta{}, 10, "")
+	require.Equal(t, "o4-mini", target)
+	require.Equal(t, "rule_4", info.VirtualModelRule)
+
+	info, target = resolve(&dto.GeneralOpenAIRequest{}, &types.TokenCountMeta{}, 10, "")
+	require.Equal(t, "gpt-4o-mini", target)
+	require.Empty(t, info.VirtualModelRule)
+
+	// 令牌不允许的目标模型被跳过，与跨模型回退一致
+	limited := func(allowed map[string]bool) (*gin.Context, *relaycommon.RelayInfo) {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		common.SetContextKey(ctx, constant.ContextKeyTokenModelLimitEnabled, true)
+		common.SetContextKey(ctx, constant.ContextKeyTokenModelLimit, allowed)
+		return ctx, &relaycommon.RelayInfo{OriginModelName: "smart-router"}
+	}
+	imageMeta := &types.TokenCountMeta{Files: []*types.FileMeta{{FileType: types.FileTypeImage}}}
+	ctx, info := limited(map[string]bool{"smart-router": true, "gpt-4o-mini": true})
+	target, ok := ResolveVirtualModel(ctx, info, &dto.GeneralOpenAIRequest{}, imageMeta, 10)
+	require.True(t, ok)
+	require.Equal(t, "gpt-4o-mini", target)
+
+	ctx, info = limited(map[string]bool{"smart-router": true})
+	_, ok = ResolveVirtualModel(ctx, info, &dto.GeneralOpenAIRequest{}, imageMeta, 10)
+	require.False(t, ok)
+	require.Equal(t, "smart-router", info.OriginModelName)
+}
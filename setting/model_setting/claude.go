@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/setting/config"
 )
 
@@ -19,6 +20,8 @@ type ClaudeSettings struct {
 	DefaultMaxTokens                      map[string]int                 `json:"default_max_tokens"`
 	ThinkingAdapterEnabled                bool                           `json:"thinking_adapter_enabled"`
 	ThinkingAdapterBudgetTokensPercentage float64                        `json:"thinking_adapter_budget_tokens_percentage"`
+	// PromptCacheGroupSettings 按分组配置的自动 prompt caching 策略，渠道级配置优先
+	PromptCacheGroupSettings map[string]dto.ClaudePromptCacheSettings `json:"prompt_cache_group_settings"`
 }
 
 // 默认配置
@@ -29,6 +32,7 @@ var defaultClaudeSettings = ClaudeSettings{
 		"default": 8192,
 	},
 	ThinkingAdapterBudgetTokensPercentage: 0.8,
+	PromptCacheGroupSettings:              map[string]dto.ClaudePromptCacheSettings{},
 }
 
 // 全局实例
@@ -87,3 +91,11 @@ func (c *ClaudeSettings) GetDefaultMaxTokens(model string) int {
 	}
 	return c.DefaultMaxTokens["default"]
 }
+
+// GetPromptCacheSettings 返回指定分组的自动 prompt caching 策略，未配置时返回 nil
+func (c *ClaudeSettings) GetPromptCacheSettings(group string) *dto.ClaudePromptCacheSettings {
+	if setting, ok := c.PromptCacheGroupSettings[group]; ok && setting.Enabled {
+		return &setting
+	}
+	return nil
+}
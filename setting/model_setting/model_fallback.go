@@ -0,0 +1,62 @@
+package model_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ModelFallbackGroupAll 对所有分组生效的回退链配置键
+const ModelFallbackGroupAll = "*"
+
+// ModelFallbackSettings 跨模型回退链：当前模型的渠道全部不可用或重试用尽时，依次切换到备选模型
+type ModelFallbackSettings struct {
+	Enabled bool `json:"enabled"`
+	// GroupChains 分组 -> 模型 -> 备选模型列表，分组 "*" 对所有分组生效
+	GroupChains map[string]map[string][]string `json:"group_chains"`
+	// AllowClientModels 是否允许客户端通过请求体 models 字段指定备选模型
+	AllowClientModels bool `json:"allow_client_models"`
+	// MaxHops 单次请求最多切换的模型数
+	MaxHops int `json:"max_hops"`
+}
+
+// 默认配置
+var defaultModelFallbackSettings = ModelFallbackSettings{
+	Enabled:           false,
+	GroupChains:       map[string]map[string][]string{},
+	AllowClientModels: true,
+	MaxHops:           3,
+}
+
+// 全局实例
+var modelFallbackSettings = defaultModelFallbackSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("model_fallback", &modelFallbackSettings)
+}
+
+func GetModelFallbackSettings() *ModelFallbackSettings {
+	return &modelFallbackSettings
+}
+
+// GetGroupChain 返回分组下模型的备选模型列表，分组未配置时使用 "*"
+func (s *ModelFallbackSettings) GetGroupChain(group string, modelName string) []string {
+	if chains, ok := s.GroupChains[group]; ok {
+		if chain, ok := chains[modelName]; ok {
+			return chain
+		}
+	}
+	if chains, ok := s.GroupChains[ModelFallbackGroupAll]; ok {
+		return chains[modelName]
+	}
+	return nil
+}
+
+func (s *ModelFallbackSettings) GetMaxHops() int {
+	if s.MaxHops <= 0 {
+		return 0
+	}
+	if s.MaxHops > 10 {
+		return 10
+	}
+	return s.MaxHops
+}
@@ -0,0 +1,61 @@
+package model_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	StructuredOutputRepairModeReprompt = "reprompt" // 携带校验错误重新请求上游
+	StructuredOutputRepairModeFixup    = "fixup"    // 仅做确定性的 JSON 语法修复
+)
+
+// StructuredOutputSettings 网关侧的 response_format: json_schema 校验与修复
+type StructuredOutputSettings struct {
+	Enabled bool `json:"enabled"`
+	// ChannelTypes 为空时对所有渠道生效
+	ChannelTypes      []int  `json:"channel_types"`
+	MaxRepairAttempts int    `json:"max_repair_attempts"`
+	RepairMode        string `json:"repair_mode"`
+	// StrictMode 修复失败时返回错误而不是不合法的 JSON
+	StrictMode bool `json:"strict_mode"`
+}
+
+// 默认配置
+var defaultStructuredOutputSettings = StructuredOutputSettings{
+	Enabled:           false,
+	ChannelTypes:      []int{},
+	MaxRepairAttempts: 1,
+	RepairMode:        StructuredOutputRepairModeReprompt,
+	StrictMode:        false,
+}
+
+// 全局实例
+var structuredOutputSettings = defaultStructuredOutputSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("structured_output", &structuredOutputSettings)
+}
+
+func GetStructuredOutputSettings() *StructuredOutputSettings {
+	return &structuredOutputSettings
+}
+
+func (s *StructuredOutputSettings) IsChannelEnabled(channelType int) bool {
+	if !s.Enabled {
+		return false
+	}
+	return len(s.ChannelTypes) == 0 || slices.Contains(s.ChannelTypes, channelType)
+}
+
+func (s *StructuredOutputSettings) GetMaxRepairAttempts() int {
+	if s.MaxRepairAttempts < 0 {
+		return 0
+	}
+	if s.MaxRepairAttempts > 5 {
+		return 5
+	}
+	return s.MaxRepairAttempts
+}
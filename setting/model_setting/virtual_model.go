@@ -0,0 +1,157 @@
+package model_setting
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// VirtualModelRule 虚拟模型的路由规则，所有已设置的条件同时满足时命中
+type VirtualModelRule struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	// MinPromptTokens / MaxPromptTokens 预估输入 token 范围，0 表示不限制
+	MinPromptTokens int   `json:"min_prompt_tokens,omitempty"`
+	MaxPromptTokens int   `json:"max_prompt_tokens,omitempty"`
+	HasImage        *bool `json:"has_image,omitempty"`
+	HasAudio        *bool `json:"has_audio,omitempty"`
+	HasTools        *bool `json:"has_tools,omitempty"`
+	// ReasoningEffort 匹配任一推理强度，"none" 表示请求未指定
+	ReasoningEffort []string `json:"reasoning_effort,omitempty"`
+	Groups          []string `json:"groups,omitempty"`
+	// Header / HeaderValues 匹配请求头，HeaderValues 为空时仅要求请求头存在
+	Header       string   `json:"header,omitempty"`
+	HeaderValues []string `json:"header_values,omitempty"`
+}
+
+// VirtualModel 按顺序匹配规则，均未命中时使用 Default
+type VirtualModel struct {
+	Description string             `json:"description,omitempty"`
+	Rules       []VirtualModelRule `json:"rules"`
+	Default     string             `json:"default"`
+}
+
+// VirtualModelFeatures 用于规则匹配的请求特征
+type VirtualModelFeatures struct {
+	PromptTokens    int         `json:"prompt_tokens"`
+	HasImage        bool        `json:"has_image"`
+	HasAudio        bool        `json:"has_audio"`
+	HasTools        bool        `json:"has_tools"`
+	ReasoningEffort string      `json:"reasoning_effort"`
+	Group           string      `json:"group"`
+	Headers         http.Header `json:"headers,omitempty"`
+}
+
+// VirtualModelSettings 虚拟模型：对外暴露的模型名在请求时按请求特征解析为具体模型
+type VirtualModelSettings struct {
+	Enabled bool                    `json:"enabled"`
+	Models  map[string]VirtualModel `json:"models"`
+}
+
+// 默认配置
+var defaultVirtualModelSettings = VirtualModelSettings{
+	Enabled: false,
+	Models:  map[string]VirtualModel{},
+}
+
+// 全局实例
+var virtualModelSettings = defaultVirtualModelSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("virtual_model", &virtualModelSettings)
+}
+
+func GetVirtualModelSettings() *VirtualModelSettings {
+	return &virtualModelSettings
+}
+
+// IsVirtualModel 判断模型名是否为已启用的虚拟模型
+func (s *VirtualModelSettings) IsVirtualModel(modelName string) bool {
+	if !s.Enabled {
+		return false
+	}
+	_, ok := s.Models[modelName]
+	return ok
+}
+
+// GetModelNames 返回已启用的虚拟模型名（按名称排序）
+func (s *VirtualModelSettings) GetModelNames() []string {
+	if !s.Enabled {
+		return nil
+	}
+	names := make([]string, 0, len(s.Models))
+	for name := range s.Models {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Resolve 返回虚拟模型解析出的具体模型及命中的规则名，未命中任何规则时规则名为空。
+// allowed 非空时跳过其不允许的目标模型（如令牌模型限制），继续匹配后续规则
+func (s *VirtualModelSettings) Resolve(modelName string, features VirtualModelFeatures, allowed func(target string) bool) (string, string, bool) {
+	virtualModel, ok := s.Models[modelName]
+	if !ok {
+		return "", "", false
+	}
+	for i, rule := range virtualModel.Rules {
+		if rule.Target == "" || !rule.Match(features) || (allowed != nil && !allowed(rule.Target)) {
+			continue
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule_%d", i+1)
+		}
+		return rule.Target, name, true
+	}
+	if virtualModel.Default == "" || (allowed != nil && !allowed(virtualModel.Default)) {
+		return "", "", false
+	}
+	return virtualModel.Default, "", true
+}
+
+func (r *VirtualModelRule) Match(features VirtualModelFeatures) bool {
+	if r.MinPromptTokens > 0 && features.PromptTokens < r.MinPromptTokens {
+		return false
+	}
+	if r.MaxPromptTokens > 0 && features.PromptTokens > r.MaxPromptTokens {
+		return false
+	}
+	if r.HasImage != nil && *r.HasImage != features.HasImage {
+		return false
+	}
+	if r.HasAudio != nil && *r.HasAudio != features.HasAudio {
+		return false
+	}
+	if r.HasTools != nil && *r.HasTools != features.HasTools {
+		return false
+	}
+	if len(r.ReasoningEffort) > 0 {
+		effort := features.ReasoningEffort
+		if effort == "" {
+			effort = "none"
+		}
+		if !slices.Contains(r.ReasoningEffort, effort) {
+			return false
+		}
+	}
+	if len(r.Groups) > 0 && !slices.Contains(r.Groups, features.Group) {
+		return false
+	}
+	if r.Header != "" {
+		values := features.Headers.Values(r.Header)
+		if len(values) == 0 {
+			return false
+		}
+		if len(r.HeaderValues) > 0 && !slices.ContainsFunc(values, func(v string) bool {
+			return slices.Contains(r.HeaderValues, strings.TrimSpace(v))
+		}) {
+			return false
+		}
+	}
+	return true
+}
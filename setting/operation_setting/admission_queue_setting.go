@@ -0,0 +1,68 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	AdmissionFairShareByUser  = "user"  // 按用户公平排队
+	AdmissionFairShareByGroup = "group" // 按分组公平排队
+)
+
+// AdmissionQueueSetting 上游容量不足时的准入排队配置，按模型与分组分别排队
+type AdmissionQueueSetting struct {
+	Enabled bool `json:"enabled"`
+	// MaxWaitSeconds 最长排队时间，客户端可通过 X-Queue-Max-Wait 请求头缩短
+	MaxWaitSeconds int `json:"max_wait_seconds"`
+	// MaxQueueLength 单个队列的最大等待请求数，超出直接拒绝
+	MaxQueueLength int    `json:"max_queue_length"`
+	FairShareBy    string `json:"fair_share_by"`
+	// GroupWeights 分组权重，未配置的分组权重为 1
+	GroupWeights map[string]int `json:"group_weights"`
+	// DefaultConcurrency 每个模型与分组的默认并发上限，0 表示不限制
+	DefaultConcurrency int `json:"default_concurrency"`
+	// ModelConcurrency 按模型覆盖并发上限
+	ModelConcurrency map[string]int `json:"model_concurrency"`
+	// ChannelConcurrency 单个渠道的并发上限，0 表示不限制
+	ChannelConcurrency int `json:"channel_concurrency"`
+	// SaturationCooldownSeconds 所有渠道返回 429 后暂停放行新请求的时间
+	SaturationCooldownSeconds int `json:"saturation_cooldown_seconds"`
+	// KeepAliveStream 流式请求排队期间发送 SSE ping 保活
+	KeepAliveStream bool `json:"keep_alive_stream"`
+}
+
+// 默认配置
+var admissionQueueSetting = AdmissionQueueSetting{
+	Enabled:                   false,
+	MaxWaitSeconds:            30,
+	MaxQueueLength:            100,
+	FairShareBy:               AdmissionFairShareByUser,
+	GroupWeights:              map[string]int{},
+	ModelConcurrency:          map[string]int{},
+	SaturationCooldownSeconds: 5,
+	KeepAliveStream:           true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("admission_queue_setting", &admissionQueueSetting)
+}
+
+// GetAdmissionQueueSetting 获取准入排队配置
+func GetAdmissionQueueSetting() *AdmissionQueueSetting {
+	return &admissionQueueSetting
+}
+
+// GetConcurrency 返回模型的并发上限
+func (s *AdmissionQueueSetting) GetConcurrency(modelName string) int {
+	if limit, ok := s.ModelConcurrency[modelName]; ok {
+		return limit
+	}
+	return s.DefaultConcurrency
+}
+
+// GetGroupWeight 返回分组权重，最小为 1
+func (s *AdmissionQueueSetting) GetGroupWeight(group string) int {
+	if weight := s.GroupWeights[group]; weight > 0 {
+		return weight
+	}
+	return 1
+}
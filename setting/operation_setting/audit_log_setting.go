@@ -0,0 +1,30 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// AuditLogSetting 管理操作审计日志配置
+type AuditLogSetting struct {
+	Enabled bool `json:"enabled"`
+	// RetentionDays 审计日志保留天数，与使用日志分开清理，0 表示永久保留
+	RetentionDays int `json:"retention_days"`
+	// WebhookEnabled 开启后将审计事件转发到 Webhook
+	WebhookEnabled bool   `json:"webhook_enabled"`
+	WebhookUrl     string `json:"webhook_url"`
+	WebhookSecret  string `json:"webhook_secret"`
+}
+
+// 默认配置
+var auditLogSetting = AuditLogSetting{
+	Enabled:       true,
+	RetentionDays: 180,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("audit_log_setting", &auditLogSetting)
+}
+
+// GetAuditLogSetting 获取审计日志配置
+func GetAuditLogSetting() *AuditLogSetting {
+	return &auditLogSetting
+}
@@ -0,0 +1,49 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	CreditBucketOrderExpiringFirst = "expiring_first" // 先到期的先消耗，永不过期的最后
+	CreditBucketOrderPromoFirst    = "promo_first"    // 赠送额度优先，其次按到期时间
+	CreditBucketOrderFIFO          = "fifo"           // 按入账先后消耗
+)
+
+// CreditBucketSetting 额度桶配置，按来源记录额度并支持过期
+type CreditBucketSetting struct {
+	Enabled      bool   `json:"enabled"`
+	ConsumeOrder string `json:"consume_order"`
+	// 各来源额度的有效天数，0 表示永不过期
+	TopUpExpireDays      int `json:"topup_expire_days"`
+	RedemptionExpireDays int `json:"redemption_expire_days"`
+	CheckinExpireDays    int `json:"checkin_expire_days"`
+	AffiliateExpireDays  int `json:"affiliate_expire_days"` // 邀请奖励与邀请额度划转
+	AdminExpireDays      int `json:"admin_expire_days"`
+	// SweepIntervalMinutes 过期扫描间隔
+	SweepIntervalMinutes int `json:"sweep_interval_minutes"`
+}
+
+// 默认配置
+var creditBucketSetting = CreditBucketSetting{
+	Enabled:              false,
+	ConsumeOrder:         CreditBucketOrderExpiringFirst,
+	SweepIntervalMinutes: 10,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("credit_bucket_setting", &creditBucketSetting)
+}
+
+// GetCreditBucketSetting 获取额度桶配置
+func GetCreditBucketSetting() *CreditBucketSetting {
+	return &creditBucketSetting
+}
+
+// IsValidCreditBucketOrder 校验消耗顺序
+func IsValidCreditBucketOrder(order string) bool {
+	switch order {
+	case CreditBucketOrderExpiringFirst, CreditBucketOrderPromoFirst, CreditBucketOrderFIFO:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// DataResidencySetting 数据驻留策略配置，策略按渠道区域标签筛选可用渠道
+type DataResidencySetting struct {
+	// HeaderName 客户端声明请求区域的请求头，只能在用户、令牌与分组策略的基础上进一步收窄
+	HeaderName string `json:"header_name"`
+	// GroupRegions 分组允许的数据驻留区域，如 {"eu-customers": ["eu"]}
+	GroupRegions map[string][]string `json:"group_regions"`
+}
+
+// 默认配置
+var dataResidencySetting = DataResidencySetting{
+	HeaderName:   "X-Data-Residency",
+	GroupRegions: map[string][]string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("data_residency_setting", &dataResidencySetting)
+}
+
+// GetDataResidencySetting 获取数据驻留策略配置
+func GetDataResidencySetting() *DataResidencySetting {
+	return &dataResidencySetting
+}
@@ -0,0 +1,35 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// EndUserSetting 终端用户标识配置，用于在共享令牌下区分下游客户
+type EndUserSetting struct {
+	// Enabled 开启后才识别终端用户标识并执行令牌的终端用户限制
+	Enabled bool `json:"enabled"`
+	// HeaderName 读取终端用户标识的请求头，优先于请求体中的 user / safety_identifier
+	HeaderName string `json:"header_name"`
+	// HashIdentifiers 开启后标识经 HMAC-SHA256 处理后再记录与计数
+	HashIdentifiers bool `json:"hash_identifiers"`
+	// HashSecret 哈希密钥，为空时使用系统加密密钥
+	HashSecret string `json:"hash_secret"`
+	// MaxLength 未哈希时标识的最大长度，超出的标识经哈希后记录
+	MaxLength int `json:"max_length"`
+}
+
+// 默认配置
+var endUserSetting = EndUserSetting{
+	Enabled:         false,
+	HeaderName:      "X-End-User-Id",
+	HashIdentifiers: false,
+	MaxLength:       64,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("end_user_setting", &endUserSetting)
+}
+
+// GetEndUserSetting 获取终端用户标识配置
+func GetEndUserSetting() *EndUserSetting {
+	return &endUserSetting
+}
@@ -0,0 +1,43 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// InvoiceSetting 发票与月度账单配置
+type InvoiceSetting struct {
+	Enabled bool `json:"enabled"` // 支付成功后自动开具发票
+	// NumberPrefix 发票号前缀，发票号为前缀加全局递增序号
+	NumberPrefix   string `json:"number_prefix"`
+	CompanyName    string `json:"company_name"`
+	CompanyAddress string `json:"company_address"`
+	CompanyTaxId   string `json:"company_tax_id"`
+	CompanyEmail   string `json:"company_email"`
+	TaxName        string `json:"tax_name"`
+	// TaxRate 税率，例如 0.06 表示 6%，支付金额视为含税价
+	TaxRate  float64 `json:"tax_rate"`
+	Currency string  `json:"currency"`
+	Footer   string  `json:"footer"`
+	// StatementEmailEnabled 每月初向有用量的用户发送上月账单邮件
+	StatementEmailEnabled bool `json:"statement_email_enabled"`
+	// LastStatementMonth 最近一次已发送账单的月份（YYYY-MM），由系统维护
+	LastStatementMonth string `json:"last_statement_month"`
+}
+
+// 默认配置
+var invoiceSetting = InvoiceSetting{
+	Enabled:               false,
+	NumberPrefix:          "INV-",
+	TaxName:               "VAT",
+	TaxRate:               0,
+	Currency:              "USD",
+	StatementEmailEnabled: false,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("invoice_setting", &invoiceSetting)
+}
+
+// GetInvoiceSetting 获取发票配置
+func GetInvoiceSetting() *InvoiceSetting {
+	return &invoiceSetting
+}
@@ -0,0 +1,33 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	PaymentReversalPolicyAllowNegative = "allow_negative" // 扣回额度，余额允许为负
+	PaymentReversalPolicySuspend       = "suspend"        // 扣回额度，余额为负时禁用用户
+)
+
+// PaymentReversalSetting 退款、争议与拒付的处理配置
+type PaymentReversalSetting struct {
+	Enabled bool   `json:"enabled"`
+	Policy  string `json:"policy"`
+	// NotifyAdmin 处理后通知 root 用户
+	NotifyAdmin bool `json:"notify_admin"`
+}
+
+// 默认配置
+var paymentReversalSetting = PaymentReversalSetting{
+	Enabled:     true,
+	Policy:      PaymentReversalPolicyAllowNegative,
+	NotifyAdmin: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("payment_reversal_setting", &paymentReversalSetting)
+}
+
+// GetPaymentReversalSetting 获取支付撤销处理配置
+func GetPaymentReversalSetting() *PaymentReversalSetting {
+	return &paymentReversalSetting
+}
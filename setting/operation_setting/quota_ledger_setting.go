@@ -0,0 +1,30 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// QuotaLedgerSetting 额度流水账本配置
+type QuotaLedgerSetting struct {
+	// Enabled 是否记录额度流水，开启后用户余额变动与流水在同一事务内同步写入，不再合并批量更新
+	Enabled bool `json:"enabled"`
+	// ReconcileIntervalMinutes 对账任务间隔，0 表示不自动对账
+	ReconcileIntervalMinutes int `json:"reconcile_interval_minutes"`
+	// DriftThreshold 余额与账本差额超过该值时标记为异常
+	DriftThreshold int `json:"drift_threshold"`
+}
+
+// 默认配置
+var quotaLedgerSetting = QuotaLedgerSetting{
+	Enabled:                  false,
+	ReconcileIntervalMinutes: 60,
+	DriftThreshold:           0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("quota_ledger_setting", &quotaLedgerSetting)
+}
+
+// GetQuotaLedgerSetting 获取额度流水配置
+func GetQuotaLedgerSetting() *QuotaLedgerSetting {
+	return &quotaLedgerSetting
+}
@@ -0,0 +1,63 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	SpendAnomalyActionNotify  = "notify"  // 仅通知用户
+	SpendAnomalyActionConfirm = "confirm" // 暂停令牌，用户确认后恢复
+	SpendAnomalyActionDisable = "disable" // 直接禁用令牌
+)
+
+// SpendAnomalySetting 异常消费检测配置，检测基于消费日志，关闭 LogConsumeEnabled 时不会执行
+type SpendAnomalySetting struct {
+	Enabled         bool `json:"enabled"`
+	IntervalMinutes int  `json:"interval_minutes"`
+	// WindowMinutes 检测窗口，BaselineHours 之前的消费作为基线
+	WindowMinutes int `json:"window_minutes"`
+	BaselineHours int `json:"baseline_hours"`
+	// SpendMultiplier 窗口消费超过基线平均值的倍数时视为异常
+	SpendMultiplier float64 `json:"spend_multiplier"`
+	// MinWindowQuota 窗口消费低于该值时不检测速度异常
+	MinWindowQuota    int  `json:"min_window_quota"`
+	DetectNewIp       bool `json:"detect_new_ip"` // 依赖用户开启 IP 记录
+	DetectModelSwitch bool `json:"detect_model_switch"`
+	// VelocityAction 消费速度异常的处理方式，SignalAction 新 IP 与模型切换的处理方式
+	VelocityAction string `json:"velocity_action"`
+	SignalAction   string `json:"signal_action"`
+	// CooldownMinutes 同一令牌同类异常的最小告警间隔
+	CooldownMinutes int `json:"cooldown_minutes"`
+}
+
+// 默认配置
+var spendAnomalySetting = SpendAnomalySetting{
+	Enabled:           false,
+	IntervalMinutes:   5,
+	WindowMinutes:     10,
+	BaselineHours:     24,
+	SpendMultiplier:   5,
+	MinWindowQuota:    500000,
+	DetectNewIp:       true,
+	DetectModelSwitch: true,
+	VelocityAction:    SpendAnomalyActionConfirm,
+	SignalAction:      SpendAnomalyActionNotify,
+	CooldownMinutes:   60,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("spend_anomaly_setting", &spendAnomalySetting)
+}
+
+// GetSpendAnomalySetting 获取异常消费检测配置
+func GetSpendAnomalySetting() *SpendAnomalySetting {
+	return &spendAnomalySetting
+}
+
+// IsValidSpendAnomalyAction 校验处理方式
+func IsValidSpendAnomalyAction(action string) bool {
+	switch action {
+	case SpendAnomalyActionNotify, SpendAnomalyActionConfirm, SpendAnomalyActionDisable:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+package ratio_setting
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// GroupPricingRuleRatioKey 规则倍率在 PriceData.OtherRatios 中的键名
+const GroupPricingRuleRatioKey = "group_pricing_rule"
+
+const (
+	GroupPricingCombineBest     = "best"     // 命中多条规则时取最低倍率
+	GroupPricingCombineMultiply = "multiply" // 命中多条规则时倍率相乘
+)
+
+// GroupPricingRule 叠加在分组倍率之上的定价规则，所有条件同时满足时命中
+type GroupPricingRule struct {
+	Name string `json:"name"`
+	// Groups 为空匹配所有分组
+	Groups []string `json:"groups,omitempty"`
+	// Models 为空匹配所有模型，以 * 结尾表示前缀匹配
+	Models []string `json:"models,omitempty"`
+	// MinMonthlyQuota/MaxMonthlyQuota 用户当月累计消费额度区间 [min, max)，max 为 0 表示不限
+	MinMonthlyQuota int `json:"min_monthly_quota,omitempty"`
+	MaxMonthlyQuota int `json:"max_monthly_quota,omitempty"`
+	// Weekdays 0 表示周日，为空匹配每一天
+	Weekdays []int `json:"weekdays,omitempty"`
+	// StartTime/EndTime 格式 HH:MM，EndTime 小于 StartTime 时表示跨越午夜
+	StartTime string `json:"start_time,omitempty"`
+	EndTime   string `json:"end_time,omitempty"`
+	// Timezone 为空时使用全局时区
+	Timezone string  `json:"timezone,omitempty"`
+	Ratio    float64 `json:"ratio"`
+}
+
+type GroupPricingRuleSettings struct {
+	Enabled bool `json:"enabled"`
+	// Timezone IANA 时区名，同时决定月度用量的统计周期，为空时使用服务器时区
+	Timezone    string             `json:"timezone"`
+	CombineMode string             `json:"combine_mode"`
+	Rules       []GroupPricingRule `json:"rules"`
+}
+
+// GroupPricingInput 规则匹配所需的请求信息，MonthlyQuota 仅在存在用量条件的规则时才会调用
+type GroupPricingInput struct {
+	Group        string
+	Model        string
+	Now          time.Time
+	MonthlyQuota func(monthStart time.Time) int
+}
+
+// 默认配置
+var defaultGroupPricingRuleSettings = GroupPricingRuleSettings{
+	Enabled:     false,
+	Timezone:    "",
+	CombineMode: GroupPricingCombineBest,
+	Rules:       []GroupPricingRule{},
+}
+
+// 全局实例
+var groupPricingRuleSettings = defaultGroupPricingRuleSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("group_pricing_rule", &groupPricingRuleSettings)
+}
+
+func GetGroupPricingRuleSettings() *GroupPricingRuleSettings {
+	return &groupPricingRuleSettings
+}
+
+// groupPricingLocations 全局与各规则时区解析结果，配置更新时重建，避免计费路径反复读取时区数据库
+var groupPricingLocations atomic.Pointer[map[string]*time.Location]
+
+// RefreshGroupPricingRuleLocations 在 timezone 或 rules 更新后重新解析并缓存时区
+func RefreshGroupPricingRuleLocations() {
+	settings := GetGroupPricingRuleSettings()
+	locations := make(map[string]*time.Location)
+	load := func(timezone string) {
+		if timezone == "" {
+			return
+		}
+		if _, ok := locations[timezone]; ok {
+			return
+		}
+		locations[timezone] = loadGroupPricingLocation(timezone)
+	}
+	load(settings.Timezone)
+	for _, rule := range settings.Rules {
+		load(rule.Timezone)
+	}
+	groupPricingLocations.Store(&locations)
+}
+
+// loadGroupPricingLocation 加载时区，无效时记录日志并回退到服务器时区
+func loadGroupPricingLocation(timezone string) *time.Location {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		common.SysError(fmt.Sprintf("invalid group pricing rule timezone %q, fall back to server timezone: %v", timezone, err))
+		return time.Local
+	}
+	return loc
+}
+
+func (s *GroupPricingRuleSettings) location(timezone string) *time.Location {
+	if timezone == "" {
+		timezone = s.Timezone
+	}
+	if timezone == "" {
+		return time.Local
+	}
+	if locations := groupPricingLocations.Load(); locations != nil {
+		if loc, ok := (*locations)[timezone]; ok {
+			return loc
+		}
+	}
+	// 未缓存的时区（如模拟接口传入的临时配置）直接加载
+	return loadGroupPricingLocation(timezone)
+}
+
+// MonthStart 返回 now 所在自然月的起始时间（按全局时区）
+func (s *GroupPricingRuleSettings) MonthStart(now time.Time) time.Time {
+	local := now.In(s.location(""))
+	return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, local.Location())
+}
+
+// Validate 校验规则配置，供管理端保存前检查
+func (s *GroupPricingRuleSettings) Validate() error {
+	if s.CombineMode != "" && s.CombineMode != GroupPricingCombineBest && s.CombineMode != GroupPricingCombineMultiply {
+		return fmt.Errorf("invalid combine_mode %q", s.CombineMode)
+	}
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q", s.Timezone)
+		}
+	}
+	for i, rule := range s.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule_%d", i+1)
+		}
+		if rule.Ratio <= 0 {
+			return fmt.Errorf("%s: ratio must be greater than 0", name)
+		}
+		if rule.MaxMonthlyQuota > 0 && rule.MaxMonthlyQuota <= rule.MinMonthlyQuota {
+			return fmt.Errorf("%s: max_monthly_quota must be greater than min_monthly_quota", name)
+		}
+		for _, weekday := range rule.Weekdays {
+			if weekday < 0 || weekday > 6 {
+				return fmt.Errorf("%s: weekday must be between 0 and 6", name)
+			}
+		}
+		if (rule.StartTime == "") != (rule.EndTime == "") {
+			return fmt.Errorf("%s: start_time and end_time must be set together", name)
+		}
+		if rule.StartTime != "" {
+			if _, ok := parseClock(rule.StartTime); !ok {
+				return fmt.Errorf("%s: invalid start_time %q", name, rule.StartTime)
+			}
+			if _, ok := parseClock(rule.EndTime); !ok {
+				return fmt.Errorf("%s: invalid end_time %q", name, rule.EndTime)
+			}
+		}
+		if rule.Timezone != "" {
+			if _, err := time.LoadLocation(rule.Timezone); err != nil {
+				return fmt.Errorf("%s: invalid timezone %q", name, rule.Timezone)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateGroupPricingRuleOption 校验单个配置项更新后的完整规则配置
+func ValidateGroupPricingRuleOption(key string, value string) error {
+	settings := *GetGroupPricingRuleSettings()
+	switch key {
+	case "rules":
+		settings.Rules = nil
+		if err := common.UnmarshalJsonStr(value, &settings.Rules); err != nil {
+			return err
+		}
+	case "timezone":
+		settings.Timezone = value
+	case "combine_mode":
+		settings.CombineMode = value
+	}
+	return settings.Validate()
+}
+
+// Evaluate 返回命中规则的合并倍率与规则名，未命中时倍率为 1
+func (s *GroupPricingRuleSettings) Evaluate(input GroupPricingInput) (float64, []string) {
+	if !s.Enabled || len(s.Rules) == 0 {
+		return 1, nil
+	}
+	monthlyQuota := -1
+	getMonthlyQuota := func() int {
+		if monthlyQuota < 0 {
+			monthlyQuota = 0
+			if input.MonthlyQuota != nil {
+				monthlyQuota = input.MonthlyQuota(s.MonthStart(input.Now))
+			}
+		}
+		return monthlyQuota
+	}
+
+	ratio := 1.0
+	var matched []string
+	for i, rule := range s.Rules {
+		if rule.Ratio <= 0 || !s.ruleMatches(rule, input, getMonthlyQuota) {
+			continue
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule_%d", i+1)
+		}
+		if s.CombineMode == GroupPricingCombineMultiply {
+			ratio *= rule.Ratio
+			matched = append(matched, name)
+			continue
+		}
+		if len(matched) == 0 || rule.Ratio < ratio {
+			ratio = rule.Ratio
+			matched = []string{name}
+		}
+	}
+	return ratio, matched
+}
+
+func (s *GroupPricingRuleSettings) ruleMatches(rule GroupPricingRule, input GroupPricingInput, monthlyQuota func() int) bool {
+	if len(rule.Groups) > 0 && !slices.Contains(rule.Groups, input.Group) {
+		return false
+	}
+	if len(rule.Models) > 0 && !matchPricingRuleModel(rule.Models, input.Model) {
+		return false
+	}
+	if len(rule.Weekdays) > 0 || rule.StartTime != "" {
+		now := input.Now.In(s.location(rule.Timezone))
+		if len(rule.Weekdays) > 0 && !slices.Contains(rule.Weekdays, int(now.Weekday())) {
+			return false
+		}
+		if rule.StartTime != "" && !inClockWindow(now, rule.StartTime, rule.EndTime) {
+			return false
+		}
+	}
+	// 用量条件放在最后判断，避免无谓的查询
+	if rule.MinMonthlyQuota > 0 || rule.MaxMonthlyQuota > 0 {
+		quota := monthlyQuota()
+		if quota < rule.MinMonthlyQuota {
+			return false
+		}
+		if rule.MaxMonthlyQuota > 0 && quota >= rule.MaxMonthlyQuota {
+			return false
+		}
+	}
+	return true
+}
+
+func matchPricingRuleModel(models []string, model string) bool {
+	for _, pattern := range models {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(model, prefix) {
+				return true
+			}
+		} else if pattern == model {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock 解析 HH:MM，返回当天的分钟数
+func parseClock(value string) (int, bool) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+func inClockWindow(now time.Time, start, end string) bool {
+	startMinute, ok := parseClock(start)
+	if !ok {
+		return false
+	}
+	endMinute, ok := parseClock(end)
+	if !ok {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	if startMinute <= endMinute {
+		return minute >= startMinute && minute < endMinute
+	}
+	return minute >= startMinute || minute < endMinute
+}
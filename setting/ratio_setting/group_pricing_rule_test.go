@@ -0,0 +1,87 @@
+package ratio_setting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupPricingRuleEvaluate(t *testing.T) {
+	settings := &GroupPricingRuleSettings{
+		Enabled:  true,
+		Timezone: "Asia/Shanghai",
+		Rules: []GroupPricingRule{
+			{Name: "volume_1", Groups: []string{"team"}, MinMonthlyQuota: 1000, MaxMonthlyQuota: 5000, Ratio: 0.9},
+			{Name: "volume_2", Groups: []string{"team"}, MinMonthlyQuota: 5000, Ratio: 0.8},
+			{Name: "off_peak", StartTime: "22:00", EndTime: "06:00", Ratio: 0.5, Models: []string{"gpt-4o*"}},
+			{Name: "weekend", Weekdays: []int{0, 6}, Timezone: "UTC", Ratio: 0.7},
+		},
+	}
+	// 2026-10-14 是周三，UTC 15:00 即上海 23:00
+	night := time.Date(2026, 10, 14, 15, 0, 0, 0, time.UTC)
+	day := time.Date(2026, 10, 14, 4, 0, 0, 0, time.UTC)
+
+	queried := 0
+	monthlyQuota := func(quota int) func(time.Time) int {
+		return func(monthStart time.Time) int {
+			queried++
+			require.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, monthStart.Location()), monthStart)
+			return quota
+		}
+	}
+
+	ratio, rules := settings.Evaluate(GroupPricingInput{Group: "team", Model: "gpt-4o-mini", Now: night, MonthlyQuota: monthlyQuota(6000)})
+	require.Equal(t, 0.5, ratio)
+	require.Equal(t, []string{"off_peak"}, rules)
+	require.Equal(t, 1, queried)
+
+	ratio, rules = settings.Evaluate(GroupPricingInput{Group: "team", Model: "claude-sonnet-4", Now: day, MonthlyQuota: monthlyQuota(2000)})
+	require.Equal(t, 0.9, ratio)
+	require.Equal(t, []string{"volume_1"}, rules)
+
+	// 没有用量条件命中时不查询月度消费
+	queried = 0
+	ratio, rules = settings.Evaluate(GroupPricingInput{Group: "default", Model: "claude-sonnet-4", Now: day, MonthlyQuota: monthlyQuota(0)})
+	require.Equal(t, 1.0, ratio)
+	require.Empty(t, rules)
+	require.Equal(t, 0, queried)
+
+	settings.CombineMode = GroupPricingCombineMultiply
+	ratio, rules = settings.Evaluate(GroupPricingInput{Group: "team", Model: "gpt-4o", Now: night, MonthlyQuota: monthlyQuota(6000)})
+	require.InDelta(t, 0.4, ratio, 1e-9)
+	require.Equal(t, []string{"volume_2", "off_peak"}, rules)
+
+	saturday := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	ratio, rules = settings.Evaluate(GroupPricingInput{Group: "default", Model: "x", Now: saturday})
+	require.Equal(t, 0.7, ratio)
+	require.Equal(t, []string{"weekend"}, rules)
+}
+
+func TestGroupPricingRuleValidate(t *testing.T) {
+	require.NoError(t, (&GroupPricingRuleSettings{Rules: []GroupPricingRule{{Ratio: 0.5, StartTime: "22:00", EndTime: "06:00"}}}).Validate())
+	require.Error(t, (&GroupPricingRuleSettings{Rules: []GroupPricingRule{{Ratio: 0}}}).Validate())
+	require.Error(t, (&GroupPricingRuleSettings{Rules: []GroupPricingRule{{Ratio: 1, StartTime: "25:00", EndTime: "06:00"}}}).Validate())
+	require.Error(t, (&GroupPricingRuleSettings{Rules: []GroupPricingRule{{Ratio: 1, MinMonthlyQuota: 10, MaxMonthlyQuota: 5}}}).Validate())
+	require.Error(t, (&GroupPricingRuleSettings{Timezone: "Mars/Base"}).Validate())
+	require.Error(t, ValidateGroupPricingRuleOption("combine_mode", "sum"))
+}
+
+func TestRefreshGroupPricingRuleLocations(t *testing.T) {
+	settings := GetGroupPricingRuleSettings()
+	original := *settings
+	t.Cleanup(func() {
+		*settings = original
+		RefreshGroupPricingRuleLocations()
+	})
+	settings.Timezone = "Asia/Shanghai"
+	settings.Rules = []GroupPricingRule{{Name: "weekend", Timezone: "Invalid/Zone", Ratio: 0.7}}
+	RefreshGroupPricingRuleLocations()
+
+	locations := *groupPricingLocations.Load()
+	require.Len(t, locations, 2)
+	require.Equal(t, "Asia/Shanghai", locations["Asia/Shanghai"].String())
+	// 无效时区回退到服务器时区
+	require.Same(t, time.Local, locations["Invalid/Zone"])
+	require.Same(t, locations["Asia/Shanghai"], settings.location(""))
+}
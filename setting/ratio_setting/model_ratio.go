@@ -660,6 +660,12 @@ func ImageRatio2JSONString() string {
 	return imageRatioMap.MarshalJSONString()
 }
 
+// ValidateRatioJSONString 校验模型到倍率的映射但不生效
+func ValidateRatioJSONString(jsonStr string) error {
+	var ratios map[string]float64
+	return common.UnmarshalJsonStr(jsonStr, &ratios)
+}
+
 func UpdateImageRatioByJSONString(jsonStr string) error {
 	return types.LoadFromJsonString(imageRatioMap, jsonStr)
 }
@@ -0,0 +1,76 @@
+package ratio_setting
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// modelPricingTiersMap 模型按提示 tokens 的上下文长度分档，例如 gemini-2.5-pro 超过 200k 后单价翻倍
+var modelPricingTiersMap = types.NewRWMap[string, []types.PricingTier]()
+
+// ModelPricingTiers2JSONString converts the model pricing tiers map to a JSON string
+func ModelPricingTiers2JSONString() string {
+	return modelPricingTiersMap.MarshalJSONString()
+}
+
+// UpdateModelPricingTiersByJSONString 校验并加载分档配置，每个模型的分档按阈值升序保存
+func UpdateModelPricingTiersByJSONString(jsonStr string) error {
+	sorted, err := normalizeModelPricingTiers(jsonStr)
+	if err != nil {
+		return err
+	}
+	return types.LoadFromJsonStringWithCallback(modelPricingTiersMap, sorted, InvalidateExposedDataCache)
+}
+
+// ValidateModelPricingTiers 校验分档配置但不生效
+func ValidateModelPricingTiers(jsonStr string) error {
+	_, err := normalizeModelPricingTiers(jsonStr)
+	return err
+}
+
+// normalizeModelPricingTiers 校验分档配置并按阈值排序
+func normalizeModelPricingTiers(jsonStr string) (string, error) {
+	tiersMap := make(map[string][]types.PricingTier)
+	if err := common.UnmarshalJsonStr(jsonStr, &tiersMap); err != nil {
+		return "", err
+	}
+	for model, tiers := range tiersMap {
+		sort.SliceStable(tiers, func(i, j int) bool {
+			return tiers[i].Threshold < tiers[j].Threshold
+		})
+		for i, tier := range tiers {
+			if tier.Threshold <= 0 {
+				return "", fmt.Errorf("model %s: tier threshold must be greater than 0", model)
+			}
+			if i > 0 && tiers[i-1].Threshold == tier.Threshold {
+				return "", fmt.Errorf("model %s: duplicate tier threshold %d", model, tier.Threshold)
+			}
+			if tier.ModelRatio < 0 || tier.CompletionRatio < 0 ||
+				(tier.CacheRatio != nil && *tier.CacheRatio < 0) ||
+				(tier.CreateCacheRatio != nil && *tier.CreateCacheRatio < 0) {
+				return "", fmt.Errorf("model %s: tier ratios must not be negative", model)
+			}
+		}
+	}
+	sorted, err := common.Marshal(tiersMap)
+	if err != nil {
+		return "", err
+	}
+	return string(sorted), nil
+}
+
+// GetModelPricingTiers 返回模型的分档配置，先按原始名称匹配，再按归一化后的名称匹配
+func GetModelPricingTiers(name string) ([]types.PricingTier, bool) {
+	if tiers, ok := modelPricingTiersMap.Get(name); ok && len(tiers) > 0 {
+		return tiers, true
+	}
+	tiers, ok := modelPricingTiersMap.Get(FormatMatchingModelName(name))
+	return tiers, ok && len(tiers) > 0
+}
+
+func GetModelPricingTiersCopy() map[string][]types.PricingTier {
+	return modelPricingTiersMap.ReadAll()
+}
@@ -0,0 +1,27 @@
+package ratio_setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateModelPricingTiersByJSONString(t *testing.T) {
+	t.Cleanup(func() {
+		require.NoError(t, UpdateModelPricingTiersByJSONString("{}"))
+	})
+
+	require.NoError(t, UpdateModelPricingTiersByJSONString(`{"gemini-2.5-pro":[{"threshold":500000,"model_ratio":3},{"threshold":200000,"model_ratio":1.25,"completion_ratio":6}]}`))
+	tiers, ok := GetModelPricingTiers("gemini-2.5-pro")
+	require.True(t, ok)
+	require.Len(t, tiers, 2)
+	require.Equal(t, 200000, tiers[0].Threshold)
+	require.Equal(t, 500000, tiers[1].Threshold)
+
+	_, ok = GetModelPricingTiers("gemini-2.5-flash")
+	require.False(t, ok)
+
+	require.Error(t, UpdateModelPricingTiersByJSONString(`{"m":[{"threshold":0,"model_ratio":1}]}`))
+	require.Error(t, UpdateModelPricingTiersByJSONString(`{"m":[{"threshold":10,"model_ratio":1},{"threshold":10,"model_ratio":2}]}`))
+	require.Error(t, UpdateModelPricingTiersByJSONString(`{"m":[{"threshold":10,"model_ratio":-1}]}`))
+}
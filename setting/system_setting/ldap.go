@@ -0,0 +1,56 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// LDAPGroupMapping 满足条件的用户登录时被分配到指定网关分组
+type LDAPGroupMapping struct {
+	Group string `json:"group"`
+	// AccessPolicy 与自定义 OAuth 提供方的访问策略格式相同，字段取自 LDAP 条目属性（如 memberOf、dn）
+	AccessPolicy string `json:"access_policy"`
+}
+
+type LDAPSettings struct {
+	Enabled bool `json:"enabled"`
+	// ServerURL 形如 ldap://host:389 或 ldaps://host:636
+	ServerURL          string `json:"server_url"`
+	StartTLS           bool   `json:"start_tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	// BindDN/BindPassword 用于搜索用户的服务账号，为空时匿名搜索
+	BindDN       string `json:"bind_dn"`
+	BindPassword string `json:"bind_password"`
+	SearchBase   string `json:"search_base"`
+	// SearchFilter 中的 {username} 会被替换为转义后的登录名
+	SearchFilter         string `json:"search_filter"`
+	UsernameAttribute    string `json:"username_attribute"`
+	DisplayNameAttribute string `json:"display_name_attribute"`
+	EmailAttribute       string `json:"email_attribute"`
+	// AccessPolicy 不满足时拒绝登录，为空表示不限制
+	AccessPolicy        string `json:"access_policy"`
+	AccessDeniedMessage string `json:"access_denied_message"`
+	// GroupMappings 按顺序匹配，第一个满足条件的映射决定用户分组
+	GroupMappings []LDAPGroupMapping `json:"group_mappings"`
+	// AutoProvision 首次登录时自动创建账号，不受注册开关限制
+	AutoProvision bool `json:"auto_provision"`
+	// Timeout 连接与操作超时（秒）
+	Timeout int `json:"timeout"`
+}
+
+// 默认配置
+var defaultLDAPSettings = LDAPSettings{
+	SearchFilter:         "(uid={username})",
+	UsernameAttribute:    "uid",
+	DisplayNameAttribute: "cn",
+	EmailAttribute:       "mail",
+	GroupMappings:        []LDAPGroupMapping{},
+	AutoProvision:        true,
+	Timeout:              10,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("ldap", &defaultLDAPSettings)
+}
+
+func GetLDAPSettings() *LDAPSettings {
+	return &defaultLDAPSettings
+}
@@ -10,6 +10,10 @@ type OIDCSettings struct {
 	AuthorizationEndpoint string `json:"authorization_endpoint"`
 	TokenEndpoint         string `json:"token_endpoint"`
 	UserInfoEndpoint      string `json:"user_info_endpoint"`
+	// ClaimMappings 按 userinfo 声明映射分组、角色与可用分组的规则（JSON），格式同自定义 OAuth 提供方
+	ClaimMappings string `json:"claim_mappings"`
+	// TrustedForScimLink 信任该提供方的邮箱声明，允许按已验证邮箱关联 SCIM 预先开通的账号
+	TrustedForScimLink bool `json:"trusted_for_scim_link"`
 }
 
 // 默认配置
@@ -0,0 +1,33 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// SCIMGroupMapping SCIM 组映射到的网关分组与角色
+type SCIMGroupMapping struct {
+	// Group 网关分组，为空表示不修改用户分组
+	Group string `json:"group"`
+	// Roles 自定义角色名称，内置的 admin 角色会将用户设为管理员
+	Roles []string `json:"roles"`
+}
+
+type SCIMSettings struct {
+	Enabled bool `json:"enabled"`
+	// BearerSecret 身份提供方调用 SCIM 接口时使用的 Bearer 密钥
+	BearerSecret string `json:"bearer_secret"`
+	// GroupMappings SCIM 组显示名称到网关分组与角色的映射，用户属于多个组时按组名排序取第一个分组
+	GroupMappings map[string]SCIMGroupMapping `json:"group_mappings"`
+}
+
+// 默认配置
+var defaultSCIMSettings = SCIMSettings{
+	GroupMappings: map[string]SCIMGroupMapping{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("scim", &defaultSCIMSettings)
+}
+
+func GetSCIMSettings() *SCIMSettings {
+	return &defaultSCIMSettings
+}
@@ -25,6 +25,98 @@ type PriceData struct {
 	Quota                int // 按次计费的最终额度（MJ / Task）
 	QuotaToPreConsume    int // 按量计费的预消耗额度
 	GroupRatioInfo       GroupRatioInfo
+	// PricingTiers 模型的上下文长度分档，结算时按实际提示 tokens 重新选档
+	PricingTiers []PricingTier
+	// PricingTier 当前生效的分档，nil 表示使用基础倍率
+	PricingTier *PricingTier
+	baseRatios  pricingTierBase
+	// GroupPricingRules 命中的分组定价规则，倍率记录在 OtherRatios 中
+	GroupPricingRules []string
+}
+
+// PricingTier 按提示 tokens 分档的倍率，提示 tokens 超过 Threshold 时适用。
+// CompletionRatio 为 0、缓存倍率为空时沿用模型的基础倍率。
+type PricingTier struct {
+	Threshold        int      `json:"threshold"`
+	ModelRatio       float64  `json:"model_ratio"`
+	CompletionRatio  float64  `json:"completion_ratio,omitempty"`
+	CacheRatio       *float64 `json:"cache_ratio,omitempty"`
+	CreateCacheRatio *float64 `json:"create_cache_ratio,omitempty"`
+}
+
+type pricingTierBase struct {
+	modelRatio           float64
+	completionRatio      float64
+	cacheRatio           float64
+	cacheCreationRatio   float64
+	cacheCreation5mRatio float64
+	cacheCreation1hRatio float64
+}
+
+// SelectPricingTier 从按 Threshold 升序排列的分档中选出适用的一档，未超过任何阈值时返回 nil
+func SelectPricingTier(tiers []PricingTier, promptTokens int) *PricingTier {
+	var selected *PricingTier
+	for i := range tiers {
+		if promptTokens > tiers[i].Threshold {
+			selected = &tiers[i]
+		}
+	}
+	return selected
+}
+
+// SetPricingTiers 记录当前倍率作为基础倍率，并按提示 tokens 应用分档
+func (p *PriceData) SetPricingTiers(tiers []PricingTier, promptTokens int) {
+	p.PricingTiers = tiers
+	p.PricingTier = nil
+	p.baseRatios = pricingTierBase{
+		modelRatio:           p.ModelRatio,
+		completionRatio:      p.CompletionRatio,
+		cacheRatio:           p.CacheRatio,
+		cacheCreationRatio:   p.CacheCreationRatio,
+		cacheCreation5mRatio: p.CacheCreation5mRatio,
+		cacheCreation1hRatio: p.CacheCreation1hRatio,
+	}
+	p.ApplyPricingTier(promptTokens)
+}
+
+// ApplyPricingTier 按提示 tokens 重新选档并更新倍率，返回生效的分档是否发生变化
+func (p *PriceData) ApplyPricingTier(promptTokens int) bool {
+	if len(p.PricingTiers) == 0 {
+		return false
+	}
+	tier := SelectPricingTier(p.PricingTiers, promptTokens)
+	if tier == p.PricingTier {
+		return false
+	}
+	base := p.baseRatios
+	p.PricingTier = tier
+	p.ModelRatio = base.modelRatio
+	p.CompletionRatio = base.completionRatio
+	p.CacheRatio = base.cacheRatio
+	p.CacheCreationRatio = base.cacheCreationRatio
+	p.CacheCreation5mRatio = base.cacheCreation5mRatio
+	p.CacheCreation1hRatio = base.cacheCreation1hRatio
+	if tier == nil {
+		return true
+	}
+	p.ModelRatio = tier.ModelRatio
+	if tier.CompletionRatio > 0 {
+		p.CompletionRatio = tier.CompletionRatio
+	}
+	if tier.CacheRatio != nil {
+		p.CacheRatio = *tier.CacheRatio
+	}
+	if tier.CreateCacheRatio != nil {
+		p.CacheCreationRatio = *tier.CreateCacheRatio
+		p.CacheCreation5mRatio = *tier.CreateCacheRatio
+		// 保持 1h 与 5m 缓存写入价格的比例
+		if base.cacheCreationRatio > 0 {
+			p.CacheCreation1hRatio = *tier.CreateCacheRatio * base.cacheCreation1hRatio / base.cacheCreationRatio
+		} else {
+			p.CacheCreation1hRatio = *tier.CreateCacheRatio
+		}
+	}
+	return true
 }
 
 func (p *PriceData) AddOtherRatio(key string, ratio float64) {
@@ -13,6 +13,7 @@ const (
 	RelayFormatOpenAIRealtime                        = "openai_realtime"
 	RelayFormatRerank                                = "rerank"
 	RelayFormatEmbedding                             = "embedding"
+	RelayFormatOpenAIEmulatedTools                   = "openai_emulated_tools"
 
 	RelayFormatTask    = "task"
 	RelayFormatMjProxy = "mj_proxy"